@@ -10,15 +10,20 @@ import (
 
 // AutoHealer implements automatic healing for Marathon applications
 type AutoHealer struct {
-	client              MarathonClient
-	applications        map[string]*HealingConfig
-	mu                  sync.RWMutex
-	checkInterval       time.Duration
-	unhealthyTasks      map[string]*UnhealthyTask
-	healingInProgress   map[string]bool
-	healingHistory      []HealingEvent
+	client            MarathonClient
+	applications      map[string]*HealingConfig
+	mu                sync.RWMutex
+	checkInterval     time.Duration
+	pollInterval      time.Duration
+	unhealthyTasks    map[string]*UnhealthyTask
+	healingInProgress map[string]bool
+	healingHistory    []HealingEvent
+	circuits          map[string]*CircuitState
 }
 
+// maxHealingHistory bounds the number of healing events kept
+const maxHealingHistory = 100
+
 // HealingConfig defines auto-healing parameters
 type HealingConfig struct {
 	AppID                  string
@@ -29,6 +34,29 @@ type HealingConfig struct {
 	BackoffPolicy          BackoffPolicy
 	MaxRestartAttempts     int
 	ReplacementStrategy    ReplacementStrategy
+	CircuitBreaker         CircuitBreakerConfig
+}
+
+// CircuitBreakerConfig stops healing an app when too many of its tasks fail
+// in a short time. Replacing the tasks of an app that crash loops only
+// multiplies the failures, so healing pauses until ResetTimeout has passed.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the percentage of the app's instances that may
+	// fail within Window before the circuit opens. Zero disables the breaker.
+	FailureThreshold float64
+	Window           time.Duration
+	ResetTimeout     time.Duration
+}
+
+// CircuitState is the circuit breaker state of an app
+type CircuitState struct {
+	AppID    string
+	Open     bool
+	OpenedAt time.Time
+	Reason   string
+	// Failures holds the times tasks of the app were found unhealthy
+	// within the breaker's window
+	Failures []time.Time
 }
 
 // RestartPolicy defines how to handle unhealthy tasks
@@ -44,9 +72,9 @@ const (
 type ReplacementStrategy string
 
 const (
-	RollingReplacement  ReplacementStrategy = "rolling"
+	RollingReplacement   ReplacementStrategy = "rolling"
 	ImmediateReplacement ReplacementStrategy = "immediate"
-	BatchReplacement    ReplacementStrategy = "batch"
+	BatchReplacement     ReplacementStrategy = "batch"
 )
 
 // BackoffPolicy defines restart backoff behavior
@@ -69,15 +97,21 @@ type UnhealthyTask struct {
 	Reason           string
 }
 
+// Healing event actions besides task restarts
+const (
+	ActionCircuitOpened = "circuit-opened"
+	ActionCircuitClosed = "circuit-closed"
+)
+
 // HealingEvent records a healing action
 type HealingEvent struct {
-	Timestamp   time.Time
-	AppID       string
-	TaskID      string
-	Action      string
-	Reason      string
-	Success     bool
-	ErrorMsg    string
+	Timestamp time.Time
+	AppID     string
+	TaskID    string
+	Action    string
+	Reason    string
+	Success   bool
+	ErrorMsg  string
 }
 
 // NewAutoHealer creates a new auto-healer instance
@@ -86,9 +120,11 @@ func NewAutoHealer(client MarathonClient) *AutoHealer {
 		client:            client,
 		applications:      make(map[string]*HealingConfig),
 		checkInterval:     15 * time.Second,
+		pollInterval:      time.Second,
 		unhealthyTasks:    make(map[string]*UnhealthyTask),
 		healingInProgress: make(map[string]bool),
 		healingHistory:    []HealingEvent{},
+		circuits:          make(map[string]*CircuitState),
 	}
 }
 
@@ -97,7 +133,7 @@ func (ah *AutoHealer) RegisterApp(config *HealingConfig) error {
 	if config == nil {
 		return fmt.Errorf("config cannot be nil")
 	}
-	
+
 	ah.mu.Lock()
 	defer ah.mu.Unlock()
 
@@ -129,6 +165,14 @@ func (ah *AutoHealer) RegisterApp(config *HealingConfig) error {
 		config.BackoffPolicy.Multiplier = 2.0
 	}
 
+	// Set default circuit breaker timing, the breaker itself stays disabled
+	if config.CircuitBreaker.Window == 0 {
+		config.CircuitBreaker.Window = 5 * time.Minute
+	}
+	if config.CircuitBreaker.ResetTimeout == 0 {
+		config.CircuitBreaker.ResetTimeout = 10 * time.Minute
+	}
+
 	ah.applications[config.AppID] = config
 
 	log.Printf("Registered auto-healing for app %s: policy=%s, maxFailures=%d",
@@ -187,8 +231,23 @@ func (ah *AutoHealer) checkAppHealth(ctx context.Context, config *HealingConfig)
 	}
 
 	// Check each task
-	for _, task := range tasks {
-		ah.evaluateTask(ctx, config, &task)
+	candidates := make([]healingCandidate, 0)
+	for i := range tasks {
+		task := &tasks[i]
+		if reason, heal := ah.evaluateTask(ctx, config, task); heal {
+			candidates = append(candidates, healingCandidate{task: task, reason: reason})
+		}
+	}
+	ah.forgetMissingTasks(config.AppID, tasks)
+
+	// A deployment in progress replaces tasks itself, and scaling the app
+	// would supersede it. Healing waits until the deployment has finished.
+	if len(app.Deployments) > 0 {
+		if len(candidates) > 0 {
+			log.Printf("Postponing healing of %d tasks of app %s while deployment %s is in progress",
+				len(candidates), config.AppID, app.Deployments[0].ID)
+		}
+		return nil
 	}
 
 	// Log health status
@@ -197,33 +256,73 @@ func (ah *AutoHealer) checkAppHealth(ctx context.Context, config *HealingConfig)
 			config.AppID, app.TasksHealthy, app.TasksRunning, app.TasksUnhealthy)
 	}
 
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	// A tripped circuit stops all healing of the app
+	if ah.circuitOpen(config, max(app.Instances, len(tasks)), time.Now()) || len(candidates) == 0 {
+		return nil
+	}
+	for i := range candidates {
+		candidates[i].unhealthy = ah.unhealthyTasks[candidates[i].task.ID]
+		ah.healingInProgress[candidates[i].task.ID] = true
+	}
+	go ah.healTasks(ctx, config, candidates)
+
 	return nil
 }
 
-// evaluateTask evaluates a single task for healing
-func (ah *AutoHealer) evaluateTask(ctx context.Context, config *HealingConfig, task *Task) {
+// healingCandidate is an unhealthy task due for replacement
+type healingCandidate struct {
+	task      *Task
+	unhealthy *UnhealthyTask
+	reason    string
+}
+
+// forgetMissingTasks stops tracking tasks of an app that no longer exist,
+// such as tasks killed by a replacement that did not turn healthy in time
+func (ah *AutoHealer) forgetMissingTasks(appID string, tasks []Task) {
+	current := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		current[task.ID] = true
+	}
+
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+	for taskID, unhealthy := range ah.unhealthyTasks {
+		if unhealthy.AppID == appID && !current[taskID] && !ah.healingInProgress[taskID] {
+			delete(ah.unhealthyTasks, taskID)
+		}
+	}
+}
+
+// evaluateTask evaluates a single task for healing and reports whether it
+// should be replaced now
+func (ah *AutoHealer) evaluateTask(ctx context.Context, config *HealingConfig, task *Task) (string, bool) {
 	// Skip if healing already in progress for this task
 	ah.mu.RLock()
 	inProgress := ah.healingInProgress[task.ID]
 	ah.mu.RUnlock()
 
 	if inProgress {
-		return
+		return "", false
 	}
 
 	// Check if task is unhealthy
 	if task.HealthState == "unhealthy" || task.State == "TASK_FAILED" || task.State == "TASK_LOST" {
-		ah.handleUnhealthyTask(ctx, config, task)
+		return ah.handleUnhealthyTask(ctx, config, task)
 	} else if task.HealthState == "healthy" {
 		// Task recovered, remove from tracking
 		ah.mu.Lock()
 		delete(ah.unhealthyTasks, task.ID)
 		ah.mu.Unlock()
 	}
+	return "", false
 }
 
-// handleUnhealthyTask handles an unhealthy task
-func (ah *AutoHealer) handleUnhealthyTask(ctx context.Context, config *HealingConfig, task *Task) {
+// handleUnhealthyTask tracks an unhealthy task and reports whether it
+// should be replaced now, and why
+func (ah *AutoHealer) handleUnhealthyTask(ctx context.Context, config *HealingConfig, task *Task) (string, bool) {
 	ah.mu.Lock()
 	defer ah.mu.Unlock()
 
@@ -241,8 +340,9 @@ func (ah *AutoHealer) handleUnhealthyTask(ctx context.Context, config *HealingCo
 			Reason:           fmt.Sprintf("Task state: %s, Health: %s", task.State, task.HealthState),
 		}
 		ah.unhealthyTasks[task.ID] = unhealthy
+		ah.recordFailure(task.AppID, now)
 		log.Printf("Detected unhealthy task: %s (app: %s)", task.ID, task.AppID)
-		return
+		return "", false
 	}
 
 	// Increment failure count
@@ -265,10 +365,9 @@ func (ah *AutoHealer) handleUnhealthyTask(ctx context.Context, config *HealingCo
 
 	// Check max restart attempts
 	if unhealthy.RestartAttempts >= config.MaxRestartAttempts {
-		shouldHeal = false
 		log.Printf("Task %s exceeded max restart attempts (%d), giving up",
 			task.ID, config.MaxRestartAttempts)
-		return
+		return "", false
 	}
 
 	// Check backoff delay
@@ -278,99 +377,291 @@ func (ah *AutoHealer) handleUnhealthyTask(ctx context.Context, config *HealingCo
 			task.ID, unhealthy.NextAttemptTime.Format(time.RFC3339))
 	}
 
-	if shouldHeal {
-		go ah.healTask(context.Background(), config, task, unhealthy, reason)
+	return reason, shouldHeal
+}
+
+// recordFailure counts a task failure towards an app's circuit breaker. The
+// caller must hold ah.mu.
+func (ah *AutoHealer) recordFailure(appID string, now time.Time) {
+	circuit, exists := ah.circuits[appID]
+	if !exists {
+		circuit = &CircuitState{AppID: appID}
+		ah.circuits[appID] = circuit
 	}
+	circuit.Failures = append(circuit.Failures, now)
 }
 
-// healTask performs the healing action for a task
-func (ah *AutoHealer) healTask(ctx context.Context, config *HealingConfig, task *Task, unhealthy *UnhealthyTask, reason string) {
-	taskID := task.ID
+// circuitOpen reports whether healing of an app is suspended, opening the
+// circuit when more than the threshold of its instances failed within the
+// window and closing it again after the reset timeout. The caller must hold
+// ah.mu.
+func (ah *AutoHealer) circuitOpen(config *HealingConfig, instances int, now time.Time) bool {
+	breaker := config.CircuitBreaker
+	circuit, exists := ah.circuits[config.AppID]
+	if breaker.FailureThreshold <= 0 || !exists {
+		return false
+	}
+
+	if circuit.Open {
+		if now.Sub(circuit.OpenedAt) < breaker.ResetTimeout {
+			return true
+		}
+		circuit.Failures = nil
+		ah.closeCircuit(circuit, fmt.Sprintf("reset timeout of %s elapsed", breaker.ResetTimeout), now)
+		return false
+	}
+
+	cutoff := now.Add(-breaker.Window)
+	recent := circuit.Failures[:0]
+	for _, failure := range circuit.Failures {
+		if failure.After(cutoff) {
+			recent = append(recent, failure)
+		}
+	}
+	circuit.Failures = recent
+
+	failedPercent := float64(len(recent)) / float64(max(instances, 1)) * 100
+	if failedPercent <= breaker.FailureThreshold {
+		return false
+	}
+
+	circuit.Open = true
+	circuit.OpenedAt = now
+	circuit.Reason = fmt.Sprintf("%d task failures within %s are %.0f%% of %d instances, above %.0f%%",
+		len(recent), breaker.Window, failedPercent, instances, breaker.FailureThreshold)
+	log.Printf("Circuit opened for app %s, healing suspended: %s", config.AppID, circuit.Reason)
+	ah.recordEvent(HealingEvent{
+		Timestamp: now,
+		AppID:     config.AppID,
+		Action:    ActionCircuitOpened,
+		Reason:    circuit.Reason,
+		Success:   true,
+	})
+	return true
+}
+
+// closeCircuit resumes healing of an app. The caller must hold ah.mu.
+func (ah *AutoHealer) closeCircuit(circuit *CircuitState, reason string, now time.Time) {
+	circuit.Open = false
+	circuit.OpenedAt = time.Time{}
+	circuit.Reason = ""
+	log.Printf("Circuit closed for app %s, healing resumed: %s", circuit.AppID, reason)
+	ah.recordEvent(HealingEvent{
+		Timestamp: now,
+		AppID:     circuit.AppID,
+		Action:    ActionCircuitClosed,
+		Reason:    reason,
+		Success:   true,
+	})
+}
+
+// recordEvent adds an event to the bounded healing history. The caller must
+// hold ah.mu.
+func (ah *AutoHealer) recordEvent(event HealingEvent) {
+	ah.healingHistory = append(ah.healingHistory, event)
+	if len(ah.healingHistory) > maxHealingHistory {
+		ah.healingHistory = ah.healingHistory[len(ah.healingHistory)-maxHealingHistory:]
+	}
+}
 
-	// Mark as in progress
+// healTask performs the healing action for a single task
+func (ah *AutoHealer) healTask(ctx context.Context, config *HealingConfig, task *Task, unhealthy *UnhealthyTask, reason string) {
 	ah.mu.Lock()
-	ah.healingInProgress[taskID] = true
+	ah.healingInProgress[task.ID] = true
 	ah.mu.Unlock()
 
+	ah.healTasks(ctx, config, []healingCandidate{{task: task, unhealthy: unhealthy, reason: reason}})
+}
+
+// healTasks replaces the unhealthy tasks of an app according to its
+// replacement strategy and records the outcome for each task. The tasks
+// must be marked in progress.
+func (ah *AutoHealer) healTasks(ctx context.Context, config *HealingConfig, candidates []healingCandidate) {
 	defer func() {
 		ah.mu.Lock()
-		delete(ah.healingInProgress, taskID)
+		for _, c := range candidates {
+			delete(ah.healingInProgress, c.task.ID)
+		}
 		ah.mu.Unlock()
 	}()
 
-	log.Printf("Healing task %s (app: %s): %s", taskID, task.AppID, reason)
-
-	event := HealingEvent{
-		Timestamp: time.Now(),
-		AppID:     task.AppID,
-		TaskID:    taskID,
-		Action:    "restart",
-		Reason:    reason,
+	tasks := make([]*Task, len(candidates))
+	for i, c := range candidates {
+		tasks[i] = c.task
+		log.Printf("Healing task %s (app: %s): %s", c.task.ID, c.task.AppID, c.reason)
 	}
 
 	// Execute healing based on replacement strategy
-	var err error
+	errs := make([]error, len(candidates))
 	switch config.ReplacementStrategy {
 	case RollingReplacement:
-		err = ah.rollingReplace(ctx, task)
+		// Replace one task at a time, halting once a replacement fails
+		for i, task := range tasks {
+			if i > 0 && errs[i-1] != nil {
+				errs[i] = fmt.Errorf("rolling replacement halted: %w", errs[i-1])
+				continue
+			}
+			errs[i] = ah.rollingReplace(ctx, config, task)
+		}
 	case ImmediateReplacement:
-		err = ah.immediateReplace(ctx, task)
+		for i, task := range tasks {
+			errs[i] = ah.immediateReplace(ctx, config, task)
+		}
 	case BatchReplacement:
-		err = ah.batchReplace(ctx, task)
+		err := ah.batchReplace(ctx, config, tasks)
+		for i := range errs {
+			errs[i] = err
+		}
 	default:
-		err = fmt.Errorf("unknown replacement strategy: %s", config.ReplacementStrategy)
+		for i := range errs {
+			errs[i] = fmt.Errorf("unknown replacement strategy: %s", config.ReplacementStrategy)
+		}
 	}
 
 	// Record result
 	ah.mu.Lock()
+	defer ah.mu.Unlock()
+	for i, c := range candidates {
+		event := HealingEvent{
+			Timestamp: time.Now(),
+			AppID:     c.task.AppID,
+			TaskID:    c.task.ID,
+			Action:    "restart",
+			Reason:    c.reason,
+		}
+		if err := errs[i]; err != nil {
+			event.Success = false
+			event.ErrorMsg = err.Error()
+			log.Printf("Failed to heal task %s: %v", c.task.ID, err)
+
+			// Update backoff
+			if c.unhealthy != nil {
+				c.unhealthy.RestartAttempts++
+				c.unhealthy.LastAttemptTime = time.Now()
+				c.unhealthy.NextAttemptTime = ah.calculateBackoff(config, c.unhealthy.RestartAttempts)
+			}
+		} else {
+			event.Success = true
+			log.Printf("Successfully healed task %s", c.task.ID)
+
+			// Remove from unhealthy tracking
+			delete(ah.unhealthyTasks, c.task.ID)
+		}
+		ah.recordEvent(event)
+	}
+}
+
+// rollingReplace kills a task and waits for Marathon to launch a healthy
+// replacement, so capacity drops by at most one task
+func (ah *AutoHealer) rollingReplace(ctx context.Context, config *HealingConfig, task *Task) error {
+	known, err := ah.knownTaskIDs(task.AppID)
 	if err != nil {
-		event.Success = false
-		event.ErrorMsg = err.Error()
-		log.Printf("Failed to heal task %s: %v", taskID, err)
-
-		// Update backoff
-		unhealthy.RestartAttempts++
-		unhealthy.LastAttemptTime = time.Now()
-		unhealthy.NextAttemptTime = ah.calculateBackoff(config, unhealthy.RestartAttempts)
-	} else {
-		event.Success = true
-		log.Printf("Successfully healed task %s", taskID)
+		return err
+	}
 
-		// Remove from unhealthy tracking
-		delete(ah.unhealthyTasks, taskID)
+	log.Printf("Killing unhealthy task %s for replacement", task.ID)
+	if err := ah.client.KillTask(task.ID); err != nil {
+		return fmt.Errorf("failed to kill task %s: %w", task.ID, err)
 	}
+	return ah.waitForReplacements(ctx, config, task.AppID, known, 1)
+}
 
-	// Add to history
-	ah.healingHistory = append(ah.healingHistory, event)
-	if len(ah.healingHistory) > 100 {
-		ah.healingHistory = ah.healingHistory[len(ah.healingHistory)-100:]
+// immediateReplace launches a replacement before killing the task, so
+// capacity never drops. The app is scaled up by one instance and scaled
+// back down by killing the task, even if the replacement does not turn
+// healthy in time.
+func (ah *AutoHealer) immediateReplace(ctx context.Context, config *HealingConfig, task *Task) error {
+	app, err := ah.client.GetApp(task.AppID)
+	if err != nil {
+		return fmt.Errorf("failed to get app: %w", err)
 	}
-	ah.mu.Unlock()
+	if len(app.Deployments) > 0 {
+		return fmt.Errorf("deployment %s in progress on app %s", app.Deployments[0].ID, task.AppID)
+	}
+	known, err := ah.knownTaskIDs(task.AppID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Immediately replacing task %s", task.ID)
+	if err := ah.client.ScaleApp(task.AppID, app.Instances+1); err != nil {
+		return fmt.Errorf("failed to launch replacement for task %s: %w", task.ID, err)
+	}
+	waitErr := ah.waitForReplacements(ctx, config, task.AppID, known, 1)
+
+	if err := ah.client.KillTaskAndScale(task.ID); err != nil {
+		return fmt.Errorf("failed to kill task %s: %w", task.ID, err)
+	}
+	return waitErr
 }
 
-// rollingReplace replaces a task using rolling strategy
-func (ah *AutoHealer) rollingReplace(ctx context.Context, task *Task) error {
-	// In Marathon, killing a task triggers automatic replacement
-	// This is already a rolling replacement
-	log.Printf("Killing unhealthy task %s for replacement", task.ID)
-	// TODO: Implement actual task kill via Marathon API
-	return nil
+// batchReplace kills all unhealthy tasks of an app at once and waits for
+// their replacements
+func (ah *AutoHealer) batchReplace(ctx context.Context, config *HealingConfig, tasks []*Task) error {
+	appID := tasks[0].AppID
+	known, err := ah.knownTaskIDs(appID)
+	if err != nil {
+		return err
+	}
+
+	taskIDs := make([]string, len(tasks))
+	for i, task := range tasks {
+		taskIDs[i] = task.ID
+	}
+	log.Printf("Batch replacing %d tasks of app %s", len(taskIDs), appID)
+	if err := ah.client.KillTasks(taskIDs); err != nil {
+		return fmt.Errorf("failed to kill tasks: %w", err)
+	}
+	return ah.waitForReplacements(ctx, config, appID, known, len(taskIDs))
 }
 
-// immediateReplace replaces a task immediately
-func (ah *AutoHealer) immediateReplace(ctx context.Context, task *Task) error {
-	// Start new task before killing old one
-	log.Printf("Immediately replacing task %s", task.ID)
-	// TODO: Implement via Marathon API
-	return nil
+// knownTaskIDs returns the IDs of an app's current tasks
+func (ah *AutoHealer) knownTaskIDs(appID string) (map[string]bool, error) {
+	tasks, err := ah.client.GetAppTasks(appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+	known := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		known[task.ID] = true
+	}
+	return known, nil
 }
 
-// batchReplace replaces multiple tasks at once
-func (ah *AutoHealer) batchReplace(ctx context.Context, task *Task) error {
-	// Batch replacement for multiple unhealthy tasks
-	log.Printf("Batch replacing task %s", task.ID)
-	// TODO: Implement via Marathon API
-	return nil
+// waitForReplacements polls an app's tasks until count tasks not in known
+// are running and not unhealthy, giving up after the health check timeout
+func (ah *AutoHealer) waitForReplacements(ctx context.Context, config *HealingConfig, appID string, known map[string]bool, count int) error {
+	timeout := config.HealthCheckTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(ah.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		tasks, err := ah.client.GetAppTasks(appID)
+		if err == nil {
+			ready := 0
+			for _, task := range tasks {
+				if !known[task.ID] && task.State == "TASK_RUNNING" && task.HealthState != "unhealthy" {
+					ready++
+				}
+			}
+			if ready >= count {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("replacement tasks of app %s not healthy within %s", appID, timeout)
+		case <-ticker.C:
+		}
+	}
 }
 
 // calculateBackoff calculates next retry time using exponential backoff
@@ -393,6 +684,36 @@ func (ah *AutoHealer) GetHealingHistory() []HealingEvent {
 	return ah.healingHistory
 }
 
+// GetCircuitState returns a copy of an app's circuit breaker state
+func (ah *AutoHealer) GetCircuitState(appID string) CircuitState {
+	ah.mu.RLock()
+	defer ah.mu.RUnlock()
+
+	circuit, exists := ah.circuits[appID]
+	if !exists {
+		return CircuitState{AppID: appID}
+	}
+	state := *circuit
+	state.Failures = append([]time.Time(nil), circuit.Failures...)
+	return state
+}
+
+// ResetCircuit closes an app's circuit and forgets its failures, resuming
+// healing before the reset timeout
+func (ah *AutoHealer) ResetCircuit(appID string) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	circuit, exists := ah.circuits[appID]
+	if !exists {
+		return
+	}
+	if circuit.Open {
+		ah.closeCircuit(circuit, "circuit reset manually", time.Now())
+	}
+	circuit.Failures = nil
+}
+
 // GetUnhealthyTasks returns currently tracked unhealthy tasks
 func (ah *AutoHealer) GetUnhealthyTasks() map[string]*UnhealthyTask {
 	ah.mu.RLock()
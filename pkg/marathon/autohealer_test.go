@@ -70,6 +70,11 @@ func (m *MockMarathonClient) KillTasks(taskIDs []string) error {
 	return args.Error(0)
 }
 
+func (m *MockMarathonClient) KillTaskAndScale(taskID string) error {
+	args := m.Called(taskID)
+	return args.Error(0)
+}
+
 func TestNewAutoHealer(t *testing.T) {
 	mockClient := &MockMarathonClient{}
 	healer := NewAutoHealer(mockClient)
@@ -204,6 +209,7 @@ func TestAutoHealer_Start(t *testing.T) {
 	mockClient := &MockMarathonClient{}
 	healer := NewAutoHealer(mockClient)
 	healer.checkInterval = 10 * time.Millisecond // Short interval for testing
+	healer.pollInterval = time.Millisecond
 
 	// Register a test app
 	config := &HealingConfig{
@@ -234,6 +240,8 @@ func TestAutoHealer_Start(t *testing.T) {
 			HealthState: "unhealthy",
 		},
 	}, nil)
+	// The unhealthy task is replaced once it failed often enough
+	mockClient.On("KillTask", "task-2").Return(nil).Maybe()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
@@ -625,7 +633,11 @@ func TestAutoHealer_handleUnhealthyTask(t *testing.T) {
 			}
 
 			ctx := context.Background()
-			healer.handleUnhealthyTask(ctx, tt.config, tt.task)
+			reason, shouldHeal := healer.handleUnhealthyTask(ctx, tt.config, tt.task)
+			assert.Equal(t, tt.expectedShouldHeal, shouldHeal)
+			if shouldHeal {
+				assert.Contains(t, reason, "Exceeded max consecutive failures")
+			}
 
 			// Check if task is tracked as unhealthy
 			assert.Contains(t, healer.unhealthyTasks, tt.task.ID)
@@ -643,6 +655,7 @@ func TestAutoHealer_healTask(t *testing.T) {
 		config              *HealingConfig
 		unhealthy           *UnhealthyTask
 		reason              string
+		setup               func(*MockMarathonClient)
 		expectedSuccess     bool
 		expectedInProgress  bool
 	}{
@@ -663,6 +676,12 @@ func TestAutoHealer_healTask(t *testing.T) {
 				RestartAttempts: 0,
 			},
 			reason:             "Test healing",
+			setup: func(client *MockMarathonClient) {
+				// Marathon replaces the killed task
+				client.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-1", AppID: "test-app", State: "TASK_RUNNING"}}, nil).Once()
+				client.On("KillTask", "task-1").Return(nil).Once()
+				client.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-4", AppID: "test-app", State: "TASK_RUNNING", HealthState: "healthy"}}, nil)
+			},
 			expectedSuccess:   true,
 			expectedInProgress: false, // Should be cleaned up after healing
 		},
@@ -683,6 +702,17 @@ func TestAutoHealer_healTask(t *testing.T) {
 				RestartAttempts: 0,
 			},
 			reason:             "Test healing",
+			setup: func(client *MockMarathonClient) {
+				// The replacement is launched before the task is killed
+				client.On("GetApp", "test-app").Return(&Application{ID: "test-app", Instances: 1}, nil)
+				client.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-2", AppID: "test-app", State: "TASK_RUNNING"}}, nil).Once()
+				client.On("ScaleApp", "test-app", 2).Return(nil).Once()
+				client.On("GetAppTasks", "test-app").Return([]Task{
+					{ID: "task-2", AppID: "test-app", State: "TASK_RUNNING"},
+					{ID: "task-4", AppID: "test-app", State: "TASK_RUNNING"},
+				}, nil)
+				client.On("KillTaskAndScale", "task-2").Return(nil).Once()
+			},
 			expectedSuccess:   true,
 			expectedInProgress: false,
 		},
@@ -703,6 +733,11 @@ func TestAutoHealer_healTask(t *testing.T) {
 				RestartAttempts: 0,
 			},
 			reason:             "Test healing",
+			setup: func(client *MockMarathonClient) {
+				client.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-3", AppID: "test-app", State: "TASK_RUNNING"}}, nil).Once()
+				client.On("KillTasks", []string{"task-3"}).Return(nil).Once()
+				client.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-4", AppID: "test-app", State: "TASK_RUNNING"}}, nil)
+			},
 			expectedSuccess:   true,
 			expectedInProgress: false,
 		},
@@ -711,10 +746,13 @@ func TestAutoHealer_healTask(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockClient := &MockMarathonClient{}
+			tt.setup(mockClient)
 			healer := NewAutoHealer(mockClient)
+			healer.pollInterval = time.Millisecond
 
 			ctx := context.Background()
 			healer.healTask(ctx, tt.config, tt.task, tt.unhealthy, tt.reason)
+			mockClient.AssertExpectations(t)
 
 			// Check healing history
 			assert.Len(t, healer.healingHistory, 1)
@@ -1173,3 +1211,199 @@ func TestAutoHealer_HealingHistoryLimit(t *testing.T) {
 	assert.Equal(t, "app-50", history[0].AppID) // Should start from app-50
 	assert.Equal(t, "app-149", history[99].AppID) // Should end at app-149
 }
+
+func TestAutoHealer_RollingReplacementTimeout(t *testing.T) {
+	mockClient := &MockMarathonClient{}
+	healer := NewAutoHealer(mockClient)
+	healer.pollInterval = time.Millisecond
+
+	config := &HealingConfig{
+		AppID:               "test-app",
+		Enabled:             true,
+		HealthCheckTimeout:  20 * time.Millisecond,
+		ReplacementStrategy: RollingReplacement,
+	}
+	assert.NoError(t, healer.RegisterApp(config))
+
+	// The replacement of the first task never turns healthy
+	mockClient.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-1", AppID: "test-app", State: "TASK_RUNNING"}}, nil).Once()
+	mockClient.On("KillTask", "task-1").Return(nil).Once()
+	mockClient.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-3", AppID: "test-app", State: "TASK_RUNNING", HealthState: "unhealthy"}}, nil)
+
+	candidates := []healingCandidate{
+		{task: &Task{ID: "task-1", AppID: "test-app"}, unhealthy: &UnhealthyTask{TaskID: "task-1"}, reason: "unhealthy"},
+		{task: &Task{ID: "task-2", AppID: "test-app"}, unhealthy: &UnhealthyTask{TaskID: "task-2"}, reason: "unhealthy"},
+	}
+	healer.healTasks(context.Background(), config, candidates)
+	mockClient.AssertExpectations(t)
+
+	// The second task is left alone once the first replacement failed
+	mockClient.AssertNotCalled(t, "KillTask", "task-2")
+	history := healer.GetHealingHistory()
+	assert.Len(t, history, 2)
+	assert.False(t, history[0].Success)
+	assert.Contains(t, history[0].ErrorMsg, "not healthy within")
+	assert.Contains(t, history[1].ErrorMsg, "rolling replacement halted")
+	for _, c := range candidates {
+		assert.Equal(t, 1, c.unhealthy.RestartAttempts)
+		assert.True(t, c.unhealthy.NextAttemptTime.After(time.Now()))
+	}
+}
+
+func TestAutoHealer_ImmediateReplacementKillsAfterTimeout(t *testing.T) {
+	mockClient := &MockMarathonClient{}
+	healer := NewAutoHealer(mockClient)
+	healer.pollInterval = time.Millisecond
+
+	config := &HealingConfig{AppID: "test-app", HealthCheckTimeout: 10 * time.Millisecond, ReplacementStrategy: ImmediateReplacement}
+	mockClient.On("GetApp", "test-app").Return(&Application{ID: "test-app", Instances: 3}, nil)
+	mockClient.On("GetAppTasks", "test-app").Return([]Task{{ID: "task-1", AppID: "test-app", State: "TASK_RUNNING"}}, nil)
+	mockClient.On("ScaleApp", "test-app", 4).Return(nil).Once()
+	mockClient.On("KillTaskAndScale", "task-1").Return(nil).Once()
+
+	// The app is scaled back down even though no replacement came up
+	err := healer.immediateReplace(context.Background(), config, &Task{ID: "task-1", AppID: "test-app"})
+	assert.ErrorContains(t, err, "not healthy within")
+	mockClient.AssertExpectations(t)
+}
+
+func TestAutoHealer_BatchReplacementGroupsAppTasks(t *testing.T) {
+	mockClient := &MockMarathonClient{}
+	healer := NewAutoHealer(mockClient)
+	healer.pollInterval = time.Millisecond
+
+	config := &HealingConfig{AppID: "test-app", Enabled: true, ReplacementStrategy: BatchReplacement}
+	assert.NoError(t, healer.RegisterApp(config))
+
+	tasks := []Task{
+		{ID: "task-1", AppID: "test-app", State: "TASK_RUNNING", HealthState: "unhealthy"},
+		{ID: "task-2", AppID: "test-app", State: "TASK_FAILED"},
+		{ID: "task-3", AppID: "test-app", State: "TASK_RUNNING", HealthState: "healthy"},
+	}
+	healer.unhealthyTasks["task-1"] = &UnhealthyTask{TaskID: "task-1", AppID: "test-app", FailureCount: 2}
+	healer.unhealthyTasks["task-2"] = &UnhealthyTask{TaskID: "task-2", AppID: "test-app", FailureCount: 2}
+	// Tasks that no longer exist are forgotten
+	healer.unhealthyTasks["task-0"] = &UnhealthyTask{TaskID: "task-0", AppID: "test-app", FailureCount: 1}
+
+	mockClient.On("GetApp", "test-app").Return(&Application{ID: "test-app", Instances: 3}, nil)
+	mockClient.On("GetAppTasks", "test-app").Return(tasks, nil).Twice()
+	mockClient.On("KillTasks", []string{"task-1", "task-2"}).Return(nil).Once()
+	mockClient.On("GetAppTasks", "test-app").Return([]Task{
+		tasks[2],
+		{ID: "task-4", AppID: "test-app", State: "TASK_RUNNING", HealthState: "healthy"},
+		{ID: "task-5", AppID: "test-app", State: "TASK_RUNNING", HealthState: "healthy"},
+	}, nil)
+
+	assert.NoError(t, healer.checkAppHealth(context.Background(), config))
+	assert.Eventually(t, func() bool {
+		return len(healer.GetHealingHistory()) == 2
+	}, time.Second, time.Millisecond)
+	mockClient.AssertExpectations(t)
+
+	for _, event := range healer.GetHealingHistory() {
+		assert.True(t, event.Success, event.ErrorMsg)
+	}
+	assert.Empty(t, healer.GetUnhealthyTasks())
+}
+
+func TestAutoHealer_CircuitBreaker(t *testing.T) {
+	mockClient := &MockMarathonClient{}
+	healer := NewAutoHealer(mockClient)
+
+	config := &HealingConfig{
+		AppID:   "test-app",
+		Enabled: true,
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 50,
+			ResetTimeout:     time.Minute,
+		},
+	}
+	assert.NoError(t, healer.RegisterApp(config))
+	assert.Equal(t, 5*time.Minute, config.CircuitBreaker.Window)
+
+	// Three of four tasks crash, more than half of the app
+	tasks := []Task{
+		{ID: "task-1", AppID: "test-app", State: "TASK_FAILED"},
+		{ID: "task-2", AppID: "test-app", State: "TASK_FAILED"},
+		{ID: "task-3", AppID: "test-app", State: "TASK_FAILED"},
+		{ID: "task-4", AppID: "test-app", State: "TASK_RUNNING", HealthState: "healthy"},
+	}
+	mockClient.On("GetApp", "test-app").Return(&Application{ID: "test-app", Instances: 4}, nil)
+	mockClient.On("GetAppTasks", "test-app").Return(tasks, nil)
+
+	// The failures are detected on the first check, which opens the circuit.
+	// Healing stays suspended after the tasks failed often enough.
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, healer.checkAppHealth(context.Background(), config))
+	}
+	mockClient.AssertNotCalled(t, "KillTask", mock.Anything)
+	assert.Empty(t, healer.healingInProgress)
+
+	state := healer.GetCircuitState("test-app")
+	assert.True(t, state.Open)
+	assert.Len(t, state.Failures, 3)
+	assert.Contains(t, state.Reason, "75% of 4 instances")
+
+	history := healer.GetHealingHistory()
+	assert.Len(t, history, 1)
+	assert.Equal(t, ActionCircuitOpened, history[0].Action)
+
+	// The circuit closes after the reset timeout
+	healer.mu.Lock()
+	assert.False(t, healer.circuitOpen(config, 4, state.OpenedAt.Add(time.Minute)))
+	healer.mu.Unlock()
+	assert.False(t, healer.GetCircuitState("test-app").Open)
+	assert.Empty(t, healer.GetCircuitState("test-app").Failures)
+	assert.Equal(t, ActionCircuitClosed, healer.GetHealingHistory()[1].Action)
+}
+
+func TestAutoHealer_CircuitBreakerWindow(t *testing.T) {
+	healer := NewAutoHealer(&MockMarathonClient{})
+	config := &HealingConfig{AppID: "test-app", CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 50, Window: time.Minute, ResetTimeout: time.Minute}}
+
+	now := time.Now()
+	healer.recordFailure("test-app", now.Add(-2*time.Minute))
+	healer.recordFailure("test-app", now.Add(-90*time.Second))
+	healer.recordFailure("test-app", now)
+
+	// Failures outside the window do not count
+	assert.False(t, healer.circuitOpen(config, 2, now))
+	assert.Len(t, healer.GetCircuitState("test-app").Failures, 1)
+
+	// A disabled breaker never opens
+	healer.recordFailure("test-app", now)
+	config.CircuitBreaker.FailureThreshold = 0
+	assert.False(t, healer.circuitOpen(config, 1, now))
+
+	config.CircuitBreaker.FailureThreshold = 50
+	assert.True(t, healer.circuitOpen(config, 2, now))
+	healer.ResetCircuit("test-app")
+	assert.False(t, healer.GetCircuitState("test-app").Open)
+	assert.False(t, healer.circuitOpen(config, 2, now))
+}
+
+func TestAutoHealer_PostponesHealingDuringDeployment(t *testing.T) {
+	mockClient := &MockMarathonClient{}
+	healer := NewAutoHealer(mockClient)
+
+	config := &HealingConfig{AppID: "test-app", Enabled: true, ReplacementStrategy: ImmediateReplacement}
+	assert.NoError(t, healer.RegisterApp(config))
+	healer.unhealthyTasks["task-1"] = &UnhealthyTask{TaskID: "task-1", AppID: "test-app", FailureCount: 2}
+
+	app := &Application{ID: "test-app", Instances: 2, Deployments: []*Deployment{{ID: "deployment-1"}}}
+	mockClient.On("GetApp", "test-app").Return(app, nil)
+	mockClient.On("GetAppTasks", "test-app").Return([]Task{
+		{ID: "task-1", AppID: "test-app", State: "TASK_FAILED"},
+		{ID: "task-2", AppID: "test-app", State: "TASK_RUNNING", HealthState: "healthy"},
+	}, nil)
+
+	// Scaling the app would supersede the deployment in progress
+	assert.NoError(t, healer.checkAppHealth(context.Background(), config))
+	assert.Empty(t, healer.healingInProgress)
+	assert.Contains(t, healer.GetUnhealthyTasks(), "task-1")
+
+	err := healer.immediateReplace(context.Background(), config, &Task{ID: "task-1", AppID: "test-app"})
+	assert.ErrorContains(t, err, "deployment-1")
+	mockClient.AssertNotCalled(t, "ScaleApp", mock.Anything, mock.Anything)
+	mockClient.AssertNotCalled(t, "KillTaskAndScale", mock.Anything)
+}
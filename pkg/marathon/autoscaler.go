@@ -2,12 +2,35 @@ package marathon
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"strings"
 	"sync"
 	"time"
 )
 
+var (
+	// ErrNotAutoScaled is returned for apps not registered for autoscaling
+	ErrNotAutoScaled = errors.New("not registered for autoscaling")
+	// ErrInvalidAutoScaleConfig is returned for invalid autoscaling configs
+	ErrInvalidAutoScaleConfig = errors.New("invalid autoscale config")
+)
+
+// Metrics every autoscaled app can track
+const (
+	MetricCPU    = "cpu"
+	MetricMemory = "memory"
+)
+
+// defaultTargetCPUPercent is the CPU target of configs that set none
+const defaultTargetCPUPercent = 70.0
+
+// maxScaleHistory bounds the scale events kept per app
+const maxScaleHistory = 50
+
 // AutoScaler implements horizontal pod autoscaling for Marathon applications
 type AutoScaler struct {
 	client          MarathonClient
@@ -17,37 +40,139 @@ type AutoScaler struct {
 	metricsProvider MetricsProvider
 }
 
-// AutoScaleConfig defines autoscaling parameters for an application
+// AutoScaleConfig defines autoscaling parameters for an application. Each
+// tracked metric recommends current × value / target instances, and the
+// largest recommendation within the instance bounds wins.
 type AutoScaleConfig struct {
-	AppID            string
-	MinInstances     int
-	MaxInstances     int
-	TargetCPUPercent float64
-	TargetMemPercent float64
-	ScaleUpPolicy    ScalePolicy
-	ScaleDownPolicy  ScalePolicy
-	Enabled          bool
-	LastScaleTime    time.Time
-	ScaleHistory     []ScaleEvent
+	AppID            string  `json:"appId"`
+	MinInstances     int     `json:"minInstances"`
+	MaxInstances     int     `json:"maxInstances"`
+	TargetCPUPercent float64 `json:"targetCpuPercent,omitempty"`
+	TargetMemPercent float64 `json:"targetMemPercent,omitempty"`
+	// Metrics tracks custom metrics besides CPU and memory. Their values
+	// must be per instance averages, such as requests per second per task.
+	Metrics []MetricTarget `json:"metrics,omitempty"`
+	// Schedules change the instance bounds at times of day
+	Schedules       []*ScheduledScaling `json:"schedules,omitempty"`
+	ScaleUpPolicy   ScalePolicy         `json:"scaleUpPolicy"`
+	ScaleDownPolicy ScalePolicy         `json:"scaleDownPolicy"`
+	Enabled         bool                `json:"enabled"`
+	LastScaleTime   time.Time           `json:"lastScaleTime"`
+	ScaleHistory    []ScaleEvent        `json:"-"`
+
+	// recommendations holds the instance counts recommended by the latest
+	// evaluations, oldest first
+	recommendations []int
+}
+
+// UnmarshalJSON decodes a config, enabling it unless it says otherwise
+func (c *AutoScaleConfig) UnmarshalJSON(data []byte) error {
+	type plain AutoScaleConfig
+	decoded := plain{Enabled: true}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*c = AutoScaleConfig(decoded)
+	return nil
+}
+
+// MetricTarget is a custom metric an app is scaled to hold at a target
+type MetricTarget struct {
+	Name   string  `json:"name"`
+	Target float64 `json:"target"`
 }
 
 // ScalePolicy defines scaling behavior
 type ScalePolicy struct {
-	Threshold         float64       // Metric threshold to trigger scaling
-	ConsecutivePeriods int          // Number of consecutive periods before scaling
-	Cooldown          time.Duration // Minimum time between scale operations
-	StepSize          int           // Number of instances to add/remove
-	StepPercentage    float64       // Percentage of current instances to add/remove
+	// Threshold is the tolerance, in percent of the target, by which a
+	// metric must exceed (scale up) or fall below (scale down) its target
+	// before it recommends scaling
+	Threshold float64
+	// ConsecutivePeriods is the number of consecutive evaluations that
+	// must recommend scaling in this direction; the most conservative of
+	// their recommendations is applied
+	ConsecutivePeriods int
+	Cooldown           time.Duration // Minimum time between scale operations
+	// StepSize and StepPercentage limit the instances one scale operation
+	// adds or removes, the larger of the two applying
+	StepSize       int
+	StepPercentage float64
+}
+
+// scalePolicyJSON is the API representation of a ScalePolicy
+type scalePolicyJSON struct {
+	Threshold          float64 `json:"threshold,omitempty"`
+	ConsecutivePeriods int     `json:"consecutivePeriods,omitempty"`
+	CooldownSeconds    float64 `json:"cooldownSeconds,omitempty"`
+	StepSize           int     `json:"stepSize,omitempty"`
+	StepPercentage     float64 `json:"stepPercentage,omitempty"`
+}
+
+// MarshalJSON encodes a policy with its cooldown in seconds
+func (p ScalePolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(scalePolicyJSON{
+		Threshold:          p.Threshold,
+		ConsecutivePeriods: p.ConsecutivePeriods,
+		CooldownSeconds:    p.Cooldown.Seconds(),
+		StepSize:           p.StepSize,
+		StepPercentage:     p.StepPercentage,
+	})
+}
+
+// UnmarshalJSON decodes a policy with its cooldown in seconds
+func (p *ScalePolicy) UnmarshalJSON(data []byte) error {
+	var decoded scalePolicyJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*p = ScalePolicy{
+		Threshold:          decoded.Threshold,
+		ConsecutivePeriods: decoded.ConsecutivePeriods,
+		Cooldown:           time.Duration(decoded.CooldownSeconds * float64(time.Second)),
+		StepSize:           decoded.StepSize,
+		StepPercentage:     decoded.StepPercentage,
+	}
+	return nil
+}
+
+// ScheduledScaling overrides the instance bounds of an app for
+// DurationSeconds after each time its cron schedule fires, such as at least
+// 10 instances on weekdays from 08:00 for 10 hours. Scheduled bounds apply
+// at once, regardless of metrics and cooldowns.
+type ScheduledScaling struct {
+	Name            string `json:"name"`
+	Cron            string `json:"cron"`
+	TimeZone        string `json:"timezone,omitempty"`
+	DurationSeconds int    `json:"durationSeconds"`
+	MinInstances    int    `json:"minInstances,omitempty"`
+	MaxInstances    int    `json:"maxInstances,omitempty"`
+}
+
+// active reports whether a schedule applies at now
+func (s *ScheduledScaling) active(now time.Time) (bool, error) {
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return false, err
+	}
+	loc := time.UTC
+	if s.TimeZone != "" {
+		if loc, err = time.LoadLocation(s.TimeZone); err != nil {
+			return false, err
+		}
+	}
+	start := now.Add(-time.Duration(s.DurationSeconds) * time.Second)
+	fired := cron.Next(start.In(loc))
+	return !fired.IsZero() && !fired.After(now), nil
 }
 
 // ScaleEvent records a scaling event
 type ScaleEvent struct {
-	Timestamp     time.Time
-	FromInstances int
-	ToInstances   int
-	Reason        string
-	Metric        string
-	MetricValue   float64
+	Timestamp     time.Time `json:"timestamp"`
+	FromInstances int       `json:"fromInstances"`
+	ToInstances   int       `json:"toInstances"`
+	Reason        string    `json:"reason"`
+	Metric        string    `json:"metric"`
+	MetricValue   float64   `json:"metricValue"`
 }
 
 // MetricsProvider interface for retrieving application metrics
@@ -62,17 +187,20 @@ type MarathonClient interface {
 	GetApp(appID string) (*Application, error)
 	ScaleApp(appID string, instances int) error
 	GetAppTasks(appID string) ([]Task, error)
+	KillTask(taskID string) error
+	KillTasks(taskIDs []string) error
+	KillTaskAndScale(taskID string) error
 }
 
 // ApplicationMetrics represents metrics for a Marathon application
 type ApplicationMetrics struct {
-	ID        string
-	Instances int
-	TasksRunning int
-	TasksHealthy int
+	ID             string
+	Instances      int
+	TasksRunning   int
+	TasksHealthy   int
 	TasksUnhealthy int
-	CPUUsage  float64
-	MemUsage  float64
+	CPUUsage       float64
+	MemUsage       float64
 }
 
 // Task represents a Marathon task
@@ -95,23 +223,17 @@ func NewAutoScaler(client MarathonClient, metricsProvider MetricsProvider) *Auto
 	}
 }
 
-// RegisterApp registers an application for autoscaling
+// RegisterApp registers an application for autoscaling. Registering an app
+// again replaces its config and keeps its scale history.
 func (as *AutoScaler) RegisterApp(config *AutoScaleConfig) error {
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
-	// Validate config
-	if config == nil {
-		return fmt.Errorf("config cannot be nil")
-	}
-	if config.MinInstances < 1 {
-		return fmt.Errorf("minInstances must be >= 1")
-	}
-	if config.MaxInstances < config.MinInstances {
-		return fmt.Errorf("maxInstances must be >= minInstances")
+	if err := validateAutoScaleConfig(config); err != nil {
+		return err
 	}
 	if config.TargetCPUPercent <= 0 {
-		config.TargetCPUPercent = 70.0
+		config.TargetCPUPercent = defaultTargetCPUPercent
 	}
 
 	// Set default scale policies if not configured
@@ -129,6 +251,11 @@ func (as *AutoScaler) RegisterApp(config *AutoScaleConfig) error {
 	}
 
 	config.ScaleHistory = []ScaleEvent{}
+	config.recommendations = nil
+	if existing, exists := as.applications[config.AppID]; exists {
+		config.ScaleHistory = existing.ScaleHistory
+		config.LastScaleTime = existing.LastScaleTime
+	}
 	as.applications[config.AppID] = config
 
 	log.Printf("Registered autoscaling for app %s: min=%d, max=%d, targetCPU=%.1f%%",
@@ -137,6 +264,120 @@ func (as *AutoScaler) RegisterApp(config *AutoScaleConfig) error {
 	return nil
 }
 
+// validateAutoScaleConfig checks a config before it is registered
+func validateAutoScaleConfig(config *AutoScaleConfig) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidAutoScaleConfig, fmt.Sprintf(format, args...))
+	}
+
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	if config.AppID == "" {
+		return invalid("appId is required")
+	}
+	if config.MinInstances < 1 {
+		return invalid("minInstances must be >= 1")
+	}
+	if config.MaxInstances < config.MinInstances {
+		return invalid("maxInstances must be >= minInstances")
+	}
+	if config.TargetMemPercent < 0 {
+		return invalid("targetMemPercent must not be negative")
+	}
+
+	for direction, policy := range map[string]ScalePolicy{"scaleUpPolicy": config.ScaleUpPolicy, "scaleDownPolicy": config.ScaleDownPolicy} {
+		if policy.Threshold < 0 || policy.ConsecutivePeriods < 0 || policy.Cooldown < 0 ||
+			policy.StepSize < 0 || policy.StepPercentage < 0 {
+			return invalid("%s values must not be negative", direction)
+		}
+	}
+
+	names := map[string]bool{MetricCPU: true, MetricMemory: true}
+	for _, metric := range config.Metrics {
+		switch {
+		case metric.Name == "":
+			return invalid("metric name is required")
+		case names[metric.Name]:
+			return invalid("metric %s is tracked more than once", metric.Name)
+		case metric.Target <= 0:
+			return invalid("target of metric %s must be positive", metric.Name)
+		}
+		names[metric.Name] = true
+	}
+
+	for _, schedule := range config.Schedules {
+		if schedule == nil {
+			return invalid("schedules must not be null")
+		}
+		if _, err := schedule.active(time.Now()); err != nil {
+			return invalid("schedule %s: %v", schedule.Name, err)
+		}
+		if schedule.DurationSeconds <= 0 {
+			return invalid("schedule %s: durationSeconds must be positive", schedule.Name)
+		}
+		if schedule.MinInstances < 0 || schedule.MaxInstances < 0 {
+			return invalid("schedule %s: instances must not be negative", schedule.Name)
+		}
+		if schedule.MaxInstances > 0 && schedule.MaxInstances < schedule.MinInstances {
+			return invalid("schedule %s: maxInstances must be >= minInstances", schedule.Name)
+		}
+	}
+	return nil
+}
+
+// UnregisterApp stops autoscaling an application
+func (as *AutoScaler) UnregisterApp(appID string) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if _, exists := as.applications[appID]; !exists {
+		return fmt.Errorf("app %s %w", appID, ErrNotAutoScaled)
+	}
+	delete(as.applications, appID)
+	log.Printf("Unregistered autoscaling for app %s", appID)
+	return nil
+}
+
+// GetConfig returns a copy of an application's autoscaling config
+func (as *AutoScaler) GetConfig(appID string) (*AutoScaleConfig, error) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	config, exists := as.applications[appID]
+	if !exists {
+		return nil, fmt.Errorf("app %s %w", appID, ErrNotAutoScaled)
+	}
+	return snapshotAutoScaleConfig(config), nil
+}
+
+// ListConfigs returns copies of all autoscaling configs
+func (as *AutoScaler) ListConfigs() []*AutoScaleConfig {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	configs := make([]*AutoScaleConfig, 0, len(as.applications))
+	for _, config := range as.applications {
+		configs = append(configs, snapshotAutoScaleConfig(config))
+	}
+	return configs
+}
+
+// snapshotAutoScaleConfig copies a config without its history and
+// evaluation state. The caller must hold as.mu.
+func snapshotAutoScaleConfig(config *AutoScaleConfig) *AutoScaleConfig {
+	snapshot := *config
+	snapshot.Metrics = append([]MetricTarget(nil), config.Metrics...)
+	snapshot.Schedules = make([]*ScheduledScaling, len(config.Schedules))
+	for i, schedule := range config.Schedules {
+		copied := *schedule
+		snapshot.Schedules[i] = &copied
+	}
+	snapshot.ScaleHistory = nil
+	snapshot.recommendations = nil
+	return &snapshot
+}
+
 // Start begins the autoscaling loop
 func (as *AutoScaler) Start(ctx context.Context) error {
 	log.Println("Starting Marathon autoscaler")
@@ -181,24 +422,27 @@ func (as *AutoScaler) evaluateApp(ctx context.Context, config *AutoScaleConfig)
 		return fmt.Errorf("failed to get app: %w", err)
 	}
 
-	// Get metrics
-	cpuUtil, err := as.metricsProvider.GetCPUUtilization(config.AppID)
-	if err != nil {
-		log.Printf("Failed to get CPU metrics for %s: %v", config.AppID, err)
-		cpuUtil = 0
-	}
+	as.mu.RLock()
+	targets := config.metricTargets()
+	as.mu.RUnlock()
 
-	memUtil, err := as.metricsProvider.GetMemoryUtilization(config.AppID)
-	if err != nil {
-		log.Printf("Failed to get memory metrics for %s: %v", config.AppID, err)
-		memUtil = 0
+	// Metrics that cannot be read are left out of the decision
+	metrics := make(map[string]float64, len(targets))
+	observed := make([]string, 0, len(targets))
+	for _, target := range targets {
+		value, err := as.getMetric(config.AppID, target.Name)
+		if err != nil {
+			log.Printf("Failed to get %s metrics for %s: %v", target.Name, config.AppID, err)
+			continue
+		}
+		metrics[target.Name] = value
+		observed = append(observed, formatMetric(target.Name, value))
 	}
 
-	log.Printf("App %s: instances=%d, CPU=%.1f%%, Memory=%.1f%%",
-		config.AppID, app.Instances, cpuUtil, memUtil)
+	log.Printf("App %s: instances=%d, %s", config.AppID, app.Instances, strings.Join(observed, ", "))
 
 	// Determine scaling action
-	decision := as.makeScalingDecision(config, app, cpuUtil, memUtil)
+	decision := as.makeScalingDecision(config, app, metrics, time.Now())
 
 	if decision.ShouldScale {
 		return as.executeScale(ctx, config, app, decision)
@@ -207,104 +451,236 @@ func (as *AutoScaler) evaluateApp(ctx context.Context, config *AutoScaleConfig)
 	return nil
 }
 
+// getMetric reads a tracked metric of an app from the metrics provider
+func (as *AutoScaler) getMetric(appID, name string) (float64, error) {
+	switch name {
+	case MetricCPU:
+		return as.metricsProvider.GetCPUUtilization(appID)
+	case MetricMemory:
+		return as.metricsProvider.GetMemoryUtilization(appID)
+	}
+	return as.metricsProvider.GetCustomMetric(appID, name)
+}
+
+// metricTargets returns the metrics a config tracks with their targets
+func (c *AutoScaleConfig) metricTargets() []MetricTarget {
+	targetCPU := c.TargetCPUPercent
+	if targetCPU <= 0 {
+		targetCPU = defaultTargetCPUPercent
+	}
+	targets := []MetricTarget{{Name: MetricCPU, Target: targetCPU}}
+	if c.TargetMemPercent > 0 {
+		targets = append(targets, MetricTarget{Name: MetricMemory, Target: c.TargetMemPercent})
+	}
+	return append(targets, c.Metrics...)
+}
+
+// instanceBounds returns the instance bounds at now and the names of the
+// schedules changing them. A scheduled minimum wins over the maximum.
+func (c *AutoScaleConfig) instanceBounds(now time.Time) (minInstances, maxInstances int, schedules []string) {
+	minInstances, maxInstances = c.MinInstances, c.MaxInstances
+	for _, schedule := range c.Schedules {
+		active, err := schedule.active(now)
+		if err != nil {
+			log.Printf("Skipping schedule %s of app %s: %v", schedule.Name, c.AppID, err)
+			continue
+		}
+		if !active {
+			continue
+		}
+		schedules = append(schedules, schedule.Name)
+		minInstances = max(minInstances, schedule.MinInstances)
+		if schedule.MaxInstances > 0 {
+			maxInstances = min(maxInstances, schedule.MaxInstances)
+		}
+	}
+	return minInstances, max(minInstances, maxInstances), schedules
+}
+
+// recommend returns the instance count the tracked metrics call for: the
+// largest of current × value / target over the metrics outside the policy
+// thresholds. Metrics that could not be read prevent scaling down.
+func (c *AutoScaleConfig) recommend(current int, metrics map[string]float64) (int, MetricTarget, bool) {
+	desired := -1
+	var driver MetricTarget
+	missing := false
+	for _, target := range c.metricTargets() {
+		value, exists := metrics[target.Name]
+		if !exists {
+			missing = true
+			continue
+		}
+		ratio := value / target.Target
+		count := current
+		if ratio > 1+c.ScaleUpPolicy.Threshold/100 || ratio < 1-c.ScaleDownPolicy.Threshold/100 {
+			count = int(math.Ceil(float64(current) * ratio))
+		}
+		if count > desired {
+			desired, driver = count, target
+		}
+	}
+	if desired < 0 {
+		return current, driver, false
+	}
+	if missing && desired < current {
+		desired = current
+	}
+	return desired, driver, true
+}
+
+// stabilize records a recommendation and returns the instance count to
+// scale to: the most conservative of the latest recommendations once the
+// policy's ConsecutivePeriods all call for scaling the same way, otherwise
+// current
+func (c *AutoScaleConfig) stabilize(current, desired int) int {
+	upPeriods := max(1, c.ScaleUpPolicy.ConsecutivePeriods)
+	downPeriods := max(1, c.ScaleDownPolicy.ConsecutivePeriods)
+	c.recommendations = append(c.recommendations, desired)
+	if keep := max(upPeriods, downPeriods); len(c.recommendations) > keep {
+		c.recommendations = c.recommendations[len(c.recommendations)-keep:]
+	}
+
+	periods := downPeriods
+	if desired > current {
+		periods = upPeriods
+	}
+	if desired == current || len(c.recommendations) < periods {
+		return current
+	}
+	target := desired
+	for _, recommended := range c.recommendations[len(c.recommendations)-periods:] {
+		switch {
+		case desired > current && recommended <= current, desired < current && recommended >= current:
+			return current
+		case desired > current:
+			target = min(target, recommended)
+		default:
+			target = max(target, recommended)
+		}
+	}
+	return target
+}
+
+// stepLimit returns the instances one scale operation may add or remove,
+// defaulting to a share of the current instances
+func stepLimit(policy ScalePolicy, current int, defaultShare float64) int {
+	if policy.StepSize == 0 && policy.StepPercentage == 0 {
+		return max(1, int(float64(current)*defaultShare))
+	}
+	return max(1, max(policy.StepSize, int(float64(current)*policy.StepPercentage/100)))
+}
+
+// formatMetric describes a metric value, as in CPU=30.0%
+func formatMetric(name string, value float64) string {
+	switch name {
+	case MetricCPU:
+		return fmt.Sprintf("CPU=%.1f%%", value)
+	case MetricMemory:
+		return fmt.Sprintf("Memory=%.1f%%", value)
+	}
+	return fmt.Sprintf("%s=%.1f", name, value)
+}
+
 // ScalingDecision represents a scaling decision
 type ScalingDecision struct {
-	ShouldScale   bool
-	Direction     string // "up" or "down"
-	TargetCount   int
-	Reason        string
-	MetricName    string
-	MetricValue   float64
+	ShouldScale bool
+	Direction   string // "up" or "down"
+	TargetCount int
+	Reason      string
+	MetricName  string
+	MetricValue float64
 }
 
-// makeScalingDecision determines if and how to scale
-func (as *AutoScaler) makeScalingDecision(config *AutoScaleConfig, app *Application, cpuUtil, memUtil float64) ScalingDecision {
+// makeScalingDecision determines if and how to scale from the metric values
+// read at now
+func (as *AutoScaler) makeScalingDecision(config *AutoScaleConfig, app *Application, metrics map[string]float64, now time.Time) ScalingDecision {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
 	decision := ScalingDecision{
 		ShouldScale: false,
 	}
-
-	// Apply defaults if not set (in case makeScalingDecision is called directly)
-	targetCPU := config.TargetCPUPercent
-	if targetCPU <= 0 {
-		targetCPU = 70.0
-	}
-	targetMem := config.TargetMemPercent
-
 	currentInstances := app.Instances
 
-	// Check scale-up conditions
-	if cpuUtil > targetCPU {
+	// Scheduled bounds apply at once
+	minInstances, maxInstances, schedules := config.instanceBounds(now)
+	if len(schedules) > 0 && (currentInstances < minInstances || currentInstances > maxInstances) {
+		config.recommendations = nil
 		decision.ShouldScale = true
 		decision.Direction = "up"
-		decision.MetricName = "cpu"
-		decision.MetricValue = cpuUtil
-		decision.Reason = fmt.Sprintf("CPU utilization %.1f%% > target %.1f%%", cpuUtil, targetCPU)
-	} else if memUtil > targetMem && targetMem > 0 {
-		decision.ShouldScale = true
-		decision.Direction = "up"
-		decision.MetricName = "memory"
-		decision.MetricValue = memUtil
-		decision.Reason = fmt.Sprintf("Memory utilization %.1f%% > target %.1f%%", memUtil, targetMem)
-	}
-
-	// Check scale-down conditions
-	// Only scale down if we have valid metrics (not 0 due to errors)
-	scaleDown := false
-	if targetMem > 0 {
-		// If memory target is set, require both CPU and memory to be low
-		// Also ensure metrics are valid (> 0) to avoid scaling down on metric failures
-		scaleDown = cpuUtil > 0 && memUtil > 0 &&
-			cpuUtil < targetCPU*0.5 && memUtil < targetMem*0.5
-	} else {
-		// If memory target is not set, only check CPU
-		// Ensure CPU metric is valid (> 0)
-		scaleDown = cpuUtil > 0 && cpuUtil < targetCPU*0.5
+		decision.TargetCount = minInstances
+		if currentInstances > maxInstances {
+			decision.Direction = "down"
+			decision.TargetCount = maxInstances
+		}
+		decision.MetricName = "schedule"
+		decision.Reason = fmt.Sprintf("Schedule %s bounds instances to %d-%d",
+			strings.Join(schedules, ", "), minInstances, maxInstances)
+		return decision
 	}
 
-	if scaleDown {
-		decision.ShouldScale = true
+	desired, driver, ok := config.recommend(currentInstances, metrics)
+	if !ok {
+		decision.Reason = "No metrics available"
+		return decision
+	}
+	if desired == currentInstances {
+		config.stabilize(currentInstances, currentInstances)
+		return decision
+	}
+
+	// Don't scale if already at limit
+	bounded := max(minInstances, min(desired, maxInstances))
+	if bounded == currentInstances {
+		config.stabilize(currentInstances, currentInstances)
+		decision.Reason = "Already at scale limit"
+		return decision
+	}
+
+	decision.Direction = "up"
+	policy, share := config.ScaleUpPolicy, 0.5
+	if bounded < currentInstances {
 		decision.Direction = "down"
-		decision.MetricName = "cpu_memory"
-		decision.MetricValue = (cpuUtil + memUtil) / 2
-		decision.Reason = fmt.Sprintf("Low utilization: CPU=%.1f%%, Memory=%.1f%%", cpuUtil, memUtil)
+		policy, share = config.ScaleDownPolicy, 0.25
 	}
 
-	// Check cooldown period
-	if decision.ShouldScale {
-		cooldown := config.ScaleUpPolicy.Cooldown
-		if decision.Direction == "down" {
-			cooldown = config.ScaleDownPolicy.Cooldown
-		}
+	target := config.stabilize(currentInstances, bounded)
+	if target == currentInstances {
+		decision.Reason = fmt.Sprintf("Waiting for %d consecutive periods recommending scale %s",
+			max(1, policy.ConsecutivePeriods), decision.Direction)
+		return decision
+	}
 
-		if time.Since(config.LastScaleTime) < cooldown {
-			decision.ShouldScale = false
-			decision.Reason = fmt.Sprintf("Cooldown active (%.0f seconds remaining)",
-				(cooldown - time.Since(config.LastScaleTime)).Seconds())
-			return decision
-		}
+	// Check cooldown period
+	if since := now.Sub(config.LastScaleTime); since < policy.Cooldown {
+		decision.Reason = fmt.Sprintf("Cooldown active (%.0f seconds remaining)", (policy.Cooldown - since).Seconds())
+		return decision
 	}
 
-	// Calculate target instance count
-	if decision.ShouldScale {
-		if decision.Direction == "up" {
-			stepSize := config.ScaleUpPolicy.StepSize
-			if stepSize == 0 {
-				stepSize = max(1, int(float64(currentInstances)*0.5)) // 50% increase
-			}
-			decision.TargetCount = min(currentInstances+stepSize, config.MaxInstances)
-		} else {
-			stepSize := config.ScaleDownPolicy.StepSize
-			if stepSize == 0 {
-				stepSize = max(1, int(float64(currentInstances)*0.25)) // 25% decrease
-			}
-			decision.TargetCount = max(currentInstances-stepSize, config.MinInstances)
+	// Limit the instances added or removed at once
+	limit := stepLimit(policy, currentInstances, share)
+	decision.TargetCount = max(currentInstances-limit, min(target, currentInstances+limit))
+	decision.ShouldScale = true
+	decision.MetricName = driver.Name
+	decision.MetricValue = metrics[driver.Name]
+
+	if decision.Direction == "up" {
+		label, unit := driver.Name, ""
+		switch driver.Name {
+		case MetricCPU:
+			label, unit = "CPU utilization", "%"
+		case MetricMemory:
+			label, unit = "Memory utilization", "%"
 		}
-
-		// Don't scale if already at limit
-		if decision.TargetCount == currentInstances {
-			decision.ShouldScale = false
-			decision.Reason = "Already at scale limit"
+		decision.Reason = fmt.Sprintf("%s %.1f%s > target %.1f%s", label, decision.MetricValue, unit, driver.Target, unit)
+	} else {
+		values := make([]string, 0, len(metrics))
+		for _, target := range config.metricTargets() {
+			if value, exists := metrics[target.Name]; exists {
+				values = append(values, formatMetric(target.Name, value))
+			}
 		}
+		decision.Reason = "Low utilization: " + strings.Join(values, ", ")
 	}
 
 	return decision
@@ -333,10 +709,10 @@ func (as *AutoScaler) executeScale(ctx context.Context, config *AutoScaleConfig,
 
 	as.mu.Lock()
 	config.LastScaleTime = time.Now()
+	config.recommendations = nil
 	config.ScaleHistory = append(config.ScaleHistory, event)
-	// Keep only last 50 events
-	if len(config.ScaleHistory) > 50 {
-		config.ScaleHistory = config.ScaleHistory[len(config.ScaleHistory)-50:]
+	if len(config.ScaleHistory) > maxScaleHistory {
+		config.ScaleHistory = config.ScaleHistory[len(config.ScaleHistory)-maxScaleHistory:]
 	}
 	as.mu.Unlock()
 
@@ -351,7 +727,7 @@ func (as *AutoScaler) GetScaleHistory(appID string) []ScaleEvent {
 	defer as.mu.RUnlock()
 
 	if config, exists := as.applications[appID]; exists {
-		return config.ScaleHistory
+		return append([]ScaleEvent{}, config.ScaleHistory...)
 	}
 	return nil
 }
@@ -363,7 +739,7 @@ func (as *AutoScaler) UpdateConfig(appID string, updates func(*AutoScaleConfig))
 
 	config, exists := as.applications[appID]
 	if !exists {
-		return fmt.Errorf("app %s not registered for autoscaling", appID)
+		return fmt.Errorf("app %s %w", appID, ErrNotAutoScaled)
 	}
 
 	updates(config)
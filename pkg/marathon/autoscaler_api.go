@@ -0,0 +1,206 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// GetApp returns a copy of an app definition with its task counts and the
+// deployments in progress on it, but without its tasks. With the other
+// methods below it makes Marathon the MarathonClient of an AutoScaler or
+// AutoHealer running in process.
+func (m *Marathon) GetApp(appID string) (*Application, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, exists := m.Applications[appID]
+	if !exists || app.Pod != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	snapshot := snapshotApp(app)
+	snapshot.TasksStaged, snapshot.TasksRunning = app.TasksStaged, app.TasksRunning
+	snapshot.TasksHealthy, snapshot.TasksUnhealthy = app.TasksHealthy, app.TasksUnhealthy
+	for _, deployment := range app.Deployments {
+		d := *deployment
+		snapshot.Deployments = append(snapshot.Deployments, &d)
+	}
+	return snapshot, nil
+}
+
+// GetAppTasks returns the tasks of an app. Tasks of apps with health checks
+// are reported healthy or unhealthy.
+func (m *Marathon) GetAppTasks(appID string) ([]Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, exists := m.Applications[appID]
+	if !exists || app.Pod != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	tasks := make([]Task, 0, len(app.Tasks))
+	for _, task := range app.Tasks {
+		t := Task{ID: task.ID, AppID: task.AppID, State: task.State, Host: task.Host}
+		if task.StartedAt != nil {
+			t.StartedAt = *task.StartedAt
+		}
+		if len(app.HealthChecks) > 0 {
+			t.HealthState = "unhealthy"
+			if m.taskHealthy(app, task) {
+				t.HealthState = "healthy"
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// KillTask kills a task of an app. Marathon launches a replacement unless
+// the task belongs to a superseded version of the app.
+func (m *Marathon) KillTask(taskID string) error {
+	return m.killTasks([]string{taskID}, false)
+}
+
+// KillTasks kills several tasks at once, each of them replaced like by
+// KillTask. No task is killed if any of them is unknown.
+func (m *Marathon) KillTasks(taskIDs []string) error {
+	return m.killTasks(taskIDs, false)
+}
+
+// KillTaskAndScale kills a task and lowers the instance count of its app
+// instead of replacing it
+func (m *Marathon) KillTaskAndScale(taskID string) error {
+	return m.killTasks([]string{taskID}, true)
+}
+
+func (m *Marathon) killTasks(taskIDs []string, scale bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	tasks := make(map[string]*MarathonTask, len(taskIDs))
+	for _, taskID := range taskIDs {
+		task, exists := m.Tasks[taskID]
+		if !exists || m.Applications[task.AppID] == nil || !m.appHasTask(m.Applications[task.AppID], taskID) {
+			return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+		tasks[taskID] = task
+	}
+
+	for _, task := range tasks {
+		app := m.Applications[task.AppID]
+		m.killAppTask(app, task)
+		log.Printf("Killed task %s of %s", task.ID, app.ID)
+		if scale {
+			app.Instances = max(app.Instances-1, 0)
+		} else if task.Version == app.Version {
+			m.stageTask(app)
+		}
+		m.updateTaskCounts(app)
+	}
+	return nil
+}
+
+// appHasTask reports whether a task is one of an app's current tasks. The
+// caller must hold m.mu.
+func (m *Marathon) appHasTask(app *Application, taskID string) bool {
+	for _, task := range app.Tasks {
+		if task.ID == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// autoScaler returns the autoscaler served by the HTTP API, answering the
+// request itself when there is none
+func (m *Marathon) autoScaler(w http.ResponseWriter) *AutoScaler {
+	if m.AutoScaler == nil {
+		http.Error(w, "autoscaling is not enabled", http.StatusServiceUnavailable)
+	}
+	return m.AutoScaler
+}
+
+func (m *Marathon) handleListAutoScalers(w http.ResponseWriter, r *http.Request) {
+	scaler := m.autoScaler(w)
+	if scaler == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scaler.ListConfigs())
+}
+
+func (m *Marathon) handleGetAutoScaler(w http.ResponseWriter, r *http.Request) {
+	scaler := m.autoScaler(w)
+	if scaler == nil {
+		return
+	}
+	config, err := scaler.GetConfig(m.appIDFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
+
+func (m *Marathon) handlePutAutoScaler(w http.ResponseWriter, r *http.Request) {
+	scaler := m.autoScaler(w)
+	if scaler == nil {
+		return
+	}
+	appID := m.appIDFromRequest(r)
+	if _, err := m.GetApp(appID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	var config AutoScaleConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	config.AppID = appID
+	if err := scaler.RegisterApp(&config); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	updated, err := scaler.GetConfig(appID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (m *Marathon) handleDeleteAutoScaler(w http.ResponseWriter, r *http.Request) {
+	scaler := m.autoScaler(w)
+	if scaler == nil {
+		return
+	}
+	if err := scaler.UnregisterApp(m.appIDFromRequest(r)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *Marathon) handleGetScaleHistory(w http.ResponseWriter, r *http.Request) {
+	scaler := m.autoScaler(w)
+	if scaler == nil {
+		return
+	}
+	appID := m.appIDFromRequest(r)
+	if _, err := scaler.GetConfig(appID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scaler.GetScaleHistory(appID))
+}
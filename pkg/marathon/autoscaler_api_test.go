@@ -0,0 +1,160 @@
+package marathon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarathon_AutoScalerClient(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 2, CPUs: 0.5}))
+	marathon.monitorTasks()
+
+	app, err := marathon.GetApp("/web")
+	require.NoError(t, err)
+	assert.Equal(t, 2, app.Instances)
+	assert.Equal(t, 2, app.TasksRunning)
+	assert.Empty(t, app.Tasks)
+	assert.Empty(t, app.Deployments)
+
+	tasks, err := marathon.GetAppTasks("/web")
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	for _, task := range tasks {
+		assert.Equal(t, "/web", task.AppID)
+		assert.Equal(t, "TASK_RUNNING", task.State)
+		assert.Empty(t, task.HealthState)
+	}
+
+	_, err = marathon.GetApp("/missing")
+	assert.ErrorIs(t, err, ErrAppNotFound)
+	_, err = marathon.GetAppTasks("/missing")
+	assert.ErrorIs(t, err, ErrAppNotFound)
+
+	// Marathon scales its own apps for an in process autoscaler
+	metrics := &MockMetricsProvider{}
+	metrics.On("GetCPUUtilization", "/web").Return(140.0, nil)
+	scaler := NewAutoScaler(marathon, metrics)
+	config := &AutoScaleConfig{AppID: "/web", MinInstances: 1, MaxInstances: 10, ScaleUpPolicy: ScalePolicy{ConsecutivePeriods: 1, StepSize: 5}}
+	require.NoError(t, scaler.RegisterApp(config))
+	require.NoError(t, scaler.evaluateApp(context.Background(), config))
+
+	app, err = marathon.GetApp("/web")
+	require.NoError(t, err)
+	assert.Equal(t, 4, app.Instances)
+	require.Len(t, app.Deployments, 1)
+	assert.Equal(t, marathon.Applications["/web"].Deployments[0].ID, app.Deployments[0].ID)
+}
+
+func TestMarathon_HandleAutoScaler(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 2, CPUs: 0.5}))
+	router := marathon.setupRoutes()
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, &buf))
+		return w
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, do("GET", "/v2/apps/web/autoscaler", nil).Code)
+	marathon.AutoScaler = NewAutoScaler(marathon, &MockMetricsProvider{})
+
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v2/apps/web/autoscaler", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("PUT", "/v2/apps/missing/autoscaler", json.RawMessage(`{"minInstances": 1, "maxInstances": 2}`)).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, do("PUT", "/v2/apps/web/autoscaler", json.RawMessage(`{"minInstances": 3, "maxInstances": 2}`)).Code)
+
+	// Configs are enabled unless disabled explicitly
+	w := do("PUT", "/v2/apps/web/autoscaler", json.RawMessage(`{
+		"minInstances": 2, "maxInstances": 10, "targetCpuPercent": 60,
+		"metrics": [{"name": "requests", "target": 100}],
+		"schedules": [{"name": "business-hours", "cron": "0 8 * * 1-5", "durationSeconds": 36000, "minInstances": 5}],
+		"scaleUpPolicy": {"consecutivePeriods": 1, "cooldownSeconds": 60, "stepPercentage": 100}}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var config AutoScaleConfig
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&config))
+	assert.Equal(t, "/web", config.AppID)
+	assert.True(t, config.Enabled)
+	assert.Equal(t, time.Minute, config.ScaleUpPolicy.Cooldown)
+	assert.Equal(t, 5*time.Minute, config.ScaleDownPolicy.Cooldown)
+	assert.Equal(t, []MetricTarget{{Name: "requests", Target: 100}}, config.Metrics)
+	assert.Equal(t, 5, config.Schedules[0].MinInstances)
+
+	w = do("GET", "/v2/apps/web/autoscaler", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cooldownSeconds":60`)
+
+	var configs []*AutoScaleConfig
+	require.NoError(t, json.NewDecoder(do("GET", "/v2/autoscaler", nil).Body).Decode(&configs))
+	require.Len(t, configs, 1)
+
+	marathon.AutoScaler.applications["/web"].ScaleHistory = []ScaleEvent{{FromInstances: 2, ToInstances: 4, Reason: "CPU utilization 90.0% > target 60.0%", Metric: MetricCPU, MetricValue: 90}}
+	var history []ScaleEvent
+	w = do("GET", "/v2/apps/web/autoscaler/history", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&history))
+	require.Len(t, history, 1)
+	assert.Equal(t, 4, history[0].ToInstances)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", "/v2/apps/web/autoscaler", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/v2/apps/web/autoscaler", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v2/apps/web/autoscaler/history", nil).Code)
+
+	// The app itself is still served
+	assert.Equal(t, http.StatusOK, do("GET", "/v2/apps/web", nil).Code)
+}
+
+func TestMarathon_KillTasks(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 3}))
+	marathon.monitorTasks()
+
+	taskIDs := func() []string {
+		tasks, err := marathon.GetAppTasks("/web")
+		require.NoError(t, err)
+		ids := make([]string, 0, len(tasks))
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+	initial := taskIDs()
+	require.Len(t, initial, 3)
+
+	// Killed tasks are replaced
+	require.NoError(t, marathon.KillTask(initial[0]))
+	current := taskIDs()
+	assert.Len(t, current, 3)
+	assert.NotContains(t, current, initial[0])
+	assert.NotContains(t, marathon.Tasks, initial[0])
+
+	// Nothing is killed if a task is unknown
+	assert.ErrorIs(t, marathon.KillTasks([]string{initial[1], "missing"}), ErrTaskNotFound)
+	assert.Contains(t, taskIDs(), initial[1])
+	assert.ErrorIs(t, marathon.KillTask(initial[0]), ErrTaskNotFound)
+
+	require.NoError(t, marathon.KillTasks(initial[1:]))
+	current = taskIDs()
+	assert.Len(t, current, 3)
+	assert.NotContains(t, current, initial[1])
+	assert.NotContains(t, current, initial[2])
+
+	// Killing and scaling shrinks the app instead
+	require.NoError(t, marathon.KillTaskAndScale(current[0]))
+	app, err := marathon.GetApp("/web")
+	require.NoError(t, err)
+	assert.Equal(t, 2, app.Instances)
+	assert.Len(t, taskIDs(), 2)
+}
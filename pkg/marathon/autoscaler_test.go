@@ -31,6 +31,21 @@ func (m *MockMarathonClientForAutoScaler) GetAppTasks(appID string) ([]Task, err
 	return args.Get(0).([]Task), args.Error(1)
 }
 
+func (m *MockMarathonClientForAutoScaler) KillTask(taskID string) error {
+	args := m.Called(taskID)
+	return args.Error(0)
+}
+
+func (m *MockMarathonClientForAutoScaler) KillTasks(taskIDs []string) error {
+	args := m.Called(taskIDs)
+	return args.Error(0)
+}
+
+func (m *MockMarathonClientForAutoScaler) KillTaskAndScale(taskID string) error {
+	args := m.Called(taskID)
+	return args.Error(0)
+}
+
 // MockMetricsProvider is a mock implementation of MetricsProvider
 type MockMetricsProvider struct {
 	mock.Mock
@@ -401,6 +416,7 @@ func TestAutoScaler_evaluateApp(t *testing.T) {
 			config: &AutoScaleConfig{
 				AppID:            "test-app",
 				TargetCPUPercent: 70.0, // Set proper target to prevent scaling
+				TargetMemPercent: 80.0,
 			},
 			app: &Application{
 				ID:        "test-app",
@@ -431,9 +447,10 @@ func TestAutoScaler_evaluateApp(t *testing.T) {
 					mockMetrics.On("GetCPUUtilization", tt.config.AppID).Return(tt.cpuUtil, nil)
 				}
 
-				if tt.memMetricsError != nil {
+				// Memory is only read when it has a target
+				if tt.config.TargetMemPercent > 0 && tt.memMetricsError != nil {
 					mockMetrics.On("GetMemoryUtilization", tt.config.AppID).Return(float64(0), tt.memMetricsError)
-				} else {
+				} else if tt.config.TargetMemPercent > 0 {
 					mockMetrics.On("GetMemoryUtilization", tt.config.AppID).Return(tt.memUtil, nil)
 				}
 			}
@@ -593,7 +610,7 @@ func TestAutoScaler_makeScalingDecision(t *testing.T) {
 			mockMetrics := &MockMetricsProvider{}
 			scaler := NewAutoScaler(mockClient, mockMetrics)
 
-			decision := scaler.makeScalingDecision(tt.config, tt.app, tt.cpuUtil, tt.memUtil)
+			decision := scaler.makeScalingDecision(tt.config, tt.app, map[string]float64{MetricCPU: tt.cpuUtil, MetricMemory: tt.memUtil}, time.Now())
 
 			assert.Equal(t, tt.expectedScale, decision.ShouldScale)
 			if tt.expectedScale {
@@ -836,7 +853,7 @@ func TestAutoScaler_EdgeCases(t *testing.T) {
 		assert.NoError(t, err)
 
 		app := &Application{Instances: 3}
-		decision := scaler.makeScalingDecision(config, app, 50.0, 90.0) // High memory but target is 0
+		decision := scaler.makeScalingDecision(config, app, map[string]float64{MetricCPU: 50.0, MetricMemory: 90.0}, time.Now()) // High memory but target is 0
 		assert.False(t, decision.ShouldScale)
 	})
 
@@ -860,13 +877,13 @@ func TestAutoScaler_EdgeCases(t *testing.T) {
 		app := &Application{Instances: 5}
 
 		// Test scale up with custom step size
-		decision := scaler.makeScalingDecision(config, app, 85.0, 60.0)
+		decision := scaler.makeScalingDecision(config, app, map[string]float64{MetricCPU: 85.0, MetricMemory: 60.0}, time.Now())
 		assert.True(t, decision.ShouldScale)
 		assert.Equal(t, "up", decision.Direction)
-		assert.Equal(t, 8, decision.TargetCount) // 5 + 3
+		assert.Equal(t, 7, decision.TargetCount) // ceil(5 × 85/70), within 5 + 3
 
 		// Test scale down with custom step size
-		decision = scaler.makeScalingDecision(config, app, 30.0, 35.0)
+		decision = scaler.makeScalingDecision(config, app, map[string]float64{MetricCPU: 30.0, MetricMemory: 35.0}, time.Now())
 		assert.True(t, decision.ShouldScale)
 		assert.Equal(t, "down", decision.Direction)
 		assert.Equal(t, 3, decision.TargetCount) // 5 - 2
@@ -886,3 +903,246 @@ func TestHelperFunctions(t *testing.T) {
 		assert.Equal(t, 3, min(3, 3))
 	})
 }
+
+func TestAutoScaler_TargetTracking(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *AutoScaleConfig
+		instances int
+		metrics   map[string]float64
+		scale     bool
+		target    int
+		metric    string
+	}{
+		{
+			name:      "proportional scale up",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50, ScaleUpPolicy: ScalePolicy{StepPercentage: 100}},
+			instances: 4,
+			metrics:   map[string]float64{MetricCPU: 90},
+			scale:     true,
+			target:    8, // ceil(4 × 90/50)
+			metric:    MetricCPU,
+		},
+		{
+			name: "largest recommendation wins",
+			config: &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50, TargetMemPercent: 50,
+				Metrics: []MetricTarget{{Name: "requests", Target: 100}}, ScaleUpPolicy: ScalePolicy{StepSize: 10}},
+			instances: 4,
+			metrics:   map[string]float64{MetricCPU: 60, MetricMemory: 40, "requests": 250},
+			scale:     true,
+			target:    10, // ceil(4 × 250/100)
+			metric:    "requests",
+		},
+		{
+			name:      "within threshold",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50, ScaleUpPolicy: ScalePolicy{Threshold: 10}},
+			instances: 4,
+			metrics:   map[string]float64{MetricCPU: 54},
+		},
+		{
+			name:      "proportional scale down",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50, ScaleDownPolicy: ScalePolicy{StepPercentage: 50}},
+			instances: 8,
+			metrics:   map[string]float64{MetricCPU: 30},
+			scale:     true,
+			target:    5, // ceil(8 × 30/50)
+			metric:    MetricCPU,
+		},
+		{
+			name:      "step limit",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50},
+			instances: 8,
+			metrics:   map[string]float64{MetricCPU: 10},
+			scale:     true,
+			target:    6, // 25% of 8 removed at most
+			metric:    MetricCPU,
+		},
+		{
+			name:      "missing metric prevents scale down",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50, TargetMemPercent: 50},
+			instances: 8,
+			metrics:   map[string]float64{MetricCPU: 10},
+		},
+		{
+			name:      "missing metric allows scale up",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20, TargetCPUPercent: 50, TargetMemPercent: 50},
+			instances: 2,
+			metrics:   map[string]float64{MetricMemory: 100},
+			scale:     true,
+			target:    3,
+			metric:    MetricMemory,
+		},
+		{
+			name:      "no metrics",
+			config:    &AutoScaleConfig{MinInstances: 1, MaxInstances: 20},
+			instances: 2,
+			metrics:   map[string]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scaler := NewAutoScaler(&MockMarathonClientForAutoScaler{}, &MockMetricsProvider{})
+			decision := scaler.makeScalingDecision(tt.config, &Application{Instances: tt.instances}, tt.metrics, time.Now())
+
+			assert.Equal(t, tt.scale, decision.ShouldScale, decision.Reason)
+			if tt.scale {
+				assert.Equal(t, tt.target, decision.TargetCount)
+				assert.Equal(t, tt.metric, decision.MetricName)
+				assert.Equal(t, tt.metrics[tt.metric], decision.MetricValue)
+			}
+		})
+	}
+}
+
+func TestAutoScaler_Stabilization(t *testing.T) {
+	scaler := NewAutoScaler(&MockMarathonClientForAutoScaler{}, &MockMetricsProvider{})
+	config := &AutoScaleConfig{
+		MinInstances:     1,
+		MaxInstances:     20,
+		TargetCPUPercent: 50,
+		ScaleUpPolicy:    ScalePolicy{ConsecutivePeriods: 2, StepSize: 10},
+		ScaleDownPolicy:  ScalePolicy{ConsecutivePeriods: 3, StepSize: 10},
+	}
+	app := &Application{Instances: 4}
+	decide := func(cpu float64) ScalingDecision {
+		return scaler.makeScalingDecision(config, app, map[string]float64{MetricCPU: cpu}, time.Now())
+	}
+
+	// Scale up after two periods, to the smaller recommendation
+	decision := decide(100)
+	assert.False(t, decision.ShouldScale)
+	assert.Contains(t, decision.Reason, "Waiting for 2 consecutive periods recommending scale up")
+	decision = decide(75)
+	assert.True(t, decision.ShouldScale)
+	assert.Equal(t, 6, decision.TargetCount)
+
+	// A period at target restarts the count
+	config.recommendations = nil
+	assert.False(t, decide(100).ShouldScale)
+	assert.False(t, decide(50).ShouldScale)
+	assert.False(t, decide(100).ShouldScale)
+
+	// Scale down after three periods, to the largest recommendation
+	config.recommendations = nil
+	assert.False(t, decide(25).ShouldScale)
+	assert.False(t, decide(37).ShouldScale)
+	decision = decide(12)
+	assert.True(t, decision.ShouldScale)
+	assert.Equal(t, "down", decision.Direction)
+	assert.Equal(t, 3, decision.TargetCount)
+}
+
+func TestAutoScaler_ScheduledScaling(t *testing.T) {
+	config := &AutoScaleConfig{
+		MinInstances:     2,
+		MaxInstances:     8,
+		TargetCPUPercent: 50,
+		Schedules: []*ScheduledScaling{
+			{Name: "business-hours", Cron: "0 8 * * 1-5", DurationSeconds: 10 * 3600, MinInstances: 10},
+			{Name: "maintenance", Cron: "0 2 * * *", TimeZone: "America/New_York", DurationSeconds: 3600, MaxInstances: 3},
+		},
+	}
+	wednesday := func(hour, minute int) time.Time { return time.Date(2026, 10, 14, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		instances int
+		metrics   map[string]float64
+		scale     bool
+		target    int
+	}{
+		{"raises minimum during business hours", wednesday(9, 30), 4, map[string]float64{MetricCPU: 50}, true, 10},
+		{"applies without metrics", wednesday(8, 0), 4, map[string]float64{}, true, 10},
+		{"holds minimum against low load", wednesday(17, 59), 10, map[string]float64{MetricCPU: 5}, false, 0},
+		{"ends after its duration", wednesday(18, 0), 10, map[string]float64{MetricCPU: 5}, true, 8},
+		{"skips weekends", time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC), 4, map[string]float64{MetricCPU: 50}, false, 0},
+		{"lowers maximum in its time zone", wednesday(6, 30), 4, map[string]float64{MetricCPU: 90}, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scaler := NewAutoScaler(&MockMarathonClientForAutoScaler{}, &MockMetricsProvider{})
+			decision := scaler.makeScalingDecision(config, &Application{Instances: tt.instances}, tt.metrics, tt.now)
+			assert.Equal(t, tt.scale, decision.ShouldScale, decision.Reason)
+			if tt.scale {
+				assert.Equal(t, tt.target, decision.TargetCount)
+			}
+		})
+	}
+}
+
+func TestAutoScaler_evaluateAppCustomMetric(t *testing.T) {
+	mockClient := &MockMarathonClientForAutoScaler{}
+	mockMetrics := &MockMetricsProvider{}
+	scaler := NewAutoScaler(mockClient, mockMetrics)
+	config := &AutoScaleConfig{
+		AppID:        "test-app",
+		MinInstances: 1,
+		MaxInstances: 10,
+		Metrics:      []MetricTarget{{Name: "queue-depth", Target: 20}},
+	}
+
+	mockClient.On("GetApp", "test-app").Return(&Application{ID: "test-app", Instances: 2}, nil)
+	mockMetrics.On("GetCPUUtilization", "test-app").Return(float64(0), errors.New("metrics unavailable"))
+	mockMetrics.On("GetCustomMetric", "test-app", "queue-depth").Return(30.0, nil)
+	mockClient.On("ScaleApp", "test-app", 3).Return(nil)
+
+	assert.NoError(t, scaler.evaluateApp(context.Background(), config))
+	mockClient.AssertExpectations(t)
+	mockMetrics.AssertExpectations(t)
+	assert.Equal(t, "queue-depth", config.ScaleHistory[0].Metric)
+	assert.Equal(t, "queue-depth 30.0 > target 20.0", config.ScaleHistory[0].Reason)
+}
+
+func TestAutoScaler_RegisterAppValidation(t *testing.T) {
+	valid := func() *AutoScaleConfig {
+		return &AutoScaleConfig{AppID: "test-app", MinInstances: 1, MaxInstances: 5}
+	}
+	tests := []struct {
+		name   string
+		modify func(*AutoScaleConfig)
+		err    string
+	}{
+		{"duplicate metric", func(c *AutoScaleConfig) { c.Metrics = []MetricTarget{{Name: "rps", Target: 1}, {Name: "rps", Target: 2}} }, "metric rps is tracked more than once"},
+		{"built-in metric", func(c *AutoScaleConfig) { c.Metrics = []MetricTarget{{Name: MetricCPU, Target: 50}} }, "metric cpu is tracked more than once"},
+		{"metric without target", func(c *AutoScaleConfig) { c.Metrics = []MetricTarget{{Name: "rps"}} }, "target of metric rps must be positive"},
+		{"negative policy", func(c *AutoScaleConfig) { c.ScaleDownPolicy.Threshold = -1 }, "scaleDownPolicy values must not be negative"},
+		{"bad cron", func(c *AutoScaleConfig) {
+			c.Schedules = []*ScheduledScaling{{Name: "peak", Cron: "0 8 * *", DurationSeconds: 60}}
+		}, "schedule peak: expected 5 fields"},
+		{"bad time zone", func(c *AutoScaleConfig) {
+			c.Schedules = []*ScheduledScaling{{Name: "peak", Cron: "@daily", TimeZone: "Mars/Olympus", DurationSeconds: 60}}
+		}, "schedule peak"},
+		{"no duration", func(c *AutoScaleConfig) { c.Schedules = []*ScheduledScaling{{Name: "peak", Cron: "@daily"}} }, "durationSeconds must be positive"},
+		{"inverted bounds", func(c *AutoScaleConfig) {
+			c.Schedules = []*ScheduledScaling{{Name: "peak", Cron: "@daily", DurationSeconds: 60, MinInstances: 5, MaxInstances: 2}}
+		}, "schedule peak: maxInstances must be >= minInstances"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid()
+			tt.modify(config)
+			err := NewAutoScaler(&MockMarathonClientForAutoScaler{}, &MockMetricsProvider{}).RegisterApp(config)
+			assert.ErrorIs(t, err, ErrInvalidAutoScaleConfig)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestAutoScaler_ReregisterKeepsHistory(t *testing.T) {
+	scaler := NewAutoScaler(&MockMarathonClientForAutoScaler{}, &MockMetricsProvider{})
+	assert.NoError(t, scaler.RegisterApp(&AutoScaleConfig{AppID: "test-app", MinInstances: 1, MaxInstances: 5}))
+	scaler.applications["test-app"].ScaleHistory = []ScaleEvent{{Reason: "earlier"}}
+
+	assert.NoError(t, scaler.RegisterApp(&AutoScaleConfig{AppID: "test-app", MinInstances: 2, MaxInstances: 6}))
+	config, err := scaler.GetConfig("test-app")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, config.MinInstances)
+	assert.Equal(t, []ScaleEvent{{Reason: "earlier"}}, scaler.GetScaleHistory("test-app"))
+
+	assert.NoError(t, scaler.UnregisterApp("test-app"))
+	_, err = scaler.GetConfig("test-app")
+	assert.ErrorIs(t, err, ErrNotAutoScaled)
+	assert.ErrorIs(t, scaler.UnregisterApp("test-app"), ErrNotAutoScaled)
+}
@@ -0,0 +1,250 @@
+package marathon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ErrCanaryAnalysisFailed is returned when a canary stage fails its metric
+// analysis; the update is then rolled back
+var ErrCanaryAnalysisFailed = errors.New("canary analysis failed")
+
+// AnalysisVerdict is the outcome of analyzing a metric or a canary stage
+type AnalysisVerdict string
+
+const (
+	VerdictPass         AnalysisVerdict = "pass"
+	VerdictFail         AnalysisVerdict = "fail"
+	VerdictInconclusive AnalysisVerdict = "inconclusive"
+)
+
+// Thresholds of the default canary metrics
+const (
+	defaultCanarySuccessRate = 0.99
+	defaultCanaryLatencyP99  = 0.5 // seconds
+	defaultCanaryMaxErrors   = 10
+)
+
+// MetricTemplate describes a metric evaluated for the canary and the
+// baseline. Query is a text/template executed with the fields AppID,
+// Version and Interval, the analysis interval as a Prometheus range.
+type MetricTemplate struct {
+	Name           string
+	Query          string
+	Threshold      float64
+	HigherIsBetter bool
+	// InconclusiveMargin widens the threshold into a band in which the
+	// result is inconclusive rather than failed
+	InconclusiveMargin float64
+	// MaxBaselineDeviation fails the canary when it is worse than the
+	// baseline by more than this fraction of the baseline; zero disables
+	// the comparison
+	MaxBaselineDeviation float64
+}
+
+// MetricResult is the analysis of one metric in a canary stage
+type MetricResult struct {
+	Name     string
+	Canary   *float64
+	Baseline *float64
+	Verdict  AnalysisVerdict
+	Message  string
+}
+
+// CanaryStageResult records the analysis of a canary stage. A stage fails
+// when any metric fails and is inconclusive when any metric is.
+type CanaryStageResult struct {
+	Stage     string
+	Timestamp time.Time
+	Verdict   AnalysisVerdict
+	Metrics   []*MetricResult
+}
+
+// canaryQueryData is the data metric query templates are executed with
+type canaryQueryData struct {
+	AppID    string
+	Version  string
+	Interval string
+}
+
+// DefaultCanaryMetrics returns the success rate, p99 latency and error
+// count templates used when a canary config names no metrics. They expect
+// request metrics labeled with the app ID and version.
+func DefaultCanaryMetrics(successThreshold float64) []MetricTemplate {
+	if successThreshold == 0 {
+		successThreshold = defaultCanarySuccessRate
+	}
+	selector := `app="{{.AppID}}",version="{{.Version}}"`
+	return []MetricTemplate{
+		{
+			Name: "success-rate",
+			Query: `sum(rate(http_requests_total{` + selector + `,code!~"5.."}[{{.Interval}}])) / ` +
+				`sum(rate(http_requests_total{` + selector + `}[{{.Interval}}]))`,
+			Threshold:            successThreshold,
+			HigherIsBetter:       true,
+			MaxBaselineDeviation: 0.01,
+		},
+		{
+			Name:                 "latency-p99",
+			Query:                `histogram_quantile(0.99, sum by (le) (rate(http_request_duration_seconds_bucket{` + selector + `}[{{.Interval}}])))`,
+			Threshold:            defaultCanaryLatencyP99,
+			MaxBaselineDeviation: 0.2,
+		},
+		{
+			Name:      "error-count",
+			Query:     `sum(increase(http_requests_total{` + selector + `,code=~"5.."}[{{.Interval}}]))`,
+			Threshold: defaultCanaryMaxErrors,
+		},
+	}
+}
+
+// canaryMetrics returns the metrics analyzed for a canary config. A bare
+// MetricsQuery is analyzed as the success rate.
+func canaryMetrics(config *CanaryConfig) []MetricTemplate {
+	switch {
+	case len(config.Metrics) > 0:
+		return config.Metrics
+	case config.MetricsQuery != "":
+		threshold := config.SuccessThreshold
+		if threshold == 0 {
+			threshold = defaultCanarySuccessRate
+		}
+		return []MetricTemplate{{Name: "success-rate", Query: config.MetricsQuery, Threshold: threshold, HigherIsBetter: true}}
+	}
+	return DefaultCanaryMetrics(config.SuccessThreshold)
+}
+
+// renderQuery executes a metric query template
+func renderQuery(query string, data canaryQueryData) (string, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// evaluateMetric judges a canary value against the template's threshold
+// and the baseline value
+func evaluateMetric(tmpl MetricTemplate, canary, baseline *float64) (AnalysisVerdict, string) {
+	if canary == nil {
+		return VerdictInconclusive, "no data for the canary"
+	}
+	worse := func(a, b float64) bool {
+		if tmpl.HigherIsBetter {
+			return a < b
+		}
+		return a > b
+	}
+
+	if worse(*canary, tmpl.Threshold) {
+		limit := tmpl.Threshold + tmpl.InconclusiveMargin
+		if tmpl.HigherIsBetter {
+			limit = tmpl.Threshold - tmpl.InconclusiveMargin
+		}
+		if tmpl.InconclusiveMargin > 0 && !worse(*canary, limit) {
+			return VerdictInconclusive, fmt.Sprintf("%g is within %g of threshold %g", *canary, tmpl.InconclusiveMargin, tmpl.Threshold)
+		}
+		return VerdictFail, fmt.Sprintf("%g misses threshold %g", *canary, tmpl.Threshold)
+	}
+
+	if tmpl.MaxBaselineDeviation > 0 && baseline != nil {
+		limit := *baseline * (1 + tmpl.MaxBaselineDeviation)
+		if tmpl.HigherIsBetter {
+			limit = *baseline * (1 - tmpl.MaxBaselineDeviation)
+		}
+		if worse(*canary, limit) {
+			return VerdictFail, fmt.Sprintf("%g deviates more than %g%% from baseline %g", *canary, tmpl.MaxBaselineDeviation*100, *baseline)
+		}
+	}
+	return VerdictPass, ""
+}
+
+// SetMetricsQuerier sets the metrics backend canary stages are analyzed
+// against. Without one, canary stages pass unanalyzed.
+func (ru *RollingUpdater) SetMetricsQuerier(querier MetricsQuerier) {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	ru.querier = querier
+}
+
+// GetCanaryResults returns the stage analyses of an app's latest canary
+// update, oldest first
+func (ru *RollingUpdater) GetCanaryResults(appID string) []*CanaryStageResult {
+	ru.mu.RLock()
+	defer ru.mu.RUnlock()
+	return append([]*CanaryStageResult(nil), ru.canaryResults[appID]...)
+}
+
+// analyzeCanaryMetrics evaluates the canary's metrics against the baseline
+// of the old version over the analysis interval and records the result
+func (ru *RollingUpdater) analyzeCanaryMetrics(ctx context.Context, config *UpdateConfig, state *UpdateState, stage CanaryStage) *CanaryStageResult {
+	ru.mu.RLock()
+	querier := ru.querier
+	ru.mu.RUnlock()
+
+	result := &CanaryStageResult{Stage: stage.Name, Timestamp: time.Now(), Verdict: VerdictPass, Metrics: make([]*MetricResult, 0)}
+	if querier == nil {
+		log.Printf("No metrics source configured, canary stage '%s' passes unanalyzed", stage.Name)
+	} else {
+		interval := promDuration(config.CanaryConfig.AnalysisInterval)
+		query := func(tmpl MetricTemplate, version string) (*float64, error) {
+			q, err := renderQuery(tmpl.Query, canaryQueryData{AppID: config.AppID, Version: version, Interval: interval})
+			if err != nil {
+				return nil, err
+			}
+			value, ok, err := querier.Query(ctx, q, result.Timestamp)
+			if err != nil || !ok {
+				return nil, err
+			}
+			return &value, nil
+		}
+
+		for _, tmpl := range canaryMetrics(config.CanaryConfig) {
+			metric := &MetricResult{Name: tmpl.Name}
+			canary, err := query(tmpl, state.NewVersion)
+			if err == nil {
+				metric.Canary = canary
+				metric.Baseline, err = query(tmpl, state.OldVersion)
+			}
+			if err != nil {
+				metric.Verdict, metric.Message = VerdictInconclusive, err.Error()
+			} else {
+				metric.Verdict, metric.Message = evaluateMetric(tmpl, metric.Canary, metric.Baseline)
+			}
+			result.Metrics = append(result.Metrics, metric)
+
+			switch {
+			case metric.Verdict == VerdictFail:
+				result.Verdict = VerdictFail
+			case metric.Verdict == VerdictInconclusive && result.Verdict == VerdictPass:
+				result.Verdict = VerdictInconclusive
+			}
+		}
+		log.Printf("Canary stage '%s' of app %s analyzed: %s", stage.Name, config.AppID, result.Verdict)
+	}
+
+	ru.mu.Lock()
+	ru.canaryResults[config.AppID] = append(ru.canaryResults[config.AppID], result)
+	ru.mu.Unlock()
+	return result
+}
+
+// summary describes the metrics of a stage result that did not pass
+func (r *CanaryStageResult) summary() string {
+	parts := make([]string, 0)
+	for _, metric := range r.Metrics {
+		if metric.Verdict != VerdictPass {
+			parts = append(parts, fmt.Sprintf("%s %s: %s", metric.Name, metric.Verdict, metric.Message))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,186 @@
+package marathon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateMetric(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	successRate := MetricTemplate{Threshold: 0.99, HigherIsBetter: true, InconclusiveMargin: 0.01, MaxBaselineDeviation: 0.01}
+	latency := MetricTemplate{Threshold: 0.5, MaxBaselineDeviation: 0.2}
+
+	tests := []struct {
+		name     string
+		tmpl     MetricTemplate
+		canary   *float64
+		baseline *float64
+		want     AnalysisVerdict
+	}{
+		{"meets threshold", successRate, value(0.995), value(0.996), VerdictPass},
+		{"no baseline", successRate, value(0.995), nil, VerdictPass},
+		{"no canary data", successRate, nil, value(0.996), VerdictInconclusive},
+		{"within inconclusive margin", successRate, value(0.985), value(0.996), VerdictInconclusive},
+		{"misses threshold", successRate, value(0.97), value(0.996), VerdictFail},
+		{"worse than baseline", MetricTemplate{Threshold: 0.9, HigherIsBetter: true, MaxBaselineDeviation: 0.01}, value(0.95), value(0.99), VerdictFail},
+		{"lower is better", latency, value(0.3), value(0.28), VerdictPass},
+		{"lower misses threshold", latency, value(0.6), value(0.28), VerdictFail},
+		{"lower worse than baseline", latency, value(0.4), value(0.3), VerdictFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, _ := evaluateMetric(tt.tmpl, tt.canary, tt.baseline)
+			assert.Equal(t, tt.want, verdict)
+		})
+	}
+}
+
+func TestCanaryMetrics(t *testing.T) {
+	defaults := canaryMetrics(&CanaryConfig{SuccessThreshold: 0.95})
+	require.Len(t, defaults, 3)
+	assert.Equal(t, []string{"success-rate", "latency-p99", "error-count"}, []string{defaults[0].Name, defaults[1].Name, defaults[2].Name})
+	assert.Equal(t, 0.95, defaults[0].Threshold)
+
+	legacy := canaryMetrics(&CanaryConfig{MetricsQuery: "success_rate"})
+	assert.Equal(t, []MetricTemplate{{Name: "success-rate", Query: "success_rate", Threshold: 0.99, HigherIsBetter: true}}, legacy)
+
+	custom := []MetricTemplate{{Name: "saturation", Query: "q"}}
+	assert.Equal(t, custom, canaryMetrics(&CanaryConfig{Metrics: custom, MetricsQuery: "ignored"}))
+
+	query, err := renderQuery(defaults[2].Query, canaryQueryData{AppID: "/web", Version: "v2", Interval: "30s"})
+	require.NoError(t, err)
+	assert.Equal(t, `sum(increase(http_requests_total{app="/web",version="v2",code=~"5.."}[30s]))`, query)
+	_, err = renderQuery("{{.Missing}}", canaryQueryData{})
+	assert.Error(t, err)
+}
+
+// startCanary runs a two stage canary update of a four instance app whose
+// success rate is analyzed against fake Prometheus; setup receives the old
+// and new version before the first analysis
+func startCanary(t *testing.T, setup func(fake *fakePrometheus, oldVersion, newVersion string)) (*Marathon, *RollingUpdater, *UpdateState) {
+	app := &Application{ID: "/canary-app", Instances: 4, CPUs: 0.5,
+		Container: &Container{Type: "DOCKER", Docker: &DockerSpec{Image: "myapp:v1"}}}
+	marathon, updater, _ := newTestUpdater(t, app, true)
+	fake := newFakePrometheus(t)
+	updater.SetMetricsQuerier(NewPrometheusClient(fake.URL))
+
+	config := &UpdateConfig{
+		AppID:    "/canary-app",
+		Strategy: CanaryUpdate,
+		NewImage: "myapp:v2",
+		CanaryConfig: &CanaryConfig{
+			Stages:           []CanaryStage{{Name: "stage-1", Weight: 25}, {Name: "stage-2", Weight: 50}},
+			AnalysisInterval: 20 * time.Millisecond,
+			Metrics: []MetricTemplate{{
+				Name:                 "success-rate",
+				Query:                `success_rate{app="{{.AppID}}",version="{{.Version}}"}[{{.Interval}}]`,
+				Threshold:            0.99,
+				HigherIsBetter:       true,
+				MaxBaselineDeviation: 0.01,
+			}},
+		},
+	}
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	state := updater.GetUpdateState("/canary-app")
+	setup(fake, state.OldVersion, state.NewVersion)
+	return marathon, updater, state
+}
+
+// successRateQuery is the success rate query of startCanary for a version
+func successRateQuery(version string) string {
+	return `success_rate{app="/canary-app",version="` + version + `"}[1s]`
+}
+
+func TestCanaryUpdate_AnalysisPasses(t *testing.T) {
+	marathon, updater, state := startCanary(t, func(fake *fakePrometheus, oldVersion, newVersion string) {
+		fake.set(successRateQuery(oldVersion), "0.996")
+		fake.set(successRateQuery(newVersion), "0.995")
+	})
+	waitForUpdate(t, updater, "/canary-app")
+
+	assert.Equal(t, map[string]int{state.NewVersion: 4}, appTaskVersions(marathon, "/canary-app"))
+	results := updater.GetCanaryResults("/canary-app")
+	require.Len(t, results, 2)
+	for i, result := range results {
+		assert.Equal(t, []string{"stage-1", "stage-2"}[i], result.Stage)
+		assert.Equal(t, VerdictPass, result.Verdict)
+		require.Len(t, result.Metrics, 1)
+		assert.Equal(t, 0.995, *result.Metrics[0].Canary)
+		assert.Equal(t, 0.996, *result.Metrics[0].Baseline)
+	}
+}
+
+func TestCanaryUpdate_AnalysisFailsAndRollsBack(t *testing.T) {
+	marathon, updater, _ := startCanary(t, func(fake *fakePrometheus, oldVersion, newVersion string) {
+		fake.set(successRateQuery(oldVersion), "0.996")
+		fake.set(successRateQuery(newVersion), "0.95")
+	})
+	waitForUpdate(t, updater, "/canary-app")
+
+	results := updater.GetCanaryResults("/canary-app")
+	require.Len(t, results, 1)
+	assert.Equal(t, VerdictFail, results[0].Verdict)
+	assert.Contains(t, results[0].Metrics[0].Message, "misses threshold 0.99")
+
+	history := updater.GetAppUpdateHistory("/canary-app")
+	assert.Equal(t, []string{"update-failed", "rollback-completed"}, updateActions(updater, "/canary-app"))
+	assert.Contains(t, history[0].Message, ErrCanaryAnalysisFailed.Error())
+
+	// The rollback deployment restores the old image on all tasks
+	require.Eventually(t, func() bool {
+		marathon.mu.RLock()
+		defer marathon.mu.RUnlock()
+		return len(marathon.Deployments) == 0
+	}, 5*time.Second, time.Millisecond)
+	marathon.mu.RLock()
+	defer marathon.mu.RUnlock()
+	app := marathon.Applications["/canary-app"]
+	assert.Equal(t, "myapp:v1", app.Container.Docker.Image)
+	for _, task := range app.Tasks {
+		assert.Equal(t, app.Version, task.Version)
+	}
+}
+
+func TestCanaryUpdate_InconclusiveWaitsForDecision(t *testing.T) {
+	marathon, updater, _ := startCanary(t, func(fake *fakePrometheus, oldVersion, newVersion string) {
+		fake.set(successRateQuery(oldVersion), "0.996")
+	})
+
+	// Without canary data the update waits for a decision
+	state := waitForStatus(t, updater, "/canary-app", UpdatePaused)
+	assert.Equal(t, "stage-1", state.CurrentStage)
+	results := updater.GetCanaryResults("/canary-app")
+	require.Len(t, results, 1)
+	assert.Equal(t, VerdictInconclusive, results[0].Verdict)
+	assert.Contains(t, updateActions(updater, "/canary-app"), "analysis-inconclusive")
+
+	require.NoError(t, updater.AbortUpdate("/canary-app"))
+	waitForUpdate(t, updater, "/canary-app")
+	assert.Equal(t, []string{"analysis-inconclusive", "update-failed", "rollback-completed"}, updateActions(updater, "/canary-app"))
+	assert.Error(t, updater.AbortUpdate("/canary-app"))
+
+	marathon.mu.RLock()
+	defer marathon.mu.RUnlock()
+	assert.Equal(t, "myapp:v1", marathon.Applications["/canary-app"].Container.Docker.Image)
+}
+
+func TestCanaryUpdate_WithoutMetricsSource(t *testing.T) {
+	_, updater, _ := newTestUpdater(t, &Application{ID: "/canary-app", Instances: 2, CPUs: 0.5}, true)
+
+	config := &UpdateConfig{
+		AppID:        "/canary-app",
+		Strategy:     CanaryUpdate,
+		CanaryConfig: &CanaryConfig{Stages: []CanaryStage{{Name: "stage-1", Weight: 50}}},
+	}
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	waitForUpdate(t, updater, "/canary-app")
+
+	results := updater.GetCanaryResults("/canary-app")
+	require.Len(t, results, 1)
+	assert.Equal(t, VerdictPass, results[0].Verdict)
+	assert.Empty(t, results[0].Metrics)
+}
@@ -0,0 +1,256 @@
+package marathon
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Constraint operators supported by Marathon
+const (
+	ConstraintUnique  = "UNIQUE"
+	ConstraintCluster = "CLUSTER"
+	ConstraintGroupBy = "GROUP_BY"
+	ConstraintLike    = "LIKE"
+	ConstraintUnlike  = "UNLIKE"
+	ConstraintMaxPer  = "MAX_PER"
+	ConstraintIs      = "IS"
+)
+
+// hostnameField is the constraint field that refers to the agent hostname
+// rather than to one of its attributes
+const hostnameField = "hostname"
+
+// Constraint represents a parsed placement constraint
+type Constraint struct {
+	Field    string
+	Operator string
+	Value    string
+	regex    *regexp.Regexp
+	count    int
+}
+
+// ConstraintError describes an invalid constraint in an app definition
+type ConstraintError struct {
+	Index      int
+	Constraint []string
+	Reason     string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("constraint %d %v: %s", e.Index, e.Constraint, e.Reason)
+}
+
+// ParseConstraint parses a constraint in Marathon's [field, operator, value] form
+func ParseConstraint(raw []string) (*Constraint, error) {
+	if len(raw) < 2 || len(raw) > 3 {
+		return nil, fmt.Errorf("expected [field, operator] or [field, operator, value]")
+	}
+
+	c := &Constraint{Field: raw[0], Operator: raw[1]}
+	if len(raw) == 3 {
+		c.Value = raw[2]
+	}
+	if c.Field == "" {
+		return nil, fmt.Errorf("field must not be empty")
+	}
+
+	switch c.Operator {
+	case ConstraintUnique:
+		if len(raw) == 3 {
+			return nil, fmt.Errorf("UNIQUE does not take a value")
+		}
+	case ConstraintCluster:
+		// The value is optional: without it all tasks share whatever value the first task landed on
+	case ConstraintGroupBy:
+		if c.Value != "" {
+			count, err := strconv.Atoi(c.Value)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("GROUP_BY count must be a positive integer, got %q", c.Value)
+			}
+			c.count = count
+		}
+	case ConstraintLike, ConstraintUnlike:
+		if c.Value == "" {
+			return nil, fmt.Errorf("%s requires a regular expression", c.Operator)
+		}
+		regex, err := regexp.Compile("^(?:" + c.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", c.Value, err)
+		}
+		c.regex = regex
+	case ConstraintMaxPer:
+		count, err := strconv.Atoi(c.Value)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("MAX_PER requires a positive integer, got %q", c.Value)
+		}
+		c.count = count
+	case ConstraintIs:
+		if c.Value == "" {
+			return nil, fmt.Errorf("IS requires a value")
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", c.Operator)
+	}
+
+	return c, nil
+}
+
+// ParseConstraints parses all constraints of an app definition
+func ParseConstraints(raw [][]string) ([]*Constraint, error) {
+	constraints := make([]*Constraint, 0, len(raw))
+	for i, r := range raw {
+		c, err := ParseConstraint(r)
+		if err != nil {
+			return nil, &ConstraintError{Index: i, Constraint: r, Reason: err.Error()}
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, nil
+}
+
+// ValidateConstraints checks that all constraints are well formed
+func ValidateConstraints(raw [][]string) error {
+	_, err := ParseConstraints(raw)
+	return err
+}
+
+// fieldValue returns the value of a constraint field on an agent
+func fieldValue(agent *AgentInfo, field string) (string, bool) {
+	if agent == nil {
+		return "", false
+	}
+	if field == hostnameField {
+		return agent.Hostname, true
+	}
+	value, ok := agent.Attributes[field]
+	return value, ok
+}
+
+// valueCounts counts placed tasks per field value
+func valueCounts(field string, placed []*AgentInfo) map[string]int {
+	counts := make(map[string]int)
+	for _, agent := range placed {
+		if value, ok := fieldValue(agent, field); ok {
+			counts[value]++
+		}
+	}
+	return counts
+}
+
+// Matches reports whether a new task may be placed on agent given the agents
+// hosting the app's already placed tasks
+func (c *Constraint) Matches(agent *AgentInfo, placed []*AgentInfo) bool {
+	value, ok := fieldValue(agent, c.Field)
+
+	switch c.Operator {
+	case ConstraintUnlike:
+		// Agents lacking the attribute cannot match the pattern
+		return !ok || !c.regex.MatchString(value)
+	case ConstraintLike:
+		return ok && c.regex.MatchString(value)
+	case ConstraintIs:
+		return ok && value == c.Value
+	}
+
+	if !ok {
+		return false
+	}
+
+	counts := valueCounts(c.Field, placed)
+
+	switch c.Operator {
+	case ConstraintUnique:
+		return counts[value] == 0
+	case ConstraintCluster:
+		if c.Value != "" {
+			return value == c.Value
+		}
+		for existing := range counts {
+			if existing != value {
+				return false
+			}
+		}
+		return true
+	case ConstraintGroupBy:
+		if c.count > 0 && len(counts) < c.count {
+			// Fill every expected group before stacking tasks in one
+			return counts[value] == 0
+		}
+		for _, n := range counts {
+			if counts[value] > n {
+				return false
+			}
+		}
+		return true
+	case ConstraintMaxPer:
+		return counts[value] < c.count
+	}
+
+	return false
+}
+
+// constraintsMatch reports whether all constraints accept the agent
+func constraintsMatch(constraints []*Constraint, agent *AgentInfo, placed []*AgentInfo) (bool, *Constraint) {
+	for _, c := range constraints {
+		if !c.Matches(agent, placed) {
+			return false, c
+		}
+	}
+	return true, nil
+}
+
+// selectTasksToKill picks count tasks to remove when scaling down. Tasks that
+// are not yet running go first; among the rest, tasks in the most crowded
+// group of any spreading constraint are killed so the remaining instances
+// stay balanced, newest first.
+func (m *Marathon) selectTasksToKill(app *Application, count int) []*MarathonTask {
+	constraints, _ := ParseConstraints(app.Constraints)
+
+	candidates := make([]*MarathonTask, len(app.Tasks))
+	copy(candidates, app.Tasks)
+
+	selected := make([]*MarathonTask, 0, count)
+	for len(selected) < count && len(candidates) > 0 {
+		placed := make([]*AgentInfo, 0, len(candidates))
+		for _, task := range candidates {
+			if agent := m.Agents[task.SlaveID]; agent != nil {
+				placed = append(placed, agent)
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if sa, sb := a.State != "TASK_RUNNING", b.State != "TASK_RUNNING"; sa != sb {
+				return sa
+			}
+			if ca, cb := m.groupPressure(constraints, a, placed), m.groupPressure(constraints, b, placed); ca != cb {
+				return ca > cb
+			}
+			return taskIndex(a) > taskIndex(b)
+		})
+
+		selected = append(selected, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	return selected
+}
+
+// groupPressure returns the size of the largest constraint group the task
+// belongs to, used to prefer killing tasks from overpopulated groups
+func (m *Marathon) groupPressure(constraints []*Constraint, task *MarathonTask, placed []*AgentInfo) int {
+	agent := m.Agents[task.SlaveID]
+	pressure := 0
+	for _, c := range constraints {
+		value, ok := fieldValue(agent, c.Field)
+		if !ok {
+			continue
+		}
+		if n := valueCounts(c.Field, placed)[value]; n > pressure {
+			pressure = n
+		}
+	}
+	return pressure
+}
@@ -0,0 +1,197 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         []string
+		expectError string
+	}{
+		{"Unique", []string{"hostname", "UNIQUE"}, ""},
+		{"Unique with value", []string{"hostname", "UNIQUE", "x"}, "does not take a value"},
+		{"Cluster without value", []string{"rack", "CLUSTER"}, ""},
+		{"Cluster with value", []string{"rack", "CLUSTER", "rack-1"}, ""},
+		{"Group by", []string{"rack", "GROUP_BY"}, ""},
+		{"Group by with count", []string{"rack", "GROUP_BY", "3"}, ""},
+		{"Group by with invalid count", []string{"rack", "GROUP_BY", "many"}, "positive integer"},
+		{"Like", []string{"rack", "LIKE", "rack-[1-3]"}, ""},
+		{"Like without pattern", []string{"rack", "LIKE"}, "requires a regular expression"},
+		{"Unlike with invalid pattern", []string{"rack", "UNLIKE", "rack-["}, "invalid regular expression"},
+		{"Max per", []string{"zone", "MAX_PER", "2"}, ""},
+		{"Max per zero", []string{"zone", "MAX_PER", "0"}, "positive integer"},
+		{"Is", []string{"os", "IS", "linux"}, ""},
+		{"Is without value", []string{"os", "IS"}, "requires a value"},
+		{"Unknown operator", []string{"rack", "SPREAD"}, "unknown operator"},
+		{"Empty field", []string{"", "UNIQUE"}, "field must not be empty"},
+		{"Too short", []string{"hostname"}, "expected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConstraint(tt.raw)
+			if tt.expectError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.raw[0], c.Field)
+				assert.Equal(t, tt.raw[1], c.Operator)
+			}
+		})
+	}
+}
+
+func TestValidateConstraints(t *testing.T) {
+	err := ValidateConstraints([][]string{{"hostname", "UNIQUE"}, {"rack", "MAX_PER", "x"}})
+	require.Error(t, err)
+
+	var constraintErr *ConstraintError
+	require.ErrorAs(t, err, &constraintErr)
+	assert.Equal(t, 1, constraintErr.Index)
+	assert.Equal(t, []string{"rack", "MAX_PER", "x"}, constraintErr.Constraint)
+}
+
+func TestConstraint_Matches(t *testing.T) {
+	agent := func(host, rack string) *AgentInfo {
+		return &AgentInfo{ID: host, Hostname: host, Attributes: map[string]string{"rack": rack}}
+	}
+	a1, a2, a3 := agent("a1", "r1"), agent("a2", "r1"), agent("a3", "r2")
+	bare := &AgentInfo{ID: "bare", Hostname: "bare"}
+
+	tests := []struct {
+		name       string
+		constraint []string
+		agent      *AgentInfo
+		placed     []*AgentInfo
+		expected   bool
+	}{
+		{"Unique free host", []string{"hostname", "UNIQUE"}, a2, []*AgentInfo{a1}, true},
+		{"Unique taken host", []string{"hostname", "UNIQUE"}, a1, []*AgentInfo{a1}, false},
+		{"Unique attribute", []string{"rack", "UNIQUE"}, a2, []*AgentInfo{a1}, false},
+		{"Cluster value match", []string{"rack", "CLUSTER", "r2"}, a3, nil, true},
+		{"Cluster value mismatch", []string{"rack", "CLUSTER", "r2"}, a1, nil, false},
+		{"Cluster follows first task", []string{"rack", "CLUSTER"}, a2, []*AgentInfo{a1}, true},
+		{"Cluster rejects other value", []string{"rack", "CLUSTER"}, a3, []*AgentInfo{a1}, false},
+		{"Group by prefers smaller group", []string{"rack", "GROUP_BY"}, a3, []*AgentInfo{a1}, true},
+		{"Group by rejects larger group", []string{"rack", "GROUP_BY"}, a2, []*AgentInfo{a1, a1, a3}, false},
+		{"Group by count waits for new group", []string{"rack", "GROUP_BY", "2"}, a2, []*AgentInfo{a1, a3, a1}, false},
+		{"Group by count balanced", []string{"rack", "GROUP_BY", "2"}, a3, []*AgentInfo{a1, a3, a1}, true},
+		{"Like match", []string{"rack", "LIKE", "r[12]"}, a1, nil, true},
+		{"Like mismatch", []string{"rack", "LIKE", "r3"}, a1, nil, false},
+		{"Like missing attribute", []string{"rack", "LIKE", ".*"}, bare, nil, false},
+		{"Unlike match", []string{"rack", "UNLIKE", "r1"}, a1, nil, false},
+		{"Unlike missing attribute", []string{"rack", "UNLIKE", "r1"}, bare, nil, true},
+		{"Max per below limit", []string{"rack", "MAX_PER", "2"}, a2, []*AgentInfo{a1}, true},
+		{"Max per at limit", []string{"rack", "MAX_PER", "2"}, a2, []*AgentInfo{a1, a2}, false},
+		{"Is match", []string{"rack", "IS", "r2"}, a3, nil, true},
+		{"Is mismatch", []string{"rack", "IS", "r2"}, a1, nil, false},
+		{"Missing attribute", []string{"rack", "UNIQUE"}, bare, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, c.Matches(tt.agent, tt.placed))
+		})
+	}
+}
+
+func TestMarathon_CreateAppInvalidConstraints(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{
+		ID:          "/test/app",
+		Instances:   1,
+		CPUs:        1.0,
+		Memory:      128.0,
+		Constraints: [][]string{{"hostname", "BOGUS"}},
+	}
+
+	err := marathon.CreateApp(app)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown operator")
+	assert.Empty(t, marathon.Applications)
+}
+
+func TestMarathon_HandleCreateAppInvalidConstraints(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{
+		ID:          "test-app",
+		Instances:   1,
+		CPUs:        1.0,
+		Memory:      128.0,
+		Constraints: [][]string{{"rack", "MAX_PER"}},
+	}
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(app)
+
+	req := httptest.NewRequest("POST", "/v2/apps", &buf)
+	rr := httptest.NewRecorder()
+	marathon.setupRoutes().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "MAX_PER")
+}
+
+func TestMarathon_ScaleDownBalancesGroups(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{
+		ID:          "/test/app",
+		Instances:   4,
+		CPUs:        0.1,
+		Memory:      32.0,
+		Constraints: [][]string{{"rack", "GROUP_BY"}},
+	}
+	require.NoError(t, marathon.CreateApp(app))
+
+	// Place three tasks on rack r1 and one on r2
+	for i, rack := range []string{"r1", "r1", "r1", "r2"} {
+		agentID := fmt.Sprintf("agent-%d", i)
+		marathon.Agents[agentID] = &AgentInfo{ID: agentID, Hostname: agentID, Attributes: map[string]string{"rack": rack}}
+		app.Tasks[i].SlaveID = agentID
+		app.Tasks[i].State = "TASK_RUNNING"
+	}
+
+	require.NoError(t, marathon.ScaleApp(app.ID, 2))
+
+	racks := map[string]int{}
+	for _, task := range app.Tasks {
+		racks[marathon.Agents[task.SlaveID].Attributes["rack"]]++
+	}
+	assert.Equal(t, map[string]int{"r1": 1, "r2": 1}, racks)
+}
+
+func TestMarathon_ScaleDownPrefersStagedTasks(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{ID: "/test/app", Instances: 3, CPUs: 0.1, Memory: 32.0}
+	require.NoError(t, marathon.CreateApp(app))
+
+	app.Tasks[0].State = "TASK_RUNNING"
+	app.Tasks[2].State = "TASK_RUNNING"
+
+	require.NoError(t, marathon.ScaleApp(app.ID, 2))
+
+	assert.NotContains(t, marathon.Tasks, "/test/app.1")
+	assert.Len(t, app.Tasks, 2)
+
+	// Scaling up again must not reuse the killed task's ID
+	require.NoError(t, marathon.ScaleApp(app.ID, 3))
+	assert.Len(t, app.Tasks, 3)
+	assert.NotContains(t, marathon.Tasks, "/test/app.1")
+}
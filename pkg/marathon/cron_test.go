@@ -0,0 +1,55 @@
+package marathon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2026, 10, 14, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 14, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2026, 10, 14, 10, 25, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cron.Next(from))
+		})
+	}
+}
+
+func TestCronSchedule_NextInTimeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	cron, err := ParseCron("0 2 * * *")
+	require.NoError(t, err)
+
+	next := cron.Next(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC).In(berlin))
+	assert.Equal(t, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
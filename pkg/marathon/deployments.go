@@ -0,0 +1,461 @@
+package marathon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Deployment step actions
+const (
+	ActionStartApplication   = "StartApplication"
+	ActionScaleApplication   = "ScaleApplication"
+	ActionRestartApplication = "RestartApplication"
+	ActionStopApplication    = "StopApplication"
+)
+
+// ErrDeploymentConflict is returned when a deployment would touch apps that
+// are locked by another deployment in progress
+var ErrDeploymentConflict = errors.New("app is locked by one or more deployments")
+
+// ErrDeploymentNotFound is returned when a deployment does not exist
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
+// versionFormat is the layout of app and deployment versions
+const versionFormat = "2006-01-02T15:04:05.000Z"
+
+// newVersion returns a version timestamp that is strictly greater than any
+// version handed out before, so tasks of consecutive versions never compare
+// equal. The caller must hold m.mu.
+func (m *Marathon) newVersion() string {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(m.lastVersion) {
+		now = m.lastVersion.Add(time.Millisecond)
+	}
+	m.lastVersion = now
+	return now.Format(versionFormat)
+}
+
+// snapshotApp returns a copy of an app definition without runtime state
+func snapshotApp(app *Application) *Application {
+	if app == nil {
+		return nil
+	}
+	snapshot := *app
+	snapshot.Tasks = nil
+	snapshot.Deployments = nil
+	snapshot.LastTaskFailure = nil
+	snapshot.TasksStaged = 0
+	snapshot.TasksRunning = 0
+	snapshot.TasksHealthy = 0
+	snapshot.TasksUnhealthy = 0
+	return &snapshot
+}
+
+// specChanged reports whether two app definitions differ in anything but
+// their instance count, which requires restarting the app's tasks
+func specChanged(a, b *Application) bool {
+	sa, sb := snapshotApp(a), snapshotApp(b)
+	sa.Instances, sb.Instances = 0, 0
+	sa.Version, sb.Version = "", ""
+	return !reflect.DeepEqual(sa, sb)
+}
+
+// computePlan derives the ordered deployment steps that turn the original
+// app definitions into the target ones. A nil target stops the app. Apps
+// are stopped in reverse dependency order first, then started, restarted
+// or scaled in dependency order.
+func (m *Marathon) computePlan(original, target map[string]*Application, groups map[string]*Group) ([]*DeploymentStep, error) {
+	running := make(map[string]*Application)
+	stopped := make([]*DeploymentStep, 0)
+	for id, app := range target {
+		if app != nil {
+			if err := ValidateConstraints(app.Constraints); err != nil {
+				return nil, err
+			}
+			if err := validateHealthChecks(app); err != nil {
+				return nil, err
+			}
+			running[id] = app
+		} else if original[id] != nil {
+			stopped = append(stopped, &DeploymentStep{Action: ActionStopApplication, App: id})
+		}
+	}
+
+	ordered, err := m.dependencyOrder(groups, running)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := m.reverseDependencyOrder(stopped, original)
+	for _, app := range ordered {
+		orig := original[app.ID]
+		switch {
+		case orig == nil:
+			steps = append(steps, &DeploymentStep{Action: ActionStartApplication, App: app.ID})
+		case specChanged(orig, app):
+			steps = append(steps, &DeploymentStep{Action: ActionRestartApplication, App: app.ID})
+		case orig.Instances != app.Instances:
+			steps = append(steps, &DeploymentStep{Action: ActionScaleApplication, App: app.ID})
+		}
+	}
+
+	return steps, nil
+}
+
+// reverseDependencyOrder reorders stop steps so dependents stop before the
+// apps they depend on, using the given app definitions
+func (m *Marathon) reverseDependencyOrder(steps []*DeploymentStep, specs map[string]*Application) []*DeploymentStep {
+	apps := make(map[string]*Application, len(steps))
+	for _, step := range steps {
+		apps[step.App] = specs[step.App]
+	}
+	ordered, err := m.dependencyOrder(nil, apps)
+	if err != nil {
+		// Stopping never fails on ordering; fall back to the given order
+		return steps
+	}
+
+	reversed := make([]*DeploymentStep, 0, len(ordered))
+	for i := len(ordered) - 1; i >= 0; i-- {
+		reversed = append(reversed, &DeploymentStep{Action: ActionStopApplication, App: ordered[i].ID})
+	}
+	return reversed
+}
+
+// deploy plans and starts a deployment towards the target app definitions
+func (m *Marathon) deploy(target map[string]*Application, groups map[string]*Group, force bool) (*Deployment, error) {
+	original := make(map[string]*Application, len(target))
+	for id := range target {
+		original[id] = snapshotApp(m.Applications[id])
+	}
+	if err := m.allocateServicePorts(target); err != nil {
+		return nil, err
+	}
+
+	steps, err := m.computePlan(original, target, groups)
+	if err != nil {
+		return nil, err
+	}
+	return m.startDeployment(original, target, steps, force)
+}
+
+// startDeployment registers a deployment and applies its first step. The
+// caller must hold m.mu.
+func (m *Marathon) startDeployment(original, target map[string]*Application, steps []*DeploymentStep, force bool) (*Deployment, error) {
+	affected := make([]string, 0, len(steps))
+	seen := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		if !seen[step.App] {
+			seen[step.App] = true
+			affected = append(affected, step.App)
+		}
+	}
+
+	if conflicts := m.conflictingDeployments(affected); len(conflicts) > 0 {
+		if !force {
+			ids := make([]string, len(conflicts))
+			for i, d := range conflicts {
+				ids[i] = d.ID
+			}
+			return nil, fmt.Errorf("%w: %s", ErrDeploymentConflict, strings.Join(ids, ", "))
+		}
+		for _, d := range conflicts {
+			log.Printf("Deployment %s superseded", d.ID)
+			m.removeDeployment(d)
+			m.publishDeployment(EventDeploymentFailed, d, nil, "superseded by a forced deployment")
+		}
+	}
+
+	version := m.newVersion()
+	deployment := &Deployment{
+		ID:             fmt.Sprintf("deployment-%d", time.Now().UnixNano()),
+		Version:        version,
+		AffectedApps:   affected,
+		Steps:          steps,
+		CurrentActions: []*DeploymentAction{},
+		CurrentStep:    0,
+		TotalSteps:     len(steps),
+		original:       original,
+		target:         target,
+		startedAt:      time.Now(),
+	}
+	for _, step := range steps {
+		if step.Action == ActionStartApplication || step.Action == ActionRestartApplication {
+			target[step.App].Version = version
+			m.recordVersion(target[step.App])
+		}
+	}
+
+	m.Deployments[deployment.ID] = deployment
+	if len(steps) > 0 {
+		m.applyStep(deployment)
+	}
+	m.advanceDeployment(deployment)
+
+	return deployment, nil
+}
+
+// conflictingDeployments returns deployments in progress that affect any
+// of the given apps
+func (m *Marathon) conflictingDeployments(appIDs []string) []*Deployment {
+	conflicts := make([]*Deployment, 0)
+	for _, deployment := range m.Deployments {
+		for _, affected := range deployment.AffectedApps {
+			if containsString(appIDs, affected) {
+				conflicts = append(conflicts, deployment)
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// applyStep performs the action of the deployment's current step
+func (m *Marathon) applyStep(d *Deployment) {
+	step := d.Steps[d.CurrentStep]
+	d.CurrentActions = []*DeploymentAction{{Action: step.Action, App: step.App}}
+
+	target := d.target[step.App]
+	existing := m.Applications[step.App]
+
+	switch step.Action {
+	case ActionStartApplication:
+		m.launchApp(target)
+	case ActionScaleApplication:
+		if existing != nil {
+			m.scaleApp(existing, target.Instances)
+		}
+	case ActionRestartApplication:
+		if existing != nil {
+			m.replaceApp(existing, target)
+			for i := 0; i < target.Instances; i++ {
+				m.stageTask(target)
+			}
+		}
+	case ActionStopApplication:
+		m.stopApp(step.App)
+	}
+
+	if app, exists := m.Applications[step.App]; exists {
+		trackDeployment(app, d)
+	}
+
+	m.publishDeployment(EventDeploymentInfo, d, step, "")
+	log.Printf("Deployment %s: step %d/%d %s %s", d.ID, d.CurrentStep+1, d.TotalSteps, step.Action, step.App)
+}
+
+// stepComplete reports whether the deployment's current step has converged
+func (m *Marathon) stepComplete(d *Deployment) bool {
+	step := d.Steps[d.CurrentStep]
+	app, exists := m.Applications[step.App]
+
+	switch step.Action {
+	case ActionStopApplication:
+		return !exists
+	case ActionScaleApplication:
+		if !exists {
+			return true
+		}
+		return len(app.Tasks) == app.Instances && m.readyTasks(d, app, "") == app.Instances
+	default:
+		if !exists {
+			return true
+		}
+		return m.readyTasks(d, app, app.Version) >= app.Instances
+	}
+}
+
+// readyTasks counts an app's ready tasks within a deployment, optionally
+// only those of a given version
+func (m *Marathon) readyTasks(d *Deployment, app *Application, version string) int {
+	ready := 0
+	for _, task := range app.Tasks {
+		if version != "" && task.Version != version {
+			continue
+		}
+		if m.taskReady(d, app, task) {
+			ready++
+		}
+	}
+	return ready
+}
+
+// trackDeployment lists a deployment in progress on an app it affects
+func trackDeployment(app *Application, d *Deployment) {
+	for _, existing := range app.Deployments {
+		if existing.ID == d.ID {
+			return
+		}
+	}
+	app.Deployments = append(app.Deployments, d)
+}
+
+// removeDeployment unregisters a deployment that finished or was canceled,
+// also from the apps it affects. The caller must hold m.mu.
+func (m *Marathon) removeDeployment(d *Deployment) {
+	delete(m.Deployments, d.ID)
+	for _, appID := range d.AffectedApps {
+		app, exists := m.Applications[appID]
+		if !exists {
+			continue
+		}
+		active := make([]*Deployment, 0, len(app.Deployments))
+		for _, existing := range app.Deployments {
+			if existing.ID != d.ID {
+				active = append(active, existing)
+			}
+		}
+		app.Deployments = active
+	}
+}
+
+// advanceDeployment moves a deployment through all steps that have
+// completed and removes it once finished. The caller must hold m.mu.
+func (m *Marathon) advanceDeployment(d *Deployment) {
+	for d.CurrentStep < d.TotalSteps && m.stepComplete(d) {
+		step := d.Steps[d.CurrentStep]
+		if step.Action == ActionRestartApplication {
+			m.killOldTasks(step.App)
+		}
+
+		m.publishDeployment(EventDeploymentStepSuccess, d, step, "")
+
+		d.CurrentStep++
+		if d.CurrentStep < d.TotalSteps {
+			m.applyStep(d)
+		}
+	}
+
+	if d.CurrentStep >= d.TotalSteps {
+		d.CurrentActions = []*DeploymentAction{}
+		m.removeDeployment(d)
+		m.publishDeployment(EventDeploymentSuccess, d, nil, "")
+		log.Printf("Deployment %s finished after %s", d.ID, time.Since(d.startedAt).Round(time.Millisecond))
+	}
+}
+
+// advanceDeployments advances all deployments in progress, oldest first,
+// except those of rolling updates. The caller must hold m.mu.
+func (m *Marathon) advanceDeployments() {
+	deployments := make([]*Deployment, 0, len(m.Deployments))
+	for _, d := range m.Deployments {
+		if !d.rolling {
+			deployments = append(deployments, d)
+		}
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].startedAt.Before(deployments[j].startedAt)
+	})
+
+	for _, d := range deployments {
+		if _, active := m.Deployments[d.ID]; active {
+			m.advanceDeployment(d)
+		}
+	}
+}
+
+// resumeRestart stages the tasks of an app's current version a recovered
+// restart still lacks. Tasks of previous versions are killed when the step
+// completes. The caller must hold m.mu.
+func (m *Marathon) resumeRestart(app *Application) {
+	current := 0
+	for _, task := range app.Tasks {
+		if task.Version == app.Version {
+			current++
+		}
+	}
+	for ; current < app.Instances; current++ {
+		m.stageTask(app)
+	}
+}
+
+// killOldTasks kills the tasks of an app that run a previous version
+func (m *Marathon) killOldTasks(appID string) {
+	app, exists := m.Applications[appID]
+	if !exists {
+		return
+	}
+	old := make([]*MarathonTask, 0)
+	for _, task := range app.Tasks {
+		if task.Version != app.Version {
+			old = append(old, task)
+		}
+	}
+	for _, task := range old {
+		m.killAppTask(app, task)
+	}
+}
+
+// CancelDeployment stops a deployment in progress. Unless force is set, a
+// new deployment is started that rolls the affected apps back to their
+// definitions from before the canceled deployment and is returned.
+func (m *Marathon) CancelDeployment(deploymentID string, force bool) (*Deployment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	d, exists := m.Deployments[deploymentID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrDeploymentNotFound, deploymentID)
+	}
+	m.removeDeployment(d)
+	m.publishDeployment(EventDeploymentFailed, d, nil, "canceled")
+	log.Printf("Canceled deployment %s", deploymentID)
+
+	if force {
+		return nil, nil
+	}
+
+	current := make(map[string]*Application, len(d.original))
+	target := make(map[string]*Application, len(d.original))
+	for id, app := range d.original {
+		current[id] = snapshotApp(m.Applications[id])
+		target[id] = snapshotApp(app)
+	}
+
+	steps, err := m.computePlan(current, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan rollback of %s: %w", deploymentID, err)
+	}
+	return m.startDeployment(current, target, steps, true)
+}
+
+// forceParam reports whether a request asked to override deployment locks
+func forceParam(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "true"
+}
+
+// containsString reports whether s is in list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Marathon) handleDeleteDeployment(w http.ResponseWriter, r *http.Request) {
+	deploymentID := mux.Vars(r)["id"]
+
+	rollback, err := m.CancelDeployment(deploymentID, forceParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	if rollback == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	writeDeploymentResult(w, rollback)
+}
@@ -0,0 +1,226 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// completeDeployments runs staged tasks until all deployments have finished
+func completeDeployments(t *testing.T, marathon *Marathon) {
+	t.Helper()
+	for i := 0; i < 20 && len(marathon.Deployments) > 0; i++ {
+		marathon.monitorTasks()
+	}
+	require.Empty(t, marathon.Deployments, "deployments did not finish")
+}
+
+func TestMarathon_NewVersionIsMonotonic(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	previous := ""
+	for i := 0; i < 100; i++ {
+		version := marathon.newVersion()
+		assert.Greater(t, version, previous)
+		previous = version
+	}
+}
+
+func TestMarathon_ComputePlan(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	base := &Application{ID: "/app", Instances: 2, CPUs: 1.0, Memory: 128.0}
+	scaled := snapshotApp(base)
+	scaled.Instances = 4
+	changed := snapshotApp(base)
+	changed.CPUs = 2.0
+
+	tests := []struct {
+		name     string
+		original *Application
+		target   *Application
+		expected []string
+	}{
+		{"Start", nil, base, []string{ActionStartApplication}},
+		{"Scale", base, scaled, []string{ActionScaleApplication}},
+		{"Restart", base, changed, []string{ActionRestartApplication}},
+		{"Stop", base, nil, []string{ActionStopApplication}},
+		{"Unchanged", base, snapshotApp(base), []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := marathon.computePlan(
+				map[string]*Application{"/app": tt.original},
+				map[string]*Application{"/app": tt.target},
+				nil,
+			)
+			require.NoError(t, err)
+
+			actions := make([]string, 0, len(steps))
+			for _, step := range steps {
+				actions = append(actions, step.Action)
+			}
+			assert.Equal(t, tt.expected, actions)
+		})
+	}
+}
+
+func TestMarathon_DeploymentProgress(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	_, err := marathon.CreateGroup(&Group{
+		ID: "/svc",
+		Apps: []*Application{
+			{ID: "db", Instances: 1},
+			{ID: "api", Instances: 2, Dependencies: []string{"db"}},
+		},
+	}, false)
+	require.NoError(t, err)
+
+	var deployment *Deployment
+	for _, d := range marathon.Deployments {
+		deployment = d
+	}
+	require.NotNil(t, deployment)
+	assert.Equal(t, 0, deployment.CurrentStep)
+	assert.Equal(t, []*DeploymentAction{{Action: ActionStartApplication, App: "/svc/db"}}, deployment.CurrentActions)
+
+	marathon.monitorTasks()
+	assert.Equal(t, 1, deployment.CurrentStep)
+	assert.Equal(t, []*DeploymentAction{{Action: ActionStartApplication, App: "/svc/api"}}, deployment.CurrentActions)
+	assert.Equal(t, []*Deployment{deployment}, marathon.Applications["/svc/db"].Deployments)
+	assert.Equal(t, []*Deployment{deployment}, marathon.Applications["/svc/api"].Deployments)
+
+	// Apps only list the deployments in progress
+	marathon.monitorTasks()
+	assert.NotContains(t, marathon.Deployments, deployment.ID)
+	assert.Empty(t, marathon.Applications["/svc/db"].Deployments)
+	assert.Empty(t, marathon.Applications["/svc/api"].Deployments)
+}
+
+func TestMarathon_DeploymentWaitsForHealth(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{
+		ID:           "/app",
+		Instances:    1,
+		HealthChecks: []*HealthCheck{{Protocol: "TCP"}},
+	}
+	require.NoError(t, marathon.CreateApp(app))
+
+	marathon.monitorTasks()
+	assert.Len(t, marathon.Deployments, 1, "running but unchecked tasks are not ready")
+
+	app.Tasks[0].HealthCheckResults = []*HealthCheckResult{{Alive: true}}
+	marathon.monitorTasks()
+	assert.Empty(t, marathon.Deployments)
+}
+
+func TestMarathon_RestartReplacesTasks(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 2, CPUs: 1.0}))
+	completeDeployments(t, marathon)
+
+	require.NoError(t, marathon.UpdateApp("/app", &Application{ID: "/app", Instances: 2, CPUs: 2.0}))
+	app := marathon.Applications["/app"]
+
+	// Old tasks keep running until the new version is up
+	assert.Len(t, app.Tasks, 4)
+
+	completeDeployments(t, marathon)
+	assert.Len(t, app.Tasks, 2)
+	for _, task := range app.Tasks {
+		assert.Equal(t, app.Version, task.Version)
+	}
+}
+
+func TestMarathon_DeploymentConflict(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	first, err := marathon.createApp(&Application{ID: "/app", Instances: 2}, false)
+	require.NoError(t, err)
+
+	_, err = marathon.scaleAppDeployment("/app", 3, false)
+	assert.ErrorIs(t, err, ErrDeploymentConflict)
+	assert.Contains(t, err.Error(), first.ID)
+
+	second, err := marathon.scaleAppDeployment("/app", 3, true)
+	require.NoError(t, err)
+	assert.NotContains(t, marathon.Deployments, first.ID)
+	assert.Contains(t, marathon.Deployments, second.ID)
+}
+
+func TestMarathon_CancelDeploymentRollsBack(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 2, CPUs: 1.0}))
+	completeDeployments(t, marathon)
+
+	deployment, err := marathon.updateApp("/app", &Application{ID: "/app", Instances: 2, CPUs: 2.0}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, marathon.Applications["/app"].CPUs)
+
+	rollback, err := marathon.CancelDeployment(deployment.ID, false)
+	require.NoError(t, err)
+	require.NotNil(t, rollback)
+	assert.NotContains(t, marathon.Deployments, deployment.ID)
+	assert.Equal(t, []*DeploymentStep{{Action: ActionRestartApplication, App: "/app"}}, rollback.Steps)
+	assert.Equal(t, []*Deployment{rollback}, marathon.Applications["/app"].Deployments)
+
+	completeDeployments(t, marathon)
+	app := marathon.Applications["/app"]
+	assert.Equal(t, 1.0, app.CPUs)
+	assert.Len(t, app.Tasks, 2)
+	assert.Empty(t, app.Deployments)
+}
+
+func TestMarathon_CancelDeploymentOfNewApp(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	deployment, err := marathon.createApp(&Application{ID: "/app", Instances: 2}, false)
+	require.NoError(t, err)
+
+	// Rolling back a start removes the app again
+	_, err = marathon.CancelDeployment(deployment.ID, false)
+	require.NoError(t, err)
+	assert.NotContains(t, marathon.Applications, "/app")
+	assert.Empty(t, marathon.Deployments)
+
+	_, err = marathon.CancelDeployment(deployment.ID, false)
+	assert.ErrorIs(t, err, ErrDeploymentNotFound)
+}
+
+func TestMarathon_HandleDeleteDeploymentForce(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(&Application{ID: "/app", Instances: 1, CPUs: 0.5})
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v2/apps", &buf))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v2/apps/app/scale", bytes.NewBufferString(`{"instances": 2}`)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	deploymentID := marathon.Applications["/app"].Deployments[0].ID
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/v2/deployments/"+deploymentID+"?force=true", nil))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	// Without rollback the app stays as it was when the deployment was canceled
+	assert.Contains(t, marathon.Applications, "/app")
+	assert.Empty(t, marathon.Deployments)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/v2/deployments/"+deploymentID, nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,229 @@
+package marathon
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSDomain is the domain the DNS responder serves records under
+const DefaultDNSDomain = "marathon.local"
+
+// dnsTTL is the TTL of served records in seconds. Endpoints change with
+// every task launch, so records are kept short-lived.
+const dnsTTL = 5
+
+// UDP response sizes: responses fit in 512 bytes unless the query
+// advertises a larger EDNS0 payload size, which is capped at dnsMaxUDPSize
+const (
+	dnsMinUDPSize = 512
+	dnsMaxUDPSize = 4096
+)
+
+// DNSServer answers SRV queries for the endpoints of healthy app tasks.
+// Records are named _<app>._<protocol>.<domain>, where <app> is the app
+// ID's path segments in reverse order joined by dashes as in Mesos-DNS, so
+// the TCP ports of /prod/web are found at _web-prod._tcp.marathon.local.
+type DNSServer struct {
+	marathon *Marathon
+	domain   string
+}
+
+// NewDNSServer creates a DNS responder for a Marathon instance, serving
+// records under domain or DefaultDNSDomain if it is empty
+func NewDNSServer(m *Marathon, domain string) *DNSServer {
+	if domain == "" {
+		domain = DefaultDNSDomain
+	}
+	return &DNSServer{marathon: m, domain: strings.ToLower(strings.Trim(domain, "."))}
+}
+
+// dnsLabel returns the DNS label of an app ID
+func dnsLabel(appID string) string {
+	parts := strings.Split(strings.Trim(appID, "/"), "/")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.ToLower(strings.Join(parts, "-"))
+}
+
+// ListenAndServe answers queries on a UDP address until the socket fails
+func (s *DNSServer) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.Serve(conn)
+}
+
+// Serve answers queries arriving on conn until reading from it fails
+func (s *DNSServer) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		response, err := s.answer(buf[:n])
+		if err != nil {
+			log.Printf("Dropping malformed DNS query from %s: %v", addr, err)
+			continue
+		}
+		if _, err := conn.WriteTo(response, addr); err != nil {
+			log.Printf("Failed to answer DNS query from %s: %v", addr, err)
+		}
+	}
+}
+
+// srvTarget is a host and port an SRV record points at
+type srvTarget struct {
+	host string
+	port int
+}
+
+// lookup returns the SRV targets for an app label and protocol, and whether
+// such an app exists
+func (s *DNSServer) lookup(label, protocol string) ([]srvTarget, bool) {
+	m := s.marathon
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := false
+	targets := make([]srvTarget, 0)
+	for _, app := range m.sortedApps() {
+		if dnsLabel(app.ID) != label {
+			continue
+		}
+		found = true
+		for i, port := range appPorts(app) {
+			if !port.hasProtocol(protocol) {
+				continue
+			}
+			for _, task := range app.Tasks {
+				if m.taskHealthy(app, task) && i < len(task.Ports) {
+					targets = append(targets, srvTarget{host: task.Host, port: task.Ports[i]})
+				}
+			}
+		}
+	}
+	return targets, found
+}
+
+// answer builds the response to a DNS query. Responses that do not fit the
+// UDP payload size of the query keep as many whole records as fit and are
+// marked truncated, so clients retry over TCP.
+func (s *DNSServer) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if errors.Is(err, dnsmessage.ErrSectionDone) {
+		return nil, errors.New("query has no question")
+	}
+	if err != nil {
+		return nil, err
+	}
+	size, edns := udpSize(&parser)
+
+	response := dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeSuccess}
+	var targets []srvTarget
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	labels := strings.SplitN(name, ".", 3)
+	switch {
+	case name != s.domain && !strings.HasSuffix(name, "."+s.domain):
+		response.Authoritative = false
+		response.RCode = dnsmessage.RCodeRefused
+	case len(labels) < 3 || labels[2] != s.domain ||
+		!strings.HasPrefix(labels[0], "_") || (labels[1] != "_tcp" && labels[1] != "_udp"):
+		response.RCode = dnsmessage.RCodeNameError
+	default:
+		var found bool
+		targets, found = s.lookup(labels[0][1:], labels[1][1:])
+		if !found {
+			response.RCode = dnsmessage.RCodeNameError
+		}
+		if question.Type != dnsmessage.TypeSRV && question.Type != dnsmessage.TypeALL {
+			// The name exists but holds SRV records only
+			targets = nil
+		}
+	}
+
+	msg, err := buildResponse(response, question, targets, edns)
+	if err != nil || len(msg) <= size {
+		return msg, err
+	}
+	response.Truncated = true
+	fits := sort.Search(len(targets), func(i int) bool {
+		msg, err := buildResponse(response, question, targets[:i+1], edns)
+		return err != nil || len(msg) > size
+	})
+	return buildResponse(response, question, targets[:fits], edns)
+}
+
+// udpSize returns the UDP payload size a query accepts, and whether it
+// advertised one in an EDNS0 OPT record
+func udpSize(parser *dnsmessage.Parser) (int, bool) {
+	if parser.SkipAllQuestions() != nil || parser.SkipAllAnswers() != nil || parser.SkipAllAuthorities() != nil {
+		return dnsMinUDPSize, false
+	}
+	for {
+		header, err := parser.AdditionalHeader()
+		if err != nil {
+			return dnsMinUDPSize, false
+		}
+		if header.Type == dnsmessage.TypeOPT {
+			// The class of an OPT record holds the payload size
+			return min(max(int(header.Class), dnsMinUDPSize), dnsMaxUDPSize), true
+		}
+		if parser.SkipAdditional() != nil {
+			return dnsMinUDPSize, false
+		}
+	}
+}
+
+// buildResponse encodes a response with an SRV record per target, and an
+// OPT record advertising dnsMaxUDPSize if the query used EDNS0
+func buildResponse(response dnsmessage.Header, question dnsmessage.Question, targets []srvTarget, edns bool) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, response)
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		host, err := dnsmessage.NewName(strings.TrimSuffix(target.host, ".") + ".")
+		if err != nil {
+			continue
+		}
+		header := dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: dnsTTL}
+		if err := builder.SRVResource(header, dnsmessage.SRVResource{Port: uint16(target.port), Target: host}); err != nil {
+			return nil, err
+		}
+	}
+	if edns {
+		if err := builder.StartAdditionals(); err != nil {
+			return nil, err
+		}
+		var header dnsmessage.ResourceHeader
+		if err := header.SetEDNS0(dnsMaxUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, err
+		}
+		if err := builder.OPTResource(header, dnsmessage.OPTResource{}); err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
@@ -0,0 +1,156 @@
+package marathon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func dnsQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	require.NoError(t, builder.StartQuestions())
+	require.NoError(t, builder.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  qtype,
+		Class: dnsmessage.ClassINET,
+	}))
+	query, err := builder.Finish()
+	require.NoError(t, err)
+	return query
+}
+
+func newDNSMarathon(t *testing.T) *Marathon {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/prod/web", Instances: 2, CPUs: 1.0,
+		PortDefinitions: []*PortDefinition{{Protocol: "tcp"}, {Protocol: "udp"}}}))
+	marathon.ResourceOffers([]*Offer{portOffer(1, 31000, 31001), portOffer(2, 31000, 31001)})
+	completeDeployments(t, marathon)
+	return marathon
+}
+
+func TestDNSLabel(t *testing.T) {
+	assert.Equal(t, "web-prod", dnsLabel("/prod/web"))
+	assert.Equal(t, "api", dnsLabel("/API"))
+}
+
+func TestDNSServer_Answer(t *testing.T) {
+	server := NewDNSServer(newDNSMarathon(t), "")
+
+	tests := []struct {
+		name    string
+		query   string
+		qtype   dnsmessage.Type
+		rcode   dnsmessage.RCode
+		targets map[string]uint16
+	}{
+		{"tcp ports", "_web-prod._tcp.marathon.local.", dnsmessage.TypeSRV, dnsmessage.RCodeSuccess,
+			map[string]uint16{"host-1.": 31000, "host-2.": 31000}},
+		{"udp ports", "_web-prod._udp.Marathon.Local.", dnsmessage.TypeSRV, dnsmessage.RCodeSuccess,
+			map[string]uint16{"host-1.": 31001, "host-2.": 31001}},
+		{"other record type", "_web-prod._tcp.marathon.local.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, nil},
+		{"unknown app", "_db-prod._tcp.marathon.local.", dnsmessage.TypeSRV, dnsmessage.RCodeNameError, nil},
+		{"malformed name", "web-prod.marathon.local.", dnsmessage.TypeSRV, dnsmessage.RCodeNameError, nil},
+		{"other domain", "_web-prod._tcp.example.com.", dnsmessage.TypeSRV, dnsmessage.RCodeRefused, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := server.answer(dnsQuery(t, tt.query, tt.qtype))
+			require.NoError(t, err)
+
+			var msg dnsmessage.Message
+			require.NoError(t, msg.Unpack(response))
+			assert.Equal(t, uint16(42), msg.Header.ID)
+			assert.True(t, msg.Header.Response)
+			assert.Equal(t, tt.rcode, msg.Header.RCode)
+
+			targets := make(map[string]uint16)
+			for _, answer := range msg.Answers {
+				srv := answer.Body.(*dnsmessage.SRVResource)
+				targets[srv.Target.String()] = srv.Port
+			}
+			if tt.targets == nil {
+				assert.Empty(t, targets)
+			} else {
+				assert.Equal(t, tt.targets, targets)
+			}
+		})
+	}
+
+	_, err := server.answer([]byte{0, 1})
+	assert.Error(t, err)
+}
+
+func TestDNSServer_Serve(t *testing.T) {
+	server := NewDNSServer(newDNSMarathon(t), "svc.example.")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(conn)
+	defer conn.Close()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, err = client.Write(dnsQuery(t, "_web-prod._tcp.svc.example.", dnsmessage.TypeSRV))
+	require.NoError(t, err)
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(buf[:n]))
+	assert.Equal(t, dnsmessage.RCodeSuccess, msg.Header.RCode)
+	assert.Len(t, msg.Answers, 2)
+}
+
+func TestDNSServer_Truncation(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/prod/web", Instances: 40, CPUs: 1.0,
+		PortDefinitions: []*PortDefinition{{Protocol: "tcp"}}}))
+	offers := make([]*Offer, 0, 40)
+	for i := 1; i <= 40; i++ {
+		offers = append(offers, portOffer(i, 31000))
+	}
+	marathon.ResourceOffers(offers)
+	completeDeployments(t, marathon)
+	server := NewDNSServer(marathon, "")
+
+	// Without EDNS0 the response keeps the whole records that fit in 512 bytes
+	response, err := server.answer(dnsQuery(t, "_web-prod._tcp.marathon.local.", dnsmessage.TypeSRV))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(response), 512)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(response))
+	assert.True(t, msg.Header.Truncated)
+	assert.NotEmpty(t, msg.Answers)
+	assert.Less(t, len(msg.Answers), 40)
+
+	// A larger EDNS0 payload size fits all records
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	require.NoError(t, builder.StartQuestions())
+	require.NoError(t, builder.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName("_web-prod._tcp.marathon.local."),
+		Type:  dnsmessage.TypeSRV,
+		Class: dnsmessage.ClassINET,
+	}))
+	require.NoError(t, builder.StartAdditionals())
+	var opt dnsmessage.ResourceHeader
+	require.NoError(t, opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false))
+	require.NoError(t, builder.OPTResource(opt, dnsmessage.OPTResource{}))
+	query, err := builder.Finish()
+	require.NoError(t, err)
+
+	response, err = server.answer(query)
+	require.NoError(t, err)
+	require.NoError(t, msg.Unpack(response))
+	assert.False(t, msg.Header.Truncated)
+	assert.Len(t, msg.Answers, 40)
+	require.Len(t, msg.Additionals, 1)
+	assert.Equal(t, dnsmessage.TypeOPT, msg.Additionals[0].Header.Type)
+}
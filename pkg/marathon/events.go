@@ -0,0 +1,225 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the event bus
+const (
+	EventAPIPost               = "api_post_event"
+	EventStatusUpdate          = "status_update_event"
+	EventHealthStatusChanged   = "health_status_changed_event"
+	EventDeploymentInfo        = "deployment_info"
+	EventDeploymentStepSuccess = "deployment_step_success"
+	EventDeploymentSuccess     = "deployment_success"
+	EventDeploymentFailed      = "deployment_failed"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber before
+// further events are dropped for it
+const subscriberBuffer = 256
+
+// Event is a Marathon event. Only the fields relevant to the event type are
+// set, so events serialize to the flat layout of Marathon's event stream.
+type Event struct {
+	EventType string `json:"eventType"`
+	Timestamp string `json:"timestamp"`
+
+	// api_post_event
+	AppDefinition *Application `json:"appDefinition,omitempty"`
+
+	// status_update_event and health_status_changed_event
+	AppID      string `json:"appId,omitempty"`
+	TaskID     string `json:"taskId,omitempty"`
+	TaskStatus string `json:"taskStatus,omitempty"`
+	SlaveID    string `json:"slaveId,omitempty"`
+	Host       string `json:"host,omitempty"`
+	Ports      []int  `json:"ports,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Alive      *bool  `json:"alive,omitempty"`
+
+	// deployment events
+	ID          string          `json:"id,omitempty"`
+	Plan        *Deployment     `json:"plan,omitempty"`
+	CurrentStep *DeploymentStep `json:"currentStep,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+}
+
+// EventBus fans events out to subscribers. Publishing never blocks; events
+// for subscribers that fall behind are dropped.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*subscription
+	nextID      int
+}
+
+type subscription struct {
+	events chan *Event
+	types  map[string]bool
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[int]*subscription)}
+}
+
+// Subscribe registers a subscriber for the given event types, or for all
+// events if none are given. The returned function unsubscribes and closes
+// the channel.
+func (b *EventBus) Subscribe(types ...string) (<-chan *Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{
+		events: make(chan *Event, subscriberBuffer),
+		types:  make(map[string]bool, len(types)),
+	}
+	for _, eventType := range types {
+		sub.types[eventType] = true
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = sub
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(sub.events)
+		})
+	}
+}
+
+// Publish delivers an event to all subscribers interested in its type,
+// stamping it with the current time if it has none
+func (b *EventBus) Publish(event *Event) {
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().UTC().Format(versionFormat)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subscribers {
+		if len(sub.types) > 0 && !sub.types[event.EventType] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("Dropped %s event for slow subscriber", event.EventType)
+		}
+	}
+}
+
+// snapshotDeployment copies the parts of a deployment that change as it
+// progresses, so published events are not mutated afterwards
+func snapshotDeployment(d *Deployment) *Deployment {
+	return &Deployment{
+		ID:             d.ID,
+		Version:        d.Version,
+		AffectedApps:   d.AffectedApps,
+		Steps:          d.Steps,
+		CurrentActions: d.CurrentActions,
+		CurrentStep:    d.CurrentStep,
+		TotalSteps:     d.TotalSteps,
+	}
+}
+
+// publishAPIPost publishes the definition an API call stored for an app
+func (m *Marathon) publishAPIPost(app *Application) {
+	m.Events.Publish(&Event{EventType: EventAPIPost, AppDefinition: snapshotApp(app)})
+}
+
+// publishStatusUpdate publishes a task's current state
+func (m *Marathon) publishStatusUpdate(task *MarathonTask) {
+	m.Events.Publish(&Event{
+		EventType:  EventStatusUpdate,
+		AppID:      task.AppID,
+		TaskID:     task.ID,
+		TaskStatus: task.State,
+		SlaveID:    task.SlaveID,
+		Host:       task.Host,
+		Ports:      append([]int(nil), task.Ports...),
+		Version:    task.Version,
+	})
+}
+
+// publishHealthChanged publishes a change of a task's health
+func (m *Marathon) publishHealthChanged(task *MarathonTask, alive bool) {
+	m.Events.Publish(&Event{
+		EventType: EventHealthStatusChanged,
+		AppID:     task.AppID,
+		TaskID:    task.ID,
+		Version:   task.Version,
+		Alive:     &alive,
+	})
+}
+
+// publishDeployment publishes a deployment event, including the step it
+// refers to for step events
+func (m *Marathon) publishDeployment(eventType string, d *Deployment, step *DeploymentStep, reason string) {
+	m.Events.Publish(&Event{
+		EventType:   eventType,
+		ID:          d.ID,
+		Plan:        snapshotDeployment(d),
+		CurrentStep: step,
+		Reason:      reason,
+	})
+}
+
+// handleEvents streams events as Server-Sent Events until the client
+// disconnects. Event types may be restricted with one or more event_type
+// query parameters, each holding one or more comma-separated types.
+func (m *Marathon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	types := make([]string, 0)
+	for _, param := range r.URL.Query()["event_type"] {
+		for _, eventType := range strings.Split(param, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				types = append(types, eventType)
+			}
+		}
+	}
+
+	events, unsubscribe := m.Events.Subscribe(types...)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode %s event: %v", event.EventType, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.EventType, data)
+			flusher.Flush()
+		}
+	}
+}
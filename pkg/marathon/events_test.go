@@ -0,0 +1,193 @@
+package marathon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drainEvents returns the events buffered on a subscription
+func drainEvents(events <-chan *Event) []*Event {
+	drained := make([]*Event, 0)
+	for {
+		select {
+		case event := <-events:
+			drained = append(drained, event)
+		default:
+			return drained
+		}
+	}
+}
+
+// eventTypes returns the types of the given events in order
+func eventTypes(events []*Event) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.EventType
+	}
+	return types
+}
+
+func TestEventBus_Subscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	all, unsubscribeAll := bus.Subscribe()
+	filtered, unsubscribeFiltered := bus.Subscribe(EventDeploymentFailed)
+	defer unsubscribeFiltered()
+
+	bus.Publish(&Event{EventType: EventAPIPost})
+	bus.Publish(&Event{EventType: EventDeploymentFailed})
+
+	received := drainEvents(all)
+	assert.Equal(t, []string{EventAPIPost, EventDeploymentFailed}, eventTypes(received))
+	assert.NotEmpty(t, received[0].Timestamp)
+	assert.Equal(t, []string{EventDeploymentFailed}, eventTypes(drainEvents(filtered)))
+
+	unsubscribeAll()
+	unsubscribeAll()
+	_, open := <-all
+	assert.False(t, open)
+
+	bus.Publish(&Event{EventType: EventDeploymentFailed})
+	assert.Len(t, drainEvents(filtered), 1)
+}
+
+func TestEventBus_SlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	events, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	// Publishing must not block once the subscriber's buffer is full
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(&Event{EventType: EventStatusUpdate})
+	}
+	assert.Len(t, drainEvents(events), subscriberBuffer)
+}
+
+func TestMarathon_AppEvents(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	events, unsubscribe := marathon.Events.Subscribe()
+	defer unsubscribe()
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 1, CPUs: 0.5}))
+
+	received := drainEvents(events)
+	assert.Equal(t, []string{EventStatusUpdate, EventDeploymentInfo, EventAPIPost}, eventTypes(received))
+	assert.Equal(t, "TASK_STAGING", received[0].TaskStatus)
+	assert.Equal(t, "/app.0", received[0].TaskID)
+	assert.Equal(t, ActionStartApplication, received[1].CurrentStep.Action)
+	require.NotNil(t, received[2].AppDefinition)
+	assert.Equal(t, "/app", received[2].AppDefinition.ID)
+	assert.Empty(t, received[2].AppDefinition.Tasks)
+
+	marathon.monitorTasks()
+	received = drainEvents(events)
+	assert.Equal(t, []string{EventStatusUpdate, EventDeploymentStepSuccess, EventDeploymentSuccess}, eventTypes(received))
+	assert.Equal(t, "TASK_RUNNING", received[0].TaskStatus)
+	assert.Equal(t, 1, received[2].Plan.TotalSteps)
+
+	require.NoError(t, marathon.ScaleApp("/app", 0))
+	received = drainEvents(events)
+	assert.Contains(t, eventTypes(received), EventAPIPost)
+	assert.Equal(t, "TASK_KILLED", received[0].TaskStatus)
+}
+
+func TestMarathon_DeploymentFailedEvent(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	events, unsubscribe := marathon.Events.Subscribe(EventDeploymentFailed)
+	defer unsubscribe()
+
+	deployment, err := marathon.createApp(&Application{ID: "/app", Instances: 1}, false)
+	require.NoError(t, err)
+	_, err = marathon.CancelDeployment(deployment.ID, true)
+	require.NoError(t, err)
+
+	received := drainEvents(events)
+	require.Len(t, received, 1)
+	assert.Equal(t, deployment.ID, received[0].ID)
+	assert.Equal(t, "canceled", received[0].Reason)
+}
+
+func TestMarathon_HealthStatusChangedEvent(t *testing.T) {
+	var unhealthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unhealthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	events, unsubscribe := marathon.Events.Subscribe(EventHealthStatusChanged)
+	defer unsubscribe()
+
+	startApp(t, marathon, &Application{
+		ID:           "/app",
+		Instances:    1,
+		HealthChecks: []*HealthCheck{{Protocol: "HTTP", IntervalSeconds: 1}},
+	}, server.Listener.Addr().String())
+
+	now := time.Now()
+	marathon.runHealthChecks(now)
+	marathon.runHealthChecks(now.Add(time.Second))
+	received := drainEvents(events)
+	require.Len(t, received, 1, "only changes are published")
+	assert.True(t, *received[0].Alive)
+
+	unhealthy.Store(true)
+	marathon.runHealthChecks(now.Add(2 * time.Second))
+	received = drainEvents(events)
+	require.Len(t, received, 1)
+	assert.False(t, *received[0].Alive)
+	assert.Equal(t, "/app.0", received[0].TaskID)
+}
+
+func TestMarathon_HandleEvents(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	server := httptest.NewServer(marathon.setupRoutes())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v2/events?event_type=api_post_event,deployment_success")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 0}))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() (string, *Event) {
+		var name string
+		var event Event
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			case line == "":
+				return name, &event
+			}
+		}
+	}
+
+	// A deployment without tasks finishes right away, before the API post
+	name, event := readEvent()
+	assert.Equal(t, EventDeploymentSuccess, name)
+	assert.Equal(t, EventDeploymentSuccess, event.EventType)
+
+	name, event = readEvent()
+	assert.Equal(t, EventAPIPost, name)
+	assert.Equal(t, "/app", event.AppDefinition.ID)
+}
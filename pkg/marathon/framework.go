@@ -3,7 +3,9 @@ package marathon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"sync"
@@ -12,15 +14,48 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// ErrAppNotFound is returned when an application does not exist
+var ErrAppNotFound = errors.New("application not found")
+
+// ErrTaskNotFound is returned when a task does not exist
+var ErrTaskNotFound = errors.New("task not found")
+
 // Marathon represents the Marathon framework
 type Marathon struct {
-	ID           string
-	Hostname     string
-	Port         int
-	MasterURL    string
+	ID        string
+	Hostname  string
+	Port      int
+	MasterURL string
+	// ServicePortMin and ServicePortMax bound the service ports assigned
+	// to apps
+	ServicePortMin int
+	ServicePortMax int
+	// DNSAddress enables the DNS responder on a UDP address, serving
+	// records under DNSDomain
+	DNSAddress   string
+	DNSDomain    string
 	Applications map[string]*Application
 	Deployments  map[string]*Deployment
 	Tasks        map[string]*MarathonTask
+	Agents       map[string]*AgentInfo
+	Groups       map[string]*Group
+	Jobs         map[string]*Job
+	Events       *EventBus
+	Store        Store
+	Elector      LeaderElector
+	AutoScaler   *AutoScaler
+	persisted    map[string][]byte // Values in the store by key
+	persistCh    chan struct{}     // Signals the state writer
+	startWriter  sync.Once
+	flushMu      sync.Mutex // Serializes flushes
+	elected      bool
+	cancel       context.CancelFunc
+	versions     map[string][]*Application
+	lastVersion  time.Time
+	delays       map[string]*launchDelay
+	offerStats   map[string]*offerStats
+	jobRuns      map[string][]*JobRun
+	taskIndexes  map[string]int // Next task index per app
 	mu           sync.RWMutex
 	server       *http.Server
 }
@@ -33,17 +68,26 @@ type Application struct {
 	CPUs            float64           `json:"cpus"`
 	Memory          float64           `json:"mem"`
 	HealthChecks    []*HealthCheck    `json:"healthChecks,omitempty"`
+	ReadinessChecks []*ReadinessCheck `json:"readinessChecks,omitempty"`
 	Constraints     [][]string        `json:"constraints,omitempty"`
+	Dependencies    []string          `json:"dependencies,omitempty"`
 	Labels          map[string]string `json:"labels,omitempty"`
 	Env             map[string]string `json:"env,omitempty"`
-	Tasks           []*MarathonTask   `json:"tasks,omitempty"`
-	Deployments     []*Deployment     `json:"deployments,omitempty"`
-	Version         string            `json:"version"`
-	LastTaskFailure *TaskFailure      `json:"lastTaskFailure,omitempty"`
-	TasksStaged     int               `json:"tasksStaged"`
-	TasksRunning    int               `json:"tasksRunning"`
-	TasksHealthy    int               `json:"tasksHealthy"`
-	TasksUnhealthy  int               `json:"tasksUnhealthy"`
+	PortDefinitions []*PortDefinition `json:"portDefinitions,omitempty"`
+	// Pod is set on the run specs of pods, which are not served as apps
+	Pod                   *Pod                 `json:"pod,omitempty"`
+	BackoffSeconds        int                  `json:"backoffSeconds,omitempty"`
+	BackoffFactor         float64              `json:"backoffFactor,omitempty"`
+	MaxLaunchDelaySeconds int                  `json:"maxLaunchDelaySeconds,omitempty"`
+	UnreachableStrategy   *UnreachableStrategy `json:"unreachableStrategy,omitempty"`
+	Tasks                 []*MarathonTask      `json:"tasks,omitempty"`
+	Deployments           []*Deployment        `json:"deployments,omitempty"`
+	Version               string               `json:"version"`
+	LastTaskFailure       *TaskFailure         `json:"lastTaskFailure,omitempty"`
+	TasksStaged           int                  `json:"tasksStaged"`
+	TasksRunning          int                  `json:"tasksRunning"`
+	TasksHealthy          int                  `json:"tasksHealthy"`
+	TasksUnhealthy        int                  `json:"tasksUnhealthy"`
 }
 
 // MarathonTask represents a Marathon task
@@ -51,6 +95,7 @@ type MarathonTask struct {
 	ID                 string               `json:"id"`
 	AppID              string               `json:"appId"`
 	Host               string               `json:"host"`
+	SlaveID            string               `json:"slaveId,omitempty"`
 	Ports              []int                `json:"ports"`
 	StartedAt          *time.Time           `json:"startedAt,omitempty"`
 	StagedAt           *time.Time           `json:"stagedAt,omitempty"`
@@ -59,6 +104,9 @@ type MarathonTask struct {
 	HealthCheckResults []*HealthCheckResult `json:"healthCheckResults,omitempty"`
 	ServicePorts       []int                `json:"servicePorts,omitempty"`
 	IPAddresses        []*IPAddress         `json:"ipAddresses,omitempty"`
+	UnreachableSince   *time.Time           `json:"unreachableSince,omitempty"`
+	// UnreachableInactive is set once an unreachable task has been replaced
+	UnreachableInactive bool `json:"unreachableInactive,omitempty"`
 }
 
 // Deployment represents a Marathon deployment
@@ -71,6 +119,17 @@ type Deployment struct {
 	CurrentStep           int                     `json:"currentStep"`
 	TotalSteps            int                     `json:"totalSteps"`
 	ReadinessCheckResults []*ReadinessCheckResult `json:"readinessCheckResults,omitempty"`
+
+	// original and target hold the app definitions before and after the
+	// deployment; a nil entry means the app does not exist in that state
+	original  map[string]*Application
+	target    map[string]*Application
+	startedAt time.Time
+
+	// rolling marks the deployment of a RollingUpdater update, which
+	// replaces the app's tasks itself. It is not stored, so the update
+	// resumes as a regular deployment after a restart.
+	rolling bool
 }
 
 // Container represents a container specification
@@ -124,6 +183,8 @@ type HealthCheckResult struct {
 	LastFailure         *time.Time `json:"lastFailure,omitempty"`
 	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
 	LastFailureCause    string     `json:"lastFailureCause,omitempty"`
+
+	lastChecked time.Time
 }
 
 // IPAddress represents an IP address
@@ -157,8 +218,12 @@ type DeploymentAction struct {
 
 // ReadinessCheckResult represents a readiness check result
 type ReadinessCheckResult struct {
+	Name         string                  `json:"name"`
 	TaskID       string                  `json:"taskId"`
+	Ready        bool                    `json:"ready"`
 	LastResponse *ReadinessCheckResponse `json:"lastResponse,omitempty"`
+
+	lastChecked time.Time
 }
 
 // ReadinessCheckResponse represents a readiness check response
@@ -171,18 +236,44 @@ type ReadinessCheckResponse struct {
 // NewMarathon creates a new Marathon framework
 func NewMarathon(id, hostname string, port int, masterURL string) *Marathon {
 	return &Marathon{
-		ID:           id,
-		Hostname:     hostname,
-		Port:         port,
-		MasterURL:    masterURL,
-		Applications: make(map[string]*Application),
-		Deployments:  make(map[string]*Deployment),
-		Tasks:        make(map[string]*MarathonTask),
+		ID:             id,
+		Hostname:       hostname,
+		Port:           port,
+		MasterURL:      masterURL,
+		ServicePortMin: DefaultServicePortMin,
+		ServicePortMax: DefaultServicePortMax,
+		DNSDomain:      DefaultDNSDomain,
+		Applications:   make(map[string]*Application),
+		Deployments:    make(map[string]*Deployment),
+		Tasks:          make(map[string]*MarathonTask),
+		Agents:         make(map[string]*AgentInfo),
+		Groups:         make(map[string]*Group),
+		Jobs:           make(map[string]*Job),
+		Events:         NewEventBus(),
+		versions:       make(map[string][]*Application),
+		delays:         make(map[string]*launchDelay),
+		offerStats:     make(map[string]*offerStats),
+		jobRuns:        make(map[string][]*JobRun),
+		taskIndexes:    make(map[string]int),
+		persisted:      make(map[string][]byte),
+		persistCh:      make(chan struct{}, 1),
 	}
 }
 
 // Start starts the Marathon framework
 func (m *Marathon) Start() error {
+	// Recover state persisted before a restart. In HA mode the state is
+	// recovered whenever this instance is elected instead.
+	if m.Elector != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		go m.runElection(ctx)
+	} else if m.Store != nil {
+		if err := m.Recover(); err != nil {
+			return fmt.Errorf("failed to recover state: %w", err)
+		}
+	}
+
 	router := m.setupRoutes()
 
 	m.server = &http.Server{
@@ -195,14 +286,37 @@ func (m *Marathon) Start() error {
 	// Start task monitoring
 	go m.startTaskMonitoring()
 
+	// Start health and readiness checking
+	go m.startHealthChecking()
+
+	// Start firing job schedules
+	go m.startJobScheduling()
+
 	// Register with Mesos master
 	go m.registerWithMaster()
 
+	// Serve DNS records for app endpoints if enabled
+	if m.DNSAddress != "" {
+		dns := NewDNSServer(m, m.DNSDomain)
+		go func() {
+			if err := dns.ListenAndServe(m.DNSAddress); err != nil {
+				log.Printf("DNS responder stopped: %v", err)
+			}
+		}()
+	}
+
 	return m.server.ListenAndServe()
 }
 
 // Stop stops the Marathon framework
 func (m *Marathon) Stop() error {
+	// Store pending changes, then leave the election so another instance
+	// takes over
+	m.flush()
+	if m.cancel != nil {
+		m.cancel()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	return m.server.Shutdown(ctx)
@@ -212,31 +326,88 @@ func (m *Marathon) Stop() error {
 func (m *Marathon) setupRoutes() *mux.Router {
 	router := mux.NewRouter()
 
-	// API v2 routes
+	// API v2 routes. Writes reaching a non-leader go to the leader.
 	v2 := router.PathPrefix("/v2").Subrouter()
+	v2.Use(m.proxyToLeader)
 
-	// Applications
+	// Applications. IDs may contain slashes, so routes with a suffix after
+	// the ID are registered before the plain ID routes.
 	v2.HandleFunc("/apps", m.handleListApps).Methods("GET")
 	v2.HandleFunc("/apps", m.handleCreateApp).Methods("POST")
-	v2.HandleFunc("/apps/{id}", m.handleGetApp).Methods("GET")
-	v2.HandleFunc("/apps/{id}", m.handleUpdateApp).Methods("PUT")
-	v2.HandleFunc("/apps/{id}", m.handleDeleteApp).Methods("DELETE")
-	v2.HandleFunc("/apps/{id}/restart", m.handleRestartApp).Methods("POST")
-	v2.HandleFunc("/apps/{id}/scale", m.handleScaleApp).Methods("PUT")
+	v2.HandleFunc("/apps/{id:.+}/restart", m.handleRestartApp).Methods("POST")
+	v2.HandleFunc("/apps/{id:.+}/scale", m.handleScaleApp).Methods("PUT")
+	v2.HandleFunc("/apps/{id:.+}/tasks", m.handleListAppTasks).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}/health", m.handleAppHealth).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}/autoscaler/history", m.handleGetScaleHistory).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}/autoscaler", m.handleGetAutoScaler).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}/autoscaler", m.handlePutAutoScaler).Methods("PUT")
+	v2.HandleFunc("/apps/{id:.+}/autoscaler", m.handleDeleteAutoScaler).Methods("DELETE")
+	v2.HandleFunc("/apps/{id:.+}/versions/{version}", m.handleGetAppVersion).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}/versions", m.handleListAppVersions).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}", m.handleGetApp).Methods("GET")
+	v2.HandleFunc("/apps/{id:.+}", m.handleUpdateApp).Methods("PUT")
+	v2.HandleFunc("/apps/{id:.+}", m.handleDeleteApp).Methods("DELETE")
+
+	// Groups
+	v2.HandleFunc("/groups", m.handleGetGroup).Methods("GET")
+	v2.HandleFunc("/groups", m.handleCreateGroup).Methods("POST")
+	v2.HandleFunc("/groups/{id:.+}", m.handleGetGroup).Methods("GET")
+	v2.HandleFunc("/groups/{id:.+}", m.handleUpdateGroup).Methods("PUT")
+	v2.HandleFunc("/groups/{id:.+}", m.handleDeleteGroup).Methods("DELETE")
 
 	// Tasks
 	v2.HandleFunc("/tasks", m.handleListTasks).Methods("GET")
-	v2.HandleFunc("/apps/{id}/tasks", m.handleListAppTasks).Methods("GET")
-	v2.HandleFunc("/tasks/{id}", m.handleGetTask).Methods("GET")
-	v2.HandleFunc("/tasks/{id}/kill", m.handleKillTask).Methods("DELETE")
+	v2.HandleFunc("/tasks/{id:.+}/kill", m.handleKillTask).Methods("DELETE")
+	v2.HandleFunc("/tasks/{id:.+}", m.handleGetTask).Methods("GET")
 
 	// Deployments
 	v2.HandleFunc("/deployments", m.handleListDeployments).Methods("GET")
 	v2.HandleFunc("/deployments/{id}", m.handleGetDeployment).Methods("GET")
 	v2.HandleFunc("/deployments/{id}", m.handleDeleteDeployment).Methods("DELETE")
 
-	// Health checks
-	v2.HandleFunc("/apps/{id}/health", m.handleAppHealth).Methods("GET")
+	// Service discovery
+	v2.HandleFunc("/discovery", m.handleDiscovery).Methods("GET")
+	v2.HandleFunc("/discovery/{id:.+}", m.handleAppDiscovery).Methods("GET")
+
+	// Pods. Status, version and instance routes carry a "::" suffix and
+	// are registered before the plain ID routes.
+	v2.HandleFunc("/pods", m.handleListPods).Methods("GET")
+	v2.HandleFunc("/pods", m.handleCreatePod).Methods("POST")
+	v2.HandleFunc("/pods/::status", m.handleListPodStatus).Methods("GET")
+	v2.HandleFunc("/pods/{id:.+}::status", m.handleGetPodStatus).Methods("GET")
+	v2.HandleFunc("/pods/{id:.+}::versions/{version}", m.handleGetPodVersion).Methods("GET")
+	v2.HandleFunc("/pods/{id:.+}::versions", m.handleListPodVersions).Methods("GET")
+	v2.HandleFunc("/pods/{id:.+}::instances/{instance:.+}", m.handleKillPodInstance).Methods("DELETE")
+	v2.HandleFunc("/pods/{id:.+}", m.handleGetPod).Methods("GET")
+	v2.HandleFunc("/pods/{id:.+}", m.handleUpdatePod).Methods("PUT")
+	v2.HandleFunc("/pods/{id:.+}", m.handleDeletePod).Methods("DELETE")
+
+	// Launch queue
+	v2.HandleFunc("/queue", m.handleGetQueue).Methods("GET")
+	v2.HandleFunc("/queue/{id:.+}/delay", m.handleResetDelay).Methods("DELETE")
+
+	// Autoscaling configs of all apps
+	v2.HandleFunc("/autoscaler", m.handleListAutoScalers).Methods("GET")
+
+	// Events
+	v2.HandleFunc("/events", m.handleEvents).Methods("GET")
+
+	// Leadership and instance info
+	v2.HandleFunc("/leader", m.handleGetLeader).Methods("GET")
+	v2.HandleFunc("/info", m.handleInfo).Methods("GET")
+
+	// Jobs API v1, as served by Metronome. Job IDs contain no slashes.
+	v1 := router.PathPrefix("/v1").Subrouter()
+	v1.Use(m.proxyToLeader)
+	v1.HandleFunc("/jobs", m.handleListJobs).Methods("GET")
+	v1.HandleFunc("/jobs", m.handleCreateJob).Methods("POST")
+	v1.HandleFunc("/jobs/{id}/runs", m.handleListJobRuns).Methods("GET")
+	v1.HandleFunc("/jobs/{id}/runs", m.handleStartJobRun).Methods("POST")
+	v1.HandleFunc("/jobs/{id}/runs/{runId}", m.handleGetJobRun).Methods("GET")
+	v1.HandleFunc("/jobs/{id}/runs/{runId}/actions/stop", m.handleStopJobRun).Methods("POST")
+	v1.HandleFunc("/jobs/{id}", m.handleGetJob).Methods("GET")
+	v1.HandleFunc("/jobs/{id}", m.handleUpdateJob).Methods("PUT")
+	v1.HandleFunc("/jobs/{id}", m.handleDeleteJob).Methods("DELETE")
 
 	// Health check
 	router.HandleFunc("/ping", m.handlePing).Methods("GET")
@@ -253,7 +424,9 @@ func (m *Marathon) startTaskMonitoring() {
 	for {
 		select {
 		case <-ticker.C:
-			m.monitorTasks()
+			if m.IsLeader() {
+				m.monitorTasks()
+			}
 		}
 	}
 }
@@ -268,23 +441,66 @@ func (m *Marathon) registerWithMaster() {
 func (m *Marathon) monitorTasks() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.persist()
 
+	now := time.Now()
 	for _, task := range m.Tasks {
-		// Simulate task health monitoring
+		// Simulate task health monitoring. Tasks of apps in launch backoff
+		// and retries of job runs in backoff keep waiting.
+		if app := m.Applications[task.AppID]; app != nil && m.launchDelayed(app, now) {
+			continue
+		}
+		run := m.jobRunForTask(task)
+		if run != nil && run.retryDelayed(now) {
+			continue
+		}
 		if task.State == "TASK_STAGING" {
 			task.State = "TASK_RUNNING"
-			now := time.Now()
 			task.StartedAt = &now
+			m.publishStatusUpdate(task)
+			if run != nil {
+				m.jobTaskUpdate(run, task, "", now)
+			}
 		}
 	}
+
+	m.expireUnreachable(now)
+
+	for _, app := range m.Applications {
+		m.updateTaskCounts(app)
+	}
+	m.advanceDeployments()
 }
 
-// CreateApp creates a new application
+// CreateApp creates a new application. Like the other programmatic
+// mutators below it supersedes any deployment in progress for the app; the
+// HTTP API instead rejects such conflicts unless force=true is given.
 func (m *Marathon) CreateApp(app *Application) error {
+	_, err := m.createApp(app, true)
+	return err
+}
+
+func (m *Marathon) createApp(app *Application, force bool) (*Deployment, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.persist()
+
+	if _, exists := m.Applications[app.ID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrAppExists, app.ID)
+	}
+	deployment, err := m.deploy(map[string]*Application{app.ID: app}, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	m.publishAPIPost(app)
+	log.Printf("Created application %s with %d instances", app.ID, app.Instances)
+	return deployment, nil
+}
 
-	app.Version = time.Now().Format("2006-01-02T15:04:05.000Z")
+// launchApp registers an application and stages its tasks. The caller must
+// hold m.mu.
+func (m *Marathon) launchApp(app *Application) {
 	app.Tasks = make([]*MarathonTask, 0)
 	app.Deployments = make([]*Deployment, 0)
 	app.TasksStaged = 0
@@ -294,37 +510,17 @@ func (m *Marathon) CreateApp(app *Application) error {
 
 	m.Applications[app.ID] = app
 
-	// Create initial deployment
-	deployment := &Deployment{
-		ID:             fmt.Sprintf("deployment-%d", time.Now().UnixNano()),
-		Version:        app.Version,
-		AffectedApps:   []string{app.ID},
-		Steps:          []*DeploymentStep{{Action: "StartApplication", App: app.ID}},
-		CurrentActions: []*DeploymentAction{{Action: "StartApplication", App: app.ID}},
-		CurrentStep:    0,
-		TotalSteps:     1,
-	}
-
-	m.Deployments[deployment.ID] = deployment
-	app.Deployments = append(app.Deployments, deployment)
-
 	// Launch tasks
 	for i := 0; i < app.Instances; i++ {
-		task := m.createTask(app, i)
-		m.Tasks[task.ID] = task
-		app.Tasks = append(app.Tasks, task)
-		app.TasksStaged++
+		m.stageTask(app)
 	}
-
-	log.Printf("Created application %s with %d instances", app.ID, app.Instances)
-	return nil
 }
 
 // createTask creates a task for an application
 func (m *Marathon) createTask(app *Application, index int) *MarathonTask {
 	taskID := fmt.Sprintf("%s.%d", app.ID, index)
 
-	return &MarathonTask{
+	task := &MarathonTask{
 		ID:       taskID,
 		AppID:    app.ID,
 		Host:     "localhost", // In real implementation, this would be assigned by Mesos
@@ -333,100 +529,210 @@ func (m *Marathon) createTask(app *Application, index int) *MarathonTask {
 		State:    "TASK_STAGING",
 		StagedAt: &[]time.Time{time.Now()}[0],
 	}
+	if ports := servicePorts(app); len(ports) > 0 {
+		task.ServicePorts = ports
+	}
+	return task
 }
 
 // UpdateApp updates an existing application
 func (m *Marathon) UpdateApp(appID string, app *Application) error {
+	_, err := m.updateApp(appID, app, true)
+	return err
+}
+
+func (m *Marathon) updateApp(appID string, app *Application, force bool) (*Deployment, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.persist()
 
-	existing, exists := m.Applications[appID]
-	if !exists {
-		return fmt.Errorf("application %s not found", appID)
+	if existing, exists := m.Applications[appID]; !exists || existing.Pod != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
 	}
 
-	// Update application
-	app.Version = time.Now().Format("2006-01-02T15:04:05.000Z")
-	app.Tasks = existing.Tasks
-	app.Deployments = existing.Deployments
-
-	m.Applications[appID] = app
-
-	// Create deployment for update
-	deployment := &Deployment{
-		ID:             fmt.Sprintf("deployment-%d", time.Now().UnixNano()),
-		Version:        app.Version,
-		AffectedApps:   []string{appID},
-		Steps:          []*DeploymentStep{{Action: "RestartApplication", App: appID}},
-		CurrentActions: []*DeploymentAction{{Action: "RestartApplication", App: appID}},
-		CurrentStep:    0,
-		TotalSteps:     1,
+	app.ID = appID
+	deployment, err := m.deploy(map[string]*Application{appID: app}, nil, force)
+	if err != nil {
+		return nil, err
 	}
 
-	m.Deployments[deployment.ID] = deployment
-	app.Deployments = append(app.Deployments, deployment)
-
+	m.publishAPIPost(app)
 	log.Printf("Updated application %s", appID)
-	return nil
+	return deployment, nil
+}
+
+// replaceApp swaps in a new definition for an existing application, keeping
+// its tasks and deployment history. The caller must hold m.mu.
+func (m *Marathon) replaceApp(existing, app *Application) {
+	app.ID = existing.ID
+	app.Tasks = existing.Tasks
+	app.Deployments = existing.Deployments
+	app.TasksStaged = existing.TasksStaged
+	app.TasksRunning = existing.TasksRunning
+	app.TasksHealthy = existing.TasksHealthy
+	app.TasksUnhealthy = existing.TasksUnhealthy
+
+	m.Applications[existing.ID] = app
 }
 
 // DeleteApp deletes an application
 func (m *Marathon) DeleteApp(appID string) error {
+	_, err := m.deleteApp(appID, true)
+	return err
+}
+
+func (m *Marathon) deleteApp(appID string, force bool) (*Deployment, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.persist()
 
-	app, exists := m.Applications[appID]
-	if !exists {
-		return fmt.Errorf("application %s not found", appID)
+	if existing, exists := m.Applications[appID]; !exists || existing.Pod != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
 	}
 
-	// Kill all tasks
-	for _, task := range app.Tasks {
-		delete(m.Tasks, task.ID)
+	deployment, err := m.deploy(map[string]*Application{appID: nil}, nil, force)
+	if err != nil {
+		return nil, err
 	}
 
-	// Remove application
-	delete(m.Applications, appID)
-
 	log.Printf("Deleted application %s", appID)
-	return nil
+	return deployment, nil
+}
+
+// stopApp kills all tasks of an application and removes it. The caller must
+// hold m.mu.
+func (m *Marathon) stopApp(appID string) {
+	// Kill all tasks, including records of tasks killed earlier
+	for taskID, task := range m.Tasks {
+		if task.AppID == appID {
+			if task.State == "TASK_STAGING" || task.State == "TASK_RUNNING" {
+				task.State = "TASK_KILLED"
+				m.publishStatusUpdate(task)
+			}
+			delete(m.Tasks, taskID)
+		}
+	}
+
+	// Remove application, its stored definitions and launch queue state
+	delete(m.Applications, appID)
+	delete(m.versions, appID)
+	delete(m.delays, appID)
+	delete(m.offerStats, appID)
+	delete(m.taskIndexes, appID)
 }
 
 // ScaleApp scales an application
 func (m *Marathon) ScaleApp(appID string, instances int) error {
+	_, err := m.scaleAppDeployment(appID, instances, true)
+	return err
+}
+
+func (m *Marathon) scaleAppDeployment(appID string, instances int, force bool) (*Deployment, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.persist()
 
 	app, exists := m.Applications[appID]
-	if !exists {
-		return fmt.Errorf("application %s not found", appID)
+	if !exists || app.Pod != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+
+	oldInstances := app.Instances
+	target := snapshotApp(app)
+	target.Instances = instances
+
+	deployment, err := m.deploy(map[string]*Application{appID: target}, nil, force)
+	if err != nil {
+		return nil, err
 	}
 
+	m.publishAPIPost(target)
+	log.Printf("Scaled application %s from %d to %d instances", appID, oldInstances, instances)
+	return deployment, nil
+}
+
+// scaleApp stages or kills tasks to reach the given instance count. The
+// caller must hold m.mu.
+func (m *Marathon) scaleApp(app *Application, instances int) {
 	oldInstances := app.Instances
 	app.Instances = instances
 
 	if instances > oldInstances {
 		// Scale up - add new tasks
 		for i := oldInstances; i < instances; i++ {
-			task := m.createTask(app, i)
-			m.Tasks[task.ID] = task
-			app.Tasks = append(app.Tasks, task)
-			app.TasksStaged++
+			m.stageTask(app)
 		}
 	} else if instances < oldInstances {
-		// Scale down - remove tasks
-		for i := instances; i < oldInstances; i++ {
-			taskID := fmt.Sprintf("%s.%d", appID, i)
-			if task, exists := m.Tasks[taskID]; exists {
-				task.State = "TASK_KILLED"
-				delete(m.Tasks, taskID)
-				app.TasksRunning--
-			}
+		// Scale down - kill tasks chosen to keep constraint groups balanced
+		for _, task := range m.selectTasksToKill(app, oldInstances-instances) {
+			m.killAppTask(app, task)
 		}
 	}
+}
 
-	log.Printf("Scaled application %s from %d to %d instances", appID, oldInstances, instances)
-	return nil
+// stageTask creates a new task for an application under the next free task
+// ID and stages it. The caller must hold m.mu.
+func (m *Marathon) stageTask(app *Application) *MarathonTask {
+	_, index := m.nextTaskID(app)
+	task := m.createTask(app, index)
+	m.Tasks[task.ID] = task
+	app.Tasks = append(app.Tasks, task)
+	app.TasksStaged++
+	m.publishStatusUpdate(task)
+	return task
+}
+
+// killAppTask marks a task as killed and removes it from its application
+// and the known tasks
+func (m *Marathon) killAppTask(app *Application, task *MarathonTask) {
+	switch task.State {
+	case "TASK_STAGING":
+		app.TasksStaged--
+	case "TASK_RUNNING":
+		app.TasksRunning--
+	}
+	task.State = "TASK_KILLED"
+	m.publishStatusUpdate(task)
+	m.removeAppTask(app, task)
+	delete(m.Tasks, task.ID)
+}
+
+// removeAppTask removes a task from its application's task list
+func (m *Marathon) removeAppTask(app *Application, task *MarathonTask) {
+	for i, t := range app.Tasks {
+		if t.ID == task.ID {
+			app.Tasks = append(app.Tasks[:i], app.Tasks[i+1:]...)
+			break
+		}
+	}
+}
+
+// appIDFromRequest returns the ID of the app addressed by a request. Path
+// parameters lack the leading slash of absolute app IDs, so the absolute form
+// is used when such an app exists.
+func (m *Marathon) appIDFromRequest(r *http.Request) string {
+	id := mux.Vars(r)["id"]
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.Applications["/"+id]; exists {
+		return "/" + id
+	}
+	return id
+}
+
+// taskIDFromRequest returns the ID of the task addressed by a request
+func (m *Marathon) taskIDFromRequest(r *http.Request) string {
+	id := mux.Vars(r)["id"]
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.Tasks["/"+id]; exists {
+		return "/" + id
+	}
+	return id
 }
 
 // HTTP handlers
@@ -436,7 +742,9 @@ func (m *Marathon) handleListApps(w http.ResponseWriter, r *http.Request) {
 
 	apps := make([]*Application, 0, len(m.Applications))
 	for _, app := range m.Applications {
-		apps = append(apps, app)
+		if app.Pod == nil {
+			apps = append(apps, app)
+		}
 	}
 
 	response := map[string]interface{}{
@@ -448,14 +756,18 @@ func (m *Marathon) handleListApps(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleCreateApp(w http.ResponseWriter, r *http.Request) {
-	var app Application
-	if err := json.NewDecoder(r.Body).Decode(&app); err != nil {
+	app := defaultApp()
+	if err := json.NewDecoder(r.Body).Decode(app); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := ValidateApp(app); err != nil {
+		writeError(w, err)
+		return
+	}
 
-	if err := m.CreateApp(&app); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := m.createApp(app, forceParam(r)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -464,14 +776,13 @@ func (m *Marathon) handleCreateApp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleGetApp(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	app, exists := m.Applications[appID]
-	if !exists {
+	if !exists || app.Pod != nil {
 		http.NotFound(w, r)
 		return
 	}
@@ -481,17 +792,43 @@ func (m *Marathon) handleGetApp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleUpdateApp(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A body of the form {"version": "..."} rolls back to a stored version
+	version, rollback, err := rollbackVersion(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rollback {
+		deployment, err := m.rollbackApp(appID, version, forceParam(r))
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeDeploymentResult(w, deployment)
+		return
+	}
 
-	var app Application
-	if err := json.NewDecoder(r.Body).Decode(&app); err != nil {
+	app := defaultApp()
+	if err := json.Unmarshal(body, app); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	app.ID = appID
+	if err := ValidateApp(app); err != nil {
+		writeError(w, err)
+		return
+	}
 
-	if err := m.UpdateApp(appID, &app); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := m.updateApp(appID, app, forceParam(r)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -500,11 +837,10 @@ func (m *Marathon) handleUpdateApp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleDeleteApp(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
 
-	if err := m.DeleteApp(appID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := m.deleteApp(appID, forceParam(r)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -512,8 +848,7 @@ func (m *Marathon) handleDeleteApp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleRestartApp(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
 
 	// In a real implementation, this would restart the application
 	log.Printf("Restarting application %s", appID)
@@ -522,8 +857,7 @@ func (m *Marathon) handleRestartApp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleScaleApp(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
 
 	var request struct {
 		Instances int `json:"instances"`
@@ -534,8 +868,8 @@ func (m *Marathon) handleScaleApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := m.ScaleApp(appID, request.Instances); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := m.scaleAppDeployment(appID, request.Instances, forceParam(r)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -560,8 +894,7 @@ func (m *Marathon) handleListTasks(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleListAppTasks(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -577,8 +910,7 @@ func (m *Marathon) handleListAppTasks(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleGetTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	taskID := vars["id"]
+	taskID := m.taskIDFromRequest(r)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -594,14 +926,16 @@ func (m *Marathon) handleGetTask(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Marathon) handleKillTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	taskID := vars["id"]
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	taskID := m.taskIDFromRequest(r)
 
-	if task, exists := m.Tasks[taskID]; exists {
-		task.State = "TASK_KILLED"
+	// Killed tasks are replaced unless the app is scaled down instead
+	kill := m.KillTask
+	if r.URL.Query().Get("scale") == "true" {
+		kill = m.KillTaskAndScale
+	}
+	if err := kill(taskID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -637,21 +971,8 @@ func (m *Marathon) handleGetDeployment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(deployment)
 }
 
-func (m *Marathon) handleDeleteDeployment(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	deploymentID := vars["id"]
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	delete(m.Deployments, deploymentID)
-
-	w.WriteHeader(http.StatusOK)
-}
-
 func (m *Marathon) handleAppHealth(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	appID := vars["id"]
+	appID := m.appIDFromRequest(r)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -672,6 +993,28 @@ func (m *Marathon) handleAppHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
+// errorStatus maps an error returned by the Marathon API to an HTTP status
+func errorStatus(err error) int {
+	var constraintErr *ConstraintError
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr), errors.Is(err, ErrInvalidAutoScaleConfig):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &constraintErr), errors.Is(err, ErrInvalidDependencies), errors.Is(err, ErrInvalidHealthCheck),
+		errors.Is(err, ErrInvalidPod):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAppNotFound), errors.Is(err, ErrTaskNotFound), errors.Is(err, ErrVersionNotFound), errors.Is(err, ErrPodNotFound),
+		errors.Is(err, ErrJobNotFound), errors.Is(err, ErrJobRunNotFound), errors.Is(err, ErrNotAutoScaled),
+		errors.Is(err, ErrGroupNotFound), errors.Is(err, ErrDeploymentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrGroupExists), errors.Is(err, ErrDeploymentConflict), errors.Is(err, ErrServicePortInUse),
+		errors.Is(err, ErrPodExists), errors.Is(err, ErrAppExists),
+		errors.Is(err, ErrJobExists), errors.Is(err, ErrJobRunsActive):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 func (m *Marathon) handlePing(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
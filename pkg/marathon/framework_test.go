@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewMarathon(t *testing.T) {
@@ -156,9 +157,11 @@ func TestMarathon_CreateAppDuplicate(t *testing.T) {
 	err := marathon.CreateApp(app)
 	assert.NoError(t, err)
 
-	// Try to create same app again
-	err = marathon.CreateApp(app)
-	assert.NoError(t, err) // Should overwrite existing app
+	// Creating the same app again is rejected
+	err = marathon.CreateApp(&Application{ID: "/test/app", Instances: 3, CPUs: 1.0})
+	assert.ErrorIs(t, err, ErrAppExists)
+	assert.Equal(t, http.StatusConflict, errorStatus(err))
+	assert.Equal(t, 1, marathon.Applications["/test/app"].Instances)
 }
 
 func TestMarathon_UpdateApp(t *testing.T) {
@@ -192,7 +195,7 @@ func TestMarathon_UpdateApp(t *testing.T) {
 	assert.Equal(t, 2.0, storedApp.CPUs)
 	assert.Equal(t, 2048.0, storedApp.Memory)
 	assert.NotEqual(t, originalApp.Version, storedApp.Version)
-	assert.Len(t, storedApp.Deployments, 2) // Original + update deployment
+	assert.Len(t, storedApp.Deployments, 1) // The update superseded the original deployment
 }
 
 func TestMarathon_UpdateAppNotFound(t *testing.T) {
@@ -286,14 +289,11 @@ func TestMarathon_ScaleApp(t *testing.T) {
 	assert.Equal(t, 3, storedApp.Instances)
 	assert.Len(t, storedApp.Tasks, 3)
 
-	// Verify tasks were killed
-	killedTasks := 0
-	for _, task := range marathon.Tasks {
-		if task.State == "TASK_KILLED" {
-			killedTasks++
-		}
+	// Verify killed tasks are forgotten
+	assert.Len(t, marathon.Tasks, 3) // 5 - 3 = 2 tasks killed
+	for _, task := range storedApp.Tasks {
+		assert.Contains(t, marathon.Tasks, task.ID)
 	}
-	assert.Equal(t, 2, killedTasks) // 5 - 3 = 2 tasks killed
 }
 
 func TestMarathon_ScaleAppNotFound(t *testing.T) {
@@ -496,7 +496,8 @@ func TestMarathon_HandleUpdateApp(t *testing.T) {
 	var buf bytes.Buffer
 	json.NewEncoder(&buf).Encode(updatedApp)
 	
-	req := httptest.NewRequest("PUT", "/v2/apps/test-app", &buf)
+	// The create deployment is still in progress, so the update must be forced
+	req := httptest.NewRequest("PUT", "/v2/apps/test-app?force=true", &buf)
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
@@ -558,7 +559,8 @@ func TestMarathon_HandleScaleApp(t *testing.T) {
 	var buf bytes.Buffer
 	json.NewEncoder(&buf).Encode(scaleRequest)
 	
-	req := httptest.NewRequest("PUT", "/v2/apps/test-app/scale", &buf)
+	// The create deployment is still in progress, so the scale must be forced
+	req := httptest.NewRequest("PUT", "/v2/apps/test-app/scale?force=true", &buf)
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
@@ -649,22 +651,35 @@ func TestMarathon_HandleGetTaskNotFound(t *testing.T) {
 
 func TestMarathon_HandleKillTask(t *testing.T) {
 	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
 
 	// Create test app
-	app := &Application{ID: "/test/app", Instances: 1, CPUs: 1.0, Memory: 1024.0}
-	marathon.CreateApp(app)
+	app := &Application{ID: "/test/app", Instances: 2, CPUs: 1.0, Memory: 1024.0}
+	require.NoError(t, marathon.CreateApp(app))
+	completeDeployments(t, marathon)
+	require.Len(t, app.Tasks, 2)
 
-	taskID := "/test/app.0"
-	req := httptest.NewRequest("DELETE", "/v2/tasks/"+taskID+"/kill", nil)
+	// Killed tasks are replaced
+	killed := app.Tasks[0].ID
 	rr := httptest.NewRecorder()
-
-	marathon.handleKillTask(rr, req)
-
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/v2/tasks"+killed+"/kill", nil))
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, marathon.Tasks, killed)
+	assert.Equal(t, 2, app.Instances)
+	assert.Len(t, app.Tasks, 2)
+
+	// Unless the app is scaled down instead
+	killed = app.Tasks[0].ID
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/v2/tasks"+killed+"/kill?scale=true", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, marathon.Tasks, killed)
+	assert.Equal(t, 1, app.Instances)
+	assert.Len(t, app.Tasks, 1)
 
-	// Verify task was killed
-	task := marathon.Tasks[taskID]
-	assert.Equal(t, "TASK_KILLED", task.State)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/v2/tasks"+killed+"/kill", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
 func TestMarathon_HandleListDeployments(t *testing.T) {
@@ -0,0 +1,568 @@
+package marathon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// rootGroupID is the ID of the implicit group containing everything
+const rootGroupID = "/"
+
+var (
+	// ErrGroupNotFound is returned when a group does not exist
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupExists is returned when creating a group or app that already exists
+	ErrGroupExists = errors.New("group already exists")
+	// ErrInvalidDependencies is returned for unknown or cyclic dependencies
+	ErrInvalidDependencies = errors.New("invalid dependencies")
+)
+
+// Group represents a Marathon application group. Apps and subgroups may use
+// IDs relative to the group they are nested in.
+type Group struct {
+	ID           string         `json:"id"`
+	Apps         []*Application `json:"apps"`
+	Pods         []*Pod         `json:"pods,omitempty"`
+	Groups       []*Group       `json:"groups"`
+	Dependencies []string       `json:"dependencies,omitempty"`
+	Version      string         `json:"version,omitempty"`
+}
+
+// GroupUpdate is the body of a group update. When ScaleBy is set the group's
+// apps are scaled by that factor and the definition is otherwise ignored.
+type GroupUpdate struct {
+	Group
+	ScaleBy *float64 `json:"scaleBy,omitempty"`
+}
+
+// canonicalID returns the absolute, cleaned form of an app or group ID
+func canonicalID(id string) string {
+	return path.Clean("/" + id)
+}
+
+// resolveID resolves a possibly relative ID against its parent group
+func resolveID(parent, id string) string {
+	if strings.HasPrefix(id, "/") {
+		return path.Clean(id)
+	}
+	return path.Join(canonicalID(parent), id)
+}
+
+// parentID returns the ID of the group containing an app or group
+func parentID(id string) string {
+	return path.Dir(canonicalID(id))
+}
+
+// isDescendant reports whether id is nested anywhere below groupID
+func isDescendant(groupID, id string) bool {
+	groupID, id = canonicalID(groupID), canonicalID(id)
+	if groupID == rootGroupID {
+		return id != rootGroupID
+	}
+	return strings.HasPrefix(id, groupID+"/")
+}
+
+// childOf returns the ID of the direct child of groupID on the path to id
+func childOf(groupID, id string) string {
+	groupID, id = canonicalID(groupID), canonicalID(id)
+	if !isDescendant(groupID, id) {
+		return ""
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(id, groupID), "/")
+	return path.Join(groupID, strings.SplitN(rest, "/", 2)[0])
+}
+
+// groupExists reports whether a group was created explicitly or is implied
+// by the ID of an application nested in it
+func (m *Marathon) groupExists(groupID string) bool {
+	groupID = canonicalID(groupID)
+	if groupID == rootGroupID {
+		return true
+	}
+	if _, exists := m.Groups[groupID]; exists {
+		return true
+	}
+	for id := range m.Groups {
+		if isDescendant(groupID, id) {
+			return true
+		}
+	}
+	for id := range m.Applications {
+		if isDescendant(groupID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// appsInGroup returns all apps nested anywhere below a group
+func (m *Marathon) appsInGroup(groupID string) []*Application {
+	apps := make([]*Application, 0)
+	for _, app := range m.sortedApps() {
+		if isDescendant(groupID, app.ID) {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// flattenGroup resolves the IDs of a group definition and collects its
+// subgroups and apps, including the run specs of its pods
+func flattenGroup(parent string, group *Group, groups map[string]*Group, apps map[string]*Application) error {
+	groupID := resolveID(parent, group.ID)
+	deps := make([]string, len(group.Dependencies))
+	for i, dep := range group.Dependencies {
+		deps[i] = resolveID(parentID(groupID), dep)
+	}
+	groups[groupID] = &Group{ID: groupID, Dependencies: deps}
+
+	for _, app := range group.Apps {
+		app.ID = resolveID(groupID, app.ID)
+		for i, dep := range app.Dependencies {
+			app.Dependencies[i] = resolveID(groupID, dep)
+		}
+		apps[app.ID] = app
+	}
+	for _, pod := range group.Pods {
+		pod.ID = resolveID(groupID, pod.ID)
+		app, err := podRunSpec(pod)
+		if err != nil {
+			return err
+		}
+		apps[app.ID] = app
+	}
+	for _, sub := range group.Groups {
+		if err := flattenGroup(groupID, sub, groups, apps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appDependencies returns the apps an app depends on, including the
+// dependencies declared by its enclosing groups. Group dependencies expand
+// to every app in that group.
+func (m *Marathon) appDependencies(app *Application, groups map[string]*Group, apps map[string]*Application) ([]string, error) {
+	declared := make([]string, 0, len(app.Dependencies))
+	for _, dep := range app.Dependencies {
+		declared = append(declared, resolveID(parentID(app.ID), dep))
+	}
+	for groupID := parentID(app.ID); ; groupID = parentID(groupID) {
+		if group, exists := groups[groupID]; exists {
+			declared = append(declared, group.Dependencies...)
+		} else if group, exists := m.Groups[groupID]; exists {
+			declared = append(declared, group.Dependencies...)
+		}
+		if groupID == rootGroupID {
+			break
+		}
+	}
+
+	deps := make([]string, 0, len(declared))
+	for _, dep := range declared {
+		found := false
+		for id := range apps {
+			if canonicalID(id) == dep || isDescendant(dep, id) {
+				deps = append(deps, id)
+				found = true
+			}
+		}
+		for id := range m.Applications {
+			if canonicalID(id) == dep || isDescendant(dep, id) {
+				found = true
+			}
+		}
+		if _, exists := groups[dep]; exists {
+			found = true
+		}
+		if !found && !m.groupExists(dep) {
+			return nil, fmt.Errorf("%w: app %s depends on unknown %s", ErrInvalidDependencies, app.ID, dep)
+		}
+	}
+	return deps, nil
+}
+
+// dependencyOrder sorts apps so that every app comes after the apps it
+// depends on. Dependencies outside the given set are assumed to be running.
+func (m *Marathon) dependencyOrder(groups map[string]*Group, apps map[string]*Application) ([]*Application, error) {
+	pending := make(map[string]int, len(apps))
+	dependents := make(map[string][]string, len(apps))
+	for id, app := range apps {
+		deps, err := m.appDependencies(app, groups, apps)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range deps {
+			if dep == id {
+				continue
+			}
+			pending[id]++
+			dependents[dep] = append(dependents[dep], id)
+		}
+	}
+
+	ready := make([]string, 0, len(apps))
+	for id := range apps {
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	ordered := make([]*Application, 0, len(apps))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		id := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, apps[id])
+
+		for _, dependent := range dependents[id] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(ordered) != len(apps) {
+		return nil, fmt.Errorf("%w: dependency cycle between apps", ErrInvalidDependencies)
+	}
+	return ordered, nil
+}
+
+// GetGroup returns the group tree rooted at groupID
+func (m *Marathon) GetGroup(groupID string) (*Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.groupExists(groupID) {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, groupID)
+	}
+	return m.buildGroup(canonicalID(groupID)), nil
+}
+
+// buildGroup assembles the tree view of a group from the flat app and group maps
+func (m *Marathon) buildGroup(groupID string) *Group {
+	group := &Group{ID: groupID, Apps: []*Application{}, Groups: []*Group{}}
+	if stored, exists := m.Groups[groupID]; exists {
+		group.Dependencies = stored.Dependencies
+		group.Version = stored.Version
+	}
+
+	children := make(map[string]bool)
+	for _, app := range m.sortedApps() {
+		if parentID(app.ID) == groupID && app.Pod != nil {
+			group.Pods = append(group.Pods, podDefinition(app))
+		} else if parentID(app.ID) == groupID {
+			group.Apps = append(group.Apps, app)
+		} else if child := childOf(groupID, app.ID); child != "" {
+			children[child] = true
+		}
+	}
+	for id := range m.Groups {
+		if child := childOf(groupID, id); child != "" {
+			children[child] = true
+		}
+	}
+
+	childIDs := make([]string, 0, len(children))
+	for id := range children {
+		childIDs = append(childIDs, id)
+	}
+	sort.Strings(childIDs)
+	for _, id := range childIDs {
+		group.Groups = append(group.Groups, m.buildGroup(id))
+	}
+
+	return group
+}
+
+// CreateGroup creates a group with all of its apps and subgroups, starting
+// apps in dependency order. Unless force is set, it fails when a deployment
+// in progress affects any of the apps.
+func (m *Marathon) CreateGroup(group *Group, force bool) (*Deployment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	groupID := resolveID(rootGroupID, group.ID)
+	if m.groupExists(groupID) {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, groupID)
+	}
+
+	groups := make(map[string]*Group)
+	apps := make(map[string]*Application)
+	if err := flattenGroup(rootGroupID, group, groups, apps); err != nil {
+		return nil, err
+	}
+
+	for id := range apps {
+		if _, exists := m.Applications[id]; exists {
+			return nil, fmt.Errorf("%w: app %s", ErrGroupExists, id)
+		}
+	}
+
+	deployment, err := m.deploy(apps, groups, force)
+	if err != nil {
+		return nil, err
+	}
+	m.storeGroups(groupID, groups, deployment.Version)
+
+	log.Printf("Created group %s with %d apps", groupID, len(apps))
+	return deployment, nil
+}
+
+// UpdateGroup replaces the definition of a group. Apps missing from the new
+// definition are stopped in reverse dependency order before new and changed
+// apps are started in dependency order.
+func (m *Marathon) UpdateGroup(groupID string, group *Group, force bool) (*Deployment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	groupID = canonicalID(groupID)
+	if !m.groupExists(groupID) {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, groupID)
+	}
+
+	group.ID = groupID
+	groups := make(map[string]*Group)
+	apps := make(map[string]*Application)
+	if err := flattenGroup(rootGroupID, group, groups, apps); err != nil {
+		return nil, err
+	}
+
+	target := make(map[string]*Application, len(apps))
+	for _, app := range m.appsInGroup(groupID) {
+		target[app.ID] = nil
+	}
+	for id, app := range apps {
+		target[id] = app
+	}
+
+	deployment, err := m.deploy(target, groups, force)
+	if err != nil {
+		return nil, err
+	}
+	m.storeGroups(groupID, groups, deployment.Version)
+
+	log.Printf("Updated group %s", groupID)
+	return deployment, nil
+}
+
+// storeGroups replaces the stored definitions of a group and its subgroups
+func (m *Marathon) storeGroups(groupID string, groups map[string]*Group, version string) {
+	for id := range m.Groups {
+		if id == groupID || isDescendant(groupID, id) {
+			delete(m.Groups, id)
+		}
+	}
+	for id, g := range groups {
+		g.Version = version
+		m.Groups[id] = g
+	}
+}
+
+// DeleteGroup removes a group and stops all of its apps, dependents first
+func (m *Marathon) DeleteGroup(groupID string, force bool) (*Deployment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	groupID = canonicalID(groupID)
+	if groupID == rootGroupID || !m.groupExists(groupID) {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, groupID)
+	}
+
+	target := make(map[string]*Application)
+	for _, app := range m.appsInGroup(groupID) {
+		target[app.ID] = nil
+	}
+
+	deployment, err := m.deploy(target, nil, force)
+	if err != nil {
+		return nil, err
+	}
+	m.storeGroups(groupID, nil, deployment.Version)
+
+	log.Printf("Deleted group %s", groupID)
+	return deployment, nil
+}
+
+// ScaleGroup multiplies the instance count of every app and pod in a group
+// by factor, rounding up
+func (m *Marathon) ScaleGroup(groupID string, factor float64, force bool) (*Deployment, error) {
+	if factor < 0 {
+		return nil, fmt.Errorf("scale factor must not be negative, got %v", factor)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	groupID = canonicalID(groupID)
+	if !m.groupExists(groupID) {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, groupID)
+	}
+
+	target := make(map[string]*Application)
+	for _, app := range m.appsInGroup(groupID) {
+		scaled := snapshotApp(app)
+		scaled.Instances = int(math.Ceil(float64(app.Instances) * factor))
+		target[app.ID] = scaled
+	}
+
+	deployment, err := m.deploy(target, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Scaled group %s by %.2f", groupID, factor)
+	return deployment, nil
+}
+
+func (m *Marathon) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["id"]
+
+	group, err := m.GetGroup(groupID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// decodeGroup decodes a group from a request body. Its apps, including
+// those of nested groups, are decoded over Marathon's defaults like the
+// body of a single app.
+func decodeGroup(data []byte, group *Group) error {
+	if err := json.Unmarshal(data, group); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Apps   []json.RawMessage `json:"apps"`
+		Groups []json.RawMessage `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for i, data := range raw.Apps {
+		if group.Apps[i] == nil {
+			continue
+		}
+		app := defaultApp()
+		if err := json.Unmarshal(data, app); err != nil {
+			return err
+		}
+		group.Apps[i] = app
+	}
+	for i, data := range raw.Groups {
+		if group.Groups[i] == nil {
+			continue
+		}
+		if err := decodeGroup(data, group.Groups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Marathon) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var group Group
+	if err := decodeGroup(body, &group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ValidateGroup(&group); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	deployment, err := m.CreateGroup(&group, forceParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	writeDeploymentResult(w, deployment)
+}
+
+func (m *Marathon) handleUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["id"]
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var update GroupUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var deployment *Deployment
+	if update.ScaleBy != nil {
+		deployment, err = m.ScaleGroup(groupID, *update.ScaleBy, forceParam(r))
+	} else {
+		if err := decodeGroup(body, &update.Group); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		update.Group.ID = groupID
+		if err := ValidateGroup(&update.Group); err != nil {
+			writeError(w, err)
+			return
+		}
+		deployment, err = m.UpdateGroup(groupID, &update.Group, forceParam(r))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	writeDeploymentResult(w, deployment)
+}
+
+func (m *Marathon) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["id"]
+
+	deployment, err := m.DeleteGroup(groupID, forceParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	writeDeploymentResult(w, deployment)
+}
+
+// writeDeploymentResult writes the version and deployment ID of a change
+func writeDeploymentResult(w http.ResponseWriter, deployment *Deployment) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"version":      deployment.Version,
+		"deploymentId": deployment.ID,
+	})
+}
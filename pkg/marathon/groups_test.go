@@ -0,0 +1,346 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testGroup() *Group {
+	return &Group{
+		ID: "/prod",
+		Apps: []*Application{
+			{ID: "db", Instances: 1, CPUs: 1.0, Memory: 1024.0},
+		},
+		Groups: []*Group{
+			{
+				ID:           "web",
+				Dependencies: []string{"/prod/db"},
+				Apps: []*Application{
+					{ID: "frontend", Instances: 2, CPUs: 0.5, Memory: 256.0, Dependencies: []string{"api"}},
+					{ID: "api", Instances: 2, CPUs: 0.5, Memory: 256.0},
+				},
+			},
+		},
+	}
+}
+
+func TestGroupIDHelpers(t *testing.T) {
+	assert.Equal(t, "/prod/web", resolveID("/prod", "web"))
+	assert.Equal(t, "/other", resolveID("/prod", "/other"))
+	assert.Equal(t, "/db", resolveID("/prod/web", "../../db"))
+	assert.Equal(t, "/prod", parentID("/prod/web"))
+	assert.Equal(t, "/", parentID("test-app"))
+	assert.True(t, isDescendant("/prod", "/prod/web/api"))
+	assert.False(t, isDescendant("/prod", "/production/api"))
+	assert.True(t, isDescendant("/", "/prod"))
+	assert.Equal(t, "/prod/web", childOf("/prod", "/prod/web/api"))
+	assert.Equal(t, "/prod", childOf("/", "/prod/web/api"))
+	assert.Equal(t, "", childOf("/prod/web", "/prod/db"))
+}
+
+func TestMarathon_CreateGroup(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	deployment, err := marathon.CreateGroup(testGroup(), false)
+	require.NoError(t, err)
+
+	// Apps in web wait until db is up
+	assert.Contains(t, marathon.Applications, "/prod/db")
+	assert.NotContains(t, marathon.Applications, "/prod/web/api")
+
+	completeDeployments(t, marathon)
+	assert.Contains(t, marathon.Applications, "/prod/web/api")
+	assert.Contains(t, marathon.Applications, "/prod/web/frontend")
+	assert.Equal(t, []string{"/prod/web/api"}, marathon.Applications["/prod/web/frontend"].Dependencies)
+
+	// Dependencies start first: db before everything in web, api before frontend
+	order := make([]string, 0, len(deployment.Steps))
+	for _, step := range deployment.Steps {
+		assert.Equal(t, "StartApplication", step.Action)
+		order = append(order, step.App)
+	}
+	assert.Equal(t, []string{"/prod/db", "/prod/web/api", "/prod/web/frontend"}, order)
+	assert.Equal(t, 3, deployment.TotalSteps)
+
+	_, err = marathon.CreateGroup(&Group{ID: "/prod"}, false)
+	assert.ErrorIs(t, err, ErrGroupExists)
+}
+
+func TestMarathon_CreateGroupInvalidDependencies(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	_, err := marathon.CreateGroup(&Group{
+		ID: "/cycle",
+		Apps: []*Application{
+			{ID: "a", Instances: 1, Dependencies: []string{"b"}},
+			{ID: "b", Instances: 1, Dependencies: []string{"a"}},
+		},
+	}, false)
+	assert.ErrorIs(t, err, ErrInvalidDependencies)
+	assert.Contains(t, err.Error(), "cycle")
+
+	_, err = marathon.CreateGroup(&Group{
+		ID:   "/missing",
+		Apps: []*Application{{ID: "a", Instances: 1, Dependencies: []string{"/nowhere"}}},
+	}, false)
+	assert.ErrorIs(t, err, ErrInvalidDependencies)
+	assert.Empty(t, marathon.Applications)
+	assert.Empty(t, marathon.Groups)
+}
+
+func TestMarathon_GetGroup(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	_, err := marathon.CreateGroup(testGroup(), false)
+	require.NoError(t, err)
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/standalone", Instances: 1}))
+	completeDeployments(t, marathon)
+
+	root, err := marathon.GetGroup("/")
+	require.NoError(t, err)
+	assert.Equal(t, "/", root.ID)
+	require.Len(t, root.Apps, 1)
+	assert.Equal(t, "/standalone", root.Apps[0].ID)
+	require.Len(t, root.Groups, 1)
+
+	prod := root.Groups[0]
+	assert.Equal(t, "/prod", prod.ID)
+	require.Len(t, prod.Apps, 1)
+	require.Len(t, prod.Groups, 1)
+	assert.Equal(t, "/prod/web", prod.Groups[0].ID)
+	assert.Equal(t, []string{"/prod/db"}, prod.Groups[0].Dependencies)
+	assert.Len(t, prod.Groups[0].Apps, 2)
+
+	_, err = marathon.GetGroup("/nonexistent")
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+}
+
+func TestMarathon_UpdateGroup(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	_, err := marathon.CreateGroup(testGroup(), false)
+	require.NoError(t, err)
+	completeDeployments(t, marathon)
+
+	deployment, err := marathon.UpdateGroup("/prod/web", &Group{
+		Apps: []*Application{
+			{ID: "api", Instances: 3, CPUs: 1.0, Memory: 256.0},
+			{ID: "worker", Instances: 1, CPUs: 0.5, Memory: 128.0, Dependencies: []string{"api"}},
+		},
+	}, false)
+	require.NoError(t, err)
+
+	assert.NotContains(t, marathon.Applications, "/prod/web/frontend")
+	assert.Equal(t, 3, marathon.Applications["/prod/web/api"].Instances)
+	assert.Len(t, marathon.Applications["/prod/web/api"].Deployments, 1)
+	assert.NotContains(t, marathon.Applications, "/prod/web/worker")
+
+	completeDeployments(t, marathon)
+	assert.Contains(t, marathon.Applications, "/prod/web/worker")
+	assert.Len(t, marathon.Applications["/prod/web/api"].Tasks, 3)
+
+	actions := make([]string, 0, len(deployment.Steps))
+	for _, step := range deployment.Steps {
+		actions = append(actions, step.Action+" "+step.App)
+	}
+	assert.Equal(t, []string{
+		"StopApplication /prod/web/frontend",
+		"RestartApplication /prod/web/api",
+		"StartApplication /prod/web/worker",
+	}, actions)
+
+	_, err = marathon.UpdateGroup("/nonexistent", &Group{}, false)
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+}
+
+func TestMarathon_DeleteGroup(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	_, err := marathon.CreateGroup(testGroup(), false)
+	require.NoError(t, err)
+
+	// The group is locked while it is being created
+	_, err = marathon.DeleteGroup("/prod", false)
+	assert.ErrorIs(t, err, ErrDeploymentConflict)
+	completeDeployments(t, marathon)
+
+	deployment, err := marathon.DeleteGroup("/prod", false)
+	require.NoError(t, err)
+
+	// Dependents stop before the apps they depend on
+	order := make([]string, 0, len(deployment.Steps))
+	for _, step := range deployment.Steps {
+		assert.Equal(t, "StopApplication", step.Action)
+		order = append(order, step.App)
+	}
+	assert.Equal(t, []string{"/prod/web/frontend", "/prod/web/api", "/prod/db"}, order)
+	assert.Empty(t, marathon.Applications)
+	assert.Empty(t, marathon.Groups)
+	assert.Empty(t, marathon.Tasks)
+
+	_, err = marathon.DeleteGroup("/prod", false)
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+}
+
+func TestMarathon_ScaleGroup(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	_, err := marathon.CreateGroup(testGroup(), false)
+	require.NoError(t, err)
+
+	completeDeployments(t, marathon)
+
+	_, err = marathon.ScaleGroup("/prod", 1.5, false)
+	require.NoError(t, err)
+	completeDeployments(t, marathon)
+
+	assert.Equal(t, 2, marathon.Applications["/prod/db"].Instances)
+	assert.Equal(t, 3, marathon.Applications["/prod/web/api"].Instances)
+	assert.Len(t, marathon.Applications["/prod/web/api"].Tasks, 3)
+
+	_, err = marathon.ScaleGroup("/prod/web", 0, false)
+	require.NoError(t, err)
+	completeDeployments(t, marathon)
+	assert.Equal(t, 0, marathon.Applications["/prod/web/frontend"].Instances)
+	assert.Equal(t, 2, marathon.Applications["/prod/db"].Instances)
+
+	_, err = marathon.ScaleGroup("/prod", -1, false)
+	assert.Error(t, err)
+}
+
+func TestMarathon_GroupHTTPHandlers(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(testGroup())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v2/groups", &buf))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var result map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Contains(t, marathon.Deployments, result["deploymentId"])
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v2/groups", bytes.NewBufferString(`{"id": "/prod"}`)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// Scaling conflicts with the running deployment unless forced
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v2/groups/prod", bytes.NewBufferString(`{"scaleBy": 2}`)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v2/groups/prod?force=true", bytes.NewBufferString(`{"scaleBy": 2}`)))
+	require.Equal(t, http.StatusOK, rr.Code)
+	completeDeployments(t, marathon)
+
+	// The forced scale superseded the create before the web apps were started
+	assert.NotContains(t, marathon.Applications, "/prod/web/api")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/groups/prod", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var group Group
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &group))
+	assert.Equal(t, "/prod", group.ID)
+	require.Len(t, group.Apps, 1)
+	assert.Equal(t, 2, group.Apps[0].Instances)
+
+	// Apps nested in groups are reachable through the app endpoints
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/apps/prod/db/tasks", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/v2/groups/prod", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/groups/prod", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestMarathon_GroupHTTPAppDefaults(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+
+	// Apps of groups get the defaults of single apps, also when nested
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v2/groups", bytes.NewBufferString(
+		`{"id": "/prod", "apps": [{"id": "db", "mem": 512}], "groups": [{"id": "web", "apps": [{"id": "api", "instances": 2}]}]}`)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	completeDeployments(t, marathon)
+
+	db := marathon.Applications["/prod/db"]
+	require.NotNil(t, db)
+	assert.Equal(t, DefaultAppInstances, db.Instances)
+	assert.Equal(t, DefaultAppCPUs, db.CPUs)
+	assert.Equal(t, 512.0, db.Memory)
+	api := marathon.Applications["/prod/web/api"]
+	require.NotNil(t, api)
+	assert.Equal(t, 2, api.Instances)
+	assert.Equal(t, DefaultAppMemory, api.Memory)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v2/groups/prod", bytes.NewBufferString(
+		`{"apps": [{"id": "db", "cpus": 2}]}`)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	completeDeployments(t, marathon)
+	db = marathon.Applications["/prod/db"]
+	assert.Equal(t, 2.0, db.CPUs)
+	assert.Equal(t, DefaultAppMemory, db.Memory)
+}
+
+func TestMarathon_GroupHTTPPods(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+	pod := testPod(1)
+	pod.ID = "/prod/web"
+	_, err := marathon.CreatePod(pod, false)
+	require.NoError(t, err)
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/prod/db", Instances: 1, CPUs: 1.0}))
+	marathon.ResourceOffers([]*Offer{portOffer(1, 31000)})
+	marathon.monitorTasks()
+	for _, task := range marathon.Applications["/prod/web"].Tasks {
+		task.HealthCheckResults = []*HealthCheckResult{{Alive: true}}
+	}
+	completeDeployments(t, marathon)
+	instances := marathon.Applications["/prod/web"].Tasks
+	require.Len(t, instances, 1)
+
+	// Putting back what GET returns keeps the pod and its instances
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/groups/prod", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v2/groups/prod", bytes.NewBufferString(body)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	completeDeployments(t, marathon)
+
+	got, err := marathon.GetPod("/prod/web")
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Scaling.Instances)
+	assert.Equal(t, instances, marathon.Applications["/prod/web"].Tasks)
+	assert.Contains(t, marathon.Applications, "/prod/db")
+
+	// Scaling a group scales its pods
+	deployment, err := marathon.ScaleGroup("/prod", 2, false)
+	require.NoError(t, err)
+	assert.Contains(t, deployment.AffectedApps, "/prod/web")
+
+	// Pods of groups are validated
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/v2/groups", bytes.NewBufferString(
+		`{"id": "/staging", "pods": [{"id": "web"}]}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/pods(0)")
+}
@@ -0,0 +1,533 @@
+package marathon
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Health and readiness check protocols
+const (
+	ProtocolHTTP  = "HTTP"
+	ProtocolHTTPS = "HTTPS"
+	ProtocolTCP   = "TCP"
+)
+
+// Defaults for unset check fields, matching Marathon
+const (
+	defaultGracePeriodSeconds       = 300
+	defaultIntervalSeconds          = 60
+	defaultTimeoutSeconds           = 20
+	defaultReadinessName            = "readinessCheck"
+	defaultReadinessPath            = "/"
+	defaultReadinessIntervalSeconds = 30
+	defaultReadinessTimeoutSeconds  = 10
+)
+
+// maxPreservedBody limits how much of a readiness response body is kept
+const maxPreservedBody = 64 * 1024
+
+// ErrInvalidHealthCheck is returned for malformed health or readiness checks
+var ErrInvalidHealthCheck = errors.New("invalid health check")
+
+// probeTransport is shared by all HTTP probes. Task certificates are usually
+// self-signed, so HTTPS checks do not verify them, as in Marathon.
+var probeTransport = &http.Transport{
+	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	DisableKeepAlives: true,
+}
+
+// ReadinessCheck represents a check that must pass before a deployment
+// considers a newly started task ready
+type ReadinessCheck struct {
+	Name                    string `json:"name,omitempty"`
+	Protocol                string `json:"protocol,omitempty"`
+	Path                    string `json:"path,omitempty"`
+	PortIndex               int    `json:"portIndex,omitempty"`
+	IntervalSeconds         int    `json:"intervalSeconds,omitempty"`
+	TimeoutSeconds          int    `json:"timeoutSeconds,omitempty"`
+	HTTPStatusCodesForReady []int  `json:"httpStatusCodesForReady,omitempty"`
+	PreserveLastResponse    bool   `json:"preserveLastResponse,omitempty"`
+}
+
+func (rc *ReadinessCheck) name() string {
+	if rc.Name == "" {
+		return defaultReadinessName
+	}
+	return rc.Name
+}
+
+func (rc *ReadinessCheck) readyStatus(status int) bool {
+	if len(rc.HTTPStatusCodesForReady) == 0 {
+		return status == http.StatusOK
+	}
+	for _, code := range rc.HTTPStatusCodesForReady {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// seconds converts a check setting to a duration, using fallback when unset
+func seconds(value, fallback int) time.Duration {
+	if value <= 0 {
+		value = fallback
+	}
+	return time.Duration(value) * time.Second
+}
+
+// validateHealthChecks checks the health and readiness checks of an app
+func validateHealthChecks(app *Application) error {
+	for i, hc := range app.HealthChecks {
+		switch hc.Protocol {
+		case ProtocolHTTP, ProtocolHTTPS, ProtocolTCP:
+		default:
+			return fmt.Errorf("%w: healthChecks[%d]: unsupported protocol %q", ErrInvalidHealthCheck, i, hc.Protocol)
+		}
+		if hc.Port < 0 || hc.PortIndex < 0 {
+			return fmt.Errorf("%w: healthChecks[%d]: port and portIndex must not be negative", ErrInvalidHealthCheck, i)
+		}
+		if hc.GracePeriodSeconds < 0 || hc.IntervalSeconds < 0 || hc.TimeoutSeconds < 0 || hc.MaxConsecutiveFailures < 0 {
+			return fmt.Errorf("%w: healthChecks[%d]: durations and maxConsecutiveFailures must not be negative", ErrInvalidHealthCheck, i)
+		}
+	}
+
+	names := make(map[string]bool, len(app.ReadinessChecks))
+	for i, rc := range app.ReadinessChecks {
+		switch rc.Protocol {
+		case "", ProtocolHTTP, ProtocolHTTPS:
+		default:
+			return fmt.Errorf("%w: readinessChecks[%d]: unsupported protocol %q", ErrInvalidHealthCheck, i, rc.Protocol)
+		}
+		if names[rc.name()] {
+			return fmt.Errorf("%w: readinessChecks[%d]: duplicate name %q", ErrInvalidHealthCheck, i, rc.name())
+		}
+		names[rc.name()] = true
+		if rc.PortIndex < 0 || rc.IntervalSeconds < 0 || rc.TimeoutSeconds < 0 {
+			return fmt.Errorf("%w: readinessChecks[%d]: portIndex and durations must not be negative", ErrInvalidHealthCheck, i)
+		}
+		for _, code := range rc.HTTPStatusCodesForReady {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("%w: readinessChecks[%d]: invalid status code %d", ErrInvalidHealthCheck, i, code)
+			}
+		}
+	}
+	return nil
+}
+
+// checkProbe is a single health or readiness check run against a task.
+// Probes are collected under m.mu, run without it and recorded under it
+// again, so slow tasks never block the API.
+type checkProbe struct {
+	appID  string
+	taskID string
+
+	health      *HealthCheck
+	healthIndex int
+
+	readiness    *ReadinessCheck
+	deploymentID string
+
+	protocol string
+	address  string
+	path     string
+	timeout  time.Duration
+
+	status  int
+	body    string
+	headers map[string]string
+	err     error
+}
+
+// taskAddress returns the host:port a check reaches a task on. A fixed port
+// takes precedence over the port index into the task's ports.
+func taskAddress(task *MarathonTask, port, portIndex int) (string, error) {
+	if port == 0 {
+		if portIndex >= len(task.Ports) {
+			return "", fmt.Errorf("port index %d out of range for %d task ports", portIndex, len(task.Ports))
+		}
+		port = task.Ports[portIndex]
+	}
+	return net.JoinHostPort(task.Host, strconv.Itoa(port)), nil
+}
+
+func newHealthProbe(app *Application, task *MarathonTask, index int) *checkProbe {
+	hc := app.HealthChecks[index]
+	p := &checkProbe{
+		appID:       app.ID,
+		taskID:      task.ID,
+		health:      hc,
+		healthIndex: index,
+		protocol:    hc.Protocol,
+		path:        hc.Path,
+		timeout:     seconds(hc.TimeoutSeconds, defaultTimeoutSeconds),
+	}
+	p.address, p.err = taskAddress(task, hc.Port, hc.PortIndex)
+	return p
+}
+
+func newReadinessProbe(d *Deployment, app *Application, task *MarathonTask, rc *ReadinessCheck) *checkProbe {
+	p := &checkProbe{
+		appID:        app.ID,
+		taskID:       task.ID,
+		readiness:    rc,
+		deploymentID: d.ID,
+		protocol:     rc.Protocol,
+		path:         rc.Path,
+		timeout:      seconds(rc.TimeoutSeconds, defaultReadinessTimeoutSeconds),
+	}
+	if p.protocol == "" {
+		p.protocol = ProtocolHTTP
+	}
+	if p.path == "" {
+		p.path = defaultReadinessPath
+	}
+	p.address, p.err = taskAddress(task, 0, rc.PortIndex)
+	return p
+}
+
+// run executes the probe and stores its outcome
+func (p *checkProbe) run() {
+	if p.err != nil {
+		return
+	}
+
+	if p.protocol == ProtocolTCP {
+		conn, err := net.DialTimeout("tcp", p.address, p.timeout)
+		if err != nil {
+			p.err = err
+			return
+		}
+		conn.Close()
+		return
+	}
+
+	scheme := "http"
+	if p.protocol == ProtocolHTTPS {
+		scheme = "https"
+	}
+	client := &http.Client{Timeout: p.timeout, Transport: probeTransport}
+	resp, err := client.Get(fmt.Sprintf("%s://%s%s", scheme, p.address, p.path))
+	if err != nil {
+		p.err = err
+		return
+	}
+	defer resp.Body.Close()
+
+	p.status = resp.StatusCode
+	if p.readiness != nil && p.readiness.PreserveLastResponse {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxPreservedBody))
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.body = string(body)
+		p.headers = make(map[string]string, len(resp.Header))
+		for key := range resp.Header {
+			p.headers[key] = resp.Header.Get(key)
+		}
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxPreservedBody))
+}
+
+// healthOutcome classifies a finished health probe. Informational responses
+// are ignored rather than counted when the check sets IgnoreHTTP1xx.
+func (p *checkProbe) healthOutcome() (healthy, ignored bool, cause string) {
+	switch {
+	case p.err != nil:
+		return false, false, p.err.Error()
+	case p.protocol == ProtocolTCP:
+		return true, false, ""
+	case p.status >= 200 && p.status < 400:
+		return true, false, ""
+	case p.status < 200 && p.health.IgnoreHTTP1xx:
+		return false, true, ""
+	}
+	return false, false, fmt.Sprintf("unexpected status %d", p.status)
+}
+
+// startHealthChecking periodically runs the health and readiness checks
+// that are due
+func (m *Marathon) startHealthChecking() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if m.IsLeader() {
+				m.runHealthChecks(time.Now())
+			}
+		}
+	}
+}
+
+// runHealthChecks runs all health and readiness checks due at now, records
+// their results and advances deployments waiting on them
+func (m *Marathon) runHealthChecks(now time.Time) {
+	m.mu.RLock()
+	probes := m.dueChecks(now)
+	m.mu.RUnlock()
+
+	if len(probes) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func(p *checkProbe) {
+			defer wg.Done()
+			p.run()
+		}(p)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	for _, p := range probes {
+		if p.health != nil {
+			m.recordHealth(p, now)
+		} else {
+			m.recordReadiness(p, now)
+		}
+	}
+	for _, app := range m.Applications {
+		m.updateTaskCounts(app)
+	}
+	m.advanceDeployments()
+}
+
+// dueChecks collects the probes whose interval has elapsed. Health checks
+// run against all running tasks; readiness checks only against healthy
+// tasks started by the current step of a deployment. The caller must hold
+// m.mu.
+func (m *Marathon) dueChecks(now time.Time) []*checkProbe {
+	probes := make([]*checkProbe, 0)
+
+	for _, app := range m.Applications {
+		for _, task := range app.Tasks {
+			if task.State != "TASK_RUNNING" {
+				continue
+			}
+			for i, hc := range app.HealthChecks {
+				if i < len(task.HealthCheckResults) {
+					last := task.HealthCheckResults[i].lastChecked
+					if !last.IsZero() && now.Sub(last) < seconds(hc.IntervalSeconds, defaultIntervalSeconds) {
+						continue
+					}
+				}
+				probes = append(probes, newHealthProbe(app, task, i))
+			}
+		}
+	}
+
+	for _, d := range m.Deployments {
+		if d.CurrentStep >= d.TotalSteps {
+			continue
+		}
+		step := d.Steps[d.CurrentStep]
+		app, exists := m.Applications[step.App]
+		if !exists || step.Action == ActionStopApplication || len(app.ReadinessChecks) == 0 {
+			continue
+		}
+		for _, task := range app.Tasks {
+			if !m.taskHealthy(app, task) || (step.Action != ActionScaleApplication && task.Version != app.Version) {
+				continue
+			}
+			for _, rc := range app.ReadinessChecks {
+				result := d.readinessResult(task.ID, rc.name())
+				if result != nil && (result.Ready || now.Sub(result.lastChecked) < seconds(rc.IntervalSeconds, defaultReadinessIntervalSeconds)) {
+					continue
+				}
+				probes = append(probes, newReadinessProbe(d, app, task, rc))
+			}
+		}
+	}
+
+	return probes
+}
+
+// recordHealth applies a health probe outcome to the task's results and
+// replaces the task once it exceeds the check's consecutive failures.
+// Failures before the first success within the grace period are not
+// counted. The caller must hold m.mu.
+func (m *Marathon) recordHealth(p *checkProbe, now time.Time) {
+	app, exists := m.Applications[p.appID]
+	task, taskExists := m.Tasks[p.taskID]
+	if !exists || !taskExists || task.State != "TASK_RUNNING" || p.healthIndex >= len(app.HealthChecks) {
+		return
+	}
+
+	for len(task.HealthCheckResults) < len(app.HealthChecks) {
+		task.HealthCheckResults = append(task.HealthCheckResults, &HealthCheckResult{})
+	}
+	result := task.HealthCheckResults[p.healthIndex]
+	checkedBefore := !result.lastChecked.IsZero()
+	result.lastChecked = now
+
+	healthy, ignored, cause := p.healthOutcome()
+	if ignored {
+		return
+	}
+	if !checkedBefore || result.Alive != healthy {
+		m.publishHealthChanged(task, healthy)
+	}
+
+	stamp := now
+	if healthy {
+		result.Alive = true
+		result.ConsecutiveFailures = 0
+		result.LastSuccess = &stamp
+		if result.FirstSuccess == nil {
+			result.FirstSuccess = &stamp
+		}
+		return
+	}
+
+	result.Alive = false
+	result.LastFailure = &stamp
+	result.LastFailureCause = cause
+
+	hc := app.HealthChecks[p.healthIndex]
+	if result.FirstSuccess == nil && task.StartedAt != nil &&
+		now.Sub(*task.StartedAt) < seconds(hc.GracePeriodSeconds, defaultGracePeriodSeconds) {
+		return
+	}
+
+	result.ConsecutiveFailures++
+	if hc.MaxConsecutiveFailures > 0 && result.ConsecutiveFailures >= hc.MaxConsecutiveFailures {
+		m.replaceUnhealthyTask(app, task, cause, now)
+	}
+}
+
+// replaceUnhealthyTask kills a task that failed its health checks and
+// stages a replacement if it ran the app's current version. The caller must
+// hold m.mu.
+func (m *Marathon) replaceUnhealthyTask(app *Application, task *MarathonTask, cause string, now time.Time) {
+	app.LastTaskFailure = &TaskFailure{
+		AppID:     app.ID,
+		TaskID:    task.ID,
+		State:     "TASK_KILLED",
+		Message:   "health check failed: " + cause,
+		Host:      task.Host,
+		Version:   task.Version,
+		Timestamp: now,
+	}
+	m.killAppTask(app, task)
+	log.Printf("Killed unhealthy task %s of %s: %s", task.ID, app.ID, cause)
+
+	if task.Version == app.Version {
+		m.stageTask(app)
+	}
+}
+
+// recordReadiness stores a readiness probe outcome in its deployment. The
+// caller must hold m.mu.
+func (m *Marathon) recordReadiness(p *checkProbe, now time.Time) {
+	d, exists := m.Deployments[p.deploymentID]
+	if !exists {
+		return
+	}
+
+	result := d.readinessResult(p.taskID, p.readiness.name())
+	if result == nil {
+		result = &ReadinessCheckResult{Name: p.readiness.name(), TaskID: p.taskID}
+		d.ReadinessCheckResults = append(d.ReadinessCheckResults, result)
+	}
+	result.lastChecked = now
+	result.Ready = p.err == nil && p.readiness.readyStatus(p.status)
+
+	if p.err == nil {
+		result.LastResponse = &ReadinessCheckResponse{Status: p.status, Body: p.body, Headers: p.headers}
+	}
+}
+
+// readinessResult returns the deployment's result of a task's readiness
+// check, or nil if it has not been checked yet
+func (d *Deployment) readinessResult(taskID, name string) *ReadinessCheckResult {
+	for _, result := range d.ReadinessCheckResults {
+		if result.TaskID == taskID && result.Name == name {
+			return result
+		}
+	}
+	return nil
+}
+
+// taskHealthy reports whether a task is running and passes its health checks
+func (m *Marathon) taskHealthy(app *Application, task *MarathonTask) bool {
+	if task.State != "TASK_RUNNING" {
+		return false
+	}
+	if len(app.HealthChecks) == 0 {
+		return true
+	}
+	if len(task.HealthCheckResults) < len(app.HealthChecks) {
+		return false
+	}
+	for _, result := range task.HealthCheckResults {
+		if !result.Alive {
+			return false
+		}
+	}
+	return true
+}
+
+// taskReady reports whether a task is healthy and has passed all of its
+// app's readiness checks within the deployment
+func (m *Marathon) taskReady(d *Deployment, app *Application, task *MarathonTask) bool {
+	if !m.taskHealthy(app, task) {
+		return false
+	}
+	for _, rc := range app.ReadinessChecks {
+		result := d.readinessResult(task.ID, rc.name())
+		if result == nil || !result.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// updateTaskCounts recomputes an app's task counters from its tasks. A task
+// counts as unhealthy once any of its health checks reported a failure.
+// The caller must hold m.mu.
+func (m *Marathon) updateTaskCounts(app *Application) {
+	app.TasksStaged, app.TasksRunning, app.TasksHealthy, app.TasksUnhealthy = 0, 0, 0, 0
+
+	for _, task := range app.Tasks {
+		switch task.State {
+		case "TASK_STAGING":
+			app.TasksStaged++
+			continue
+		case "TASK_RUNNING":
+			app.TasksRunning++
+		default:
+			continue
+		}
+
+		if len(app.HealthChecks) == 0 {
+			continue
+		}
+		if m.taskHealthy(app, task) {
+			app.TasksHealthy++
+			continue
+		}
+		for _, result := range task.HealthCheckResults {
+			if !result.Alive && result.LastFailure != nil {
+				app.TasksUnhealthy++
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package marathon
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pointTasksAt directs all of an app's tasks at the given server address
+func pointTasksAt(t *testing.T, app *Application, address string) {
+	host, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	for _, task := range app.Tasks {
+		task.Host = host
+		task.Ports = []int{portNum}
+	}
+}
+
+// closedAddress returns an address nothing listens on
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// startApp creates an app, points its tasks at address and marks them running
+func startApp(t *testing.T, marathon *Marathon, app *Application, address string) *Application {
+	require.NoError(t, marathon.CreateApp(app))
+	pointTasksAt(t, app, address)
+	marathon.monitorTasks()
+	return app
+}
+
+func TestValidateHealthChecks(t *testing.T) {
+	tests := []struct {
+		name        string
+		app         *Application
+		expectError string
+	}{
+		{"No checks", &Application{}, ""},
+		{"HTTP", &Application{HealthChecks: []*HealthCheck{{Protocol: "HTTP", Path: "/health"}}}, ""},
+		{"Unknown protocol", &Application{HealthChecks: []*HealthCheck{{Protocol: "COMMAND"}}}, "unsupported protocol"},
+		{"Negative port index", &Application{HealthChecks: []*HealthCheck{{Protocol: "TCP", PortIndex: -1}}}, "must not be negative"},
+		{"Negative failures", &Application{HealthChecks: []*HealthCheck{{Protocol: "TCP", MaxConsecutiveFailures: -1}}}, "must not be negative"},
+		{"Readiness default protocol", &Application{ReadinessChecks: []*ReadinessCheck{{}}}, ""},
+		{"Readiness TCP", &Application{ReadinessChecks: []*ReadinessCheck{{Protocol: "TCP"}}}, "unsupported protocol"},
+		{"Readiness duplicate name", &Application{ReadinessChecks: []*ReadinessCheck{{}, {Name: "readinessCheck"}}}, "duplicate name"},
+		{"Readiness invalid status", &Application{ReadinessChecks: []*ReadinessCheck{{HTTPStatusCodesForReady: []int{42}}}}, "invalid status code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHealthChecks(tt.app)
+			if tt.expectError != "" {
+				assert.ErrorIs(t, err, ErrInvalidHealthCheck)
+				assert.Contains(t, err.Error(), tt.expectError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckProbe_HealthOutcome(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     *checkProbe
+		healthy   bool
+		ignored   bool
+		causePart string
+	}{
+		{"TCP connected", &checkProbe{protocol: "TCP", health: &HealthCheck{}}, true, false, ""},
+		{"Connection error", &checkProbe{protocol: "HTTP", health: &HealthCheck{}, err: errors.New("refused")}, false, false, "refused"},
+		{"OK", &checkProbe{protocol: "HTTP", health: &HealthCheck{}, status: 200}, true, false, ""},
+		{"Redirect", &checkProbe{protocol: "HTTP", health: &HealthCheck{}, status: 302}, true, false, ""},
+		{"Server error", &checkProbe{protocol: "HTTP", health: &HealthCheck{}, status: 503}, false, false, "503"},
+		{"Informational", &checkProbe{protocol: "HTTP", health: &HealthCheck{}, status: 102}, false, false, "102"},
+		{"Informational ignored", &checkProbe{protocol: "HTTP", health: &HealthCheck{IgnoreHTTP1xx: true}, status: 102}, false, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthy, ignored, cause := tt.probe.healthOutcome()
+			assert.Equal(t, tt.healthy, healthy)
+			assert.Equal(t, tt.ignored, ignored)
+			assert.Contains(t, cause, tt.causePart)
+		})
+	}
+}
+
+func TestMarathon_HTTPHealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := startApp(t, marathon, &Application{
+		ID:           "/app",
+		Instances:    2,
+		HealthChecks: []*HealthCheck{{Protocol: "HTTP", Path: "/health"}},
+	}, server.Listener.Addr().String())
+	require.Len(t, marathon.Deployments, 1, "deployment waits for health checks")
+
+	now := time.Now()
+	marathon.runHealthChecks(now)
+
+	for _, task := range app.Tasks {
+		require.Len(t, task.HealthCheckResults, 1)
+		result := task.HealthCheckResults[0]
+		assert.True(t, result.Alive)
+		assert.Equal(t, 0, result.ConsecutiveFailures)
+		require.NotNil(t, result.FirstSuccess)
+		assert.Equal(t, now, *result.FirstSuccess)
+	}
+	assert.Equal(t, 2, app.TasksRunning)
+	assert.Equal(t, 2, app.TasksHealthy)
+	assert.Equal(t, 0, app.TasksUnhealthy)
+	assert.Empty(t, marathon.Deployments)
+}
+
+func TestMarathon_HTTPSHealthCheck(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := startApp(t, marathon, &Application{
+		ID:           "/app",
+		Instances:    1,
+		HealthChecks: []*HealthCheck{{Protocol: "HTTPS"}},
+	}, server.Listener.Addr().String())
+
+	marathon.runHealthChecks(time.Now())
+	assert.True(t, app.Tasks[0].HealthCheckResults[0].Alive)
+}
+
+func TestMarathon_TCPHealthCheckFixedPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := startApp(t, marathon, &Application{
+		ID:           "/app",
+		Instances:    1,
+		HealthChecks: []*HealthCheck{{Protocol: "TCP", Port: port}, {Protocol: "TCP", PortIndex: 0}},
+	}, closedAddress(t))
+
+	marathon.runHealthChecks(time.Now())
+
+	results := app.Tasks[0].HealthCheckResults
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Alive, "fixed port takes precedence over the task's ports")
+	assert.False(t, results[1].Alive)
+	assert.NotEmpty(t, results[1].LastFailureCause)
+	assert.Equal(t, 1, app.TasksUnhealthy)
+}
+
+func TestMarathon_HealthCheckInterval(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	startApp(t, marathon, &Application{
+		ID:           "/app",
+		Instances:    1,
+		HealthChecks: []*HealthCheck{{Protocol: "HTTP", IntervalSeconds: 10}},
+	}, server.Listener.Addr().String())
+
+	now := time.Now()
+	marathon.runHealthChecks(now)
+	marathon.runHealthChecks(now.Add(5 * time.Second))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	marathon.runHealthChecks(now.Add(10 * time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestMarathon_HealthCheckGracePeriod(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := startApp(t, marathon, &Application{
+		ID:        "/app",
+		Instances: 1,
+		HealthChecks: []*HealthCheck{{
+			Protocol:               "TCP",
+			GracePeriodSeconds:     30,
+			IntervalSeconds:        1,
+			MaxConsecutiveFailures: 2,
+		}},
+	}, closedAddress(t))
+	task := app.Tasks[0]
+	started := *task.StartedAt
+
+	// Failures within the grace period are reported but not counted
+	marathon.runHealthChecks(started.Add(time.Second))
+	marathon.runHealthChecks(started.Add(2 * time.Second))
+	result := task.HealthCheckResults[0]
+	assert.False(t, result.Alive)
+	assert.Equal(t, 0, result.ConsecutiveFailures)
+	assert.Equal(t, "TASK_RUNNING", task.State)
+
+	marathon.runHealthChecks(started.Add(31 * time.Second))
+	assert.Equal(t, 1, result.ConsecutiveFailures)
+	assert.Equal(t, "TASK_RUNNING", task.State)
+
+	// Exceeding the failures kills the task and stages a replacement
+	marathon.runHealthChecks(started.Add(32 * time.Second))
+	assert.Equal(t, "TASK_KILLED", task.State)
+	require.Len(t, app.Tasks, 1)
+	assert.NotEqual(t, task.ID, app.Tasks[0].ID)
+	assert.Equal(t, "TASK_STAGING", app.Tasks[0].State)
+
+	require.NotNil(t, app.LastTaskFailure)
+	assert.Equal(t, task.ID, app.LastTaskFailure.TaskID)
+	assert.Contains(t, app.LastTaskFailure.Message, "health check failed")
+}
+
+func TestMarathon_HealthCheckNeverKillsWithoutMaxFailures(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := startApp(t, marathon, &Application{
+		ID:           "/app",
+		Instances:    1,
+		HealthChecks: []*HealthCheck{{Protocol: "TCP", GracePeriodSeconds: 1, IntervalSeconds: 1}},
+	}, closedAddress(t))
+	task := app.Tasks[0]
+	started := *task.StartedAt
+
+	for i := 2; i < 7; i++ {
+		marathon.runHealthChecks(started.Add(time.Duration(i) * time.Second))
+	}
+	assert.Equal(t, 5, task.HealthCheckResults[0].ConsecutiveFailures)
+	assert.Equal(t, "TASK_RUNNING", task.State)
+}
+
+func TestMarathon_ReadinessChecksGateDeployment(t *testing.T) {
+	var ready atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Status", "warming")
+		if ready.Load() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("loading"))
+	}))
+	defer server.Close()
+
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := startApp(t, marathon, &Application{
+		ID:        "/app",
+		Instances: 1,
+		ReadinessChecks: []*ReadinessCheck{{
+			Path:                    "/ready",
+			IntervalSeconds:         5,
+			HTTPStatusCodesForReady: []int{http.StatusNoContent},
+			PreserveLastResponse:    true,
+		}},
+	}, server.Listener.Addr().String())
+	require.Len(t, marathon.Deployments, 1, "running tasks wait for readiness")
+
+	var deployment *Deployment
+	for _, d := range marathon.Deployments {
+		deployment = d
+	}
+
+	now := time.Now()
+	marathon.runHealthChecks(now)
+	require.Len(t, deployment.ReadinessCheckResults, 1)
+	result := deployment.ReadinessCheckResults[0]
+	assert.Equal(t, "readinessCheck", result.Name)
+	assert.Equal(t, app.Tasks[0].ID, result.TaskID)
+	assert.False(t, result.Ready)
+	require.NotNil(t, result.LastResponse)
+	assert.Equal(t, http.StatusServiceUnavailable, result.LastResponse.Status)
+	assert.Equal(t, "loading", result.LastResponse.Body)
+	assert.Equal(t, "warming", result.LastResponse.Headers["X-Status"])
+	assert.Contains(t, marathon.Deployments, deployment.ID)
+
+	// Readiness is not rechecked before its interval
+	ready.Store(true)
+	marathon.runHealthChecks(now.Add(time.Second))
+	assert.False(t, result.Ready)
+
+	marathon.runHealthChecks(now.Add(5 * time.Second))
+	assert.True(t, result.Ready)
+	assert.Equal(t, http.StatusNoContent, result.LastResponse.Status)
+	assert.NotContains(t, marathon.Deployments, deployment.ID)
+}
+
+func TestMarathon_CreateAppInvalidHealthCheck(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	err := marathon.CreateApp(&Application{ID: "/app", Instances: 1, HealthChecks: []*HealthCheck{{Protocol: "UDP"}}})
+	assert.ErrorIs(t, err, ErrInvalidHealthCheck)
+	assert.Equal(t, http.StatusBadRequest, errorStatus(err))
+	assert.Empty(t, marathon.Applications)
+}
+
+func TestTaskAddress(t *testing.T) {
+	task := &MarathonTask{Host: "10.0.0.1", Ports: []int{31000, 31001}}
+
+	address, err := taskAddress(task, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:31001", address)
+
+	address, err = taskAddress(task, 8080, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:8080", address)
+
+	_, err = taskAddress(task, 0, 2)
+	assert.Error(t, err)
+}
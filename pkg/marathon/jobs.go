@@ -0,0 +1,843 @@
+package marathon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrJobNotFound is returned when a job does not exist
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobExists is returned when creating a job whose ID is taken
+	ErrJobExists = errors.New("job already exists")
+	// ErrJobRunNotFound is returned when a job run does not exist
+	ErrJobRunNotFound = errors.New("job run not found")
+	// ErrJobRunsActive is returned when deleting a job that has active runs
+	// without stopping them
+	ErrJobRunsActive = errors.New("job has active runs")
+)
+
+// Job run statuses, as reported by Metronome
+const (
+	JobRunInitial  = "INITIAL"
+	JobRunStarting = "STARTING"
+	JobRunActive   = "ACTIVE"
+	JobRunSuccess  = "SUCCESS"
+	JobRunFailed   = "FAILED"
+)
+
+// Restart policies of job runs
+const (
+	JobRestartNever     = "NEVER"
+	JobRestartOnFailure = "ON_FAILURE"
+)
+
+// Concurrency policies of job schedules, deciding what happens when a
+// schedule fires while a run of the job is still active
+const (
+	ConcurrencyAllow   = "ALLOW"
+	ConcurrencyForbid  = "FORBID"
+	ConcurrencyReplace = "REPLACE"
+)
+
+// maxJobRunHistory is the number of finished runs kept per job
+const maxJobRunHistory = 20
+
+// jobRunIDFormat is the timestamp prefix of job run IDs
+const jobRunIDFormat = "20060102150405"
+
+// Job is a run-to-completion workload started on cron schedules or on
+// demand
+type Job struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Run         *JobRunSpec       `json:"run"`
+	Schedules   []*JobSchedule    `json:"schedules,omitempty"`
+}
+
+// JobRunSpec describes the task a job run launches
+type JobRunSpec struct {
+	CPUs      float64           `json:"cpus"`
+	Mem       float64           `json:"mem"`
+	Disk      float64           `json:"disk,omitempty"`
+	Cmd       string            `json:"cmd,omitempty"`
+	Args      []string          `json:"args,omitempty"`
+	Docker    *JobDocker        `json:"docker,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Placement *JobPlacement     `json:"placement,omitempty"`
+	Restart   *JobRestart       `json:"restart,omitempty"`
+	// MaxRuntimeSeconds fails runs whose task runs longer, 0 for no limit
+	MaxRuntimeSeconds int `json:"maxRuntimeSeconds,omitempty"`
+}
+
+// JobDocker is the Docker image a job runs
+type JobDocker struct {
+	Image          string `json:"image"`
+	ForcePullImage bool   `json:"forcePullImage,omitempty"`
+}
+
+// JobPlacement holds the placement constraints of a job
+type JobPlacement struct {
+	Constraints []*JobConstraint `json:"constraints,omitempty"`
+}
+
+// JobConstraint is a placement constraint in Metronome syntax
+type JobConstraint struct {
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator"`
+	Value     string `json:"value,omitempty"`
+}
+
+// JobRestart is the retry policy of a job. With ON_FAILURE failed tasks are
+// relaunched until ActiveDeadlineSeconds have passed since the run started,
+// or indefinitely if it is 0.
+type JobRestart struct {
+	Policy                string `json:"policy"`
+	ActiveDeadlineSeconds int    `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// JobSchedule starts runs of a job on a cron schedule evaluated in a time
+// zone. A run due longer than StartingDeadlineSeconds ago is skipped.
+type JobSchedule struct {
+	ID                      string     `json:"id"`
+	Cron                    string     `json:"cron"`
+	TimeZone                string     `json:"timezone,omitempty"`
+	StartingDeadlineSeconds int        `json:"startingDeadlineSeconds,omitempty"`
+	ConcurrencyPolicy       string     `json:"concurrencyPolicy,omitempty"`
+	Enabled                 bool       `json:"enabled"`
+	NextRunAt               *time.Time `json:"nextRunAt,omitempty"`
+}
+
+// UnmarshalJSON decodes a schedule, enabling it unless it says otherwise
+func (s *JobSchedule) UnmarshalJSON(data []byte) error {
+	type plain JobSchedule
+	decoded := plain{Enabled: true}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*s = JobSchedule(decoded)
+	return nil
+}
+
+// JobRun is one execution of a job
+type JobRun struct {
+	ID          string        `json:"id"`
+	JobID       string        `json:"jobId"`
+	Status      string        `json:"status"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	CompletedAt *time.Time    `json:"completedAt,omitempty"`
+	Reason      string        `json:"reason,omitempty"`
+	Tasks       []*JobRunTask `json:"tasks"`
+	retryDelay  time.Duration // Backoff of the latest retry
+	retryAt     time.Time     // When the retried task may launch
+}
+
+// JobRunTask is a task launched by a job run; runs that are retried launch
+// several
+type JobRunTask struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// done reports whether a run has finished
+func (r *JobRun) done() bool {
+	return r.Status == JobRunSuccess || r.Status == JobRunFailed
+}
+
+// backOff delays the retry of a run's failed task with the default launch
+// backoff of apps: the first retry waits backoffSeconds and every further
+// one multiplies the wait by backoffFactor, up to maxLaunchDelaySeconds
+func (r *JobRun) backOff(now time.Time) {
+	initial, factor, max := backoff(&Application{})
+	if r.retryDelay == 0 {
+		r.retryDelay = initial
+	} else {
+		r.retryDelay = time.Duration(math.Min(float64(r.retryDelay)*factor, float64(max)))
+	}
+	r.retryAt = now.Add(r.retryDelay)
+}
+
+// retryDelayed reports whether the retried task of a run waits for its
+// backoff
+func (r *JobRun) retryDelayed(now time.Time) bool {
+	return now.Before(r.retryAt)
+}
+
+// currentTask returns the latest task of a run, nil if it has none
+func (r *JobRun) currentTask() *JobRunTask {
+	if len(r.Tasks) == 0 {
+		return nil
+	}
+	return r.Tasks[len(r.Tasks)-1]
+}
+
+// snapshotJob returns a copy of a job whose schedules the scheduler does
+// not change afterwards
+func snapshotJob(job *Job) *Job {
+	snapshot := *job
+	snapshot.Schedules = make([]*JobSchedule, len(job.Schedules))
+	for i, s := range job.Schedules {
+		copied := *s
+		snapshot.Schedules[i] = &copied
+	}
+	return &snapshot
+}
+
+// snapshotJobRun returns a copy of a run and its tasks
+func snapshotJobRun(run *JobRun) *JobRun {
+	snapshot := *run
+	snapshot.Tasks = make([]*JobRunTask, len(run.Tasks))
+	for i, t := range run.Tasks {
+		copied := *t
+		snapshot.Tasks[i] = &copied
+	}
+	return &snapshot
+}
+
+// location returns the time zone of a schedule
+func (s *JobSchedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// next returns when a schedule fires next after now
+func (s *JobSchedule) next(now time.Time) (time.Time, error) {
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cron.Next(now.In(loc)), nil
+}
+
+// ValidateJob checks a job definition and returns a *ValidationError
+// listing every problem found
+func ValidateJob(job *Job) error {
+	var v validator
+	if job.ID == "" {
+		v.add("/id", "must not be empty")
+	} else if !idSegment.MatchString(job.ID) {
+		v.add("/id", "must consist of lowercase letters, digits, hyphens and dots")
+	}
+
+	if job.Run == nil {
+		v.add("/run", "must be set")
+	} else {
+		run := job.Run
+		if run.CPUs <= 0 {
+			v.add("/run/cpus", "must be greater than 0")
+		}
+		if run.Mem < 0 {
+			v.add("/run/mem", "must not be negative")
+		}
+		if run.Disk < 0 {
+			v.add("/run/disk", "must not be negative")
+		}
+		if run.Cmd == "" && (run.Docker == nil || run.Docker.Image == "") {
+			v.add("/run", "cmd or docker.image must be set")
+		}
+		if run.MaxRuntimeSeconds < 0 {
+			v.add("/run/maxRuntimeSeconds", "must not be negative")
+		}
+		if run.Restart != nil {
+			switch run.Restart.Policy {
+			case JobRestartNever, JobRestartOnFailure:
+			default:
+				v.add("/run/restart/policy", "must be NEVER or ON_FAILURE")
+			}
+			if run.Restart.ActiveDeadlineSeconds < 0 {
+				v.add("/run/restart/activeDeadlineSeconds", "must not be negative")
+			}
+		}
+		for i, raw := range jobConstraints(job) {
+			if _, err := ParseConstraint(raw); err != nil {
+				v.add(fmt.Sprintf("/run/placement/constraints(%d)", i), "%s", err.Error())
+			}
+		}
+	}
+
+	ids := make(map[string]bool, len(job.Schedules))
+	for i, s := range job.Schedules {
+		path := fmt.Sprintf("/schedules(%d)", i)
+		if s.ID == "" || ids[s.ID] {
+			v.add(path+"/id", "must be unique and not empty")
+		}
+		ids[s.ID] = true
+		if _, err := ParseCron(s.Cron); err != nil {
+			v.add(path+"/cron", "%s", err.Error())
+		}
+		if _, err := s.location(); err != nil {
+			v.add(path+"/timezone", "unknown time zone %q", s.TimeZone)
+		}
+		if s.StartingDeadlineSeconds < 0 {
+			v.add(path+"/startingDeadlineSeconds", "must not be negative")
+		}
+		switch s.ConcurrencyPolicy {
+		case "", ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+		default:
+			v.add(path+"/concurrencyPolicy", "must be ALLOW, FORBID or REPLACE")
+		}
+	}
+	return v.err()
+}
+
+// jobConstraints returns the placement constraints of a job in app syntax
+func jobConstraints(job *Job) [][]string {
+	if job.Run.Placement == nil {
+		return nil
+	}
+	constraints := make([][]string, 0, len(job.Run.Placement.Constraints))
+	for _, c := range job.Run.Placement.Constraints {
+		constraint := []string{c.Attribute, c.Operator}
+		if c.Value != "" {
+			constraint = append(constraint, c.Value)
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
+
+// prepareJob fills in schedule defaults and the next run times of a job
+func prepareJob(job *Job, now time.Time) {
+	for _, s := range job.Schedules {
+		if s.ConcurrencyPolicy == "" {
+			s.ConcurrencyPolicy = ConcurrencyAllow
+		}
+		s.NextRunAt = nil
+		if next, err := s.next(now); err == nil && !next.IsZero() {
+			s.NextRunAt = &next
+		}
+	}
+}
+
+// CreateJob adds a job and arms its schedules
+func (m *Marathon) CreateJob(job *Job) error {
+	if err := ValidateJob(job); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	if _, exists := m.Jobs[job.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrJobExists, job.ID)
+	}
+	prepareJob(job, time.Now())
+	m.Jobs[job.ID] = snapshotJob(job)
+	log.Printf("Created job %s with %d schedules", job.ID, len(job.Schedules))
+	return nil
+}
+
+// UpdateJob replaces the definition of a job. Active runs keep going with
+// the definition they started with.
+func (m *Marathon) UpdateJob(jobID string, job *Job) error {
+	job.ID = jobID
+	if err := ValidateJob(job); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	if _, exists := m.Jobs[jobID]; !exists {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	prepareJob(job, time.Now())
+	m.Jobs[jobID] = snapshotJob(job)
+	log.Printf("Updated job %s", jobID)
+	return nil
+}
+
+// DeleteJob removes a job and its run history. Active runs are stopped if
+// stopRuns is set; otherwise their existence fails the deletion.
+func (m *Marathon) DeleteJob(jobID string, stopRuns bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	if _, exists := m.Jobs[jobID]; !exists {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	now := time.Now()
+	for _, run := range m.jobRuns[jobID] {
+		if run.done() {
+			continue
+		}
+		if !stopRuns {
+			return fmt.Errorf("%w: %s", ErrJobRunsActive, jobID)
+		}
+		m.finishJobRun(run, JobRunFailed, "job deleted", now)
+	}
+
+	for _, run := range m.jobRuns[jobID] {
+		for _, t := range run.Tasks {
+			delete(m.Tasks, t.ID)
+		}
+	}
+	delete(m.Jobs, jobID)
+	delete(m.jobRuns, jobID)
+	log.Printf("Deleted job %s", jobID)
+	return nil
+}
+
+// GetJob returns a job
+func (m *Marathon) GetJob(jobID string) (*Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.Jobs[jobID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	return snapshotJob(job), nil
+}
+
+// ListJobs returns all jobs ordered by ID
+func (m *Marathon) ListJobs() []*Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(m.Jobs))
+	for _, job := range m.Jobs {
+		jobs = append(jobs, snapshotJob(job))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// StartJobRun starts a run of a job now, regardless of its schedules
+func (m *Marathon) StartJobRun(jobID string) (*JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	job, exists := m.Jobs[jobID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	return snapshotJobRun(m.startJobRun(job, time.Now())), nil
+}
+
+// ListJobRuns returns the active and finished runs of a job, oldest first
+func (m *Marathon) ListJobRuns(jobID string) ([]*JobRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.Jobs[jobID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	runs := make([]*JobRun, 0, len(m.jobRuns[jobID]))
+	for _, run := range m.jobRuns[jobID] {
+		runs = append(runs, snapshotJobRun(run))
+	}
+	return runs, nil
+}
+
+// GetJobRun returns a run of a job
+func (m *Marathon) GetJobRun(jobID, runID string) (*JobRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, err := m.findJobRun(jobID, runID)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotJobRun(run), nil
+}
+
+// StopJobRun kills the task of an active run and fails the run
+func (m *Marathon) StopJobRun(jobID, runID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	run, err := m.findJobRun(jobID, runID)
+	if err != nil {
+		return err
+	}
+	if !run.done() {
+		m.finishJobRun(run, JobRunFailed, "stopped", time.Now())
+	}
+	return nil
+}
+
+// findJobRun returns a run of a job. The caller must hold m.mu.
+func (m *Marathon) findJobRun(jobID, runID string) (*JobRun, error) {
+	if _, exists := m.Jobs[jobID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	for _, run := range m.jobRuns[jobID] {
+		if run.ID == runID {
+			return run, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s of %s", ErrJobRunNotFound, runID, jobID)
+}
+
+// startJobRun creates a run of a job and stages its first task. The caller
+// must hold m.mu.
+func (m *Marathon) startJobRun(job *Job, now time.Time) *JobRun {
+	stamp := now.UTC().Format(jobRunIDFormat)
+	runID := ""
+	for i := 0; runID == ""; i++ {
+		candidate := fmt.Sprintf("%s%03d", stamp, i)
+		if _, err := m.findJobRun(job.ID, candidate); err != nil {
+			runID = candidate
+		}
+	}
+
+	run := &JobRun{ID: runID, JobID: job.ID, Status: JobRunInitial, CreatedAt: now, Tasks: make([]*JobRunTask, 0)}
+	m.jobRuns[job.ID] = append(m.jobRuns[job.ID], run)
+	m.stageJobTask(run, now)
+	log.Printf("Started run %s of job %s", run.ID, job.ID)
+	return run
+}
+
+// stageJobTask stages a new task for a run, which waits for an offer. The
+// caller must hold m.mu.
+func (m *Marathon) stageJobTask(run *JobRun, now time.Time) {
+	task := &MarathonTask{
+		ID:       fmt.Sprintf("%s_%s.%d", run.JobID, run.ID, len(run.Tasks)),
+		AppID:    run.JobID,
+		Version:  run.ID,
+		State:    "TASK_STAGING",
+		StagedAt: &now,
+	}
+	m.Tasks[task.ID] = task
+	run.Tasks = append(run.Tasks, &JobRunTask{ID: task.ID, Status: task.State})
+	m.publishStatusUpdate(task)
+}
+
+// finishJobRun ends a run, killing its task if it is still live. The
+// caller must hold m.mu.
+func (m *Marathon) finishJobRun(run *JobRun, status, reason string, now time.Time) {
+	if current := run.currentTask(); current != nil {
+		if task := m.Tasks[current.ID]; task != nil && (task.State == "TASK_STAGING" || task.State == "TASK_RUNNING") {
+			task.State = "TASK_KILLED"
+			m.publishStatusUpdate(task)
+			current.Status = task.State
+			current.CompletedAt = &now
+		}
+	}
+	run.Status = status
+	run.Reason = reason
+	run.CompletedAt = &now
+	log.Printf("Run %s of job %s finished with %s %s", run.ID, run.JobID, status, reason)
+	m.pruneJobRuns(run.JobID)
+}
+
+// pruneJobRuns drops the oldest finished runs of a job beyond the history
+// limit, along with their tasks. The caller must hold m.mu.
+func (m *Marathon) pruneJobRuns(jobID string) {
+	finished := 0
+	for _, run := range m.jobRuns[jobID] {
+		if run.done() {
+			finished++
+		}
+	}
+
+	kept := make([]*JobRun, 0, len(m.jobRuns[jobID]))
+	for _, run := range m.jobRuns[jobID] {
+		if run.done() && finished > maxJobRunHistory {
+			finished--
+			for _, t := range run.Tasks {
+				delete(m.Tasks, t.ID)
+			}
+			continue
+		}
+		kept = append(kept, run)
+	}
+	m.jobRuns[jobID] = kept
+}
+
+// jobRunForTask returns the run a task was launched for, nil for tasks of
+// apps and pods. The caller must hold m.mu.
+func (m *Marathon) jobRunForTask(task *MarathonTask) *JobRun {
+	if _, exists := m.Jobs[task.AppID]; !exists {
+		return nil
+	}
+	for _, run := range m.jobRuns[task.AppID] {
+		if run.ID == task.Version {
+			return run
+		}
+	}
+	return nil
+}
+
+// jobTaskUpdate applies a task status to the run it belongs to: a finished
+// task completes the run, a failed one is retried as the restart policy
+// allows. The caller must hold m.mu.
+func (m *Marathon) jobTaskUpdate(run *JobRun, task *MarathonTask, message string, now time.Time) {
+	current := run.currentTask()
+	if run.done() || current == nil || current.ID != task.ID {
+		return
+	}
+	current.Status = task.State
+
+	switch {
+	case task.State == "TASK_RUNNING":
+		current.StartedAt = &now
+		run.Status = JobRunActive
+	case task.State == "TASK_FINISHED":
+		current.CompletedAt = &now
+		m.finishJobRun(run, JobRunSuccess, "", now)
+	case failedStates[task.State] || task.State == "TASK_KILLED":
+		current.CompletedAt = &now
+		job := m.Jobs[run.JobID]
+		restart := job.Run.Restart
+		if restart != nil && restart.Policy == JobRestartOnFailure &&
+			(restart.ActiveDeadlineSeconds == 0 || now.Sub(run.CreatedAt) < time.Duration(restart.ActiveDeadlineSeconds)*time.Second) {
+			run.Status = JobRunStarting
+			run.backOff(now)
+			m.stageJobTask(run, now)
+			log.Printf("Retrying run %s of job %s in %s after %s: %s", run.ID, run.JobID, run.retryDelay, task.State, message)
+			return
+		}
+		m.finishJobRun(run, JobRunFailed, fmt.Sprintf("%s: %s", task.State, message), now)
+	}
+}
+
+// jobRunSpec returns the app whose resources and constraints a run's task
+// is placed with. The caller must hold m.mu.
+func (m *Marathon) jobRunSpec(job *Job) *Application {
+	app := &Application{ID: job.ID, CPUs: job.Run.CPUs, Memory: job.Run.Mem, Constraints: jobConstraints(job)}
+	for _, run := range m.jobRuns[job.ID] {
+		if current := run.currentTask(); current != nil && !run.done() {
+			if task := m.Tasks[current.ID]; task != nil {
+				app.Tasks = append(app.Tasks, task)
+			}
+		}
+	}
+	return app
+}
+
+// placeJobTasks places the tasks of job runs waiting for an offer on what
+// is left of it. Retries wait for their backoff. The caller must hold m.mu.
+func (m *Marathon) placeJobTasks(match *OfferMatch, remaining *Offer, agent *AgentInfo, now time.Time) {
+	ids := make([]string, 0, len(m.Jobs))
+	for id := range m.Jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		job := m.Jobs[id]
+		spec := m.jobRunSpec(job)
+		constraints, err := ParseConstraints(spec.Constraints)
+		if err != nil {
+			continue
+		}
+		for _, run := range m.jobRuns[id] {
+			current := run.currentTask()
+			if run.done() || current == nil || run.retryDelayed(now) {
+				continue
+			}
+			task := m.Tasks[current.ID]
+			if task == nil || !waitingForOffer(task) {
+				continue
+			}
+			if reasons := m.offerRejectReasons(spec, remaining, agent, constraints); len(reasons) > 0 {
+				break
+			}
+
+			task.SlaveID = agent.ID
+			task.Host = agent.Hostname
+			remaining.CPUs -= spec.CPUs
+			remaining.Memory -= spec.Memory
+			run.Status = JobRunStarting
+			match.Tasks = append(match.Tasks, task)
+			spec.Tasks = append(spec.Tasks, task)
+		}
+	}
+}
+
+// scheduleJobs starts the runs whose schedules are due and fails runs that
+// exceed their maximum runtime. The caller must hold m.mu.
+func (m *Marathon) scheduleJobs(now time.Time) {
+	ids := make([]string, 0, len(m.Jobs))
+	for id := range m.Jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		job := m.Jobs[id]
+		if max := job.Run.MaxRuntimeSeconds; max > 0 {
+			for _, run := range m.jobRuns[id] {
+				current := run.currentTask()
+				if run.done() || current == nil || current.StartedAt == nil {
+					continue
+				}
+				if now.Sub(*current.StartedAt) > time.Duration(max)*time.Second {
+					m.finishJobRun(run, JobRunFailed, fmt.Sprintf("exceeded maxRuntimeSeconds of %d", max), now)
+				}
+			}
+		}
+
+		for _, s := range job.Schedules {
+			if !s.Enabled || s.NextRunAt == nil || now.Before(*s.NextRunAt) {
+				continue
+			}
+			due := *s.NextRunAt
+			if next, err := s.next(now); err == nil && !next.IsZero() {
+				s.NextRunAt = &next
+			} else {
+				s.NextRunAt = nil
+			}
+
+			if s.StartingDeadlineSeconds > 0 && now.Sub(due) > time.Duration(s.StartingDeadlineSeconds)*time.Second {
+				log.Printf("Skipping run of job %s due at %s: starting deadline passed", id, due.Format(time.RFC3339))
+				continue
+			}
+			active := make([]*JobRun, 0)
+			for _, run := range m.jobRuns[id] {
+				if !run.done() {
+					active = append(active, run)
+				}
+			}
+			switch {
+			case len(active) > 0 && s.ConcurrencyPolicy == ConcurrencyForbid:
+				log.Printf("Skipping run of job %s due at %s: a run is still active", id, due.Format(time.RFC3339))
+				continue
+			case s.ConcurrencyPolicy == ConcurrencyReplace:
+				for _, run := range active {
+					m.finishJobRun(run, JobRunFailed, "replaced by a scheduled run", now)
+				}
+			}
+			m.startJobRun(job, now)
+		}
+	}
+}
+
+// startJobScheduling fires job schedules while this instance leads
+func (m *Marathon) startJobScheduling() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if m.IsLeader() {
+			m.mu.Lock()
+			m.scheduleJobs(time.Now())
+			m.persist()
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *Marathon) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.ListJobs())
+}
+
+func (m *Marathon) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var job Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := m.CreateJob(&job); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&job)
+}
+
+func (m *Marathon) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := m.GetJob(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (m *Marathon) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
+	var job Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := m.UpdateJob(mux.Vars(r)["id"], &job); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&job)
+}
+
+func (m *Marathon) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	stopRuns := r.URL.Query().Get("stopCurrentJobRuns") == "true"
+	if err := m.DeleteJob(mux.Vars(r)["id"], stopRuns); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *Marathon) handleListJobRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := m.ListJobRuns(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+func (m *Marathon) handleStartJobRun(w http.ResponseWriter, r *http.Request) {
+	run, err := m.StartJobRun(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(run)
+}
+
+func (m *Marathon) handleGetJobRun(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	run, err := m.GetJobRun(vars["id"], vars["runId"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+func (m *Marathon) handleStopJobRun(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := m.StopJobRun(vars["id"], vars["runId"]); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
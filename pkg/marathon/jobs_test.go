@@ -0,0 +1,320 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJob() *Job {
+	return &Job{
+		ID: "prod.backup",
+		Run: &JobRunSpec{
+			CPUs:      1.0,
+			Mem:       512,
+			Cmd:       "backup --all",
+			Placement: &JobPlacement{Constraints: []*JobConstraint{{Attribute: "rack", Operator: "IS", Value: "r1"}}},
+		},
+		Schedules: []*JobSchedule{{ID: "nightly", Cron: "0 2 * * *", TimeZone: "Europe/Berlin", Enabled: true}},
+	}
+}
+
+// dueJobTime returns a time after the next run of a job's first schedule
+func dueJobTime(t *testing.T, marathon *Marathon, jobID string) time.Time {
+	t.Helper()
+	next := marathon.Jobs[jobID].Schedules[0].NextRunAt
+	require.NotNil(t, next)
+	return next.Add(time.Second)
+}
+
+func TestValidateJob(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(job *Job)
+		paths  []string
+	}{
+		{"valid", func(job *Job) {}, nil},
+		{"id", func(job *Job) { job.ID = "prod/backup" }, []string{"/id"}},
+		{"no run", func(job *Job) { job.Run = nil }, []string{"/run"}},
+		{"run", func(job *Job) {
+			job.Run.CPUs = 0
+			job.Run.Cmd = ""
+			job.Run.Restart = &JobRestart{Policy: "ALWAYS"}
+			job.Run.Placement.Constraints[0].Operator = "NEAR"
+		}, []string{"/run/cpus", "/run", "/run/restart/policy", "/run/placement/constraints(0)"}},
+		{"schedule", func(job *Job) {
+			job.Schedules = append(job.Schedules, &JobSchedule{ID: "nightly", Cron: "0 25 * * *", TimeZone: "Mars/Olympus", ConcurrencyPolicy: "QUEUE"})
+		}, []string{"/schedules(1)/id", "/schedules(1)/cron", "/schedules(1)/timezone", "/schedules(1)/concurrencyPolicy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := testJob()
+			tt.modify(job)
+			err := ValidateJob(job)
+			if tt.paths == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			paths := make([]string, 0)
+			for _, v := range validationErr.Details {
+				paths = append(paths, v.Path)
+			}
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestMarathon_JobScheduleLaunchesRun(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateJob(testJob()))
+
+	// 02:00 in Berlin
+	next := marathon.Jobs["prod.backup"].Schedules[0].NextRunAt
+	require.NotNil(t, next)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	assert.Equal(t, 2, next.In(berlin).Hour())
+	assert.Equal(t, ConcurrencyAllow, marathon.Jobs["prod.backup"].Schedules[0].ConcurrencyPolicy)
+
+	now := dueJobTime(t, marathon, "prod.backup")
+	marathon.scheduleJobs(now)
+	runs, err := marathon.ListJobRuns("prod.backup")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, JobRunInitial, runs[0].Status)
+	assert.True(t, marathon.Jobs["prod.backup"].Schedules[0].NextRunAt.After(now))
+
+	// The run's task goes through the offer path and honors constraints
+	assert.Empty(t, marathon.ResourceOffers([]*Offer{testOffer(1, "r2")}))
+	matches := marathon.ResourceOffers([]*Offer{testOffer(2, "r1")})
+	require.Len(t, matches, 1)
+	require.Len(t, matches[0].Tasks, 1)
+	task := matches[0].Tasks[0]
+	assert.Equal(t, []*OfferOperation{{Type: OperationLaunch, TaskIDs: []string{task.ID}}}, matches[0].Operations)
+
+	require.NoError(t, marathon.StatusUpdate(task.ID, "TASK_RUNNING", ""))
+	run, err := marathon.GetJobRun("prod.backup", runs[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobRunActive, run.Status)
+
+	require.NoError(t, marathon.StatusUpdate(task.ID, "TASK_FINISHED", ""))
+	run, err = marathon.GetJobRun("prod.backup", runs[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobRunSuccess, run.Status)
+	assert.NotNil(t, run.CompletedAt)
+	assert.Equal(t, "TASK_FINISHED", run.Tasks[0].Status)
+}
+
+func TestMarathon_JobRunRetries(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	job := testJob()
+	job.Run.Restart = &JobRestart{Policy: JobRestartOnFailure, ActiveDeadlineSeconds: 60}
+	require.NoError(t, marathon.CreateJob(job))
+
+	run, err := marathon.StartJobRun("prod.backup")
+	require.NoError(t, err)
+	start := marathon.jobRuns["prod.backup"][0].CreatedAt
+
+	// Failures within the deadline launch a new task
+	require.NoError(t, marathon.StatusUpdate(run.Tasks[0].ID, "TASK_FAILED", "exit 1"))
+	run, err = marathon.GetJobRun("prod.backup", run.ID)
+	require.NoError(t, err)
+	require.Len(t, run.Tasks, 2)
+	assert.Equal(t, JobRunStarting, run.Status)
+	assert.Equal(t, "TASK_FAILED", run.Tasks[0].Status)
+
+	// The retry waits for its backoff
+	marathon.monitorTasks()
+	assert.Equal(t, "TASK_STAGING", marathon.Tasks[run.Tasks[1].ID].State)
+	assert.Empty(t, marathon.ResourceOffers([]*Offer{testOffer(1, "r1")}))
+
+	// Past the deadline the run fails
+	marathon.mu.Lock()
+	task := marathon.Tasks[run.Tasks[1].ID]
+	task.State = "TASK_FAILED"
+	marathon.jobTaskUpdate(marathon.jobRuns["prod.backup"][0], task, "exit 1", start.Add(2*time.Minute))
+	marathon.mu.Unlock()
+
+	run, err = marathon.GetJobRun("prod.backup", run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobRunFailed, run.Status)
+	assert.Equal(t, "TASK_FAILED: exit 1", run.Reason)
+	assert.Len(t, run.Tasks, 2)
+}
+
+func TestMarathon_JobConcurrencyPolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		statuses []string
+	}{
+		{ConcurrencyAllow, []string{JobRunInitial, JobRunInitial}},
+		{ConcurrencyForbid, []string{JobRunInitial}},
+		{ConcurrencyReplace, []string{JobRunFailed, JobRunInitial}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+			job := testJob()
+			job.Schedules[0].ConcurrencyPolicy = tt.policy
+			require.NoError(t, marathon.CreateJob(job))
+			_, err := marathon.StartJobRun("prod.backup")
+			require.NoError(t, err)
+
+			marathon.scheduleJobs(dueJobTime(t, marathon, "prod.backup"))
+			runs, err := marathon.ListJobRuns("prod.backup")
+			require.NoError(t, err)
+			statuses := make([]string, 0)
+			for _, run := range runs {
+				statuses = append(statuses, run.Status)
+			}
+			assert.Equal(t, tt.statuses, statuses)
+		})
+	}
+}
+
+func TestMarathon_JobStartingDeadlineAndMaxRuntime(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	job := testJob()
+	job.Schedules[0].StartingDeadlineSeconds = 60
+	job.Run.MaxRuntimeSeconds = 600
+	require.NoError(t, marathon.CreateJob(job))
+
+	// A run missed by more than the starting deadline is skipped
+	due := dueJobTime(t, marathon, "prod.backup")
+	marathon.scheduleJobs(due.Add(5 * time.Minute))
+	assert.Empty(t, marathon.jobRuns["prod.backup"])
+	assert.True(t, marathon.Jobs["prod.backup"].Schedules[0].NextRunAt.After(due))
+
+	run, err := marathon.StartJobRun("prod.backup")
+	require.NoError(t, err)
+	require.NoError(t, marathon.StatusUpdate(run.Tasks[0].ID, "TASK_RUNNING", ""))
+	started := *marathon.jobRuns["prod.backup"][0].Tasks[0].StartedAt
+
+	marathon.scheduleJobs(started.Add(5 * time.Minute))
+	run, err = marathon.GetJobRun("prod.backup", run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobRunActive, run.Status)
+
+	marathon.scheduleJobs(started.Add(11 * time.Minute))
+	run, err = marathon.GetJobRun("prod.backup", run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobRunFailed, run.Status)
+	assert.Equal(t, "exceeded maxRuntimeSeconds of 600", run.Reason)
+	assert.Equal(t, "TASK_KILLED", marathon.Tasks[run.Tasks[0].ID].State)
+}
+
+func TestMarathon_JobRunHistoryLimit(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateJob(testJob()))
+
+	for i := 0; i < maxJobRunHistory+5; i++ {
+		run, err := marathon.StartJobRun("prod.backup")
+		require.NoError(t, err)
+		require.NoError(t, marathon.StatusUpdate(run.Tasks[0].ID, "TASK_FINISHED", ""))
+	}
+	runs, err := marathon.ListJobRuns("prod.backup")
+	require.NoError(t, err)
+	assert.Len(t, runs, maxJobRunHistory)
+	assert.Len(t, marathon.Tasks, maxJobRunHistory)
+}
+
+func TestMarathon_RecoverJobs(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			before := newStoredMarathon(t, store)
+			require.NoError(t, before.CreateJob(testJob()))
+			run, err := before.StartJobRun("prod.backup")
+			require.NoError(t, err)
+			before.flush()
+
+			after := newStoredMarathon(t, store)
+			require.NoError(t, after.Recover())
+			require.Contains(t, after.Jobs, "prod.backup")
+			assert.Equal(t, before.Jobs["prod.backup"].Schedules[0].NextRunAt.Unix(),
+				after.Jobs["prod.backup"].Schedules[0].NextRunAt.Unix())
+
+			// The recovered run still completes through its task
+			require.NoError(t, after.StatusUpdate(run.Tasks[0].ID, "TASK_FINISHED", ""))
+			recovered, err := after.GetJobRun("prod.backup", run.ID)
+			require.NoError(t, err)
+			assert.Equal(t, JobRunSuccess, recovered.Status)
+		})
+	}
+}
+
+func TestMarathon_HandleJobs(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, &buf))
+		return w
+	}
+
+	w := do("POST", "/v1/jobs", testJob())
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created Job
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.NotNil(t, created.Schedules[0].NextRunAt)
+	assert.Equal(t, http.StatusConflict, do("POST", "/v1/jobs", testJob()).Code)
+
+	invalid := testJob()
+	invalid.ID = "other"
+	invalid.Schedules[0].Cron = "every night"
+	w = do("POST", "/v1/jobs", invalid)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "/schedules(0)/cron")
+
+	// Schedules are enabled unless disabled explicitly
+	w = do("POST", "/v1/jobs", json.RawMessage(`{"id": "report", "run": {"cpus": 0.5, "mem": 64, "cmd": "report"},
+		"schedules": [{"id": "hourly", "cron": "@hourly"}]}`))
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.True(t, marathon.Jobs["report"].Schedules[0].Enabled)
+
+	var jobs []*Job
+	require.NoError(t, json.NewDecoder(do("GET", "/v1/jobs", nil).Body).Decode(&jobs))
+	assert.Len(t, jobs, 2)
+
+	updated := testJob()
+	updated.Run.Cmd = "backup --incremental"
+	assert.Equal(t, http.StatusOK, do("PUT", "/v1/jobs/prod.backup", updated).Code)
+	assert.Equal(t, "backup --incremental", marathon.Jobs["prod.backup"].Run.Cmd)
+	assert.Equal(t, http.StatusNotFound, do("PUT", "/v1/jobs/missing", updated).Code)
+
+	w = do("POST", "/v1/jobs/prod.backup/runs", nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var run JobRun
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&run))
+	assert.Equal(t, "prod.backup", run.JobID)
+
+	var runs []*JobRun
+	require.NoError(t, json.NewDecoder(do("GET", "/v1/jobs/prod.backup/runs", nil).Body).Decode(&runs))
+	require.Len(t, runs, 1)
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/jobs/prod.backup/runs/"+run.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v1/jobs/prod.backup/runs/unknown", nil).Code)
+
+	// Active runs block deletion unless they are stopped
+	assert.Equal(t, http.StatusConflict, do("DELETE", "/v1/jobs/prod.backup", nil).Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/jobs/prod.backup/runs/"+run.ID+"/actions/stop", nil).Code)
+	stopped, err := marathon.GetJobRun("prod.backup", run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobRunFailed, stopped.Status)
+
+	do("POST", "/v1/jobs/prod.backup/runs", nil)
+	assert.Equal(t, http.StatusOK, do("DELETE", "/v1/jobs/prod.backup?stopCurrentJobRuns=true", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v1/jobs/prod.backup", nil).Code)
+	assert.Empty(t, marathon.Tasks, "the tasks of deleted runs are deleted")
+}
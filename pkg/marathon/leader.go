@@ -0,0 +1,346 @@
+package marathon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// DefaultZKLeaderPath is the ZooKeeper node Marathon instances elect their
+// leader under
+const DefaultZKLeaderPath = "/marathon/leader"
+
+// MarathonVersion is the Marathon API version reported by /v2/info
+const MarathonVersion = "1.9.0"
+
+// viaHeader marks requests proxied from another instance, so a request is
+// never proxied twice while leadership moves
+const viaHeader = "X-Marathon-Via"
+
+// ErrNoLeader is returned while no instance holds leadership
+var ErrNoLeader = errors.New("no leader elected")
+
+// LeaderElector elects one leader among Marathon instances
+type LeaderElector interface {
+	// Run campaigns for leadership as candidate, an instance's host:port,
+	// until ctx is done. onChange is called whenever this instance gains
+	// or loses leadership.
+	Run(ctx context.Context, candidate string, onChange func(leader bool)) error
+	// Leader returns the host:port of the current leader or ErrNoLeader
+	Leader() (string, error)
+}
+
+// zkElectionConn is the subset of *zk.Conn used by ZKLeaderElector
+type zkElectionConn interface {
+	zkConn
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+}
+
+// ZKLeaderElector elects a leader with ZooKeeper's ephemeral sequential
+// node recipe: every candidate creates a member node and the one with the
+// lowest sequence number leads. Each follower watches only its predecessor.
+type ZKLeaderElector struct {
+	conn zkElectionConn
+	path string
+}
+
+// NewZKLeaderElector connects to a ZooKeeper ensemble and elects under
+// electionPath, or DefaultZKLeaderPath if it is empty
+func NewZKLeaderElector(servers []string, electionPath string, sessionTimeout time.Duration) (*ZKLeaderElector, error) {
+	conn, _, err := zk.Connect(servers, sessionTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ZooKeeper: %w", err)
+	}
+	return newZKLeaderElector(conn, electionPath), nil
+}
+
+func newZKLeaderElector(conn zkElectionConn, electionPath string) *ZKLeaderElector {
+	if electionPath == "" {
+		electionPath = DefaultZKLeaderPath
+	}
+	return &ZKLeaderElector{conn: conn, path: path.Clean("/" + electionPath)}
+}
+
+// members returns the election's member nodes in sequence order
+func (e *ZKLeaderElector) members() ([]string, error) {
+	children, _, err := e.conn.Children(e.path)
+	if errors.Is(err, zk.ErrNoNode) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// Leader returns the candidate stored in the lowest member node
+func (e *ZKLeaderElector) Leader() (string, error) {
+	members, err := e.members()
+	if err != nil {
+		return "", err
+	}
+	for _, member := range members {
+		data, _, err := e.conn.Get(path.Join(e.path, member))
+		if errors.Is(err, zk.ErrNoNode) {
+			// The member left after it was listed
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", ErrNoLeader
+}
+
+// Run joins the election and follows it until ctx is done. The member node
+// is recreated if it disappears, such as after a session expiry.
+func (e *ZKLeaderElector) Run(ctx context.Context, candidate string, onChange func(leader bool)) error {
+	if err := ensureZKPath(e.conn, e.path); err != nil {
+		return fmt.Errorf("failed to create election node: %w", err)
+	}
+
+	leading := false
+	setLeading := func(leader bool) {
+		if leader != leading {
+			leading = leader
+			onChange(leader)
+		}
+	}
+
+	node := ""
+	defer func() {
+		setLeading(false)
+		if node != "" {
+			e.conn.Delete(node, -1)
+		}
+	}()
+
+	for {
+		if node == "" {
+			created, err := e.conn.Create(path.Join(e.path, "member_"), []byte(candidate),
+				zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+			if err != nil {
+				return fmt.Errorf("failed to join election: %w", err)
+			}
+			node = created
+		}
+
+		members, err := e.members()
+		if err != nil {
+			return fmt.Errorf("failed to read election: %w", err)
+		}
+		index := sort.SearchStrings(members, path.Base(node))
+		if index == len(members) || members[index] != path.Base(node) {
+			log.Printf("Election node %s vanished, rejoining", node)
+			setLeading(false)
+			node = ""
+			continue
+		}
+
+		// The leader watches its own node, followers their predecessor
+		watched := node
+		if index > 0 {
+			watched = path.Join(e.path, members[index-1])
+		}
+		setLeading(index == 0)
+
+		exists, _, events, err := e.conn.ExistsW(watched)
+		if err != nil {
+			return fmt.Errorf("failed to watch election: %w", err)
+		}
+		if !exists {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-events:
+		}
+	}
+}
+
+// IsLeader reports whether this instance leads. Instances without an
+// elector always lead.
+func (m *Marathon) IsLeader() bool {
+	if m.Elector == nil {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.elected
+}
+
+// address returns the host:port this instance serves its API on
+func (m *Marathon) address() string {
+	return fmt.Sprintf("%s:%d", m.Hostname, m.Port)
+}
+
+// runElection campaigns for leadership until ctx is done, retrying after
+// elector failures
+func (m *Marathon) runElection(ctx context.Context) {
+	for {
+		if err := m.Elector.Run(ctx, m.address(), m.onLeadershipChange); err != nil {
+			log.Printf("Leader election failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// onLeadershipChange reloads the state from storage and reconciles tasks
+// when this instance is elected, so it continues where the previous leader
+// stopped. Once leadership is lost nothing more is written: another
+// instance may already lead and write the store.
+func (m *Marathon) onLeadershipChange(leader bool) {
+	if !leader {
+		m.mu.Lock()
+		m.elected = false
+		m.mu.Unlock()
+		// Wait for a write already in progress
+		m.flushMu.Lock()
+		m.flushMu.Unlock()
+		log.Printf("Lost leadership at %s", m.address())
+		return
+	}
+	if m.Store != nil {
+		if err := m.Recover(); err != nil {
+			log.Printf("Failed to recover state after election: %v", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	m.elected = true
+	log.Printf("Elected as leader at %s", m.address())
+	m.reconcileTasks()
+}
+
+// reconcileTasks brings the tasks in line with the app definitions: tasks
+// of removed apps are killed, job run tasks are left alone, and apps that are not being deployed get
+// tasks staged up to their instance count. The caller must hold m.mu.
+func (m *Marathon) reconcileTasks() {
+	for _, task := range m.Tasks {
+		if _, exists := m.Applications[task.AppID]; exists {
+			continue
+		}
+		if m.jobRunForTask(task) != nil {
+			continue
+		}
+		if task.State == "TASK_STAGING" || task.State == "TASK_RUNNING" {
+			task.State = "TASK_KILLED"
+			m.publishStatusUpdate(task)
+		}
+	}
+
+	deploying := make(map[string]bool)
+	for _, d := range m.Deployments {
+		for _, appID := range d.AffectedApps {
+			deploying[appID] = true
+		}
+	}
+	for _, app := range m.sortedApps() {
+		if deploying[app.ID] {
+			continue
+		}
+		for missing := app.Instances - len(app.Tasks); missing > 0; missing-- {
+			task := m.stageTask(app)
+			log.Printf("Reconciliation staged task %s for %s", task.ID, app.ID)
+		}
+	}
+}
+
+// isWrite reports whether a request changes state
+func isWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// proxyToLeader forwards write requests received by a non-leader to the
+// current leader
+func (m *Marathon) proxyToLeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWrite(r) || m.IsLeader() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leader, err := m.Elector.Leader()
+		if err != nil || leader == m.address() || r.Header.Get(viaHeader) != "" {
+			http.Error(w, "leader election in progress", http.StatusServiceUnavailable)
+			return
+		}
+
+		target := &url.URL{Scheme: "http", Host: leader}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("failed to reach leader %s: %v", leader, err), http.StatusBadGateway)
+		}
+		r.Header.Set(viaHeader, m.address())
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+func (m *Marathon) handleGetLeader(w http.ResponseWriter, r *http.Request) {
+	leader := m.address()
+	if m.Elector != nil {
+		var err error
+		if leader, err = m.Elector.Leader(); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"leader": leader})
+}
+
+func (m *Marathon) handleInfo(w http.ResponseWriter, r *http.Request) {
+	leader := m.address()
+	if m.Elector != nil {
+		var err error
+		if leader, err = m.Elector.Leader(); err != nil {
+			leader = ""
+		}
+	}
+
+	info := map[string]interface{}{
+		"name":        "marathon",
+		"version":     MarathonVersion,
+		"frameworkId": m.ID,
+		"leader":      leader,
+		"elected":     m.IsLeader(),
+		"marathon_config": map[string]interface{}{
+			"master":   m.MasterURL,
+			"hostname": m.Hostname,
+			"ha":       m.Elector != nil,
+		},
+		"http_config": map[string]interface{}{
+			"http_port": m.Port,
+		},
+		"storage": m.Store != nil,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,195 @@
+package marathon
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZKLeaderElector_Failover(t *testing.T) {
+	conn := newFakeZKConn()
+	elector := newZKLeaderElector(conn, "")
+
+	_, err := elector.Leader()
+	assert.ErrorIs(t, err, ErrNoLeader)
+
+	var firstLeads, secondLeads atomic.Bool
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		elector.Run(firstCtx, "first:8080", firstLeads.Store)
+	}()
+	require.Eventually(t, firstLeads.Load, time.Second, 10*time.Millisecond)
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go elector.Run(secondCtx, "second:8080", secondLeads.Store)
+
+	require.Eventually(t, func() bool {
+		members, err := elector.members()
+		return err == nil && len(members) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, secondLeads.Load())
+	leader, err := elector.Leader()
+	require.NoError(t, err)
+	assert.Equal(t, "first:8080", leader)
+
+	// The follower takes over once the leader leaves
+	stopFirst()
+	<-firstDone
+	assert.False(t, firstLeads.Load())
+	require.Eventually(t, secondLeads.Load, time.Second, 10*time.Millisecond)
+	leader, err = elector.Leader()
+	require.NoError(t, err)
+	assert.Equal(t, "second:8080", leader)
+}
+
+// haInstance is a Marathon instance serving its API for the HA tests
+type haInstance struct {
+	*Marathon
+	stop func()
+}
+
+func startHAInstance(t *testing.T, name string, store Store, elector LeaderElector) *haInstance {
+	t.Helper()
+	marathon := NewMarathon(name, "localhost", 0, "http://localhost:5050")
+	marathon.Store = store
+	marathon.Elector = elector
+
+	server := httptest.NewServer(marathon.setupRoutes())
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	marathon.Hostname = host
+	marathon.Port, err = strconv.Atoi(port)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		marathon.runElection(ctx)
+	}()
+	instance := &haInstance{Marathon: marathon, stop: func() { cancel(); <-done }}
+	t.Cleanup(instance.stop)
+	return instance
+}
+
+func (i *haInstance) url(path string) string {
+	return "http://" + i.address() + path
+}
+
+func TestMarathon_HighAvailability(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	elector := newZKLeaderElector(newFakeZKConn(), "")
+
+	leader := startHAInstance(t, "marathon-1", store, elector)
+	require.Eventually(t, leader.IsLeader, time.Second, 10*time.Millisecond)
+	follower := startHAInstance(t, "marathon-2", store, elector)
+
+	// Both instances report the same leader
+	for _, instance := range []*haInstance{leader, follower} {
+		resp, err := http.Get(instance.url("/v2/leader"))
+		require.NoError(t, err)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		assert.Equal(t, leader.address(), body["leader"])
+	}
+
+	resp, err := http.Get(follower.url("/v2/info"))
+	require.NoError(t, err)
+	var info map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	assert.Equal(t, false, info["elected"])
+	assert.Equal(t, leader.address(), info["leader"])
+	assert.Equal(t, MarathonVersion, info["version"])
+
+	// Writes sent to the follower are applied by the leader
+	resp, err = http.Post(follower.url("/v2/apps"), "application/json",
+		strings.NewReader(`{"id": "/web", "instances": 2, "cpus": 0.5}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	leader.mu.RLock()
+	assert.Contains(t, leader.Applications, "/web")
+	leader.mu.RUnlock()
+	follower.mu.RLock()
+	assert.NotContains(t, follower.Applications, "/web")
+	follower.mu.RUnlock()
+
+	// The follower takes over with the state the leader stored
+	leader.stop()
+	require.Eventually(t, follower.IsLeader, time.Second, 10*time.Millisecond)
+	follower.mu.RLock()
+	require.Contains(t, follower.Applications, "/web")
+	assert.Len(t, follower.Applications["/web"].Tasks, 2)
+	follower.mu.RUnlock()
+
+	resp, err = http.Get(follower.url("/v2/leader"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMarathon_ProxyWithoutLeader(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	marathon.Elector = newZKLeaderElector(newFakeZKConn(), "")
+	router := marathon.setupRoutes()
+
+	req := httptest.NewRequest("POST", "/v2/apps", strings.NewReader(`{"id": "/web"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Reads are served by every instance
+	req = httptest.NewRequest("GET", "/v2/apps", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/v2/leader", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMarathon_ReconcileTasks(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 2}))
+	completeDeployments(t, marathon)
+
+	// One task was lost and another belongs to an app that no longer exists
+	app := marathon.Applications["/web"]
+	delete(marathon.Tasks, app.Tasks[1].ID)
+	app.Tasks = app.Tasks[:1]
+	orphan := &MarathonTask{ID: "/gone.0", AppID: "/gone", State: "TASK_RUNNING"}
+	marathon.Tasks[orphan.ID] = orphan
+
+	// Tasks of job runs belong to no app
+	require.NoError(t, marathon.CreateJob(testJob()))
+	run, err := marathon.StartJobRun("prod.backup")
+	require.NoError(t, err)
+
+	marathon.mu.Lock()
+	marathon.reconcileTasks()
+	marathon.mu.Unlock()
+
+	assert.Len(t, app.Tasks, 2)
+	assert.Equal(t, "TASK_KILLED", orphan.State)
+	assert.Equal(t, "TASK_STAGING", marathon.Tasks[run.Tasks[0].ID].State)
+}
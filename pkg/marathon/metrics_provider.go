@@ -0,0 +1,196 @@
+package marathon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ljluestc/orchestrator/internal/storage"
+)
+
+// TaskIDLabel is the container label carrying the ID of the Marathon task
+// a container runs, as set by the Mesos Docker executor
+const TaskIDLabel = "MESOS_TASK_ID"
+
+// defaultMetricsWindow is the period utilization is averaged over
+const defaultMetricsWindow = 5 * time.Minute
+
+var (
+	// ErrNoMetrics is returned when no samples exist for an app's tasks
+	// within the window
+	ErrNoMetrics = errors.New("no metrics for app")
+	// ErrUnknownMetric is returned for custom metrics without a query
+	ErrUnknownMetric = errors.New("unknown custom metric")
+)
+
+// ProbeMetricsProvider implements MetricsProvider for the autoscaler. CPU
+// and memory utilization come from the container stats the probes report,
+// matched to the app's running tasks through TaskIDLabel and averaged over
+// a window; custom metrics are queried from Prometheus.
+type ProbeMetricsProvider struct {
+	marathon   *Marathon
+	store      *storage.TimeSeriesStore
+	prometheus MetricsQuerier
+	window     time.Duration
+	queries    map[string]string
+	mu         sync.RWMutex
+}
+
+// NewProbeMetricsProvider creates a provider reading container stats from
+// store and custom metrics from prometheus, which may be nil
+func NewProbeMetricsProvider(marathon *Marathon, store *storage.TimeSeriesStore, prometheus MetricsQuerier) *ProbeMetricsProvider {
+	return &ProbeMetricsProvider{
+		marathon:   marathon,
+		store:      store,
+		prometheus: prometheus,
+		window:     defaultMetricsWindow,
+		queries:    make(map[string]string),
+	}
+}
+
+// SetWindow changes the period utilization and custom metrics cover
+func (p *ProbeMetricsProvider) SetWindow(window time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.window = window
+}
+
+// RegisterCustomMetric names a Prometheus query for GetCustomMetric. The
+// query is a text/template executed with the fields AppID and Interval,
+// the provider's window as a Prometheus range.
+func (p *ProbeMetricsProvider) RegisterCustomMetric(name, query string) error {
+	if _, err := renderQuery(query, canaryQueryData{}); err != nil {
+		return fmt.Errorf("invalid query for metric %s: %w", name, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queries[name] = query
+	return nil
+}
+
+// GetCPUUtilization returns the app's CPU use as a percentage of the CPUs
+// allocated to its tasks, averaged over the window and across tasks
+func (p *ProbeMetricsProvider) GetCPUUtilization(appID string) (float64, error) {
+	cpus, _, tasks, err := p.appResources(appID)
+	if err != nil {
+		return 0, err
+	}
+	if cpus <= 0 {
+		return 0, fmt.Errorf("app %s declares no CPUs", appID)
+	}
+	// Docker reports 100% per fully used core
+	return p.averageUsage(appID, tasks, func(stats taskSample) float64 {
+		return stats.cpuPercent / cpus
+	})
+}
+
+// GetMemoryUtilization returns the app's memory use as a percentage of the
+// memory allocated to its tasks, or of the container limit when the app
+// declares none, averaged over the window and across tasks
+func (p *ProbeMetricsProvider) GetMemoryUtilization(appID string) (float64, error) {
+	_, mem, tasks, err := p.appResources(appID)
+	if err != nil {
+		return 0, err
+	}
+	return p.averageUsage(appID, tasks, func(stats taskSample) float64 {
+		if mem > 0 {
+			return float64(stats.memoryMB) / mem * 100
+		}
+		return stats.memoryPercent
+	})
+}
+
+// GetCustomMetric evaluates a registered custom metric for an app
+func (p *ProbeMetricsProvider) GetCustomMetric(appID, metricName string) (float64, error) {
+	p.mu.RLock()
+	query, exists := p.queries[metricName]
+	window := p.window
+	p.mu.RUnlock()
+
+	if !exists {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownMetric, metricName)
+	}
+	if p.prometheus == nil {
+		return 0, fmt.Errorf("no Prometheus configured for metric %s", metricName)
+	}
+	rendered, err := renderQuery(query, canaryQueryData{AppID: appID, Interval: promDuration(window)})
+	if err != nil {
+		return 0, err
+	}
+	value, ok, err := p.prometheus.Query(context.Background(), rendered, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w %s: %s returned no data", ErrNoMetrics, appID, metricName)
+	}
+	return value, nil
+}
+
+// appResources returns the per task resources of an app and the IDs of its
+// running tasks
+func (p *ProbeMetricsProvider) appResources(appID string) (cpus, mem float64, tasks map[string]bool, err error) {
+	m := p.marathon
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, exists := m.Applications[appID]
+	if !exists {
+		return 0, 0, nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	tasks = make(map[string]bool, len(app.Tasks))
+	for _, task := range app.Tasks {
+		if task.State == "TASK_RUNNING" {
+			tasks[task.ID] = true
+		}
+	}
+	return app.CPUs, app.Memory, tasks, nil
+}
+
+// taskSample is the resource use of a task's container in one report
+type taskSample struct {
+	cpuPercent    float64
+	memoryMB      uint64
+	memoryPercent float64
+}
+
+// averageUsage averages a utilization over the samples of each task within
+// the window, then across the tasks that have samples
+func (p *ProbeMetricsProvider) averageUsage(appID string, tasks map[string]bool, utilization func(taskSample) float64) (float64, error) {
+	p.mu.RLock()
+	window := p.window
+	p.mu.RUnlock()
+
+	sums := make(map[string]float64, len(tasks))
+	counts := make(map[string]int, len(tasks))
+	for _, agentID := range p.store.GetAllAgents() {
+		for _, point := range p.store.GetRecentPoints(agentID, window) {
+			if point.Report == nil || point.Report.DockerInfo == nil {
+				continue
+			}
+			for _, container := range point.Report.DockerInfo.Containers {
+				taskID := container.Labels[TaskIDLabel]
+				if !tasks[taskID] || container.Stats == nil {
+					continue
+				}
+				sums[taskID] += utilization(taskSample{
+					cpuPercent:    container.Stats.CPUPercent,
+					memoryMB:      container.Stats.MemoryUsageMB,
+					memoryPercent: container.Stats.MemoryPercent,
+				})
+				counts[taskID]++
+			}
+		}
+	}
+
+	if len(counts) == 0 {
+		return 0, fmt.Errorf("%w %s within %s", ErrNoMetrics, appID, window)
+	}
+	total := 0.0
+	for taskID, count := range counts {
+		total += sums[taskID] / float64(count)
+	}
+	return total / float64(len(counts)), nil
+}
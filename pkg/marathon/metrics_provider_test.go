@@ -0,0 +1,120 @@
+package marathon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ljluestc/orchestrator/internal/storage"
+	"github.com/ljluestc/orchestrator/pkg/probe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMetricsProvider creates a provider for app with all tasks running
+// and returns the IDs of its tasks
+func newTestMetricsProvider(t *testing.T, app *Application, prometheus MetricsQuerier) (*ProbeMetricsProvider, *storage.TimeSeriesStore, []string) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(app))
+	marathon.monitorTasks()
+
+	store := storage.NewTimeSeriesStore(time.Hour)
+	t.Cleanup(store.Stop)
+
+	taskIDs := make([]string, 0)
+	for _, task := range marathon.Applications[app.ID].Tasks {
+		taskIDs = append(taskIDs, task.ID)
+	}
+	provider := NewProbeMetricsProvider(marathon, store, prometheus)
+	var _ MetricsProvider = provider
+	return provider, store, taskIDs
+}
+
+// taskContainer is a container running a task with the given stats
+func taskContainer(taskID string, cpuPercent float64, memoryMB uint64) probe.ContainerInfo {
+	return probe.ContainerInfo{
+		ID:     "container-" + taskID,
+		Labels: map[string]string{TaskIDLabel: taskID},
+		Stats:  &probe.ContainerStats{CPUPercent: cpuPercent, MemoryUsageMB: memoryMB, MemoryPercent: 25},
+	}
+}
+
+// addReport stores a report of agentID taken age ago
+func addReport(store *storage.TimeSeriesStore, agentID string, age time.Duration, containers ...probe.ContainerInfo) {
+	store.AddReport(&probe.ReportData{
+		AgentID:    agentID,
+		Timestamp:  time.Now().Add(-age),
+		DockerInfo: &probe.DockerInfo{Containers: containers},
+	})
+}
+
+func TestProbeMetricsProvider_Utilization(t *testing.T) {
+	provider, store, tasks := newTestMetricsProvider(t, &Application{ID: "/web", Instances: 2, CPUs: 0.5, Memory: 256}, nil)
+	require.Len(t, tasks, 2)
+
+	// The first task is sampled twice, the second once on another agent
+	addReport(store, "agent-1", time.Minute,
+		taskContainer(tasks[0], 20, 64),
+		taskContainer("other-task", 90, 1000),
+		probe.ContainerInfo{ID: "unlabeled", Stats: &probe.ContainerStats{CPUPercent: 100}})
+	addReport(store, "agent-1", 30*time.Second, taskContainer(tasks[0], 40, 128))
+	addReport(store, "agent-2", 10*time.Second, taskContainer(tasks[1], 10, 32))
+	// Samples outside the window are ignored
+	addReport(store, "agent-2", 10*time.Minute, taskContainer(tasks[1], 100, 256))
+
+	cpu, err := provider.GetCPUUtilization("/web")
+	require.NoError(t, err)
+	// Task averages of 60% and 20% of half a core
+	assert.InDelta(t, 40, cpu, 1e-9)
+
+	mem, err := provider.GetMemoryUtilization("/web")
+	require.NoError(t, err)
+	// Task averages of 96MB and 32MB of 256MB
+	assert.InDelta(t, 25, mem, 1e-9)
+
+	// A shorter window only covers the latest samples
+	provider.SetWindow(20 * time.Second)
+	cpu, err = provider.GetCPUUtilization("/web")
+	require.NoError(t, err)
+	assert.InDelta(t, 20, cpu, 1e-9)
+}
+
+func TestProbeMetricsProvider_MemoryWithoutAllocation(t *testing.T) {
+	provider, store, tasks := newTestMetricsProvider(t, &Application{ID: "/web", Instances: 1, CPUs: 1}, nil)
+	addReport(store, "agent-1", time.Second, taskContainer(tasks[0], 10, 64))
+
+	mem, err := provider.GetMemoryUtilization("/web")
+	require.NoError(t, err)
+	assert.Equal(t, 25.0, mem)
+}
+
+func TestProbeMetricsProvider_Errors(t *testing.T) {
+	provider, store, _ := newTestMetricsProvider(t, &Application{ID: "/web", Instances: 1, CPUs: 0.5}, nil)
+	addReport(store, "agent-1", time.Second, taskContainer("other-task", 10, 64))
+
+	_, err := provider.GetCPUUtilization("/web")
+	assert.ErrorIs(t, err, ErrNoMetrics)
+	_, err = provider.GetMemoryUtilization("/missing")
+	assert.ErrorIs(t, err, ErrAppNotFound)
+	_, err = provider.GetCustomMetric("/web", "requests")
+	assert.ErrorIs(t, err, ErrUnknownMetric)
+
+	require.NoError(t, provider.RegisterCustomMetric("requests", `sum(rate(http_requests_total{app="{{.AppID}}"}[{{.Interval}}]))`))
+	_, err = provider.GetCustomMetric("/web", "requests")
+	assert.ErrorContains(t, err, "no Prometheus configured")
+	assert.Error(t, provider.RegisterCustomMetric("broken", "{{.Missing}}"))
+}
+
+func TestProbeMetricsProvider_CustomMetric(t *testing.T) {
+	fake := newFakePrometheus(t)
+	provider, _, _ := newTestMetricsProvider(t, &Application{ID: "/web", Instances: 1, CPUs: 0.5}, NewPrometheusClient(fake.URL))
+	provider.SetWindow(2 * time.Minute)
+	require.NoError(t, provider.RegisterCustomMetric("requests", `sum(rate(http_requests_total{app="{{.AppID}}"}[{{.Interval}}]))`))
+	fake.set(`sum(rate(http_requests_total{app="/web"}[120s]))`, "42.5")
+
+	value, err := provider.GetCustomMetric("/web", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, 42.5, value)
+
+	_, err = provider.GetCustomMetric("/other", "requests")
+	assert.ErrorIs(t, err, ErrNoMetrics)
+}
@@ -0,0 +1,231 @@
+package marathon
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AgentInfo describes a Mesos agent known to Marathon through its offers
+type AgentInfo struct {
+	ID         string            `json:"id"`
+	Hostname   string            `json:"hostname"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	LastSeen   time.Time         `json:"lastSeen"`
+}
+
+// Offer represents a resource offer received from the Mesos master
+type Offer struct {
+	ID         string            `json:"id"`
+	AgentID    string            `json:"agentId"`
+	Hostname   string            `json:"hostname"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	CPUs       float64           `json:"cpus"`
+	Memory     float64           `json:"mem"`
+	Disk       float64           `json:"disk"`
+	Ports      []int             `json:"ports,omitempty"`
+}
+
+// Offer operation types, as in the Mesos scheduler API
+const (
+	OperationLaunch      = "LAUNCH"
+	OperationLaunchGroup = "LAUNCH_GROUP"
+)
+
+// OfferMatch records the tasks placed on a single offer and the operations
+// that launch them
+type OfferMatch struct {
+	OfferID    string
+	AgentID    string
+	Tasks      []*MarathonTask
+	Operations []*OfferOperation
+}
+
+// OfferOperation is a Mesos operation performed on an accepted offer. A
+// LAUNCH_GROUP starts all containers of a pod instance together under one
+// executor.
+type OfferOperation struct {
+	Type       string
+	TaskIDs    []string
+	ExecutorID string
+}
+
+// ResourceOffers matches staged tasks that are still waiting for placement
+// against the given offers, honoring resource requirements, app constraints
+// and launch delays. Offers that receive no tasks are omitted from the result
+// and should be declined by the caller; why they did not suit each queued app
+// is recorded for the launch queue.
+func (m *Marathon) ResourceOffers(offers []*Offer) []*OfferMatch {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	return m.matchOffers(offers, time.Now())
+}
+
+// matchOffers places waiting tasks on offers. The caller must hold m.mu.
+func (m *Marathon) matchOffers(offers []*Offer, now time.Time) []*OfferMatch {
+	matches := make([]*OfferMatch, 0)
+	for _, offer := range offers {
+		agent := m.registerAgent(offer)
+		remaining := *offer
+
+		match := &OfferMatch{OfferID: offer.ID, AgentID: offer.AgentID}
+		for _, app := range m.sortedApps() {
+			if waitingTasks(app) == 0 {
+				delete(m.offerStats, app.ID)
+				continue
+			}
+			if m.launchDelayed(app, now) {
+				continue
+			}
+			constraints, err := ParseConstraints(app.Constraints)
+			if err != nil {
+				log.Printf("Skipping app %s with invalid constraints: %v", app.ID, err)
+				continue
+			}
+
+			var reasons []string
+			placed := 0
+			for _, task := range app.Tasks {
+				if !waitingForOffer(task) {
+					continue
+				}
+				if reasons = m.offerRejectReasons(app, &remaining, agent, constraints); len(reasons) > 0 {
+					break
+				}
+
+				if len(appPorts(app)) > 0 {
+					hostPorts, _ := pickHostPorts(app, remaining.Ports)
+					task.Ports = hostPorts
+					remaining.Ports = withoutPorts(remaining.Ports, hostPorts)
+				}
+				task.SlaveID = agent.ID
+				task.Host = agent.Hostname
+				remaining.CPUs -= app.CPUs
+				remaining.Memory -= app.Memory
+				match.Tasks = append(match.Tasks, task)
+				placed++
+			}
+			m.recordOffer(app, offer, placed, reasons, now)
+		}
+		m.placeJobTasks(match, &remaining, agent, now)
+
+		if len(match.Tasks) > 0 {
+			match.Operations = m.launchOperations(match.Tasks)
+			log.Printf("Placed %d tasks on offer %s from agent %s", len(match.Tasks), offer.ID, offer.Hostname)
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+// offerRejectReasons returns why what is left of an offer cannot host
+// another task of an app, or nothing if it can
+func (m *Marathon) offerRejectReasons(app *Application, remaining *Offer, agent *AgentInfo, constraints []*Constraint) []string {
+	reasons := make([]string, 0)
+	if remaining.CPUs < app.CPUs {
+		reasons = append(reasons, ReasonInsufficientCpus)
+	}
+	if remaining.Memory < app.Memory {
+		reasons = append(reasons, ReasonInsufficientMemory)
+	}
+	if _, ok := pickHostPorts(app, remaining.Ports); !ok {
+		reasons = append(reasons, ReasonInsufficientPorts)
+	}
+	if ok, _ := constraintsMatch(constraints, agent, m.placedAgents(app)); !ok {
+		reasons = append(reasons, ReasonUnfulfilledConstraint)
+	}
+	return reasons
+}
+
+// launchOperations turns the tasks placed on an offer into launch
+// operations: app tasks share one LAUNCH, each pod instance gets its own
+// LAUNCH_GROUP with a task per container. The caller must hold m.mu.
+func (m *Marathon) launchOperations(tasks []*MarathonTask) []*OfferOperation {
+	operations := make([]*OfferOperation, 0)
+	var launch *OfferOperation
+	for _, task := range tasks {
+		app := m.Applications[task.AppID]
+		if app != nil && app.Pod != nil {
+			group := &OfferOperation{Type: OperationLaunchGroup, ExecutorID: "instance-" + task.ID}
+			for _, container := range app.Pod.Containers {
+				group.TaskIDs = append(group.TaskIDs, podContainerTaskID(task.ID, container.Name))
+			}
+			operations = append(operations, group)
+			continue
+		}
+		if launch == nil {
+			launch = &OfferOperation{Type: OperationLaunch}
+			operations = append(operations, launch)
+		}
+		launch.TaskIDs = append(launch.TaskIDs, task.ID)
+	}
+	return operations
+}
+
+// registerAgent records the agent behind an offer
+func (m *Marathon) registerAgent(offer *Offer) *AgentInfo {
+	agent, exists := m.Agents[offer.AgentID]
+	if !exists {
+		agent = &AgentInfo{ID: offer.AgentID}
+		m.Agents[offer.AgentID] = agent
+	}
+	agent.Hostname = offer.Hostname
+	agent.Attributes = offer.Attributes
+	agent.LastSeen = time.Now()
+	return agent
+}
+
+// placedAgents returns the agents hosting an app's placed, live tasks
+func (m *Marathon) placedAgents(app *Application) []*AgentInfo {
+	agents := make([]*AgentInfo, 0, len(app.Tasks))
+	for _, task := range app.Tasks {
+		if task.State == "TASK_KILLED" {
+			continue
+		}
+		if agent := m.Agents[task.SlaveID]; agent != nil {
+			agents = append(agents, agent)
+		}
+	}
+	return agents
+}
+
+// sortedApps returns applications in a stable order for offer matching
+func (m *Marathon) sortedApps() []*Application {
+	apps := make([]*Application, 0, len(m.Applications))
+	for _, app := range m.Applications {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
+	return apps
+}
+
+// nextTaskID returns an unused task ID for an application. IDs of killed
+// tasks are not reused.
+func (m *Marathon) nextTaskID(app *Application) (string, int) {
+	for i := max(len(app.Tasks), m.taskIndexes[app.ID]); ; i++ {
+		taskID := fmt.Sprintf("%s.%d", app.ID, i)
+		if _, exists := m.Tasks[taskID]; !exists {
+			m.taskIndexes[app.ID] = i + 1
+			return taskID, i
+		}
+	}
+}
+
+// taskIndex extracts the instance index from a task ID, or -1
+func taskIndex(task *MarathonTask) int {
+	i := strings.LastIndex(task.ID, ".")
+	if i < 0 {
+		return -1
+	}
+	index, err := strconv.Atoi(task.ID[i+1:])
+	if err != nil {
+		return -1
+	}
+	return index
+}
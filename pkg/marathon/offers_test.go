@@ -0,0 +1,115 @@
+package marathon
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOffer(i int, rack string) *Offer {
+	return &Offer{
+		ID:         fmt.Sprintf("offer-%d", i),
+		AgentID:    fmt.Sprintf("agent-%d", i),
+		Hostname:   fmt.Sprintf("host-%d", i),
+		Attributes: map[string]string{"rack": rack},
+		CPUs:       4.0,
+		Memory:     4096.0,
+	}
+}
+
+func TestMarathon_ResourceOffers(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{ID: "/test/app", Instances: 3, CPUs: 1.0, Memory: 512.0}
+	require.NoError(t, marathon.CreateApp(app))
+
+	matches := marathon.ResourceOffers([]*Offer{testOffer(1, "r1")})
+
+	require.Len(t, matches, 1)
+	assert.Equal(t, "offer-1", matches[0].OfferID)
+	assert.Len(t, matches[0].Tasks, 3)
+	for _, task := range app.Tasks {
+		assert.Equal(t, "agent-1", task.SlaveID)
+		assert.Equal(t, "host-1", task.Host)
+	}
+	assert.Contains(t, marathon.Agents, "agent-1")
+}
+
+func TestMarathon_ResourceOffersInsufficientResources(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{ID: "/test/app", Instances: 3, CPUs: 1.5, Memory: 512.0}
+	require.NoError(t, marathon.CreateApp(app))
+
+	offer := testOffer(1, "r1")
+	offer.CPUs = 2.0
+
+	matches := marathon.ResourceOffers([]*Offer{offer})
+
+	require.Len(t, matches, 1)
+	assert.Len(t, matches[0].Tasks, 1)
+
+	// Nothing fits in an offer smaller than a single task
+	offer = testOffer(2, "r1")
+	offer.Memory = 256.0
+	assert.Empty(t, marathon.ResourceOffers([]*Offer{offer}))
+}
+
+func TestMarathon_ResourceOffersHostnameUnique(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{
+		ID:          "/test/app",
+		Instances:   3,
+		CPUs:        0.5,
+		Memory:      128.0,
+		Constraints: [][]string{{"hostname", "UNIQUE"}},
+	}
+	require.NoError(t, marathon.CreateApp(app))
+
+	matches := marathon.ResourceOffers([]*Offer{testOffer(1, "r1"), testOffer(2, "r1")})
+
+	require.Len(t, matches, 2)
+	for _, match := range matches {
+		assert.Len(t, match.Tasks, 1)
+	}
+
+	// A repeated offer from an occupied host is rejected
+	assert.Empty(t, marathon.ResourceOffers([]*Offer{testOffer(1, "r1")}))
+
+	matches = marathon.ResourceOffers([]*Offer{testOffer(3, "r2")})
+	require.Len(t, matches, 1)
+	assert.Equal(t, "agent-3", matches[0].Tasks[0].SlaveID)
+}
+
+func TestMarathon_ResourceOffersGroupBy(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	app := &Application{
+		ID:          "/test/app",
+		Instances:   4,
+		CPUs:        0.5,
+		Memory:      128.0,
+		Constraints: [][]string{{"rack", "GROUP_BY", "2"}},
+	}
+	require.NoError(t, marathon.CreateApp(app))
+
+	// Offers are consumed in order, so a later round fills the lagging group
+	marathon.ResourceOffers([]*Offer{testOffer(1, "r1"), testOffer(2, "r1"), testOffer(3, "r2")})
+	marathon.ResourceOffers([]*Offer{testOffer(3, "r2"), testOffer(2, "r1")})
+
+	racks := map[string]int{}
+	for _, task := range app.Tasks {
+		require.NotEmpty(t, task.SlaveID)
+		racks[marathon.Agents[task.SlaveID].Attributes["rack"]]++
+	}
+	assert.Equal(t, map[string]int{"r1": 2, "r2": 2}, racks)
+}
+
+func TestTaskIndex(t *testing.T) {
+	assert.Equal(t, 3, taskIndex(&MarathonTask{ID: "/test/app.3"}))
+	assert.Equal(t, -1, taskIndex(&MarathonTask{ID: "no-index"}))
+	assert.Equal(t, -1, taskIndex(&MarathonTask{ID: "/test/app.x"}))
+}
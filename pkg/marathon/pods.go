@@ -0,0 +1,732 @@
+package marathon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// ErrPodNotFound is returned when a pod does not exist
+	ErrPodNotFound = errors.New("pod not found")
+	// ErrPodExists is returned when creating a pod whose ID is taken
+	ErrPodExists = errors.New("pod already exists")
+	// ErrInvalidPod is returned for malformed pod definitions
+	ErrInvalidPod = errors.New("invalid pod")
+)
+
+// Pod instance and pod statuses, as reported by Marathon
+const (
+	PodInstancePending  = "PENDING"
+	PodInstanceStaging  = "STAGING"
+	PodInstanceStable   = "STABLE"
+	PodInstanceDegraded = "DEGRADED"
+	PodInstanceTerminal = "TERMINAL"
+
+	PodStable    = "STABLE"
+	PodDegraded  = "DEGRADED"
+	PodDeploying = "DEPLOYING"
+)
+
+// Pod represents a Marathon pod: containers that are launched together as
+// one task group on the same agent, share volumes and networks, and are
+// scaled and updated as whole instances
+type Pod struct {
+	ID          string            `json:"id"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Containers  []*PodContainer   `json:"containers"`
+	Volumes     []*PodVolume      `json:"volumes,omitempty"`
+	Networks    []*PodNetwork     `json:"networks,omitempty"`
+	Scaling     *PodScaling       `json:"scaling,omitempty"`
+	Scheduling  *PodScheduling    `json:"scheduling,omitempty"`
+	Version     string            `json:"version,omitempty"`
+}
+
+// PodContainer is one container of a pod
+type PodContainer struct {
+	Name         string            `json:"name"`
+	Resources    *PodResources     `json:"resources"`
+	Image        *PodImage         `json:"image,omitempty"`
+	Exec         *PodExec          `json:"exec,omitempty"`
+	Endpoints    []*PodEndpoint    `json:"endpoints,omitempty"`
+	Environment  map[string]string `json:"environment,omitempty"`
+	VolumeMounts []*PodVolumeMount `json:"volumeMounts,omitempty"`
+	HealthCheck  *PodHealthCheck   `json:"healthCheck,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// PodResources are the resources a pod container needs
+type PodResources struct {
+	CPUs float64 `json:"cpus"`
+	Mem  float64 `json:"mem"`
+	Disk float64 `json:"disk,omitempty"`
+}
+
+// PodImage is the image a pod container runs
+type PodImage struct {
+	Kind      string `json:"kind"`
+	ID        string `json:"id"`
+	ForcePull bool   `json:"forcePull,omitempty"`
+}
+
+// PodExec is the command a pod container runs
+type PodExec struct {
+	Command *PodCommand `json:"command"`
+}
+
+// PodCommand is a shell command
+type PodCommand struct {
+	Shell string `json:"shell"`
+}
+
+// PodEndpoint is a named port of a pod container. A zero host port takes
+// any port from the offer.
+type PodEndpoint struct {
+	Name          string            `json:"name"`
+	ContainerPort int               `json:"containerPort,omitempty"`
+	HostPort      int               `json:"hostPort,omitempty"`
+	Protocol      []string          `json:"protocol,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// PodVolume is a volume shared by the containers of a pod instance. Volumes
+// without a host path are ephemeral.
+type PodVolume struct {
+	Name string `json:"name"`
+	Host string `json:"host,omitempty"`
+}
+
+// PodVolumeMount mounts a pod volume into a container
+type PodVolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+// PodNetwork is a network the containers of a pod instance join
+type PodNetwork struct {
+	Mode   string            `json:"mode"`
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PodScaling sets the number of pod instances
+type PodScaling struct {
+	Kind         string `json:"kind,omitempty"`
+	Instances    int    `json:"instances"`
+	MaxInstances int    `json:"maxInstances,omitempty"`
+}
+
+// PodScheduling controls placement and launch backoff of pod instances
+type PodScheduling struct {
+	Backoff   *PodBackoff   `json:"backoff,omitempty"`
+	Placement *PodPlacement `json:"placement,omitempty"`
+}
+
+// PodBackoff is the launch backoff of a pod, in seconds
+type PodBackoff struct {
+	Backoff        int     `json:"backoff,omitempty"`
+	BackoffFactor  float64 `json:"backoffFactor,omitempty"`
+	MaxLaunchDelay int     `json:"maxLaunchDelay,omitempty"`
+}
+
+// PodPlacement holds the placement constraints of a pod
+type PodPlacement struct {
+	Constraints []*PodConstraint `json:"constraints,omitempty"`
+}
+
+// PodConstraint is a placement constraint in pod syntax
+type PodConstraint struct {
+	FieldName string `json:"fieldName"`
+	Operator  string `json:"operator"`
+	Value     string `json:"value,omitempty"`
+}
+
+// PodHealthCheck checks a pod container through one of its endpoints
+type PodHealthCheck struct {
+	HTTP                   *PodHTTPCheck `json:"http,omitempty"`
+	TCP                    *PodTCPCheck  `json:"tcp,omitempty"`
+	GracePeriodSeconds     int           `json:"gracePeriodSeconds,omitempty"`
+	IntervalSeconds        int           `json:"intervalSeconds,omitempty"`
+	TimeoutSeconds         int           `json:"timeoutSeconds,omitempty"`
+	MaxConsecutiveFailures int           `json:"maxConsecutiveFailures,omitempty"`
+}
+
+// PodHTTPCheck is an HTTP health check against a container endpoint
+type PodHTTPCheck struct {
+	Endpoint string `json:"endpoint"`
+	Path     string `json:"path,omitempty"`
+	Scheme   string `json:"scheme,omitempty"`
+}
+
+// PodTCPCheck is a TCP health check against a container endpoint
+type PodTCPCheck struct {
+	Endpoint string `json:"endpoint"`
+}
+
+// PodStatus reports the state of a pod and its instances
+type PodStatus struct {
+	ID        string               `json:"id"`
+	Spec      *Pod                 `json:"spec"`
+	Status    string               `json:"status"`
+	Instances []*PodInstanceStatus `json:"instances"`
+}
+
+// PodInstanceStatus reports the state of one pod instance
+type PodInstanceStatus struct {
+	ID            string                `json:"id"`
+	Status        string                `json:"status"`
+	AgentID       string                `json:"agentId,omitempty"`
+	AgentHostname string                `json:"agentHostname,omitempty"`
+	SpecReference string                `json:"specReference"`
+	Containers    []*PodContainerStatus `json:"containers"`
+}
+
+// PodContainerStatus reports the state of one container of a pod instance
+type PodContainerStatus struct {
+	Name        string               `json:"name"`
+	ContainerID string               `json:"containerId"`
+	Status      string               `json:"status"`
+	Endpoints   []*PodEndpointStatus `json:"endpoints,omitempty"`
+	Resources   *PodResources        `json:"resources"`
+}
+
+// PodEndpointStatus reports the host port allocated to an endpoint
+type PodEndpointStatus struct {
+	Name              string `json:"name"`
+	AllocatedHostPort int    `json:"allocatedHostPort,omitempty"`
+}
+
+// podEndpoints returns the endpoints of all containers of a pod in port
+// index order
+func podEndpoints(pod *Pod) []*PodEndpoint {
+	endpoints := make([]*PodEndpoint, 0)
+	for _, container := range pod.Containers {
+		endpoints = append(endpoints, container.Endpoints...)
+	}
+	return endpoints
+}
+
+// podHealthCheck converts a container health check to a check against the
+// port index of its endpoint
+func podHealthCheck(pod *Pod, container *PodContainer) (*HealthCheck, error) {
+	pc := container.HealthCheck
+	hc := &HealthCheck{
+		GracePeriodSeconds:     pc.GracePeriodSeconds,
+		IntervalSeconds:        pc.IntervalSeconds,
+		TimeoutSeconds:         pc.TimeoutSeconds,
+		MaxConsecutiveFailures: pc.MaxConsecutiveFailures,
+	}
+
+	var endpoint string
+	switch {
+	case pc.HTTP != nil:
+		hc.Protocol = ProtocolHTTP
+		if strings.EqualFold(pc.HTTP.Scheme, "https") {
+			hc.Protocol = ProtocolHTTPS
+		}
+		hc.Path = pc.HTTP.Path
+		endpoint = pc.HTTP.Endpoint
+	case pc.TCP != nil:
+		hc.Protocol = ProtocolTCP
+		endpoint = pc.TCP.Endpoint
+	default:
+		return nil, fmt.Errorf("%w: health check of container %s needs http or tcp", ErrInvalidPod, container.Name)
+	}
+
+	for i, ep := range podEndpoints(pod) {
+		if ep.Name == endpoint {
+			hc.PortIndex = i
+			return hc, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: health check of container %s uses unknown endpoint %q", ErrInvalidPod, container.Name, endpoint)
+}
+
+// podRunSpec validates a pod and returns the app the deployment engine runs
+// it as: one task per pod instance, requesting the summed resources of the
+// containers. The pod definition is kept without its instance count, which
+// lives in the run spec so that scaling a pod does not restart it.
+func podRunSpec(pod *Pod) (*Application, error) {
+	if strings.Trim(pod.ID, "/") == "" {
+		return nil, fmt.Errorf("%w: id must not be empty", ErrInvalidPod)
+	}
+	if len(pod.Containers) == 0 {
+		return nil, fmt.Errorf("%w: %s has no containers", ErrInvalidPod, pod.ID)
+	}
+
+	volumes := make(map[string]bool, len(pod.Volumes))
+	for _, volume := range pod.Volumes {
+		volumes[volume.Name] = true
+	}
+	names := make(map[string]bool, len(pod.Containers))
+	endpoints := make(map[string]bool)
+
+	app := &Application{
+		ID:        canonicalID(pod.ID),
+		Instances: 1,
+		Labels:    pod.Labels,
+		Env:       pod.Environment,
+	}
+	for _, container := range pod.Containers {
+		if container.Name == "" || names[container.Name] {
+			return nil, fmt.Errorf("%w: container names must be unique and not empty", ErrInvalidPod)
+		}
+		names[container.Name] = true
+		if container.Resources == nil {
+			return nil, fmt.Errorf("%w: container %s has no resources", ErrInvalidPod, container.Name)
+		}
+		app.CPUs += container.Resources.CPUs
+		app.Memory += container.Resources.Mem
+
+		for _, mount := range container.VolumeMounts {
+			if !volumes[mount.Name] {
+				return nil, fmt.Errorf("%w: container %s mounts unknown volume %q", ErrInvalidPod, container.Name, mount.Name)
+			}
+		}
+		for _, ep := range container.Endpoints {
+			if ep.Name == "" || endpoints[ep.Name] {
+				return nil, fmt.Errorf("%w: endpoint names must be unique and not empty", ErrInvalidPod)
+			}
+			endpoints[ep.Name] = true
+		}
+	}
+	for _, container := range pod.Containers {
+		if container.HealthCheck == nil {
+			continue
+		}
+		hc, err := podHealthCheck(pod, container)
+		if err != nil {
+			return nil, err
+		}
+		app.HealthChecks = append(app.HealthChecks, hc)
+	}
+
+	definition := *pod
+	definition.ID = app.ID
+	definition.Version = ""
+	if pod.Scaling != nil {
+		app.Instances = pod.Scaling.Instances
+		scaling := *pod.Scaling
+		scaling.Instances = 0
+		definition.Scaling = &scaling
+	}
+	if pod.Scheduling != nil {
+		if backoff := pod.Scheduling.Backoff; backoff != nil {
+			app.BackoffSeconds = backoff.Backoff
+			app.BackoffFactor = backoff.BackoffFactor
+			app.MaxLaunchDelaySeconds = backoff.MaxLaunchDelay
+		}
+		if placement := pod.Scheduling.Placement; placement != nil {
+			for _, c := range placement.Constraints {
+				constraint := []string{c.FieldName, c.Operator}
+				if c.Value != "" {
+					constraint = append(constraint, c.Value)
+				}
+				app.Constraints = append(app.Constraints, constraint)
+			}
+		}
+	}
+	app.Pod = &definition
+	return app, nil
+}
+
+// podDefinition returns the pod definition behind a pod's run spec
+func podDefinition(app *Application) *Pod {
+	pod := *app.Pod
+	pod.Version = app.Version
+	scaling := PodScaling{Kind: "fixed"}
+	if pod.Scaling != nil {
+		scaling = *pod.Scaling
+	}
+	scaling.Instances = app.Instances
+	pod.Scaling = &scaling
+	return &pod
+}
+
+// podRunSpecByID returns the run spec of a pod. The caller must hold m.mu.
+func (m *Marathon) podRunSpecByID(podID string) (*Application, error) {
+	app, exists := m.Applications[canonicalID(podID)]
+	if !exists || app.Pod == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPodNotFound, podID)
+	}
+	return app, nil
+}
+
+// CreatePod starts a pod. Unless force is set, it fails when a deployment
+// in progress affects the pod.
+func (m *Marathon) CreatePod(pod *Pod, force bool) (*Deployment, error) {
+	app, err := podRunSpec(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	if _, exists := m.Applications[app.ID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrPodExists, app.ID)
+	}
+	deployment, err := m.deploy(map[string]*Application{app.ID: app}, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	m.publishAPIPost(app)
+	log.Printf("Created pod %s with %d instances", app.ID, app.Instances)
+	return deployment, nil
+}
+
+// UpdatePod replaces the definition of a pod. Changing only the instance
+// count scales the pod; any other change replaces all instances.
+func (m *Marathon) UpdatePod(podID string, pod *Pod, force bool) (*Deployment, error) {
+	pod.ID = podID
+	app, err := podRunSpec(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	if _, err := m.podRunSpecByID(podID); err != nil {
+		return nil, err
+	}
+	deployment, err := m.deploy(map[string]*Application{app.ID: app}, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	m.publishAPIPost(app)
+	log.Printf("Updated pod %s", app.ID)
+	return deployment, nil
+}
+
+// DeletePod stops all instances of a pod and removes it
+func (m *Marathon) DeletePod(podID string, force bool) (*Deployment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	app, err := m.podRunSpecByID(podID)
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := m.deploy(map[string]*Application{app.ID: nil}, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Deleted pod %s", app.ID)
+	return deployment, nil
+}
+
+// GetPod returns the current definition of a pod
+func (m *Marathon) GetPod(podID string) (*Pod, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, err := m.podRunSpecByID(podID)
+	if err != nil {
+		return nil, err
+	}
+	return podDefinition(app), nil
+}
+
+// ListPods returns the definitions of all pods ordered by ID
+func (m *Marathon) ListPods() []*Pod {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pods := make([]*Pod, 0)
+	for _, app := range m.sortedApps() {
+		if app.Pod != nil {
+			pods = append(pods, podDefinition(app))
+		}
+	}
+	return pods
+}
+
+// GetPodStatus returns the status of a pod and its instances
+func (m *Marathon) GetPodStatus(podID string) (*PodStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, err := m.podRunSpecByID(podID)
+	if err != nil {
+		return nil, err
+	}
+	return m.podStatus(app), nil
+}
+
+// ListPodStatus returns the status of all pods ordered by ID
+func (m *Marathon) ListPodStatus() []*PodStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]*PodStatus, 0)
+	for _, app := range m.sortedApps() {
+		if app.Pod != nil {
+			statuses = append(statuses, m.podStatus(app))
+		}
+	}
+	return statuses
+}
+
+// podStatus builds the status of a pod. The caller must hold m.mu.
+func (m *Marathon) podStatus(app *Application) *PodStatus {
+	status := &PodStatus{ID: app.ID, Spec: podDefinition(app), Instances: make([]*PodInstanceStatus, 0, len(app.Tasks))}
+
+	stable := 0
+	for _, task := range app.Tasks {
+		instance := m.podInstanceStatus(app, task)
+		if instance.Status == PodInstanceStable {
+			stable++
+		}
+		status.Instances = append(status.Instances, instance)
+	}
+
+	switch {
+	case len(m.conflictingDeployments([]string{app.ID})) > 0:
+		status.Status = PodDeploying
+	case stable >= app.Instances:
+		status.Status = PodStable
+	default:
+		status.Status = PodDegraded
+	}
+	return status
+}
+
+// podInstanceStatus builds the status of a pod instance. The caller must
+// hold m.mu.
+func (m *Marathon) podInstanceStatus(app *Application, task *MarathonTask) *PodInstanceStatus {
+	instance := &PodInstanceStatus{
+		ID:            task.ID,
+		AgentID:       task.SlaveID,
+		SpecReference: fmt.Sprintf("/v2/pods%s::versions/%s", app.ID, task.Version),
+		Containers:    make([]*PodContainerStatus, 0, len(app.Pod.Containers)),
+	}
+	if task.SlaveID != "" {
+		instance.AgentHostname = task.Host
+	}
+
+	switch {
+	case waitingForOffer(task):
+		instance.Status = PodInstancePending
+	case task.State == "TASK_STAGING":
+		instance.Status = PodInstanceStaging
+	case m.taskHealthy(app, task):
+		instance.Status = PodInstanceStable
+	case task.State == "TASK_RUNNING":
+		instance.Status = PodInstanceDegraded
+	default:
+		instance.Status = PodInstanceTerminal
+	}
+
+	// Host ports are allocated in endpoint order across the containers
+	portIndex := 0
+	for _, container := range app.Pod.Containers {
+		cs := &PodContainerStatus{
+			Name:        container.Name,
+			ContainerID: podContainerTaskID(task.ID, container.Name),
+			Status:      task.State,
+			Resources:   container.Resources,
+		}
+		for _, ep := range container.Endpoints {
+			endpoint := &PodEndpointStatus{Name: ep.Name}
+			if task.SlaveID != "" && portIndex < len(task.Ports) {
+				endpoint.AllocatedHostPort = task.Ports[portIndex]
+			}
+			cs.Endpoints = append(cs.Endpoints, endpoint)
+			portIndex++
+		}
+		instance.Containers = append(instance.Containers, cs)
+	}
+	return instance
+}
+
+// podContainerTaskID returns the Mesos task ID of a container of a pod
+// instance
+func podContainerTaskID(instanceID, container string) string {
+	return instanceID + "." + container
+}
+
+// podInstanceForTask returns the pod instance a container task ID belongs
+// to. The caller must hold m.mu.
+func (m *Marathon) podInstanceForTask(taskID string) (*MarathonTask, bool) {
+	i := strings.LastIndex(taskID, ".")
+	if i < 0 {
+		return nil, false
+	}
+	instance, exists := m.Tasks[taskID[:i]]
+	if !exists {
+		return nil, false
+	}
+	app := m.Applications[instance.AppID]
+	if app == nil || app.Pod == nil {
+		return nil, false
+	}
+	for _, container := range app.Pod.Containers {
+		if container.Name == taskID[i+1:] {
+			return instance, true
+		}
+	}
+	return nil, false
+}
+
+// KillPodInstance kills one instance of a pod and stages a replacement
+func (m *Marathon) KillPodInstance(podID, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	app, err := m.podRunSpecByID(podID)
+	if err != nil {
+		return err
+	}
+	instanceID = canonicalID(instanceID)
+	for _, task := range app.Tasks {
+		if task.ID == instanceID {
+			m.killAppTask(app, task)
+			m.stageTask(app)
+			m.updateTaskCounts(app)
+			log.Printf("Killed instance %s of pod %s", instanceID, app.ID)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrTaskNotFound, instanceID)
+}
+
+func (m *Marathon) handleListPods(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.ListPods())
+}
+
+// writePodDeployment writes a pod with the ID of the deployment changing it
+func writePodDeployment(w http.ResponseWriter, pod *Pod, deployment *Deployment, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Marathon-Deployment-Id", deployment.ID)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(pod)
+}
+
+func (m *Marathon) handleCreatePod(w http.ResponseWriter, r *http.Request) {
+	var pod Pod
+	if err := json.NewDecoder(r.Body).Decode(&pod); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deployment, err := m.CreatePod(&pod, forceParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	pod.ID = canonicalID(pod.ID)
+	pod.Version = deployment.Version
+	writePodDeployment(w, &pod, deployment, http.StatusCreated)
+}
+
+func (m *Marathon) handleGetPod(w http.ResponseWriter, r *http.Request) {
+	pod, err := m.GetPod(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pod)
+}
+
+func (m *Marathon) handleUpdatePod(w http.ResponseWriter, r *http.Request) {
+	var pod Pod
+	if err := json.NewDecoder(r.Body).Decode(&pod); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deployment, err := m.UpdatePod(canonicalID(mux.Vars(r)["id"]), &pod, forceParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	pod.Version = deployment.Version
+	writePodDeployment(w, &pod, deployment, http.StatusOK)
+}
+
+func (m *Marathon) handleDeletePod(w http.ResponseWriter, r *http.Request) {
+	deployment, err := m.DeletePod(mux.Vars(r)["id"], forceParam(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Marathon-Deployment-Id", deployment.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *Marathon) handleGetPodStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := m.GetPodStatus(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (m *Marathon) handleListPodStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.ListPodStatus())
+}
+
+func (m *Marathon) handleListPodVersions(w http.ResponseWriter, r *http.Request) {
+	podID := canonicalID(mux.Vars(r)["id"])
+	if _, err := m.GetPod(podID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	versions, err := m.ListAppVersions(podID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+func (m *Marathon) handleGetPodVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	podID := canonicalID(vars["id"])
+	if _, err := m.GetPod(podID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	app, err := m.GetAppVersion(podID, vars["version"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(podDefinition(app))
+}
+
+func (m *Marathon) handleKillPodInstance(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := m.KillPodInstance(vars["id"], vars["instance"]); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,235 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPod(instances int) *Pod {
+	return &Pod{
+		ID:       "/web",
+		Volumes:  []*PodVolume{{Name: "shared"}},
+		Networks: []*PodNetwork{{Mode: "host"}},
+		Containers: []*PodContainer{
+			{
+				Name:         "server",
+				Resources:    &PodResources{CPUs: 0.5, Mem: 256},
+				Image:        &PodImage{Kind: "DOCKER", ID: "nginx"},
+				Endpoints:    []*PodEndpoint{{Name: "http", Protocol: []string{"tcp"}}},
+				VolumeMounts: []*PodVolumeMount{{Name: "shared", MountPath: "/usr/share/nginx/html"}},
+				HealthCheck:  &PodHealthCheck{HTTP: &PodHTTPCheck{Endpoint: "http", Path: "/health"}},
+			},
+			{
+				Name:         "sync",
+				Resources:    &PodResources{CPUs: 0.25, Mem: 128},
+				Exec:         &PodExec{Command: &PodCommand{Shell: "sync-content /data"}},
+				VolumeMounts: []*PodVolumeMount{{Name: "shared", MountPath: "/data"}},
+			},
+		},
+		Scaling: &PodScaling{Kind: "fixed", Instances: instances},
+	}
+}
+
+// runPod launches the instances of a pod on offers and marks them healthy
+func runPod(t *testing.T, marathon *Marathon, offers ...*Offer) []*OfferMatch {
+	t.Helper()
+	matches := marathon.ResourceOffers(offers)
+	marathon.monitorTasks()
+	for _, task := range marathon.Applications["/web"].Tasks {
+		task.HealthCheckResults = []*HealthCheckResult{{Alive: true}}
+	}
+	completeDeployments(t, marathon)
+	return matches
+}
+
+func TestPodRunSpec(t *testing.T) {
+	app, err := podRunSpec(testPod(2))
+	require.NoError(t, err)
+	assert.Equal(t, "/web", app.ID)
+	assert.Equal(t, 2, app.Instances)
+	assert.InDelta(t, 0.75, app.CPUs, 1e-9)
+	assert.InDelta(t, 384.0, app.Memory, 1e-9)
+	require.Len(t, app.HealthChecks, 1)
+	assert.Equal(t, ProtocolHTTP, app.HealthChecks[0].Protocol)
+	assert.Equal(t, "/health", app.HealthChecks[0].Path)
+	assert.Equal(t, 0, app.Pod.Scaling.Instances, "the instance count lives in the run spec")
+
+	tests := []struct {
+		name   string
+		modify func(pod *Pod)
+	}{
+		{"no containers", func(pod *Pod) { pod.Containers = nil }},
+		{"duplicate container", func(pod *Pod) { pod.Containers[1].Name = "server" }},
+		{"no resources", func(pod *Pod) { pod.Containers[1].Resources = nil }},
+		{"unknown volume", func(pod *Pod) { pod.Volumes = nil }},
+		{"unknown endpoint", func(pod *Pod) { pod.Containers[0].HealthCheck.HTTP.Endpoint = "admin" }},
+		{"duplicate endpoint", func(pod *Pod) {
+			pod.Containers[1].Endpoints = []*PodEndpoint{{Name: "http"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod(1)
+			tt.modify(pod)
+			_, err := podRunSpec(pod)
+			assert.ErrorIs(t, err, ErrInvalidPod)
+		})
+	}
+}
+
+func TestMarathon_PodLaunchGroup(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	_, err := marathon.CreatePod(testPod(2), false)
+	require.NoError(t, err)
+
+	matches := runPod(t, marathon, portOffer(1, 31000, 31001))
+	require.Len(t, matches, 1)
+	require.Len(t, matches[0].Tasks, 2)
+
+	// Each instance launches its containers together under one executor
+	require.Len(t, matches[0].Operations, 2)
+	for i, op := range matches[0].Operations {
+		instance := matches[0].Tasks[i]
+		assert.Equal(t, OperationLaunchGroup, op.Type)
+		assert.Equal(t, "instance-"+instance.ID, op.ExecutorID)
+		assert.Equal(t, []string{instance.ID + ".server", instance.ID + ".sync"}, op.TaskIDs)
+	}
+
+	status, err := marathon.GetPodStatus("web")
+	require.NoError(t, err)
+	assert.Equal(t, PodStable, status.Status)
+	require.Len(t, status.Instances, 2)
+	instance := status.Instances[0]
+	assert.Equal(t, PodInstanceStable, instance.Status)
+	assert.Equal(t, "host-1", instance.AgentHostname)
+	require.Len(t, instance.Containers, 2)
+	assert.Equal(t, instance.ID+".server", instance.Containers[0].ContainerID)
+	assert.Equal(t, []*PodEndpointStatus{{Name: "http", AllocatedHostPort: 31000}}, instance.Containers[0].Endpoints)
+
+	// A failing container fails its whole instance, which is replaced
+	require.NoError(t, marathon.StatusUpdate(instance.ID+".sync", "TASK_FAILED", "exited"))
+	assert.NotContains(t, marathon.Tasks, instance.ID)
+	tasks := marathon.Applications["/web"].Tasks
+	require.Len(t, tasks, 2)
+	assert.NotEqual(t, instance.ID, tasks[1].ID)
+	assert.True(t, waitingForOffer(tasks[1]))
+	assert.ErrorIs(t, marathon.StatusUpdate(instance.ID+".missing", "TASK_FAILED", ""), ErrTaskNotFound)
+}
+
+func TestMarathon_PodScaleAndUpdate(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	_, err := marathon.CreatePod(testPod(1), false)
+	require.NoError(t, err)
+	runPod(t, marathon, portOffer(1, 31000))
+
+	deployment, err := marathon.UpdatePod("/web", testPod(3), false)
+	require.NoError(t, err)
+	assert.Equal(t, []*DeploymentStep{{Action: ActionScaleApplication, App: "/web"}}, deployment.Steps)
+	runPod(t, marathon, portOffer(2, 31000, 31001, 31002))
+	assert.Len(t, marathon.Applications["/web"].Tasks, 3)
+
+	changed := testPod(3)
+	changed.Containers[0].Image.ID = "nginx:1.25"
+	deployment, err = marathon.UpdatePod("/web", changed, false)
+	require.NoError(t, err)
+	assert.Equal(t, []*DeploymentStep{{Action: ActionRestartApplication, App: "/web"}}, deployment.Steps)
+
+	_, err = marathon.UpdatePod("/web", testPod(1), false)
+	assert.ErrorIs(t, err, ErrDeploymentConflict)
+
+	_, err = marathon.UpdatePod("/missing", testPod(1), false)
+	assert.ErrorIs(t, err, ErrPodNotFound)
+
+	runPod(t, marathon, portOffer(3, 31000, 31001, 31002))
+	pod, err := marathon.GetPod("/web")
+	require.NoError(t, err)
+	assert.Equal(t, "nginx:1.25", pod.Containers[0].Image.ID)
+	assert.Equal(t, 3, pod.Scaling.Instances)
+
+	_, err = marathon.DeletePod("/web", false)
+	require.NoError(t, err)
+	completeDeployments(t, marathon)
+	assert.Empty(t, marathon.ListPods())
+}
+
+func TestMarathon_HandlePods(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/api", Instances: 1}))
+	router := marathon.setupRoutes()
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, &buf))
+		return w
+	}
+
+	w := do("POST", "/v2/pods", testPod(1))
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Marathon-Deployment-Id"))
+	assert.Equal(t, http.StatusConflict, do("POST", "/v2/pods", testPod(1)).Code)
+
+	invalid := testPod(1)
+	invalid.Containers = nil
+	invalid.ID = "/other"
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/v2/pods", invalid).Code)
+	runPod(t, marathon, portOffer(1, 31000))
+
+	var pods []*Pod
+	w = do("GET", "/v2/pods", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&pods))
+	require.Len(t, pods, 1)
+	assert.Equal(t, "/web", pods[0].ID)
+
+	// Pods are not served as apps
+	w = do("GET", "/v2/apps", nil)
+	assert.NotContains(t, w.Body.String(), `"/web"`)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v2/apps/web", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/v2/apps/web", nil).Code)
+
+	var status PodStatus
+	w = do("GET", "/v2/pods/web::status", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, PodStable, status.Status)
+	require.Len(t, status.Instances, 1)
+
+	var statuses []*PodStatus
+	w = do("GET", "/v2/pods/::status", nil)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&statuses))
+	assert.Len(t, statuses, 1)
+
+	var versions []string
+	w = do("GET", "/v2/pods/web::versions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&versions))
+	require.Len(t, versions, 1)
+
+	var version Pod
+	w = do("GET", "/v2/pods/web::versions/"+versions[0], nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&version))
+	assert.Equal(t, versions[0], version.Version)
+
+	instanceID := status.Instances[0].ID
+	assert.Equal(t, http.StatusAccepted, do("DELETE", "/v2/pods/web::instances"+instanceID, nil).Code)
+	assert.NotContains(t, marathon.Tasks, instanceID)
+	tasks := marathon.Applications["/web"].Tasks
+	require.Len(t, tasks, 1)
+	assert.True(t, waitingForOffer(tasks[0]), "the killed instance is replaced")
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/v2/pods/web::instances/missing", nil).Code)
+
+	assert.Equal(t, http.StatusOK, do("PUT", "/v2/pods/web", testPod(2)).Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v2/pods/missing", nil).Code)
+	assert.Equal(t, http.StatusAccepted, do("DELETE", "/v2/pods/web?force=true", nil).Code)
+}
@@ -0,0 +1,332 @@
+package marathon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default service port range, matching Marathon's local_port_min and
+// local_port_max
+const (
+	DefaultServicePortMin = 10000
+	DefaultServicePortMax = 20000
+)
+
+// ErrServicePortInUse is returned when an app requests a service port that
+// another app already uses
+var ErrServicePortInUse = errors.New("service port in use")
+
+// ErrNoServicePorts is returned when the service port range is exhausted
+var ErrNoServicePorts = errors.New("no free service ports")
+
+// PortDefinition declares a port of an app using host networking. A zero
+// port is assigned a free service port on deployment.
+type PortDefinition struct {
+	Port     int               `json:"port"`
+	Protocol string            `json:"protocol,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// appPort is a port declared by an app through its pod endpoints, its
+// Docker port mappings or, without those, its port definitions
+type appPort struct {
+	servicePort *int // nil for pod endpoints, which have no service port
+	hostPort    int  // 0 takes any port from the offer
+	protocol    string
+}
+
+// appPorts returns the ports an app declares, in port index order
+func appPorts(app *Application) []appPort {
+	ports := make([]appPort, 0)
+	if app.Pod != nil {
+		for _, ep := range podEndpoints(app.Pod) {
+			ports = append(ports, appPort{hostPort: ep.HostPort, protocol: strings.Join(ep.Protocol, ",")})
+		}
+		return ports
+	}
+	if app.Container != nil && app.Container.Docker != nil && len(app.Container.Docker.PortMappings) > 0 {
+		for _, pm := range app.Container.Docker.PortMappings {
+			ports = append(ports, appPort{servicePort: &pm.ServicePort, hostPort: pm.HostPort, protocol: pm.Protocol})
+		}
+		return ports
+	}
+	for _, pd := range app.PortDefinitions {
+		ports = append(ports, appPort{servicePort: &pd.Port, protocol: pd.Protocol})
+	}
+	return ports
+}
+
+// servicePorts returns the service ports of an app, in port index order
+func servicePorts(app *Application) []int {
+	ports := make([]int, 0)
+	for _, port := range appPorts(app) {
+		if port.servicePort != nil {
+			ports = append(ports, *port.servicePort)
+		}
+	}
+	return ports
+}
+
+// hasProtocol reports whether a port serves a protocol. Ports without a
+// protocol serve TCP; "udp,tcp" serves both.
+func (p appPort) hasProtocol(protocol string) bool {
+	if p.protocol == "" {
+		return protocol == "tcp"
+	}
+	for _, part := range strings.Split(strings.ToLower(p.protocol), ",") {
+		if strings.TrimSpace(part) == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// copyPorts gives an app its own copies of its port declarations, so
+// assigning service ports never changes definitions shared with stored
+// versions
+func copyPorts(app *Application) {
+	if app.Container != nil && app.Container.Docker != nil {
+		container := *app.Container
+		docker := *container.Docker
+		docker.PortMappings = make([]*PortMapping, len(docker.PortMappings))
+		for i, pm := range app.Container.Docker.PortMappings {
+			copied := *pm
+			docker.PortMappings[i] = &copied
+		}
+		container.Docker = &docker
+		app.Container = &container
+	}
+
+	definitions := make([]*PortDefinition, len(app.PortDefinitions))
+	for i, pd := range app.PortDefinitions {
+		copied := *pd
+		definitions[i] = &copied
+	}
+	if app.PortDefinitions != nil {
+		app.PortDefinitions = definitions
+	}
+}
+
+// allocateServicePorts assigns service ports to the ports of the target
+// apps that request port 0. Apps keep the service ports of their current
+// definition where they can; other ports get the lowest free port in the
+// configured range. Requested ports used by other apps, including apps
+// still being deployed, are rejected. The caller must hold m.mu.
+func (m *Marathon) allocateServicePorts(target map[string]*Application) error {
+	ids := make([]string, 0, len(target))
+	for id, app := range target {
+		if app != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	// Service ports in use, by the app holding them
+	used := make(map[int]string)
+	for id, app := range m.Applications {
+		if _, deploying := target[id]; !deploying {
+			for _, port := range servicePorts(app) {
+				used[port] = id
+			}
+		}
+	}
+	for _, d := range m.Deployments {
+		for id, app := range d.target {
+			if _, deploying := target[id]; !deploying && app != nil {
+				for _, port := range servicePorts(app) {
+					used[port] = id
+				}
+			}
+		}
+	}
+
+	// Requested ports are claimed before any port is assigned
+	for _, id := range ids {
+		for _, port := range appPorts(target[id]) {
+			if port.servicePort == nil || *port.servicePort == 0 {
+				continue
+			}
+			if holder, taken := used[*port.servicePort]; taken && holder != id {
+				return fmt.Errorf("%w: %d is used by %s", ErrServicePortInUse, *port.servicePort, holder)
+			}
+			used[*port.servicePort] = id
+		}
+	}
+
+	next := m.ServicePortMin
+	for _, id := range ids {
+		app := target[id]
+		copyPorts(app)
+
+		var current []int
+		if existing := m.Applications[id]; existing != nil {
+			current = servicePorts(existing)
+		}
+		for i, port := range appPorts(app) {
+			if port.servicePort == nil || *port.servicePort != 0 {
+				continue
+			}
+			if i < len(current) && current[i] != 0 {
+				if holder, taken := used[current[i]]; !taken || holder == id {
+					*port.servicePort = current[i]
+					used[current[i]] = id
+					continue
+				}
+			}
+
+			for ; next <= m.ServicePortMax; next++ {
+				if _, taken := used[next]; !taken {
+					break
+				}
+			}
+			if next > m.ServicePortMax {
+				return fmt.Errorf("%w in %d-%d", ErrNoServicePorts, m.ServicePortMin, m.ServicePortMax)
+			}
+			*port.servicePort = next
+			used[next] = id
+		}
+	}
+	return nil
+}
+
+// pickHostPorts chooses host ports for a task of an app from the ports left
+// in an offer: requested host ports must be offered, the others take the
+// lowest offered ports. It reports false if the offer lacks ports.
+func pickHostPorts(app *Application, offered []int) ([]int, bool) {
+	ports := appPorts(app)
+	free := make(map[int]bool, len(offered))
+	for _, port := range offered {
+		free[port] = true
+	}
+
+	picked := make([]int, len(ports))
+	for i, port := range ports {
+		if port.hostPort == 0 {
+			continue
+		}
+		if !free[port.hostPort] {
+			return nil, false
+		}
+		free[port.hostPort] = false
+		picked[i] = port.hostPort
+	}
+
+	sorted := append([]int(nil), offered...)
+	sort.Ints(sorted)
+	for i, port := range ports {
+		if port.hostPort != 0 {
+			continue
+		}
+		for len(sorted) > 0 && !free[sorted[0]] {
+			sorted = sorted[1:]
+		}
+		if len(sorted) == 0 {
+			return nil, false
+		}
+		picked[i] = sorted[0]
+		free[sorted[0]] = false
+	}
+	return picked, true
+}
+
+// withoutPorts returns the offered ports not in taken
+func withoutPorts(offered, taken []int) []int {
+	remaining := make([]int, 0, len(offered))
+	for _, port := range offered {
+		if !containsPort(taken, port) {
+			remaining = append(remaining, port)
+		}
+	}
+	return remaining
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// appEndpoints returns host:port of the given port index for each healthy
+// task of an app. The caller must hold m.mu.
+func (m *Marathon) appEndpoints(app *Application, portIndex int) []string {
+	endpoints := make([]string, 0, len(app.Tasks))
+	for _, task := range app.Tasks {
+		if !m.taskHealthy(app, task) || portIndex >= len(task.Ports) {
+			continue
+		}
+		endpoints = append(endpoints, net.JoinHostPort(task.Host, strconv.Itoa(task.Ports[portIndex])))
+	}
+	return endpoints
+}
+
+// Endpoints returns host:port of the given port index for each healthy task
+// of an app
+func (m *Marathon) Endpoints(appID string, portIndex int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, exists := m.Applications[appID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	return m.appEndpoints(app, portIndex), nil
+}
+
+// portIndexParam returns the portIndex query parameter, 0 if absent
+func portIndexParam(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("portIndex")
+	if value == "" {
+		return 0, nil
+	}
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid portIndex %q", value)
+	}
+	return index, nil
+}
+
+// handleDiscovery maps every app to the endpoints of its healthy tasks
+func (m *Marathon) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	portIndex, err := portIndexParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.RLock()
+	endpoints := make(map[string][]string, len(m.Applications))
+	for id, app := range m.Applications {
+		endpoints[id] = m.appEndpoints(app, portIndex)
+	}
+	m.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+func (m *Marathon) handleAppDiscovery(w http.ResponseWriter, r *http.Request) {
+	portIndex, err := portIndexParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoints, err := m.Endpoints(m.appIDFromRequest(r), portIndex)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoints)
+}
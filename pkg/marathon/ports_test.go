@@ -0,0 +1,150 @@
+package marathon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func portOffer(i int, ports ...int) *Offer {
+	offer := testOffer(i, "r1")
+	offer.Ports = ports
+	return offer
+}
+
+func TestMarathon_AllocateServicePorts(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/api", Instances: 1,
+		PortDefinitions: []*PortDefinition{{Port: 0}, {Port: 0, Protocol: "udp"}}}))
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 1,
+		Container: &Container{Type: "DOCKER", Docker: &DockerSpec{Image: "nginx", Network: "BRIDGE",
+			PortMappings: []*PortMapping{{ContainerPort: 80}}}}}))
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/fixed", Instances: 1,
+		PortDefinitions: []*PortDefinition{{Port: 10003}}}))
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/other", Instances: 1,
+		PortDefinitions: []*PortDefinition{{Port: 0}, {Port: 0}}}))
+
+	assert.Equal(t, []int{10000, 10001}, servicePorts(marathon.Applications["/api"]))
+	assert.Equal(t, []int{10002}, servicePorts(marathon.Applications["/web"]))
+	assert.Equal(t, []int{10003}, servicePorts(marathon.Applications["/fixed"]))
+	assert.Equal(t, []int{10004, 10005}, servicePorts(marathon.Applications["/other"]))
+	assert.Equal(t, []int{10000, 10001}, marathon.Applications["/api"].Tasks[0].ServicePorts)
+
+	// Updates keep the app's service ports
+	require.NoError(t, marathon.UpdateApp("/api", &Application{Instances: 1, CPUs: 0.5,
+		PortDefinitions: []*PortDefinition{{Port: 0}, {Port: 0, Protocol: "udp"}, {Port: 0}}}))
+	assert.Equal(t, []int{10000, 10001, 10006}, servicePorts(marathon.Applications["/api"]))
+
+	// Requested ports must not belong to another app
+	err := marathon.CreateApp(&Application{ID: "/clash", Instances: 1,
+		PortDefinitions: []*PortDefinition{{Port: 10002}}})
+	assert.ErrorIs(t, err, ErrServicePortInUse)
+	assert.Equal(t, http.StatusConflict, errorStatus(err))
+	assert.NotContains(t, marathon.Applications, "/clash")
+}
+
+func TestMarathon_AllocateServicePortsExhausted(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	marathon.ServicePortMin, marathon.ServicePortMax = 10000, 10001
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/a", Instances: 1,
+		PortDefinitions: []*PortDefinition{{}, {}}}))
+	err := marathon.CreateApp(&Application{ID: "/b", Instances: 1,
+		PortDefinitions: []*PortDefinition{{}}})
+	assert.ErrorIs(t, err, ErrNoServicePorts)
+}
+
+func TestMarathon_HostPortsFromOffers(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 2, CPUs: 1.0,
+		Container: &Container{Type: "DOCKER", Docker: &DockerSpec{Image: "nginx", Network: "BRIDGE",
+			PortMappings: []*PortMapping{{ContainerPort: 80}, {ContainerPort: 9000, HostPort: 31005}}}}}))
+
+	// The requested host port is only offered once, so one task fits
+	matches := marathon.ResourceOffers([]*Offer{portOffer(1, 31005, 31000, 31001)})
+	require.Len(t, matches, 1)
+	require.Len(t, matches[0].Tasks, 1)
+	assert.Equal(t, []int{31000, 31005}, matches[0].Tasks[0].Ports)
+
+	matches = marathon.ResourceOffers([]*Offer{portOffer(2, 31000)})
+	assert.Empty(t, matches)
+	queue := marathon.LaunchQueue()
+	require.Len(t, queue, 1)
+	assert.Equal(t, []string{ReasonInsufficientPorts}, queue[0].LastUnusedOffers[0].Reason)
+}
+
+func TestPickHostPorts(t *testing.T) {
+	app := &Application{PortDefinitions: []*PortDefinition{{}, {}}}
+
+	tests := []struct {
+		name    string
+		offered []int
+		want    []int
+		ok      bool
+	}{
+		{"lowest ports first", []int{31002, 31000, 31001}, []int{31000, 31001}, true},
+		{"too few ports", []int{31000}, nil, false},
+		{"no ports", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ports, ok := pickHostPorts(app, tt.offered)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, ports)
+		})
+	}
+
+	ports, ok := pickHostPorts(&Application{}, nil)
+	assert.True(t, ok)
+	assert.Empty(t, ports)
+}
+
+func TestMarathon_HandleDiscovery(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/prod/web", Instances: 2, CPUs: 1.0,
+		PortDefinitions: []*PortDefinition{{}, {}}}))
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/idle", Instances: 1, CPUs: 1.0}))
+	marathon.ResourceOffers([]*Offer{portOffer(1, 31000, 31001, 31002, 31003)})
+	completeDeployments(t, marathon)
+
+	// Only healthy tasks are listed
+	unhealthy := marathon.Applications["/prod/web"].Tasks[1]
+	unhealthy.State = "TASK_STAGING"
+
+	router := marathon.setupRoutes()
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"all apps", "/v2/discovery", http.StatusOK, `{"/idle":["host-1:8080"],"/prod/web":["host-1:31000"]}`},
+		{"one app", "/v2/discovery/prod/web", http.StatusOK, `["host-1:31000"]`},
+		{"port index", "/v2/discovery/prod/web?portIndex=1", http.StatusOK, `["host-1:31001"]`},
+		{"port index out of range", "/v2/discovery/prod/web?portIndex=5", http.StatusOK, `[]`},
+		{"invalid port index", "/v2/discovery?portIndex=x", http.StatusBadRequest, ""},
+		{"missing app", "/v2/discovery/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.body != "" {
+				assert.JSONEq(t, tt.body, w.Body.String())
+			}
+		})
+	}
+
+	endpoints, err := marathon.Endpoints("/prod/web", 0)
+	require.NoError(t, err)
+	encoded, err := json.Marshal(endpoints)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["host-1:31000"]`, string(encoded))
+}
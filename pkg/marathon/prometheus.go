@@ -0,0 +1,132 @@
+package marathon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultPrometheusTimeout bounds a single query when no HTTP client is set
+const defaultPrometheusTimeout = 10 * time.Second
+
+// MetricsQuerier evaluates instant queries against a metrics backend. ok is
+// false when the query matched no data.
+type MetricsQuerier interface {
+	Query(ctx context.Context, query string, at time.Time) (value float64, ok bool, err error)
+}
+
+// PrometheusClient queries a Prometheus compatible HTTP API
+type PrometheusClient struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewPrometheusClient creates a client for the API served at baseURL, such
+// as http://prometheus:9090
+func NewPrometheusClient(baseURL string) *PrometheusClient {
+	return &PrometheusClient{
+		BaseURL: baseURL,
+		Client:  &http.Client{Timeout: defaultPrometheusTimeout},
+	}
+}
+
+// prometheusResponse is the envelope of the Prometheus query API
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// prometheusSample is an element of a vector result
+type prometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// Query evaluates an instant query through /api/v1/query. Scalar results
+// and vectors of a single sample are supported; NaN counts as no data.
+func (p *PrometheusClient) Query(ctx context.Context, query string, at time.Time) (float64, bool, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatFloat(float64(at.UnixNano())/1e9, 'f', 3, 64))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, fmt.Errorf("query %q: %w", query, err)
+	}
+	defer resp.Body.Close()
+
+	var body prometheusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, false, fmt.Errorf("query %q: HTTP %d: %w", query, resp.StatusCode, err)
+	}
+	if body.Status != "success" {
+		return 0, false, fmt.Errorf("query %q: %s: %s", query, body.ErrorType, body.Error)
+	}
+
+	var value []interface{}
+	switch body.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(body.Data.Result, &value); err != nil {
+			return 0, false, fmt.Errorf("query %q: %w", query, err)
+		}
+	case "vector":
+		var samples []prometheusSample
+		if err := json.Unmarshal(body.Data.Result, &samples); err != nil {
+			return 0, false, fmt.Errorf("query %q: %w", query, err)
+		}
+		switch len(samples) {
+		case 0:
+			return 0, false, nil
+		case 1:
+			value = samples[0].Value
+		default:
+			return 0, false, fmt.Errorf("query %q returned %d series, expected one", query, len(samples))
+		}
+	default:
+		return 0, false, fmt.Errorf("query %q: unsupported result type %q", query, body.Data.ResultType)
+	}
+
+	if len(value) != 2 {
+		return 0, false, fmt.Errorf("query %q: malformed sample", query)
+	}
+	text, isString := value[1].(string)
+	if !isString {
+		return 0, false, fmt.Errorf("query %q: malformed sample value", query)
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("query %q: %w", query, err)
+	}
+	if math.IsNaN(v) {
+		return 0, false, nil
+	}
+	return v, true, nil
+}
+
+// promDuration formats a duration as a Prometheus range of whole seconds,
+// at least one
+func promDuration(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
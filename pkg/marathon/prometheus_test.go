@@ -0,0 +1,111 @@
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePrometheus serves the Prometheus query API from canned results keyed
+// by query. Queries without a result return an empty vector.
+type fakePrometheus struct {
+	*httptest.Server
+	mu      sync.Mutex
+	results map[string]string
+	queries []string
+}
+
+func newFakePrometheus(t *testing.T) *fakePrometheus {
+	fake := &fakePrometheus{results: make(map[string]string)}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		fake.mu.Lock()
+		fake.queries = append(fake.queries, query)
+		result, exists := fake.results[query]
+		fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case query == "bad(":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+		case !exists:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			fmt.Fprint(w, result)
+		}
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// set makes a query return a single sample vector with value
+func (f *fakePrometheus) set(query, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[query] = fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1760000000,%q]}]}}`, value)
+}
+
+func TestPrometheusClient_Query(t *testing.T) {
+	fake := newFakePrometheus(t)
+	fake.set("up", "1")
+	fake.set("ratio", "NaN")
+	fake.results["scalar(up)"] = `{"status":"success","data":{"resultType":"scalar","result":[1760000000,"0.25"]}}`
+	fake.results["many"] = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"a":"1"},"value":[1760000000,"1"]},{"metric":{"a":"2"},"value":[1760000000,"2"]}]}}`
+	fake.results["range"] = `{"status":"success","data":{"resultType":"matrix","result":[]}}`
+
+	client := NewPrometheusClient(fake.URL)
+	tests := []struct {
+		query string
+		value float64
+		ok    bool
+		err   string
+	}{
+		{"up", 1, true, ""},
+		{"scalar(up)", 0.25, true, ""},
+		{"missing", 0, false, ""},
+		{"ratio", 0, false, ""},
+		{"many", 0, false, "returned 2 series"},
+		{"range", 0, false, `unsupported result type "matrix"`},
+		{"bad(", 0, false, "bad_data: parse error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			value, ok, err := client.Query(context.Background(), tt.query, time.Unix(1760000000, 0))
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func TestPrometheusClient_QueryUnreachable(t *testing.T) {
+	fake := newFakePrometheus(t)
+	fake.Close()
+
+	_, _, err := NewPrometheusClient(fake.URL).Query(context.Background(), "up", time.Now())
+	assert.Error(t, err)
+}
+
+func TestPromDuration(t *testing.T) {
+	assert.Equal(t, "1s", promDuration(0))
+	assert.Equal(t, "1s", promDuration(10*time.Millisecond))
+	assert.Equal(t, "90s", promDuration(90*time.Second))
+}
@@ -0,0 +1,357 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Defaults for unset launch backoff fields, matching Marathon
+const (
+	defaultBackoffSeconds        = 1
+	defaultBackoffFactor         = 1.15
+	defaultMaxLaunchDelaySeconds = 300
+)
+
+// maxUnusedOffers limits how many unused offers are kept per queued app
+const maxUnusedOffers = 10
+
+// Reasons an offer is not used for a queued app, named as in Marathon
+const (
+	ReasonInsufficientCpus      = "InsufficientCpus"
+	ReasonInsufficientMemory    = "InsufficientMemory"
+	ReasonInsufficientPorts     = "InsufficientPorts"
+	ReasonUnfulfilledConstraint = "UnfulfilledConstraint"
+)
+
+// rejectReasons lists the offer reject reasons in summary order
+var rejectReasons = []string{ReasonInsufficientCpus, ReasonInsufficientMemory, ReasonInsufficientPorts, ReasonUnfulfilledConstraint}
+
+// failedStates are the task states that count as launch failures
+var failedStates = map[string]bool{
+	"TASK_FAILED":  true,
+	"TASK_ERROR":   true,
+	"TASK_LOST":    true,
+	"TASK_DROPPED": true,
+	"TASK_GONE":    true,
+}
+
+// launchDelay holds the backoff of an app version whose tasks failed
+type launchDelay struct {
+	version string
+	delay   time.Duration
+	until   time.Time
+}
+
+// offerStats records how the offers processed for a queued app were used
+type offerStats struct {
+	processed  int
+	unused     int
+	lastUsed   *time.Time
+	lastUnused *time.Time
+	rejected   map[string]int
+	unusedLog  []*UnusedOffer
+}
+
+// QueueItem describes an app with instances waiting to be launched
+type QueueItem struct {
+	App                    *Application            `json:"app"`
+	Count                  int                     `json:"count"`
+	Delay                  *QueueDelay             `json:"delay"`
+	Since                  *time.Time              `json:"since,omitempty"`
+	ProcessedOffersSummary *ProcessedOffersSummary `json:"processedOffersSummary"`
+	LastUnusedOffers       []*UnusedOffer          `json:"lastUnusedOffers,omitempty"`
+}
+
+// QueueDelay reports the launch delay of a queued app
+type QueueDelay struct {
+	TimeLeftSeconds int  `json:"timeLeftSeconds"`
+	Overdue         bool `json:"overdue"`
+}
+
+// ProcessedOffersSummary summarizes the offers processed for a queued app
+type ProcessedOffersSummary struct {
+	ProcessedOffersCount    int              `json:"processedOffersCount"`
+	UnusedOffersCount       int              `json:"unusedOffersCount"`
+	LastUnusedOfferAt       *time.Time       `json:"lastUnusedOfferAt,omitempty"`
+	LastUsedOfferAt         *time.Time       `json:"lastUsedOfferAt,omitempty"`
+	RejectSummaryLastOffers []*RejectSummary `json:"rejectSummaryLastOffers"`
+}
+
+// RejectSummary counts the processed offers declined for one reason
+type RejectSummary struct {
+	Reason    string `json:"reason"`
+	Declined  int    `json:"declined"`
+	Processed int    `json:"processed"`
+}
+
+// UnusedOffer records an offer that could not host a queued app's tasks
+type UnusedOffer struct {
+	Offer     *Offer    `json:"offer"`
+	Timestamp time.Time `json:"timestamp"`
+	Reason    []string  `json:"reason"`
+}
+
+// backoff returns an app's launch backoff settings with defaults applied
+func backoff(app *Application) (initial time.Duration, factor float64, max time.Duration) {
+	factor = app.BackoffFactor
+	if factor <= 0 {
+		factor = defaultBackoffFactor
+	}
+	return seconds(app.BackoffSeconds, defaultBackoffSeconds), factor,
+		seconds(app.MaxLaunchDelaySeconds, defaultMaxLaunchDelaySeconds)
+}
+
+// waitingForOffer reports whether a task is staged but not yet placed
+func waitingForOffer(task *MarathonTask) bool {
+	return task.State == "TASK_STAGING" && task.SlaveID == ""
+}
+
+// waitingTasks counts the tasks of an app waiting for an offer
+func waitingTasks(app *Application) int {
+	count := 0
+	for _, task := range app.Tasks {
+		if waitingForOffer(task) {
+			count++
+		}
+	}
+	return count
+}
+
+// recordLaunchFailure grows the launch delay of an app's current version:
+// the first failure delays launches by backoffSeconds and every further one
+// multiplies the delay by backoffFactor, up to maxLaunchDelaySeconds. The
+// caller must hold m.mu.
+func (m *Marathon) recordLaunchFailure(app *Application, now time.Time) {
+	initial, factor, max := backoff(app)
+
+	d, exists := m.delays[app.ID]
+	if !exists || d.version != app.Version {
+		d = &launchDelay{version: app.Version, delay: initial}
+		m.delays[app.ID] = d
+	} else {
+		d.delay = time.Duration(math.Min(float64(d.delay)*factor, float64(max)))
+	}
+	if d.delay > max {
+		d.delay = max
+	}
+	d.until = now.Add(d.delay)
+	log.Printf("Delaying launches of %s for %s", app.ID, d.delay)
+}
+
+// launchDelayed reports whether launches of an app wait for its backoff.
+// Delays of earlier app versions no longer apply. The caller must hold m.mu.
+func (m *Marathon) launchDelayed(app *Application, now time.Time) bool {
+	d, exists := m.delays[app.ID]
+	return exists && d.version == app.Version && now.Before(d.until)
+}
+
+// recordOffer updates the queue statistics of an app after an offer was
+// processed for it. The caller must hold m.mu.
+func (m *Marathon) recordOffer(app *Application, offer *Offer, placed int, reasons []string, now time.Time) {
+	stats, exists := m.offerStats[app.ID]
+	if !exists {
+		stats = &offerStats{rejected: make(map[string]int)}
+		m.offerStats[app.ID] = stats
+	}
+
+	at := now
+	stats.processed++
+	if placed > 0 {
+		stats.lastUsed = &at
+		return
+	}
+
+	stats.unused++
+	stats.lastUnused = &at
+	for _, reason := range reasons {
+		stats.rejected[reason]++
+	}
+	unused := *offer
+	stats.unusedLog = append(stats.unusedLog, &UnusedOffer{Offer: &unused, Timestamp: now, Reason: reasons})
+	if len(stats.unusedLog) > maxUnusedOffers {
+		stats.unusedLog = stats.unusedLog[len(stats.unusedLog)-maxUnusedOffers:]
+	}
+}
+
+// StatusUpdate applies a task status reported by Mesos. Failed tasks are
+// recorded as the app's last task failure, delay further launches of the
+// app's version and are replaced if they ran the current version. A task of
+// the current version reaching TASK_RUNNING resets the delay. A task that
+// returns from TASK_UNREACHABLE after being replaced rejoins its app, which
+// sheds the excess tasks.
+func (m *Marathon) StatusUpdate(taskID, state, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	return m.statusUpdate(taskID, state, message, time.Now())
+}
+
+// statusUpdate applies a task status. The caller must hold m.mu.
+func (m *Marathon) statusUpdate(taskID, state, message string, now time.Time) error {
+	task, exists := m.Tasks[taskID]
+	if !exists {
+		// A container of a pod instance reports for the whole instance
+		if task, exists = m.podInstanceForTask(taskID); !exists {
+			return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+	}
+	if task.State == state {
+		return nil
+	}
+
+	app := m.Applications[task.AppID]
+	if state == "TASK_RUNNING" && task.StartedAt == nil {
+		task.StartedAt = &now
+	}
+	task.State = state
+	m.publishStatusUpdate(task)
+
+	replaced := task.UnreachableInactive
+	switch {
+	case state == "TASK_UNREACHABLE":
+		task.UnreachableSince = &now
+	case state == "TASK_RUNNING" && task.UnreachableSince != nil:
+		m.taskReachable(app, task)
+	default:
+		task.UnreachableSince, task.UnreachableInactive = nil, false
+	}
+
+	if run := m.jobRunForTask(task); run != nil {
+		m.jobTaskUpdate(run, task, message, now)
+		return nil
+	}
+	if app == nil {
+		return nil
+	}
+	switch {
+	case state == "TASK_RUNNING" && task.Version == app.Version:
+		delete(m.delays, app.ID)
+	case failedStates[state]:
+		app.LastTaskFailure = &TaskFailure{
+			AppID:     app.ID,
+			TaskID:    task.ID,
+			State:     state,
+			Message:   message,
+			Host:      task.Host,
+			Version:   task.Version,
+			Timestamp: now,
+		}
+		m.removeAppTask(app, task)
+		delete(m.Tasks, task.ID)
+		log.Printf("Task %s of %s failed with %s: %s", task.ID, app.ID, state, message)
+
+		// A task replaced while unreachable has no place left to fill
+		if task.Version == app.Version && !replaced {
+			m.recordLaunchFailure(app, now)
+			m.stageTask(app)
+		}
+	}
+	m.updateTaskCounts(app)
+	return nil
+}
+
+// LaunchQueue returns the apps with instances waiting to be launched,
+// ordered by app ID
+func (m *Marathon) LaunchQueue() []*QueueItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.launchQueue(time.Now())
+}
+
+// launchQueue builds the launch queue. The caller must hold m.mu.
+func (m *Marathon) launchQueue(now time.Time) []*QueueItem {
+	queue := make([]*QueueItem, 0)
+	for _, app := range m.sortedApps() {
+		count := waitingTasks(app)
+		if count == 0 {
+			continue
+		}
+
+		item := &QueueItem{
+			App:                    snapshotApp(app),
+			Count:                  count,
+			Delay:                  &QueueDelay{Overdue: true},
+			ProcessedOffersSummary: &ProcessedOffersSummary{RejectSummaryLastOffers: make([]*RejectSummary, 0, len(rejectReasons))},
+			LastUnusedOffers:       make([]*UnusedOffer, 0),
+		}
+		for _, task := range app.Tasks {
+			if waitingForOffer(task) && task.StagedAt != nil && (item.Since == nil || task.StagedAt.Before(*item.Since)) {
+				item.Since = task.StagedAt
+			}
+		}
+		if m.launchDelayed(app, now) {
+			left := m.delays[app.ID].until.Sub(now)
+			item.Delay = &QueueDelay{TimeLeftSeconds: int(math.Ceil(left.Seconds()))}
+		}
+
+		summary := item.ProcessedOffersSummary
+		stats := m.offerStats[app.ID]
+		if stats == nil {
+			stats = &offerStats{}
+		}
+		summary.ProcessedOffersCount = stats.processed
+		summary.UnusedOffersCount = stats.unused
+		summary.LastUsedOfferAt = stats.lastUsed
+		summary.LastUnusedOfferAt = stats.lastUnused
+		for _, reason := range rejectReasons {
+			summary.RejectSummaryLastOffers = append(summary.RejectSummaryLastOffers,
+				&RejectSummary{Reason: reason, Declined: stats.rejected[reason], Processed: stats.processed})
+		}
+		// Newest first
+		for i := len(stats.unusedLog) - 1; i >= 0; i-- {
+			item.LastUnusedOffers = append(item.LastUnusedOffers, stats.unusedLog[i])
+		}
+
+		queue = append(queue, item)
+	}
+	return queue
+}
+
+// ResetLaunchDelay clears the launch delay of an app so its waiting
+// instances are launched on the next suitable offer
+func (m *Marathon) ResetLaunchDelay(appID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.Applications[appID]; !exists {
+		return fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	delete(m.delays, appID)
+	log.Printf("Reset launch delay of %s", appID)
+	return nil
+}
+
+// handleGetQueue lists the launch queue. Unused offers are only included
+// with embed=lastUnusedOffers, as in Marathon.
+func (m *Marathon) handleGetQueue(w http.ResponseWriter, r *http.Request) {
+	queue := m.LaunchQueue()
+
+	embedUnused := false
+	for _, embed := range r.URL.Query()["embed"] {
+		if embed == "lastUnusedOffers" {
+			embedUnused = true
+		}
+	}
+	if !embedUnused {
+		for _, item := range queue {
+			item.LastUnusedOffers = nil
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]*QueueItem{"queue": queue})
+}
+
+func (m *Marathon) handleResetDelay(w http.ResponseWriter, r *http.Request) {
+	if err := m.ResetLaunchDelay(m.appIDFromRequest(r)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
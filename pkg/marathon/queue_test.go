@@ -0,0 +1,160 @@
+package marathon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarathon_LaunchBackoff(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	app := &Application{ID: "/web", Instances: 1, CPUs: 1.0, BackoffSeconds: 10, BackoffFactor: 2, MaxLaunchDelaySeconds: 30}
+	require.NoError(t, marathon.CreateApp(app))
+
+	now := time.Now()
+	tests := []struct {
+		name  string
+		delay time.Duration
+	}{
+		{"first failure waits backoffSeconds", 10 * time.Second},
+		{"second failure multiplies by backoffFactor", 20 * time.Second},
+		{"delay is capped at maxLaunchDelaySeconds", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed := app.Tasks[0]
+			require.NoError(t, marathon.statusUpdate(failed.ID, "TASK_FAILED", "exit code 1", now))
+
+			assert.Equal(t, tt.delay, marathon.delays["/web"].delay)
+			require.NotNil(t, app.LastTaskFailure)
+			assert.Equal(t, failed.ID, app.LastTaskFailure.TaskID)
+			assert.Equal(t, "TASK_FAILED", app.LastTaskFailure.State)
+			assert.Equal(t, "exit code 1", app.LastTaskFailure.Message)
+
+			// The failed task was replaced
+			require.Len(t, app.Tasks, 1)
+			assert.NotEqual(t, failed.ID, app.Tasks[0].ID)
+		})
+	}
+
+	// Offers are not used while the delay lasts
+	assert.Empty(t, marathon.matchOffers([]*Offer{testOffer(1, "r1")}, now.Add(29*time.Second)))
+	assert.Len(t, marathon.matchOffers([]*Offer{testOffer(2, "r1")}, now.Add(31*time.Second)), 1)
+
+	// A running task of the current version resets the delay
+	require.NoError(t, marathon.statusUpdate(app.Tasks[0].ID, "TASK_RUNNING", "", now))
+	assert.NotContains(t, marathon.delays, "/web")
+	assert.Equal(t, 1, app.TasksRunning)
+}
+
+func TestMarathon_LaunchBackoffNewVersion(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 1, BackoffSeconds: 60}))
+
+	app := marathon.Applications["/web"]
+	now := time.Now()
+	require.NoError(t, marathon.statusUpdate(app.Tasks[0].ID, "TASK_LOST", "agent gone", now))
+	assert.True(t, marathon.launchDelayed(app, now))
+
+	// A new app version starts without the delay of the previous one
+	require.NoError(t, marathon.UpdateApp("/web", &Application{Instances: 1, BackoffSeconds: 60, CPUs: 0.5}))
+	assert.False(t, marathon.launchDelayed(marathon.Applications["/web"], now))
+
+	assert.ErrorIs(t, marathon.StatusUpdate("/missing.0", "TASK_FAILED", ""), ErrTaskNotFound)
+}
+
+func TestMarathon_LaunchQueue(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/big", Instances: 2, CPUs: 8.0, Memory: 128.0}))
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/pinned", Instances: 1, CPUs: 1.0,
+		Constraints: [][]string{{"rack", "CLUSTER", "r2"}}}))
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/small", Instances: 1, CPUs: 1.0}))
+
+	marathon.ResourceOffers([]*Offer{testOffer(1, "r1")})
+
+	queue := marathon.LaunchQueue()
+	require.Len(t, queue, 2)
+
+	big := queue[0]
+	assert.Equal(t, "/big", big.App.ID)
+	assert.Equal(t, 2, big.Count)
+	assert.True(t, big.Delay.Overdue)
+	assert.NotNil(t, big.Since)
+	assert.Equal(t, 1, big.ProcessedOffersSummary.ProcessedOffersCount)
+	assert.Equal(t, 1, big.ProcessedOffersSummary.UnusedOffersCount)
+	require.Len(t, big.LastUnusedOffers, 1)
+	assert.Equal(t, "offer-1", big.LastUnusedOffers[0].Offer.ID)
+	assert.Equal(t, []string{ReasonInsufficientCpus}, big.LastUnusedOffers[0].Reason)
+
+	pinned := queue[1]
+	assert.Equal(t, "/pinned", pinned.App.ID)
+	assert.Equal(t, []string{ReasonUnfulfilledConstraint}, pinned.LastUnusedOffers[0].Reason)
+	for _, summary := range pinned.ProcessedOffersSummary.RejectSummaryLastOffers {
+		declined := 0
+		if summary.Reason == ReasonUnfulfilledConstraint {
+			declined = 1
+		}
+		assert.Equal(t, declined, summary.Declined, summary.Reason)
+		assert.Equal(t, 1, summary.Processed, summary.Reason)
+	}
+}
+
+func TestMarathon_HandleQueue(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/web", Instances: 1, CPUs: 8.0, BackoffSeconds: 60}))
+	marathon.ResourceOffers([]*Offer{testOffer(1, "r1")})
+	router := marathon.setupRoutes()
+
+	tests := []struct {
+		name        string
+		query       string
+		unusedShown bool
+	}{
+		{"without embed", "", false},
+		{"with embedded unused offers", "?embed=lastUnusedOffers", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v2/queue"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var body struct {
+				Queue []*QueueItem `json:"queue"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+			require.Len(t, body.Queue, 1)
+			item := body.Queue[0]
+			assert.Equal(t, "/web", item.App.ID)
+			assert.Equal(t, 1, item.ProcessedOffersSummary.UnusedOffersCount)
+			assert.Equal(t, tt.unusedShown, len(item.LastUnusedOffers) == 1)
+		})
+	}
+
+	// A failure delays the app, and offers are not processed while it waits
+	app := marathon.Applications["/web"]
+	require.NoError(t, marathon.StatusUpdate(app.Tasks[0].ID, "TASK_FAILED", "oom"))
+	marathon.ResourceOffers([]*Offer{testOffer(2, "r1")})
+	queue := marathon.LaunchQueue()
+	require.Len(t, queue, 1)
+	assert.False(t, queue[0].Delay.Overdue)
+	assert.InDelta(t, 60, queue[0].Delay.TimeLeftSeconds, 1)
+	assert.Equal(t, 1, queue[0].ProcessedOffersSummary.ProcessedOffersCount)
+
+	req := httptest.NewRequest("DELETE", "/v2/queue/web/delay", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.False(t, marathon.launchDelayed(app, time.Now()))
+
+	req = httptest.NewRequest("DELETE", "/v2/queue/missing/delay", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
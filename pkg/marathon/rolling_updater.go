@@ -2,43 +2,66 @@ package marathon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"sync"
 	"time"
 )
 
-// RollingUpdater implements rolling update strategies for Marathon applications
+// Defaults for updates that leave the corresponding settings unset
+const (
+	defaultUpdateHealthTimeout = 5 * time.Minute
+	defaultUpdatePollInterval  = time.Second
+)
+
+// maxUpdateHistory limits how many update events are kept
+const maxUpdateHistory = 200
+
+// versionLabel is the app label carrying the NewVersion of an update
+const versionLabel = "version"
+
+// ErrUpdateAborted is returned when an update is aborted through
+// AbortUpdate; the update is then rolled back
+var ErrUpdateAborted = errors.New("update aborted")
+
+// RollingUpdater implements rolling update strategies for Marathon applications.
+// An update makes the new definition the app's current version and then
+// replaces the tasks of older versions according to its strategy.
 type RollingUpdater struct {
-	client         *MarathonClient
-	activeUpdates  map[string]*UpdateState
-	updateHistory  []UpdateEvent
-	mu             sync.RWMutex
+	marathon      *Marathon
+	activeUpdates map[string]*UpdateState
+	updateHistory []UpdateEvent
+	canaryResults map[string][]*CanaryStageResult
+	querier       MetricsQuerier
+	pollInterval  time.Duration
+	mu            sync.RWMutex
 }
 
 // UpdateStrategy defines the update strategy
 type UpdateStrategy string
 
 const (
-	RollingUpdate  UpdateStrategy = "rolling"
+	RollingUpdate   UpdateStrategy = "rolling"
 	BlueGreenUpdate UpdateStrategy = "blue-green"
-	CanaryUpdate   UpdateStrategy = "canary"
-	RecreateUpdate UpdateStrategy = "recreate"
+	CanaryUpdate    UpdateStrategy = "canary"
+	RecreateUpdate  UpdateStrategy = "recreate"
 )
 
 // UpdateConfig defines rolling update parameters
 type UpdateConfig struct {
 	AppID            string
 	Strategy         UpdateStrategy
-	NewVersion       string
-	NewImage         string
-	NewConfig        map[string]string
+	NewVersion       string            // Stored in the app's version label
+	NewImage         string            // Docker image of the new version
+	NewConfig        map[string]string // Environment added to the new version
 	RollingConfig    *RollingConfig
 	CanaryConfig     *CanaryConfig
 	BlueGreenConfig  *BlueGreenConfig
-	HealthCheckDelay time.Duration
-	MaxUnavailable   int
-	MaxSurge         int
+	HealthCheckDelay time.Duration // Wait before checking new tasks
+	MaxUnavailable   int           // Old tasks killed before their replacements are healthy
+	MaxSurge         int           // New tasks started above the instance count
 }
 
 // RollingConfig defines rolling update behavior
@@ -52,11 +75,12 @@ type RollingConfig struct {
 
 // CanaryConfig defines canary deployment behavior
 type CanaryConfig struct {
-	Stages           []CanaryStage // Canary deployment stages
-	TrafficShiftMode string        // "manual" or "automatic"
-	AnalysisInterval time.Duration // Time to analyze each stage
-	SuccessThreshold float64       // Success rate threshold (e.g., 0.99)
-	MetricsQuery     string        // Prometheus query for success rate
+	Stages           []CanaryStage    // Canary deployment stages
+	TrafficShiftMode string           // "manual" or "automatic"
+	AnalysisInterval time.Duration    // Time to analyze each stage
+	SuccessThreshold float64          // Success rate threshold (e.g., 0.99)
+	MetricsQuery     string           // Prometheus query for success rate
+	Metrics          []MetricTemplate // Metrics analyzed per stage, DefaultCanaryMetrics if empty
 }
 
 // CanaryStage defines a single canary stage
@@ -77,74 +101,96 @@ type BlueGreenConfig struct {
 
 // UpdateState tracks the state of an ongoing update
 type UpdateState struct {
-	AppID          string
-	Strategy       UpdateStrategy
-	StartTime      time.Time
-	CurrentStage   string
-	Progress       float64 // 0.0 to 1.0
-	Status         UpdateStatus
-	OldVersion     string
-	NewVersion     string
-	UpdatedTasks   int
-	TotalTasks     int
-	FailedTasks    []string
-	HealthyTasks   []string
-	ErrorMessage   string
+	AppID        string
+	Strategy     UpdateStrategy
+	StartTime    time.Time
+	CurrentStage string
+	Progress     float64 // 0.0 to 1.0
+	Status       UpdateStatus
+	OldVersion   string
+	NewVersion   string
+	UpdatedTasks int
+	TotalTasks   int
+	FailedTasks  []string
+	HealthyTasks []string
+	ErrorMessage string
+	aborted      bool
 }
 
 // UpdateStatus represents update status
 type UpdateStatus string
 
 const (
-	UpdateInProgress UpdateStatus = "in-progress"
-	UpdatePaused     UpdateStatus = "paused"
-	UpdateCompleted  UpdateStatus = "completed"
-	UpdateFailed     UpdateStatus = "failed"
+	UpdateInProgress  UpdateStatus = "in-progress"
+	UpdatePaused      UpdateStatus = "paused"
+	UpdateCompleted   UpdateStatus = "completed"
+	UpdateFailed      UpdateStatus = "failed"
 	UpdateRollingBack UpdateStatus = "rolling-back"
 )
 
 // UpdateEvent records an update event
 type UpdateEvent struct {
-	Timestamp  time.Time
-	AppID      string
-	Strategy   UpdateStrategy
-	Stage      string
-	Action     string
-	Success    bool
-	Message    string
+	Timestamp time.Time
+	AppID     string
+	Strategy  UpdateStrategy
+	Stage     string
+	Action    string
+	Success   bool
+	Message   string
 }
 
 // NewRollingUpdater creates a new rolling updater
-func NewRollingUpdater(client *MarathonClient) *RollingUpdater {
+func NewRollingUpdater(marathon *Marathon) *RollingUpdater {
 	return &RollingUpdater{
-		client:        client,
+		marathon:      marathon,
 		activeUpdates: make(map[string]*UpdateState),
 		updateHistory: []UpdateEvent{},
+		canaryResults: make(map[string][]*CanaryStageResult),
+		pollInterval:  defaultUpdatePollInterval,
 	}
 }
 
-// StartUpdate initiates a rolling update
+// validateUpdateConfig checks that an update names a supported strategy
+// along with the settings it needs
+func validateUpdateConfig(config *UpdateConfig) error {
+	switch config.Strategy {
+	case RollingUpdate, RecreateUpdate:
+	case CanaryUpdate:
+		if config.CanaryConfig == nil || len(config.CanaryConfig.Stages) == 0 {
+			return fmt.Errorf("canary config not specified")
+		}
+	case BlueGreenUpdate:
+		if config.BlueGreenConfig == nil {
+			return fmt.Errorf("blue-green config not specified")
+		}
+	default:
+		return fmt.Errorf("unsupported update strategy: %s", config.Strategy)
+	}
+	return nil
+}
+
+// StartUpdate makes the new version the app's definition and replaces its
+// tasks in the background
 func (ru *RollingUpdater) StartUpdate(ctx context.Context, config *UpdateConfig) error {
+	if err := validateUpdateConfig(config); err != nil {
+		return err
+	}
+
 	ru.mu.Lock()
 	defer ru.mu.Unlock()
 
 	// Check if update already in progress
-	if state, exists := ru.activeUpdates[config.AppID]; exists {
-		if state.Status == UpdateInProgress {
-			return fmt.Errorf("update already in progress for app %s", config.AppID)
-		}
+	if _, exists := ru.activeUpdates[config.AppID]; exists {
+		return fmt.Errorf("update already in progress for app %s", config.AppID)
 	}
 
-	log.Printf("Starting %s update for app %s to version %s",
-		config.Strategy, config.AppID, config.NewVersion)
-
-	// Get current application state
-	app, err := (*ru.client).GetApp(config.AppID)
+	oldVersion, newVersion, instances, err := ru.defineVersion(config)
 	if err != nil {
-		return fmt.Errorf("failed to get app: %w", err)
+		return fmt.Errorf("failed to define new version: %w", err)
 	}
+	log.Printf("Starting %s update for app %s from version %s to %s",
+		config.Strategy, config.AppID, oldVersion, newVersion)
 
-	// Initialize update state
 	state := &UpdateState{
 		AppID:        config.AppID,
 		Strategy:     config.Strategy,
@@ -152,24 +198,137 @@ func (ru *RollingUpdater) StartUpdate(ctx context.Context, config *UpdateConfig)
 		CurrentStage: "initializing",
 		Progress:     0.0,
 		Status:       UpdateInProgress,
-		OldVersion:   "", // Get from app labels
-		NewVersion:   config.NewVersion,
-		TotalTasks:   app.Instances,
+		OldVersion:   oldVersion,
+		NewVersion:   newVersion,
+		TotalTasks:   instances,
 	}
-
 	ru.activeUpdates[config.AppID] = state
+	if config.Strategy == CanaryUpdate {
+		delete(ru.canaryResults, config.AppID)
+	}
 
-	// Execute update asynchronously
+	// The update outlives the caller's request
 	go ru.executeUpdate(context.Background(), config, state)
 
 	return nil
 }
 
+// defineVersion makes the updated definition the app's current version
+// without touching its tasks, which the strategies replace afterwards. A
+// deployment restarting the app is registered for the whole update, so
+// other deployments of the app conflict with it. It returns the previous
+// and new versions and the app's instance count.
+func (ru *RollingUpdater) defineVersion(config *UpdateConfig) (string, string, int, error) {
+	m := ru.marathon
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	app, exists := m.Applications[config.AppID]
+	if !exists || app.Pod != nil {
+		return "", "", 0, fmt.Errorf("%w: %s", ErrAppNotFound, config.AppID)
+	}
+	if conflicts := m.conflictingDeployments([]string{app.ID}); len(conflicts) > 0 {
+		return "", "", 0, fmt.Errorf("%w: %s", ErrDeploymentConflict, conflicts[0].ID)
+	}
+
+	target := snapshotApp(app)
+	if config.NewImage != "" {
+		container := &Container{Type: "DOCKER"}
+		docker := &DockerSpec{}
+		if app.Container != nil {
+			*container = *app.Container
+			if app.Container.Docker != nil {
+				*docker = *app.Container.Docker
+			}
+		}
+		docker.Image = config.NewImage
+		container.Docker = docker
+		target.Container = container
+	}
+	if len(config.NewConfig) > 0 {
+		target.Env = make(map[string]string, len(app.Env)+len(config.NewConfig))
+		for k, v := range app.Env {
+			target.Env[k] = v
+		}
+		for k, v := range config.NewConfig {
+			target.Env[k] = v
+		}
+	}
+	if config.NewVersion != "" {
+		target.Labels = make(map[string]string, len(app.Labels)+1)
+		for k, v := range app.Labels {
+			target.Labels[k] = v
+		}
+		target.Labels[versionLabel] = config.NewVersion
+	}
+
+	oldVersion := app.Version
+	target.Version = m.newVersion()
+	step := &DeploymentStep{Action: ActionRestartApplication, App: app.ID}
+	d := &Deployment{
+		ID:             fmt.Sprintf("deployment-%d", time.Now().UnixNano()),
+		Version:        target.Version,
+		AffectedApps:   []string{app.ID},
+		Steps:          []*DeploymentStep{step},
+		CurrentActions: []*DeploymentAction{{Action: step.Action, App: step.App}},
+		TotalSteps:     1,
+		original:       map[string]*Application{app.ID: snapshotApp(app)},
+		target:         map[string]*Application{app.ID: target},
+		startedAt:      time.Now(),
+		rolling:        true,
+	}
+	m.Deployments[d.ID] = d
+
+	m.recordVersion(target)
+	m.replaceApp(app, target)
+	trackDeployment(target, d)
+	m.publishAPIPost(target)
+	m.publishDeployment(EventDeploymentInfo, d, step, "")
+	return oldVersion, target.Version, target.Instances, nil
+}
+
+// checkDeployment returns ErrDeploymentNotFound once the deployment of an
+// app's update was canceled or superseded. The caller must hold m.mu.
+func (ru *RollingUpdater) checkDeployment(appID string) error {
+	for _, d := range ru.marathon.Deployments {
+		if d.rolling && d.AffectedApps[0] == appID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: update of %s canceled", ErrDeploymentNotFound, appID)
+}
+
+// finishDeployment removes the deployment of an app's update, publishing
+// whether the update succeeded
+func (ru *RollingUpdater) finishDeployment(appID string, err error) {
+	m := ru.marathon
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.Deployments {
+		if !d.rolling || d.AffectedApps[0] != appID {
+			continue
+		}
+		m.removeDeployment(d)
+		d.CurrentActions = []*DeploymentAction{}
+		if err != nil {
+			m.publishDeployment(EventDeploymentFailed, d, nil, err.Error())
+			return
+		}
+		m.publishDeployment(EventDeploymentStepSuccess, d, d.Steps[0], "")
+		d.CurrentStep = d.TotalSteps
+		m.publishDeployment(EventDeploymentSuccess, d, nil, "")
+		return
+	}
+}
+
 // executeUpdate performs the actual update
 func (ru *RollingUpdater) executeUpdate(ctx context.Context, config *UpdateConfig, state *UpdateState) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Update panic for app %s: %v", config.AppID, r)
+			ru.finishDeployment(config.AppID, fmt.Errorf("panic: %v", r))
 			ru.updateStatus(config.AppID, UpdateFailed, fmt.Sprintf("panic: %v", r))
 		}
 	}()
@@ -191,78 +350,132 @@ func (ru *RollingUpdater) executeUpdate(ctx context.Context, config *UpdateConfi
 
 	if err != nil {
 		log.Printf("Update failed for app %s: %v", config.AppID, err)
-		ru.updateStatus(config.AppID, UpdateFailed, err.Error())
+		ru.recordEvent(UpdateEvent{
+			Timestamp: time.Now(),
+			AppID:     config.AppID,
+			Strategy:  config.Strategy,
+			Stage:     ru.currentStage(state),
+			Action:    "update-failed",
+			Success:   false,
+			Message:   err.Error(),
+		})
 
-		// Auto-rollback if configured
-		if config.RollingConfig != nil && config.RollingConfig.AutoRollback {
+		// Failed canaries and aborted updates always roll back, while
+		// canceling the update's deployment already rolled it back
+		ru.finishDeployment(config.AppID, err)
+		autoRollback := config.RollingConfig != nil && config.RollingConfig.AutoRollback
+		if errors.Is(err, ErrDeploymentNotFound) {
+			autoRollback = false
+		}
+		if autoRollback || errors.Is(err, ErrCanaryAnalysisFailed) || errors.Is(err, ErrUpdateAborted) {
 			log.Printf("Auto-rollback triggered for app %s", config.AppID)
-			ru.rollback(ctx, config.AppID, state)
+			if rollbackErr := ru.rollback(ctx, config.AppID, state); rollbackErr != nil {
+				log.Printf("Rollback failed for app %s: %v", config.AppID, rollbackErr)
+			}
 		}
+		ru.updateStatus(config.AppID, UpdateFailed, err.Error())
 	} else {
 		log.Printf("Update completed successfully for app %s", config.AppID)
+		ru.finishDeployment(config.AppID, nil)
+		ru.recordEvent(UpdateEvent{
+			Timestamp: time.Now(),
+			AppID:     config.AppID,
+			Strategy:  config.Strategy,
+			Stage:     ru.currentStage(state),
+			Action:    "update-completed",
+			Success:   true,
+			Message:   fmt.Sprintf("Updated %d tasks to version %s", state.TotalTasks, state.NewVersion),
+		})
 		ru.updateStatus(config.AppID, UpdateCompleted, "")
 	}
 }
 
-// rollingUpdate performs a rolling update
+// rollingUpdate replaces the old tasks in batches
 func (ru *RollingUpdater) rollingUpdate(ctx context.Context, config *UpdateConfig, state *UpdateState) error {
 	log.Printf("Executing rolling update for app %s", config.AppID)
 
-	app, err := (*ru.client).GetApp(config.AppID)
-	if err != nil {
-		return err
+	batchSize := 0
+	if config.RollingConfig != nil {
+		batchSize = config.RollingConfig.BatchSize
 	}
-
-	batchSize := config.RollingConfig.BatchSize
-	if batchSize == 0 {
-		batchSize = max(1, app.Instances/10) // Default: 10% at a time
+	if batchSize <= 0 {
+		batchSize = max(1, state.TotalTasks/10) // Default: 10% at a time
 	}
+	return ru.rollOut(ctx, config, state, batchSize, "batch")
+}
 
-	totalBatches := (app.Instances + batchSize - 1) / batchSize
-
-	for batch := 0; batch < totalBatches; batch++ {
-		state.CurrentStage = fmt.Sprintf("batch %d/%d", batch+1, totalBatches)
-		state.Progress = float64(batch) / float64(totalBatches)
-
-		log.Printf("App %s: Processing batch %d/%d", config.AppID, batch+1, totalBatches)
-
-		// Update batch of tasks
-		// In production, this would:
-		// 1. Kill old tasks
-		// 2. Wait for new tasks to start
-		// 3. Wait for health checks
-		// 4. Verify new tasks are healthy
-
-		// Simulate batch update
-		time.Sleep(config.RollingConfig.PauseTime)
-
-		// Check health of new tasks
-		healthy, err := ru.checkBatchHealth(config.AppID, batchSize)
-		if err != nil || !healthy {
-			return fmt.Errorf("batch %d health check failed", batch+1)
+// rollOut replaces the remaining old tasks in batches of at most batchSize,
+// bounded by the update's surge and unavailability limits
+func (ru *RollingUpdater) rollOut(ctx context.Context, config *UpdateConfig, state *UpdateState, batchSize int, stage string) error {
+	surge, unavailable := updateLimits(config, state.TotalTasks, batchSize)
+	for batch := 1; ru.updatedTasks(state) < state.TotalTasks; batch++ {
+		if err := ru.waitWhilePaused(ctx, config.AppID); err != nil {
+			return err
+		}
+		if batch > 1 && config.RollingConfig != nil {
+			if err := sleepContext(ctx, config.RollingConfig.PauseTime); err != nil {
+				return err
+			}
 		}
 
-		state.UpdatedTasks += batchSize
-		if state.UpdatedTasks > app.Instances {
-			state.UpdatedTasks = app.Instances
+		n := min(batchSize, min(surge+unavailable, state.TotalTasks-ru.updatedTasks(state)))
+		ru.setStage(state, fmt.Sprintf("%s %d", stage, batch))
+		log.Printf("App %s: Processing %s %d with %d tasks", config.AppID, stage, batch, n)
+
+		if err := ru.replaceTasks(ctx, config, state, n, min(n, surge)); err != nil {
+			return fmt.Errorf("%s %d: %w", stage, batch, err)
 		}
 
 		ru.recordEvent(UpdateEvent{
 			Timestamp: time.Now(),
 			AppID:     config.AppID,
 			Strategy:  config.Strategy,
-			Stage:     state.CurrentStage,
+			Stage:     ru.currentStage(state),
 			Action:    "batch-completed",
 			Success:   true,
-			Message:   fmt.Sprintf("Updated %d tasks", batchSize),
+			Message:   fmt.Sprintf("Updated %d tasks", n),
 		})
 	}
+	return nil
+}
+
+// updateLimits returns how many tasks an update may start above the app's
+// instance count and how many may be unavailable. MinHealthyPercent stands
+// in for an unset MaxUnavailable; without either limit a batch of new tasks
+// is started before old tasks are killed.
+func updateLimits(config *UpdateConfig, instances, batchSize int) (surge, unavailable int) {
+	surge, unavailable = max(config.MaxSurge, 0), max(config.MaxUnavailable, 0)
+	if rc := config.RollingConfig; unavailable == 0 && rc != nil && rc.MinHealthyPercent > 0 {
+		unavailable = max(instances-int(math.Ceil(float64(instances)*rc.MinHealthyPercent)), 0)
+	}
+	if surge == 0 && unavailable == 0 {
+		surge = batchSize
+	}
+	return surge, unavailable
+}
 
-	state.Progress = 1.0
+// replaceTasks replaces n old tasks with new ones. The old tasks beyond the
+// surge are killed first, then the new tasks started; once they are healthy
+// the remaining old tasks of the batch are killed.
+func (ru *RollingUpdater) replaceTasks(ctx context.Context, config *UpdateConfig, state *UpdateState, n, surge int) error {
+	if _, err := ru.killOldTasks(config.AppID, state.NewVersion, n-surge); err != nil {
+		return err
+	}
+	if err := ru.startTasks(config.AppID, n); err != nil {
+		return err
+	}
+	if err := ru.waitHealthy(ctx, config, state, ru.updatedTasks(state)+n); err != nil {
+		return err
+	}
+	if _, err := ru.killOldTasks(config.AppID, state.NewVersion, surge); err != nil {
+		return err
+	}
+	ru.addUpdated(state, n)
 	return nil
 }
 
-// canaryUpdate performs a canary deployment
+// canaryUpdate moves a growing share of the tasks to the new version,
+// analyzing each stage before promoting the rest
 func (ru *RollingUpdater) canaryUpdate(ctx context.Context, config *UpdateConfig, state *UpdateState) error {
 	log.Printf("Executing canary update for app %s", config.AppID)
 
@@ -270,48 +483,53 @@ func (ru *RollingUpdater) canaryUpdate(ctx context.Context, config *UpdateConfig
 		return fmt.Errorf("canary config not specified")
 	}
 
-	app, err := (*ru.client).GetApp(config.AppID)
-	if err != nil {
-		return err
-	}
-
 	totalStages := len(config.CanaryConfig.Stages)
 
 	for i, stage := range config.CanaryConfig.Stages {
-		state.CurrentStage = stage.Name
-		state.Progress = float64(i) / float64(totalStages)
+		if err := ru.waitWhilePaused(ctx, config.AppID); err != nil {
+			return err
+		}
+		ru.setStage(state, stage.Name)
 
 		log.Printf("App %s: Canary stage '%s' - %d%% traffic", config.AppID, stage.Name, stage.Weight)
 
 		// Calculate number of canary instances
-		canaryInstances := (app.Instances * stage.Weight) / 100
-		if canaryInstances == 0 {
-			canaryInstances = 1
+		canaryInstances := int(math.Ceil(float64(state.TotalTasks*stage.Weight) / 100))
+		canaryInstances = min(max(canaryInstances, 1), state.TotalTasks)
+		if n := canaryInstances - ru.updatedTasks(state); n > 0 {
+			surge, _ := updateLimits(config, state.TotalTasks, n)
+			if err := ru.replaceTasks(ctx, config, state, n, min(n, surge)); err != nil {
+				return fmt.Errorf("canary stage '%s': %w", stage.Name, err)
+			}
 		}
 
-		// Deploy canary instances
-		// In production:
-		// 1. Create canary deployment with NewImage
-		// 2. Route traffic according to weight
-		// 3. Monitor metrics
-
 		// Wait for analysis
 		log.Printf("Analyzing canary stage '%s' for %v", stage.Name, config.CanaryConfig.AnalysisInterval)
-		time.Sleep(config.CanaryConfig.AnalysisInterval)
-
-		// Check metrics
-		success, err := ru.analyzeCanaryMetrics(config, stage)
-		if err != nil || !success {
-			return fmt.Errorf("canary analysis failed at stage '%s'", stage.Name)
+		if err := sleepContext(ctx, config.CanaryConfig.AnalysisInterval); err != nil {
+			return err
 		}
 
-		// Pause if required
-		if stage.PauseBeforeNext && i < totalStages-1 {
-			state.Status = UpdatePaused
-			log.Printf("Canary paused at stage '%s', waiting for manual approval", stage.Name)
-			// In production, wait for approval via API
-			time.Sleep(30 * time.Second)
-			state.Status = UpdateInProgress
+		// Failed metrics abort the update; inconclusive ones wait for a
+		// manual decision through ResumeUpdate or AbortUpdate
+		result := ru.analyzeCanaryMetrics(ctx, config, state, stage)
+		switch result.Verdict {
+		case VerdictFail:
+			return fmt.Errorf("%w at stage '%s': %s", ErrCanaryAnalysisFailed, stage.Name, result.summary())
+		case VerdictInconclusive:
+			log.Printf("Canary analysis of stage '%s' is inconclusive, waiting for a decision: %s", stage.Name, result.summary())
+			ru.recordEvent(UpdateEvent{
+				Timestamp: time.Now(),
+				AppID:     config.AppID,
+				Strategy:  config.Strategy,
+				Stage:     stage.Name,
+				Action:    "analysis-inconclusive",
+				Success:   false,
+				Message:   result.summary(),
+			})
+			ru.setStatus(config.AppID, UpdatePaused)
+			if err := ru.waitWhilePaused(ctx, config.AppID); err != nil {
+				return err
+			}
 		}
 
 		ru.recordEvent(UpdateEvent{
@@ -323,17 +541,21 @@ func (ru *RollingUpdater) canaryUpdate(ctx context.Context, config *UpdateConfig
 			Success:   true,
 			Message:   fmt.Sprintf("Canary stage %d%% traffic successful", stage.Weight),
 		})
+
+		// Wait for ResumeUpdate before the next stage
+		if stage.PauseBeforeNext && i < totalStages-1 {
+			log.Printf("Canary paused at stage '%s', waiting for manual approval", stage.Name)
+			ru.setStatus(config.AppID, UpdatePaused)
+		}
 	}
 
 	// Promote canary to full deployment
 	log.Printf("Promoting canary to full deployment for app %s", config.AppID)
-	state.CurrentStage = "promotion"
-	state.Progress = 1.0
-
-	return nil
+	return ru.rollOut(ctx, config, state, state.TotalTasks, "promotion")
 }
 
-// blueGreenUpdate performs a blue-green deployment
+// blueGreenUpdate starts a full set of new tasks next to the old ones and
+// kills the old tasks once the new ones are healthy and promoted
 func (ru *RollingUpdater) blueGreenUpdate(ctx context.Context, config *UpdateConfig, state *UpdateState) error {
 	log.Printf("Executing blue-green update for app %s", config.AppID)
 
@@ -342,50 +564,45 @@ func (ru *RollingUpdater) blueGreenUpdate(ctx context.Context, config *UpdateCon
 	}
 
 	// Stage 1: Deploy green environment
-	state.CurrentStage = "deploying-green"
-	state.Progress = 0.25
-
+	ru.setStage(state, "deploying-green")
 	log.Printf("Deploying green environment for app %s", config.AppID)
-	// In production:
-	// 1. Create parallel deployment with NewImage
-	// 2. Wait for all instances to be healthy
-
-	time.Sleep(10 * time.Second)
+	if err := ru.startTasks(config.AppID, state.TotalTasks); err != nil {
+		return err
+	}
+	if err := ru.waitHealthy(ctx, config, state, state.TotalTasks); err != nil {
+		return fmt.Errorf("green environment: %w", err)
+	}
 
 	// Stage 2: Test green environment
-	state.CurrentStage = "testing-green"
-	state.Progress = 0.5
-
+	ru.setStage(state, "testing-green")
 	if config.BlueGreenConfig.TestTrafficWeight > 0 {
 		log.Printf("Routing %d%% test traffic to green", config.BlueGreenConfig.TestTrafficWeight)
-		time.Sleep(config.BlueGreenConfig.PromotionDelay)
+		if err := sleepContext(ctx, config.BlueGreenConfig.PromotionDelay); err != nil {
+			return err
+		}
 	}
 
-	// Stage 3: Promote green to production
-	state.CurrentStage = "promoting-green"
-	state.Progress = 0.75
-
-	if config.BlueGreenConfig.AutoPromote {
-		log.Printf("Auto-promoting green to production for app %s", config.AppID)
-		// Switch traffic from blue to green
-		time.Sleep(5 * time.Second)
-	} else {
-		// Wait for manual promotion
-		state.Status = UpdatePaused
+	// Stage 3: Promote green to production, manually through ResumeUpdate
+	// unless AutoPromote is set
+	ru.setStage(state, "promoting-green")
+	if !config.BlueGreenConfig.AutoPromote {
 		log.Printf("Waiting for manual promotion of app %s", config.AppID)
-		// In production, wait for API call
-		return fmt.Errorf("manual promotion required")
+		ru.setStatus(config.AppID, UpdatePaused)
+		if err := ru.waitWhilePaused(ctx, config.AppID); err != nil {
+			return err
+		}
 	}
+	log.Printf("Promoting green to production for app %s", config.AppID)
+	ru.addUpdated(state, state.TotalTasks)
 
 	// Stage 4: Cleanup old version
-	state.CurrentStage = "cleanup"
-	state.Progress = 1.0
-
+	ru.setStage(state, "cleanup")
 	if !config.BlueGreenConfig.KeepOldVersion {
 		log.Printf("Cleaning up blue environment for app %s", config.AppID)
-		// Remove old deployment
+		if _, err := ru.killOldTasks(config.AppID, state.NewVersion, -1); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
@@ -394,60 +611,223 @@ func (ru *RollingUpdater) recreateUpdate(ctx context.Context, config *UpdateConf
 	log.Printf("Executing recreate update for app %s", config.AppID)
 
 	// Stage 1: Stop all old instances
-	state.CurrentStage = "stopping-old"
-	state.Progress = 0.3
-
-	log.Printf("Stopping all instances of app %s", config.AppID)
-	// Scale to 0
-	time.Sleep(5 * time.Second)
+	ru.setStage(state, "stopping-old")
+	if _, err := ru.killOldTasks(config.AppID, state.NewVersion, -1); err != nil {
+		return err
+	}
 
 	// Stage 2: Start new instances
-	state.CurrentStage = "starting-new"
-	state.Progress = 0.7
-
-	log.Printf("Starting new instances of app %s", config.AppID)
-	// Scale up with new version
-	time.Sleep(10 * time.Second)
+	ru.setStage(state, "starting-new")
+	if err := ru.startTasks(config.AppID, state.TotalTasks); err != nil {
+		return err
+	}
 
 	// Stage 3: Wait for health
-	state.CurrentStage = "health-check"
-	state.Progress = 1.0
-
-	healthy, err := ru.checkBatchHealth(config.AppID, 0)
-	if err != nil || !healthy {
-		return fmt.Errorf("health check failed after recreate")
+	ru.setStage(state, "health-check")
+	if err := ru.waitHealthy(ctx, config, state, state.TotalTasks); err != nil {
+		return fmt.Errorf("health check failed after recreate: %w", err)
 	}
+	ru.addUpdated(state, state.TotalTasks)
+	return nil
+}
 
+// startTasks stages n tasks of the app's current version
+func (ru *RollingUpdater) startTasks(appID string, n int) error {
+	m := ru.marathon
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	app, exists := m.Applications[appID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	if err := ru.checkDeployment(appID); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		m.stageTask(app)
+	}
+	m.updateTaskCounts(app)
 	return nil
 }
 
-// checkBatchHealth checks if a batch of tasks is healthy
-func (ru *RollingUpdater) checkBatchHealth(appID string, batchSize int) (bool, error) {
-	// In production, query Marathon API for task health
-	app, err := (*ru.client).GetApp(appID)
-	if err != nil {
+// killOldTasks kills up to n tasks not running version, all of them if n is
+// negative. Tasks that are not running yet go first, then the newest ones.
+func (ru *RollingUpdater) killOldTasks(appID, version string, n int) ([]string, error) {
+	m := ru.marathon
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	app, exists := m.Applications[appID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	if err := ru.checkDeployment(appID); err != nil {
+		return nil, err
+	}
+
+	victims := make([]*MarathonTask, 0)
+	for _, running := range []bool{false, true} {
+		for i := len(app.Tasks) - 1; i >= 0; i-- {
+			task := app.Tasks[i]
+			if task.Version != version && (task.State == "TASK_RUNNING") == running {
+				victims = append(victims, task)
+			}
+		}
+	}
+	if n >= 0 && n < len(victims) {
+		victims = victims[:n]
+	}
+
+	killed := make([]string, 0, len(victims))
+	for _, task := range victims {
+		m.killAppTask(app, task)
+		killed = append(killed, task.ID)
+	}
+	m.updateTaskCounts(app)
+	return killed, nil
+}
+
+// waitHealthy waits until count tasks of the new version are healthy,
+// polling checkBatchHealth until the health check grace period ends
+func (ru *RollingUpdater) waitHealthy(ctx context.Context, config *UpdateConfig, state *UpdateState, count int) error {
+	timeout := defaultUpdateHealthTimeout
+	if config.RollingConfig != nil && config.RollingConfig.HealthCheckGrace > 0 {
+		timeout = config.RollingConfig.HealthCheckGrace
+	}
+	if err := sleepContext(ctx, config.HealthCheckDelay); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		healthy, err := ru.checkBatchHealth(config.AppID, state.NewVersion, count)
+		if err != nil {
+			return err
+		}
+		if healthy {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%d tasks of version %s not healthy within %s", count, state.NewVersion, timeout)
+		}
+		if err := sleepContext(ctx, ru.pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// checkBatchHealth reports whether at least count tasks of a version are
+// running and pass the app's health checks
+func (ru *RollingUpdater) checkBatchHealth(appID, version string, count int) (bool, error) {
+	m := ru.marathon
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, exists := m.Applications[appID]
+	if !exists {
+		return false, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	if err := ru.checkDeployment(appID); err != nil {
 		return false, err
 	}
+	healthy := 0
+	for _, task := range app.Tasks {
+		if task.Version == version && m.taskHealthy(app, task) {
+			healthy++
+		}
+	}
+	return healthy >= count, nil
+}
 
-	healthPercent := float64(app.TasksHealthy) / float64(app.TasksRunning)
-	return healthPercent >= 0.9, nil
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// analyzeCanaryMetrics analyzes metrics for a canary stage
-func (ru *RollingUpdater) analyzeCanaryMetrics(config *UpdateConfig, stage CanaryStage) (bool, error) {
-	// In production, query Prometheus for success rate, error rate, latency
-	// Compare canary metrics vs baseline
-	log.Printf("Analyzing metrics for canary stage '%s'", stage.Name)
+// waitWhilePaused blocks while an update is paused. It returns
+// ErrUpdateAborted once the update is aborted, and ErrDeploymentNotFound
+// once its deployment is canceled.
+func (ru *RollingUpdater) waitWhilePaused(ctx context.Context, appID string) error {
+	for {
+		ru.mu.RLock()
+		state, exists := ru.activeUpdates[appID]
+		paused := exists && state.Status == UpdatePaused
+		aborted := exists && state.aborted
+		ru.mu.RUnlock()
+		if aborted {
+			return ErrUpdateAborted
+		}
+		if !paused {
+			return nil
+		}
+		if err := ru.deploymentActive(appID); err != nil {
+			return err
+		}
+		if err := sleepContext(ctx, ru.pollInterval); err != nil {
+			return err
+		}
+	}
+}
 
-	// Simulated analysis
-	successRate := 0.995 // 99.5% success rate
+// deploymentActive returns ErrDeploymentNotFound once the deployment of an
+// app's update was canceled or superseded
+func (ru *RollingUpdater) deploymentActive(appID string) error {
+	ru.marathon.mu.RLock()
+	defer ru.marathon.mu.RUnlock()
+	return ru.checkDeployment(appID)
+}
 
-	threshold := config.CanaryConfig.SuccessThreshold
-	if threshold == 0 {
-		threshold = 0.99
+// setStage records the stage an update entered
+func (ru *RollingUpdater) setStage(state *UpdateState, stage string) {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	state.CurrentStage = stage
+}
+
+// currentStage returns the stage of an update
+func (ru *RollingUpdater) currentStage(state *UpdateState) string {
+	ru.mu.RLock()
+	defer ru.mu.RUnlock()
+	return state.CurrentStage
+}
+
+// setStatus changes the status of an active update
+func (ru *RollingUpdater) setStatus(appID string, status UpdateStatus) {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	if state, exists := ru.activeUpdates[appID]; exists {
+		state.Status = status
 	}
+}
 
-	return successRate >= threshold, nil
+// updatedTasks returns how many tasks an update has replaced
+func (ru *RollingUpdater) updatedTasks(state *UpdateState) int {
+	ru.mu.RLock()
+	defer ru.mu.RUnlock()
+	return state.UpdatedTasks
+}
+
+// addUpdated counts replaced tasks towards an update's progress
+func (ru *RollingUpdater) addUpdated(state *UpdateState, n int) {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	state.UpdatedTasks = min(state.UpdatedTasks+n, state.TotalTasks)
+	if state.TotalTasks > 0 {
+		state.Progress = float64(state.UpdatedTasks) / float64(state.TotalTasks)
+	}
 }
 
 // updateStatus updates the status of an update
@@ -458,6 +838,9 @@ func (ru *RollingUpdater) updateStatus(appID string, status UpdateStatus, errorM
 	if state, exists := ru.activeUpdates[appID]; exists {
 		state.Status = status
 		state.ErrorMessage = errorMsg
+		if status == UpdateCompleted {
+			state.Progress = 1.0
+		}
 
 		if status == UpdateCompleted || status == UpdateFailed {
 			// Move to history after completion
@@ -466,31 +849,33 @@ func (ru *RollingUpdater) updateStatus(appID string, status UpdateStatus, errorM
 	}
 }
 
-// rollback rolls back an update
+// rollback redeploys the definition the app had before the update, which
+// replaces the tasks of the new version through a regular deployment
 func (ru *RollingUpdater) rollback(ctx context.Context, appID string, state *UpdateState) error {
-	log.Printf("Rolling back update for app %s", appID)
-
-	state.Status = UpdateRollingBack
-	state.CurrentStage = "rollback"
+	log.Printf("Rolling back update for app %s to version %s", appID, state.OldVersion)
 
-	// In production:
-	// 1. Revert to old version
-	// 2. Scale back to original instance count
-	// 3. Wait for health checks
+	ru.setStatus(appID, UpdateRollingBack)
+	ru.setStage(state, "rollback")
 
-	time.Sleep(10 * time.Second)
+	old, err := ru.marathon.GetAppVersion(appID, state.OldVersion)
+	if err == nil {
+		err = ru.marathon.UpdateApp(appID, old)
+	}
 
-	ru.recordEvent(UpdateEvent{
+	event := UpdateEvent{
 		Timestamp: time.Now(),
 		AppID:     appID,
 		Strategy:  state.Strategy,
 		Stage:     "rollback",
 		Action:    "rollback-completed",
 		Success:   true,
-		Message:   "Rolled back to previous version",
-	})
-
-	return nil
+		Message:   fmt.Sprintf("Rolled back to version %s", state.OldVersion),
+	}
+	if err != nil {
+		event.Action, event.Success, event.Message = "rollback-failed", false, err.Error()
+	}
+	ru.recordEvent(event)
+	return err
 }
 
 // recordEvent records an update event
@@ -499,30 +884,46 @@ func (ru *RollingUpdater) recordEvent(event UpdateEvent) {
 	defer ru.mu.Unlock()
 
 	ru.updateHistory = append(ru.updateHistory, event)
-	if len(ru.updateHistory) > 200 {
-		ru.updateHistory = ru.updateHistory[len(ru.updateHistory)-200:]
+	if len(ru.updateHistory) > maxUpdateHistory {
+		ru.updateHistory = ru.updateHistory[len(ru.updateHistory)-maxUpdateHistory:]
 	}
 }
 
-// GetUpdateState returns the current state of an update
+// GetUpdateState returns a copy of the state of an active update
 func (ru *RollingUpdater) GetUpdateState(appID string) *UpdateState {
 	ru.mu.RLock()
 	defer ru.mu.RUnlock()
 
 	if state, exists := ru.activeUpdates[appID]; exists {
-		return state
+		snapshot := *state
+		return &snapshot
 	}
 	return nil
 }
 
-// GetUpdateHistory returns update history
+// GetUpdateHistory returns the recorded update events, oldest first
 func (ru *RollingUpdater) GetUpdateHistory() []UpdateEvent {
 	ru.mu.RLock()
 	defer ru.mu.RUnlock()
-	return ru.updateHistory
+	return append([]UpdateEvent(nil), ru.updateHistory...)
+}
+
+// GetAppUpdateHistory returns the recorded update events of an app, oldest
+// first
+func (ru *RollingUpdater) GetAppUpdateHistory(appID string) []UpdateEvent {
+	ru.mu.RLock()
+	defer ru.mu.RUnlock()
+
+	events := make([]UpdateEvent, 0)
+	for _, event := range ru.updateHistory {
+		if event.AppID == appID {
+			events = append(events, event)
+		}
+	}
+	return events
 }
 
-// PauseUpdate pauses an ongoing update
+// PauseUpdate pauses an ongoing update before its next batch or stage
 func (ru *RollingUpdater) PauseUpdate(appID string) error {
 	ru.mu.Lock()
 	defer ru.mu.Unlock()
@@ -537,7 +938,8 @@ func (ru *RollingUpdater) PauseUpdate(appID string) error {
 	return fmt.Errorf("no active update for app %s", appID)
 }
 
-// ResumeUpdate resumes a paused update
+// ResumeUpdate resumes a paused update. It also approves the next canary
+// stage and promotes a blue-green update waiting for manual promotion.
 func (ru *RollingUpdater) ResumeUpdate(appID string) error {
 	ru.mu.Lock()
 	defer ru.mu.Unlock()
@@ -551,3 +953,17 @@ func (ru *RollingUpdater) ResumeUpdate(appID string) error {
 	}
 	return fmt.Errorf("no paused update for app %s", appID)
 }
+
+// AbortUpdate stops an update before its next batch or stage and rolls the
+// app back to its previous version
+func (ru *RollingUpdater) AbortUpdate(appID string) error {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+
+	if state, exists := ru.activeUpdates[appID]; exists && !state.aborted {
+		state.aborted = true
+		log.Printf("Aborting update for app %s", appID)
+		return nil
+	}
+	return fmt.Errorf("no active update for app %s", appID)
+}
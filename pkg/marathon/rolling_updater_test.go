@@ -2,85 +2,171 @@ package marathon
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
-// Type alias for compatibility
-type MarathonApp = Application
-
-func createMockClient(t *testing.T) *MarathonClient {
-	mockClient := &MockMarathonClient{}
-	// Setup default behavior
-	mockClient.On("GetApp", mock.Anything).Return(&Application{
-		ID:           "/test-app",
-		Instances:    3,
-		TasksRunning: 3,
-		TasksHealthy: 3,
-	}, nil)
-	var clientInterface MarathonClient = mockClient
-	return &clientInterface
+// updateBounds records the largest task count and the fewest running tasks
+// of an app seen while an update runs
+type updateBounds struct {
+	mu         sync.Mutex
+	maxTasks   int
+	minRunning int
+}
+
+// newTestUpdater creates a Marathon running app with all tasks started and
+// an updater polling it quickly. With monitor set, tasks staged later start
+// running in the background as with a running Marathon.
+func newTestUpdater(t *testing.T, app *Application, monitor bool) (*Marathon, *RollingUpdater, *updateBounds) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(app))
+	marathon.monitorTasks()
+	require.Empty(t, marathon.Deployments)
+
+	updater := NewRollingUpdater(marathon)
+	updater.pollInterval = time.Millisecond
+
+	bounds := &updateBounds{maxTasks: app.Instances, minRunning: app.Instances}
+	if monitor {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+		go func() {
+			defer close(done)
+			for sleepContext(ctx, time.Millisecond) == nil {
+				marathon.monitorTasks()
+				marathon.mu.RLock()
+				bounds.mu.Lock()
+				bounds.maxTasks = max(bounds.maxTasks, len(app.Tasks))
+				bounds.minRunning = min(bounds.minRunning, app.TasksRunning)
+				bounds.mu.Unlock()
+				marathon.mu.RUnlock()
+			}
+		}()
+	}
+	return marathon, updater, bounds
+}
+
+// waitForUpdate waits until an app's update is no longer active
+func waitForUpdate(t *testing.T, updater *RollingUpdater, appID string) {
+	require.Eventually(t, func() bool { return updater.GetUpdateState(appID) == nil }, 5*time.Second, time.Millisecond)
+}
+
+// waitForStatus waits until an app's update reaches a status
+func waitForStatus(t *testing.T, updater *RollingUpdater, appID string, status UpdateStatus) *UpdateState {
+	var state *UpdateState
+	require.Eventually(t, func() bool {
+		state = updater.GetUpdateState(appID)
+		return state != nil && state.Status == status
+	}, 5*time.Second, time.Millisecond)
+	return state
+}
+
+// appTaskVersions counts the tasks of an app by version
+func appTaskVersions(marathon *Marathon, appID string) map[string]int {
+	marathon.mu.RLock()
+	defer marathon.mu.RUnlock()
+
+	versions := make(map[string]int)
+	for _, task := range marathon.Applications[appID].Tasks {
+		versions[task.Version]++
+	}
+	return versions
+}
+
+// updateActions lists the actions of an app's update events
+func updateActions(updater *RollingUpdater, appID string) []string {
+	actions := make([]string, 0)
+	for _, event := range updater.GetAppUpdateHistory(appID) {
+		actions = append(actions, event.Action)
+	}
+	return actions
 }
 
 // TestNewRollingUpdater tests creating a new rolling updater
 func TestNewRollingUpdater(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	updater := NewRollingUpdater(marathon)
 
 	assert.NotNil(t, updater)
+	assert.Same(t, marathon, updater.marathon)
 	assert.NotNil(t, updater.activeUpdates)
 	assert.NotNil(t, updater.updateHistory)
 	assert.Equal(t, 0, len(updater.activeUpdates))
 }
 
-// TestStartUpdate_RollingStrategy tests starting a rolling update
+// TestStartUpdate_RollingStrategy tests replacing tasks batch by batch
 func TestStartUpdate_RollingStrategy(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	app := &Application{ID: "/test-app", Instances: 4, CPUs: 0.5, Env: map[string]string{"MODE": "prod"}}
+	marathon, updater, bounds := newTestUpdater(t, app, true)
+	oldVersion := app.Version
 
 	config := &UpdateConfig{
 		AppID:      "/test-app",
 		Strategy:   RollingUpdate,
 		NewVersion: "v2.0.0",
 		NewImage:   "myapp:v2",
+		NewConfig:  map[string]string{"FEATURE": "on"},
+		MaxSurge:   1,
 		RollingConfig: &RollingConfig{
 			BatchSize:         2,
-			MinHealthyPercent: 0.8,
-			PauseTime:         100 * time.Millisecond,
-			AutoRollback:      false,
+			MinHealthyPercent: 0.75,
+			PauseTime:         time.Millisecond,
 		},
 	}
 
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	// Wait for update to start
-	time.Sleep(50 * time.Millisecond)
-
-	// Check update state
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
 	state := updater.GetUpdateState("/test-app")
-	assert.NotNil(t, state)
-	assert.Equal(t, "/test-app", state.AppID)
+	require.NotNil(t, state)
 	assert.Equal(t, RollingUpdate, state.Strategy)
+	assert.Equal(t, oldVersion, state.OldVersion)
+	newVersion := state.NewVersion
+	assert.NotEqual(t, oldVersion, newVersion)
+
+	marathon.mu.RLock()
+	assert.Len(t, marathon.Deployments, 1)
+	marathon.mu.RUnlock()
+	waitForUpdate(t, updater, "/test-app")
+
+	assert.Equal(t, map[string]int{newVersion: 4}, appTaskVersions(marathon, "/test-app"))
+	marathon.mu.RLock()
+	assert.Empty(t, marathon.Deployments)
+	marathon.mu.RUnlock()
+	current := marathon.Applications["/test-app"]
+	assert.Equal(t, newVersion, current.Version)
+	assert.Equal(t, "myapp:v2", current.Container.Docker.Image)
+	assert.Equal(t, map[string]string{"MODE": "prod", "FEATURE": "on"}, current.Env)
+	assert.Equal(t, "v2.0.0", current.Labels[versionLabel])
+
+	// One task may surge and one may be unavailable per batch
+	bounds.mu.Lock()
+	assert.LessOrEqual(t, bounds.maxTasks, 5)
+	assert.GreaterOrEqual(t, bounds.minRunning, 3)
+	bounds.mu.Unlock()
+
+	assert.Equal(t, []string{"batch-completed", "batch-completed", "update-completed"}, updateActions(updater, "/test-app"))
+
+	versions, err := marathon.ListAppVersions("/test-app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{newVersion, oldVersion}, versions)
 }
 
 // TestStartUpdate_AlreadyInProgress tests starting update when one is already running
 func TestStartUpdate_AlreadyInProgress(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	_, updater, _ := newTestUpdater(t, &Application{ID: "/test-app", Instances: 1, CPUs: 0.5}, false)
 
 	config := &UpdateConfig{
-		AppID:      "/test-app",
-		Strategy:   RollingUpdate,
-		NewVersion: "v2.0.0",
-		RollingConfig: &RollingConfig{
-			BatchSize: 1,
-			PauseTime: 100 * time.Millisecond,
-		},
+		AppID:         "/test-app",
+		Strategy:      RollingUpdate,
+		NewVersion:    "v2.0.0",
+		RollingConfig: &RollingConfig{BatchSize: 1, HealthCheckGrace: 20 * time.Millisecond},
 	}
 
 	err := updater.StartUpdate(context.Background(), config)
@@ -90,12 +176,62 @@ func TestStartUpdate_AlreadyInProgress(t *testing.T) {
 	err = updater.StartUpdate(context.Background(), config)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "already in progress")
+
+	waitForUpdate(t, updater, "/test-app")
+}
+
+// TestStartUpdate_AppNotFound tests updating an unknown app
+func TestStartUpdate_AppNotFound(t *testing.T) {
+	updater := NewRollingUpdater(NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050"))
+
+	err := updater.StartUpdate(context.Background(), &UpdateConfig{AppID: "/missing", Strategy: RecreateUpdate})
+	assert.ErrorIs(t, err, ErrAppNotFound)
+	assert.Nil(t, updater.GetUpdateState("/missing"))
+}
+
+// TestStartUpdate_DeploymentInProgress tests that updates do not race the
+// deployment engine
+func TestStartUpdate_DeploymentInProgress(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/test-app", Instances: 1, CPUs: 0.5}))
+	updater := NewRollingUpdater(marathon)
+
+	err := updater.StartUpdate(context.Background(), &UpdateConfig{AppID: "/test-app", Strategy: RecreateUpdate})
+	assert.ErrorIs(t, err, ErrDeploymentConflict)
+}
+
+// TestStartUpdate_LocksApp tests that an update holds a deployment of its
+// app until it finishes, and stops once that deployment is canceled
+func TestStartUpdate_LocksApp(t *testing.T) {
+	marathon, updater, _ := newTestUpdater(t, &Application{ID: "/locked-app", Instances: 2, CPUs: 0.5}, true)
+	config := &UpdateConfig{AppID: "/locked-app", Strategy: BlueGreenUpdate, BlueGreenConfig: &BlueGreenConfig{}}
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	waitForStatus(t, updater, "/locked-app", UpdatePaused)
+
+	marathon.mu.RLock()
+	require.Len(t, marathon.Deployments, 1)
+	var deployment *Deployment
+	for _, d := range marathon.Deployments {
+		deployment = d
+	}
+	marathon.mu.RUnlock()
+	assert.Equal(t, []string{"/locked-app"}, deployment.AffectedApps)
+
+	_, err := marathon.scaleAppDeployment("/locked-app", 3, false)
+	assert.ErrorIs(t, err, ErrDeploymentConflict)
+
+	// Canceling the deployment rolls the app back instead of the update
+	rollback, err := marathon.CancelDeployment(deployment.ID, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, deployment.ID, rollback.ID)
+	waitForUpdate(t, updater, "/locked-app")
+	assert.Equal(t, []string{"update-failed"}, updateActions(updater, "/locked-app"))
 }
 
-// TestStartUpdate_CanaryStrategy tests canary deployment
+// TestStartUpdate_CanaryStrategy tests canary stages with manual approval
 func TestStartUpdate_CanaryStrategy(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	marathon, updater, _ := newTestUpdater(t, &Application{ID: "/canary-app", Instances: 4, CPUs: 0.5}, true)
+	oldVersion := marathon.Applications["/canary-app"].Version
 
 	config := &UpdateConfig{
 		AppID:      "/canary-app",
@@ -103,58 +239,124 @@ func TestStartUpdate_CanaryStrategy(t *testing.T) {
 		NewVersion: "v2.0.0",
 		CanaryConfig: &CanaryConfig{
 			Stages: []CanaryStage{
-				{Name: "stage-1", Weight: 10, Duration: 50 * time.Millisecond},
-				{Name: "stage-2", Weight: 50, Duration: 50 * time.Millisecond},
+				{Name: "stage-1", Weight: 10, PauseBeforeNext: true},
+				{Name: "stage-2", Weight: 50},
 			},
-			AnalysisInterval: 20 * time.Millisecond,
+			AnalysisInterval: time.Millisecond,
 			SuccessThreshold: 0.99,
 		},
 	}
 
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
 
-	time.Sleep(100 * time.Millisecond)
+	// The first stage runs a single canary task and waits for approval
+	state := waitForStatus(t, updater, "/canary-app", UpdatePaused)
+	assert.Equal(t, "stage-1", state.CurrentStage)
+	assert.Equal(t, 1, state.UpdatedTasks)
+	assert.Equal(t, map[string]int{oldVersion: 3, state.NewVersion: 1}, appTaskVersions(marathon, "/canary-app"))
 
-	state := updater.GetUpdateState("/canary-app")
-	if state != nil {
-		assert.Equal(t, CanaryUpdate, state.Strategy)
-		t.Logf("Canary update state: %+v", state)
-	}
+	require.NoError(t, updater.ResumeUpdate("/canary-app"))
+	waitForUpdate(t, updater, "/canary-app")
+
+	assert.Equal(t, map[string]int{state.NewVersion: 4}, appTaskVersions(marathon, "/canary-app"))
+	assert.Equal(t, []string{"stage-completed", "stage-completed", "batch-completed", "update-completed"},
+		updateActions(updater, "/canary-app"))
 }
 
-// TestStartUpdate_BlueGreenStrategy tests blue-green deployment
-func TestStartUpdate_BlueGreenStrategy(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+// TestStartUpdate_RecoverAfterFailover tests that an update interrupted by
+// a failover is finished by the new leader
+func TestStartUpdate_RecoverAfterFailover(t *testing.T) {
+	marathon, updater, _ := newTestUpdater(t, &Application{ID: "/failover-app", Instances: 4, CPUs: 0.5}, true)
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	marathon.mu.Lock()
+	marathon.Store = store
+	marathon.mu.Unlock()
 
 	config := &UpdateConfig{
-		AppID:      "/bluegreen-app",
-		Strategy:   BlueGreenUpdate,
-		NewVersion: "v2.0.0",
-		BlueGreenConfig: &BlueGreenConfig{
-			AutoPromote:       true,
-			PromotionDelay:    50 * time.Millisecond,
-			KeepOldVersion:    false,
-			TestTrafficWeight: 20,
+		AppID:    "/failover-app",
+		Strategy: CanaryUpdate,
+		CanaryConfig: &CanaryConfig{
+			Stages:           []CanaryStage{{Name: "stage-1", Weight: 25, PauseBeforeNext: true}, {Name: "stage-2", Weight: 100}},
+			AnalysisInterval: time.Millisecond,
+			SuccessThreshold: 0.99,
 		},
 	}
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	state := waitForStatus(t, updater, "/failover-app", UpdatePaused)
+	marathon.flush()
+	marathon.mu.Lock()
+	marathon.Store = nil
+	marathon.mu.Unlock()
+
+	// The new leader has no updater and stages the missing tasks of the
+	// new version next to the old ones
+	after := newStoredMarathon(t, store)
+	require.NoError(t, after.Recover())
+	require.Len(t, after.Deployments, 1)
+	assert.Equal(t, map[string]int{state.OldVersion: 3, state.NewVersion: 4}, appTaskVersions(after, "/failover-app"))
+
+	// The old tasks are killed once the new ones are ready
+	completeDeployments(t, after)
+	assert.Equal(t, map[string]int{state.NewVersion: 4}, appTaskVersions(after, "/failover-app"))
+	assert.Empty(t, after.Applications["/failover-app"].Deployments)
+}
 
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(100 * time.Millisecond)
-
-	state := updater.GetUpdateState("/bluegreen-app")
-	if state != nil {
-		assert.Equal(t, BlueGreenUpdate, state.Strategy)
+// TestStartUpdate_BlueGreenStrategy tests blue-green deployments
+func TestStartUpdate_BlueGreenStrategy(t *testing.T) {
+	tests := []struct {
+		name           string
+		autoPromote    bool
+		keepOldVersion bool
+		oldTasks       int
+	}{
+		{"auto promotion", true, false, 0},
+		{"manual promotion", false, false, 0},
+		{"keep old version", true, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marathon, updater, bounds := newTestUpdater(t, &Application{ID: "/bluegreen-app", Instances: 2, CPUs: 0.5}, true)
+			oldVersion := marathon.Applications["/bluegreen-app"].Version
+
+			config := &UpdateConfig{
+				AppID:    "/bluegreen-app",
+				Strategy: BlueGreenUpdate,
+				BlueGreenConfig: &BlueGreenConfig{
+					AutoPromote:       tt.autoPromote,
+					KeepOldVersion:    tt.keepOldVersion,
+					PromotionDelay:    time.Millisecond,
+					TestTrafficWeight: 20,
+				},
+			}
+			require.NoError(t, updater.StartUpdate(context.Background(), config))
+			newVersion := updater.GetUpdateState("/bluegreen-app").NewVersion
+
+			if !tt.autoPromote {
+				state := waitForStatus(t, updater, "/bluegreen-app", UpdatePaused)
+				assert.Equal(t, "promoting-green", state.CurrentStage)
+				assert.Equal(t, map[string]int{oldVersion: 2, newVersion: 2}, appTaskVersions(marathon, "/bluegreen-app"))
+				require.NoError(t, updater.ResumeUpdate("/bluegreen-app"))
+			}
+			waitForUpdate(t, updater, "/bluegreen-app")
+
+			want := map[string]int{newVersion: 2}
+			if tt.oldTasks > 0 {
+				want[oldVersion] = tt.oldTasks
+			}
+			assert.Equal(t, want, appTaskVersions(marathon, "/bluegreen-app"))
+
+			// The blue tasks keep running until green is promoted
+			bounds.mu.Lock()
+			assert.Equal(t, 2, bounds.minRunning)
+			bounds.mu.Unlock()
+		})
 	}
 }
 
 // TestStartUpdate_RecreateStrategy tests recreate deployment
 func TestStartUpdate_RecreateStrategy(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	marathon, updater, bounds := newTestUpdater(t, &Application{ID: "/recreate-app", Instances: 3, CPUs: 0.5}, true)
 
 	config := &UpdateConfig{
 		AppID:      "/recreate-app",
@@ -162,121 +364,93 @@ func TestStartUpdate_RecreateStrategy(t *testing.T) {
 		NewVersion: "v2.0.0",
 	}
 
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	newVersion := updater.GetUpdateState("/recreate-app").NewVersion
+	waitForUpdate(t, updater, "/recreate-app")
 
-	time.Sleep(100 * time.Millisecond)
-
-	state := updater.GetUpdateState("/recreate-app")
-	if state != nil {
-		assert.Equal(t, RecreateUpdate, state.Strategy)
-	}
+	assert.Equal(t, map[string]int{newVersion: 3}, appTaskVersions(marathon, "/recreate-app"))
+	bounds.mu.Lock()
+	assert.Equal(t, 3, bounds.maxTasks)
+	bounds.mu.Unlock()
 }
 
 // TestGetUpdateHistory tests getting update history
 func TestGetUpdateHistory(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	updater := NewRollingUpdater(NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050"))
 
 	// Add some history
-	updater.recordEvent(UpdateEvent{
-		Timestamp: time.Now(),
-		AppID:     "/app1",
-		Strategy:  RollingUpdate,
-		Stage:     "batch-1",
-		Action:    "completed",
-		Success:   true,
-	})
+	for _, appID := range []string{"/app1", "/app2", "/app1"} {
+		updater.recordEvent(UpdateEvent{
+			Timestamp: time.Now(),
+			AppID:     appID,
+			Strategy:  RollingUpdate,
+			Stage:     "batch-1",
+			Action:    "completed",
+			Success:   true,
+		})
+	}
 
 	history := updater.GetUpdateHistory()
-	assert.Equal(t, 1, len(history))
+	assert.Equal(t, 3, len(history))
 	assert.Equal(t, "/app1", history[0].AppID)
+	assert.Len(t, updater.GetAppUpdateHistory("/app1"), 2)
+	assert.Empty(t, updater.GetAppUpdateHistory("/app3"))
+
+	// The returned history is a copy
+	history[0].AppID = "/changed"
+	assert.Equal(t, "/app1", updater.GetUpdateHistory()[0].AppID)
 }
 
 // TestGetUpdateState_NonExistent tests getting state for non-existent update
 func TestGetUpdateState_NonExistent(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	updater := NewRollingUpdater(NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050"))
 
 	state := updater.GetUpdateState("/nonexistent")
 	assert.Nil(t, state)
 }
 
-// TestPauseUpdate tests pausing an update
-func TestPauseUpdate(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+// TestPauseResumeUpdate tests pausing an update before its next batch
+func TestPauseResumeUpdate(t *testing.T) {
+	marathon, updater, _ := newTestUpdater(t, &Application{ID: "/pause-app", Instances: 2, CPUs: 0.5}, false)
+	oldVersion := marathon.Applications["/pause-app"].Version
 
 	config := &UpdateConfig{
-		AppID:      "/pause-app",
-		Strategy:   RollingUpdate,
-		NewVersion: "v2.0.0",
-		RollingConfig: &RollingConfig{
-			BatchSize: 1,
-			PauseTime: 1 * time.Second,
-		},
-	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(50 * time.Millisecond)
-
-	err = updater.PauseUpdate("/pause-app")
-	assert.NoError(t, err)
-
-	state := updater.GetUpdateState("/pause-app")
-	if state != nil {
-		assert.Equal(t, UpdatePaused, state.Status)
+		AppID:         "/pause-app",
+		Strategy:      RollingUpdate,
+		RollingConfig: &RollingConfig{BatchSize: 1},
 	}
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	require.NoError(t, updater.PauseUpdate("/pause-app"))
+	assert.Equal(t, UpdatePaused, updater.GetUpdateState("/pause-app").Status)
+
+	// No batch starts while paused
+	newVersion := updater.GetUpdateState("/pause-app").NewVersion
+	time.Sleep(20 * time.Millisecond)
+	marathon.monitorTasks()
+	assert.Equal(t, 0, updater.GetUpdateState("/pause-app").UpdatedTasks)
+	assert.Equal(t, map[string]int{oldVersion: 2}, appTaskVersions(marathon, "/pause-app"))
+
+	require.NoError(t, updater.ResumeUpdate("/pause-app"))
+	assert.Equal(t, UpdateInProgress, updater.GetUpdateState("/pause-app").Status)
+	require.Eventually(t, func() bool {
+		marathon.monitorTasks()
+		return updater.GetUpdateState("/pause-app") == nil
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, map[string]int{newVersion: 2}, appTaskVersions(marathon, "/pause-app"))
 }
 
 // TestPauseUpdate_NoActiveUpdate tests pausing when no update exists
 func TestPauseUpdate_NoActiveUpdate(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	updater := NewRollingUpdater(NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050"))
 
 	err := updater.PauseUpdate("/nonexistent")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no active update")
 }
 
-// TestResumeUpdate tests resuming a paused update
-func TestResumeUpdate(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/resume-app",
-		Strategy:   RollingUpdate,
-		NewVersion: "v2.0.0",
-		RollingConfig: &RollingConfig{
-			BatchSize: 1,
-			PauseTime: 1 * time.Second,
-		},
-	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(50 * time.Millisecond)
-
-	err = updater.PauseUpdate("/resume-app")
-	require.NoError(t, err)
-
-	err = updater.ResumeUpdate("/resume-app")
-	assert.NoError(t, err)
-
-	state := updater.GetUpdateState("/resume-app")
-	if state != nil {
-		assert.Equal(t, UpdateInProgress, state.Status)
-	}
-}
-
 // TestResumeUpdate_NoPausedUpdate tests resuming when no paused update exists
 func TestResumeUpdate_NoPausedUpdate(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	updater := NewRollingUpdater(NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050"))
 
 	err := updater.ResumeUpdate("/nonexistent")
 	assert.Error(t, err)
@@ -285,8 +459,7 @@ func TestResumeUpdate_NoPausedUpdate(t *testing.T) {
 
 // TestRecordEvent tests event recording
 func TestRecordEvent(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
+	updater := NewRollingUpdater(NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050"))
 
 	// Record events
 	for i := 0; i < 250; i++ {
@@ -301,195 +474,90 @@ func TestRecordEvent(t *testing.T) {
 
 	history := updater.GetUpdateHistory()
 	// Should be capped at 200
-	assert.LessOrEqual(t, len(history), 200)
+	assert.Equal(t, maxUpdateHistory, len(history))
 }
 
-// TestUpdateStrategy_UnsupportedStrategy tests unsupported strategy
-func TestUpdateStrategy_UnsupportedStrategy(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/test-app",
-		Strategy:   UpdateStrategy("unsupported"),
-		NewVersion: "v2.0.0",
-	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	// Wait for update to process
-	time.Sleep(100 * time.Millisecond)
-
-	// Should have failed
-	state := updater.GetUpdateState("/test-app")
-	assert.Nil(t, state, "Failed update should be removed from active updates")
-}
-
-// TestCanaryUpdate_MissingConfig tests canary without config
-func TestCanaryUpdate_MissingConfig(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/canary-missing",
-		Strategy:   CanaryUpdate,
-		NewVersion: "v2.0.0",
-		// Missing CanaryConfig
-	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(100 * time.Millisecond)
-}
-
-// TestBlueGreenUpdate_MissingConfig tests blue-green without config
-func TestBlueGreenUpdate_MissingConfig(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/bluegreen-missing",
-		Strategy:   BlueGreenUpdate,
-		NewVersion: "v2.0.0",
-		// Missing BlueGreenConfig
-	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(100 * time.Millisecond)
-}
-
-// TestRollingUpdate_DefaultBatchSize tests rolling update with default batch size
-func TestRollingUpdate_DefaultBatchSize(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/default-batch",
-		Strategy:   RollingUpdate,
-		NewVersion: "v2.0.0",
-		RollingConfig: &RollingConfig{
-			// BatchSize: 0, // Default should be calculated
-			PauseTime: 10 * time.Millisecond,
-		},
+// TestStartUpdate_InvalidConfig tests strategies lacking their settings
+func TestStartUpdate_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy UpdateStrategy
+		want     string
+	}{
+		{"unsupported strategy", UpdateStrategy("unsupported"), "unsupported update strategy"},
+		{"canary without config", CanaryUpdate, "canary config not specified"},
+		{"blue-green without config", BlueGreenUpdate, "blue-green config not specified"},
 	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(100 * time.Millisecond)
-}
-
-// TestCanaryUpdate_WithPause tests canary with manual pause
-func TestCanaryUpdate_WithPause(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/canary-pause",
-		Strategy:   CanaryUpdate,
-		NewVersion: "v2.0.0",
-		CanaryConfig: &CanaryConfig{
-			Stages: []CanaryStage{
-				{Name: "stage-1", Weight: 10, Duration: 10 * time.Millisecond, PauseBeforeNext: true},
-				{Name: "stage-2", Weight: 100, Duration: 10 * time.Millisecond},
-			},
-			AnalysisInterval: 5 * time.Millisecond,
-		},
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marathon, updater, _ := newTestUpdater(t, &Application{ID: "/test-app", Instances: 1, CPUs: 0.5}, false)
+			version := marathon.Applications["/test-app"].Version
+
+			err := updater.StartUpdate(context.Background(), &UpdateConfig{AppID: "/test-app", Strategy: tt.strategy})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.Nil(t, updater.GetUpdateState("/test-app"))
+			assert.Equal(t, version, marathon.Applications["/test-app"].Version)
+		})
 	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(100 * time.Millisecond)
 }
 
-// TestBlueGreenUpdate_ManualPromotion tests blue-green with manual promotion
-func TestBlueGreenUpdate_ManualPromotion(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/bluegreen-manual",
-		Strategy:   BlueGreenUpdate,
-		NewVersion: "v2.0.0",
-		BlueGreenConfig: &BlueGreenConfig{
-			AutoPromote:    false, // Manual promotion
-			PromotionDelay: 10 * time.Millisecond,
-		},
+// TestUpdateLimits tests the surge and unavailability limits of batches
+func TestUpdateLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *UpdateConfig
+		surge       int
+		unavailable int
+	}{
+		{"defaults to a surge of one batch", &UpdateConfig{}, 3, 0},
+		{"explicit limits", &UpdateConfig{MaxSurge: 1, MaxUnavailable: 2}, 1, 2},
+		{"min healthy percent", &UpdateConfig{RollingConfig: &RollingConfig{MinHealthyPercent: 0.8}}, 0, 2},
+		{"max unavailable wins over min healthy", &UpdateConfig{MaxUnavailable: 1, RollingConfig: &RollingConfig{MinHealthyPercent: 0.5}}, 0, 1},
+		{"full health required", &UpdateConfig{RollingConfig: &RollingConfig{MinHealthyPercent: 1}}, 3, 0},
 	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(100 * time.Millisecond)
-}
-
-// TestBlueGreenUpdate_KeepOldVersion tests keeping old version
-func TestBlueGreenUpdate_KeepOldVersion(t *testing.T) {
-	client := createMockClient(t)
-	updater := NewRollingUpdater(client)
-
-	config := &UpdateConfig{
-		AppID:      "/bluegreen-keep",
-		Strategy:   BlueGreenUpdate,
-		NewVersion: "v2.0.0",
-		BlueGreenConfig: &BlueGreenConfig{
-			AutoPromote:    true,
-			KeepOldVersion: true, // Keep old version
-			PromotionDelay: 10 * time.Millisecond,
-		},
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surge, unavailable := updateLimits(tt.config, 10, 3)
+			assert.Equal(t, tt.surge, surge)
+			assert.Equal(t, tt.unavailable, unavailable)
+		})
 	}
-
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
-
-	time.Sleep(200 * time.Millisecond)
 }
 
 // TestRollingUpdate_AutoRollback tests auto-rollback on failure
 func TestRollingUpdate_AutoRollback(t *testing.T) {
-	// Create a client that will fail health checks
-	mockClient := &MockMarathonClient{}
-	mockClient.On("GetApp", mock.Anything).Return(&Application{
-		ID:           "/rollback-app",
-		Instances:    3,
-		TasksRunning: 3,
-		TasksHealthy: 1, // Low health will cause failure
-	}, nil)
-	var clientInterface MarathonClient = mockClient
-	client := &clientInterface
-
-	updater := NewRollingUpdater(client)
+	app := &Application{ID: "/rollback-app", Instances: 2, CPUs: 0.5,
+		Container: &Container{Type: "DOCKER", Docker: &DockerSpec{Image: "myapp:v1"}}}
+	// Without monitoring the new tasks never start
+	marathon, updater, _ := newTestUpdater(t, app, false)
+	oldVersion := app.Version
 
 	config := &UpdateConfig{
-		AppID:      "/rollback-app",
-		Strategy:   RollingUpdate,
-		NewVersion: "v2.0.0",
+		AppID:    "/rollback-app",
+		Strategy: RollingUpdate,
+		NewImage: "myapp:v2",
 		RollingConfig: &RollingConfig{
-			BatchSize:    1,
-			PauseTime:    10 * time.Millisecond,
-			AutoRollback: true, // Enable auto-rollback
+			BatchSize:        1,
+			HealthCheckGrace: 20 * time.Millisecond,
+			AutoRollback:     true, // Enable auto-rollback
 		},
 	}
 
-	err := updater.StartUpdate(context.Background(), config)
-	require.NoError(t, err)
+	require.NoError(t, updater.StartUpdate(context.Background(), config))
+	assert.Equal(t, "myapp:v2", marathon.Applications["/rollback-app"].Container.Docker.Image)
+	waitForUpdate(t, updater, "/rollback-app")
 
-	time.Sleep(200 * time.Millisecond)
+	// The old definition is redeployed
+	assert.Equal(t, []string{"update-failed", "rollback-completed"}, updateActions(updater, "/rollback-app"))
+	history := updater.GetAppUpdateHistory("/rollback-app")
+	assert.Contains(t, history[0].Message, "not healthy within 20ms")
+	assert.Contains(t, history[1].Message, oldVersion)
 
-	// Check history for rollback event
-	history := updater.GetUpdateHistory()
-	t.Logf("Update history: %d events", len(history))
-	for _, event := range history {
-		if event.Action == "rollback-completed" {
-			assert.True(t, event.Success)
-			return
-		}
-	}
+	marathon.mu.RLock()
+	defer marathon.mu.RUnlock()
+	assert.Equal(t, "myapp:v1", marathon.Applications["/rollback-app"].Container.Docker.Image)
+	assert.Len(t, marathon.Deployments, 1)
 }
 
 // TestUpdateStateStructure tests the update state structure
@@ -0,0 +1,413 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+)
+
+// Storage key prefixes, one per kind of state
+const (
+	keyApps        = "apps"
+	keyAppVersions = "app-versions"
+	keyTasks       = "tasks"
+	keyTaskIndexes = "task-indexes"
+	keyDeployments = "deployments"
+	keyGroups      = "groups"
+	keyAgents      = "agents"
+	keyJobs        = "jobs"
+	keyJobRuns     = "job-runs"
+)
+
+// storedDeployment is the persisted form of a deployment, including the
+// app definitions it moves between so it can resume after a restart
+type storedDeployment struct {
+	*Deployment
+	Original  map[string]*Application `json:"original"`
+	Target    map[string]*Application `json:"target"`
+	StartedAt time.Time               `json:"startedAt"`
+}
+
+// storedTaskIndex is the persisted next task index of an app, so IDs of
+// killed tasks are not reused after a restart
+type storedTaskIndex struct {
+	AppID string `json:"appId"`
+	Next  int    `json:"next"`
+}
+
+// storageName escapes an ID for use as a single key segment
+func storageName(id string) string {
+	return url.PathEscape(id)
+}
+
+// stateValues serializes the framework state by storage key. The caller
+// must hold m.mu.
+func (m *Marathon) stateValues() (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	put := func(key string, value interface{}) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		values[key] = data
+		return nil
+	}
+
+	for id, app := range m.Applications {
+		// Tasks are stored under their own keys
+		stored := *app
+		stored.Tasks = nil
+		if err := put(path.Join(keyApps, storageName(id)), &stored); err != nil {
+			return nil, err
+		}
+	}
+	for id, versions := range m.versions {
+		// An app's stored definitions are kept together, oldest first
+		if err := put(path.Join(keyAppVersions, storageName(id)), versions); err != nil {
+			return nil, err
+		}
+	}
+	for id, task := range m.Tasks {
+		if err := put(path.Join(keyTasks, storageName(id)), task); err != nil {
+			return nil, err
+		}
+	}
+	for id, next := range m.taskIndexes {
+		if err := put(path.Join(keyTaskIndexes, storageName(id)), &storedTaskIndex{AppID: id, Next: next}); err != nil {
+			return nil, err
+		}
+	}
+	for id, d := range m.Deployments {
+		target := make(map[string]*Application, len(d.target))
+		for appID, app := range d.target {
+			target[appID] = snapshotApp(app)
+		}
+		stored := &storedDeployment{Deployment: d, Original: d.original, Target: target, StartedAt: d.startedAt}
+		if err := put(path.Join(keyDeployments, storageName(id)), stored); err != nil {
+			return nil, err
+		}
+	}
+	for id, group := range m.Groups {
+		if err := put(path.Join(keyGroups, storageName(id)), group); err != nil {
+			return nil, err
+		}
+	}
+	for id, agent := range m.Agents {
+		if err := put(path.Join(keyAgents, storageName(id)), agent); err != nil {
+			return nil, err
+		}
+	}
+	for id, job := range m.Jobs {
+		if err := put(path.Join(keyJobs, storageName(id)), job); err != nil {
+			return nil, err
+		}
+	}
+	for id, runs := range m.jobRuns {
+		// A job's runs are kept together, oldest first
+		if err := put(path.Join(keyJobRuns, storageName(id)), runs); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// persist signals the state writer that the state changed, starting it on
+// first use. The writer encodes and stores the state in the background, so
+// callers neither encode it nor wait for the store while holding m.mu, and
+// changes made in quick succession are written together. Only the leader
+// writes. The caller must hold m.mu.
+//
+// Changes are acknowledged before they are stored: if the instance dies,
+// the changes made since the last completed flush are lost, which are those
+// of the write in progress and those waiting for it. Stop flushes them.
+func (m *Marathon) persist() {
+	if m.Store == nil || (m.Elector != nil && !m.elected) {
+		return
+	}
+
+	m.startWriter.Do(func() { go m.writeState() })
+	select {
+	case m.persistCh <- struct{}{}:
+	default:
+		// A write is already pending and will include this change
+	}
+}
+
+// writeState flushes the state each time persist signals a change, for as
+// long as the framework runs
+func (m *Marathon) writeState() {
+	for range m.persistCh {
+		m.flush()
+	}
+}
+
+// flush writes the state that changed since the last flush to the store
+// and deletes keys of state that no longer exists. The state is encoded
+// under a read lock and written without holding m.mu. Leadership is checked
+// before every write, and an instance losing it waits for flushMu, so no
+// write starts once another instance may lead. Failures are logged and
+// retried on the next flush.
+func (m *Marathon) flush() {
+	m.flushMu.Lock()
+	defer m.flushMu.Unlock()
+
+	m.mu.RLock()
+	if m.Store == nil || (m.Elector != nil && !m.elected) {
+		m.mu.RUnlock()
+		return
+	}
+	store := m.Store
+	values, err := m.stateValues()
+	if err != nil {
+		m.mu.RUnlock()
+		log.Printf("Failed to persist state: %v", err)
+		return
+	}
+	changed := make(map[string][]byte)
+	for key, value := range values {
+		if stored, exists := m.persisted[key]; !exists || !bytes.Equal(stored, value) {
+			changed[key] = value
+		}
+	}
+	removed := make([]string, 0)
+	for key := range m.persisted {
+		if _, exists := values[key]; !exists {
+			removed = append(removed, key)
+		}
+	}
+	m.mu.RUnlock()
+
+	// Leadership may be lost while writing, after which the new leader owns
+	// the store
+	written := make(map[string][]byte, len(changed))
+	for key, value := range changed {
+		if !m.IsLeader() {
+			return
+		}
+		if err := store.Put(key, value); err != nil {
+			log.Printf("Failed to persist state: %v", err)
+			continue
+		}
+		written[key] = value
+	}
+	deleted := make([]string, 0, len(removed))
+	for _, key := range removed {
+		if !m.IsLeader() {
+			return
+		}
+		if err := store.Delete(key); err != nil {
+			log.Printf("Failed to persist state: %v", err)
+			continue
+		}
+		deleted = append(deleted, key)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, value := range written {
+		m.persisted[key] = value
+	}
+	for _, key := range deleted {
+		delete(m.persisted, key)
+	}
+}
+
+// Recover replaces the in-memory state with the state found in the store,
+// resuming deployments that were in progress. It is called by Start.
+func (m *Marathon) Recover() error {
+	if m.Store == nil {
+		return errors.New("no store configured")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	applications := make(map[string]*Application)
+	if err := m.loadAll(keyApps, func() interface{} { return &Application{} }, func(value interface{}) {
+		app := value.(*Application)
+		app.Tasks = make([]*MarathonTask, 0)
+		app.Deployments = make([]*Deployment, 0)
+		applications[app.ID] = app
+	}); err != nil {
+		return err
+	}
+
+	tasks := make(map[string]*MarathonTask)
+	if err := m.loadAll(keyTasks, func() interface{} { return &MarathonTask{} }, func(value interface{}) {
+		task := value.(*MarathonTask)
+		tasks[task.ID] = task
+	}); err != nil {
+		return err
+	}
+
+	taskIndexes := make(map[string]int)
+	if err := m.loadAll(keyTaskIndexes, func() interface{} { return &storedTaskIndex{} }, func(value interface{}) {
+		stored := value.(*storedTaskIndex)
+		taskIndexes[stored.AppID] = stored.Next
+	}); err != nil {
+		return err
+	}
+
+	versions := make(map[string][]*Application)
+	if err := m.loadAll(keyAppVersions, func() interface{} { return &[]*Application{} }, func(value interface{}) {
+		stored := *value.(*[]*Application)
+		if len(stored) > 0 {
+			versions[stored[0].ID] = stored
+		}
+	}); err != nil {
+		return err
+	}
+
+	deployments := make(map[string]*Deployment)
+	if err := m.loadAll(keyDeployments, func() interface{} { return &storedDeployment{Deployment: &Deployment{}} }, func(value interface{}) {
+		stored := value.(*storedDeployment)
+		d := stored.Deployment
+		d.original = stored.Original
+		d.target = stored.Target
+		d.startedAt = stored.StartedAt
+		deployments[d.ID] = d
+	}); err != nil {
+		return err
+	}
+
+	groups := make(map[string]*Group)
+	if err := m.loadAll(keyGroups, func() interface{} { return &Group{} }, func(value interface{}) {
+		group := value.(*Group)
+		groups[group.ID] = group
+	}); err != nil {
+		return err
+	}
+
+	agents := make(map[string]*AgentInfo)
+	if err := m.loadAll(keyAgents, func() interface{} { return &AgentInfo{} }, func(value interface{}) {
+		agent := value.(*AgentInfo)
+		agents[agent.ID] = agent
+	}); err != nil {
+		return err
+	}
+
+	jobs := make(map[string]*Job)
+	if err := m.loadAll(keyJobs, func() interface{} { return &Job{} }, func(value interface{}) {
+		job := value.(*Job)
+		jobs[job.ID] = job
+	}); err != nil {
+		return err
+	}
+
+	jobRuns := make(map[string][]*JobRun)
+	if err := m.loadAll(keyJobRuns, func() interface{} { return &[]*JobRun{} }, func(value interface{}) {
+		stored := *value.(*[]*JobRun)
+		if len(stored) > 0 {
+			jobRuns[stored[0].JobID] = stored
+		}
+	}); err != nil {
+		return err
+	}
+
+	// Reattach the tasks still owned by their apps in task order
+	owned := make([]*MarathonTask, 0, len(tasks))
+	for _, task := range tasks {
+		if task.State == "TASK_STAGING" || task.State == "TASK_RUNNING" ||
+			(task.State == "TASK_UNREACHABLE" && !task.UnreachableInactive) {
+			owned = append(owned, task)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		if owned[i].AppID != owned[j].AppID {
+			return owned[i].AppID < owned[j].AppID
+		}
+		return taskIndex(owned[i]) < taskIndex(owned[j])
+	})
+	for _, task := range owned {
+		if app, exists := applications[task.AppID]; exists {
+			app.Tasks = append(app.Tasks, task)
+		}
+	}
+
+	// Relist the deployments in progress on their apps, oldest first
+	inProgress := make([]*Deployment, 0, len(deployments))
+	for _, d := range deployments {
+		inProgress = append(inProgress, d)
+	}
+	sort.Slice(inProgress, func(i, j int) bool { return inProgress[i].startedAt.Before(inProgress[j].startedAt) })
+	for _, d := range inProgress {
+		for _, appID := range d.AffectedApps {
+			if app, exists := applications[appID]; exists {
+				trackDeployment(app, d)
+			}
+		}
+	}
+
+	m.Applications = applications
+	m.Tasks = tasks
+	m.taskIndexes = taskIndexes
+	m.versions = versions
+	m.Deployments = deployments
+	m.Groups = groups
+	m.Agents = agents
+	m.Jobs = jobs
+	m.jobRuns = jobRuns
+	for _, app := range m.Applications {
+		m.updateTaskCounts(app)
+		if version, err := time.Parse(versionFormat, app.Version); err == nil && version.After(m.lastVersion) {
+			m.lastVersion = version
+		}
+	}
+
+	// Everything just loaded is already stored
+	values, err := m.stateValues()
+	if err != nil {
+		return err
+	}
+	m.persisted = values
+
+	log.Printf("Recovered %d apps, %d tasks and %d deployments from storage",
+		len(m.Applications), len(m.Tasks), len(m.Deployments))
+
+	// Restarts, including rolling updates whose updater is gone, resume as
+	// regular deployments
+	for _, d := range inProgress {
+		if d.CurrentStep < len(d.Steps) && d.Steps[d.CurrentStep].Action == ActionRestartApplication {
+			step := d.Steps[d.CurrentStep]
+			if app, exists := m.Applications[step.App]; exists {
+				m.resumeRestart(app)
+			}
+		}
+	}
+	m.advanceDeployments()
+	return nil
+}
+
+// loadAll decodes every value below prefix into a fresh value from newValue
+// and hands it to add
+func (m *Marathon) loadAll(prefix string, newValue func() interface{}, add func(interface{})) error {
+	names, err := m.Store.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		key := path.Join(prefix, name)
+		data, err := m.Store.Get(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			// Another writer removed the key after it was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		value := newValue()
+		if err := json.Unmarshal(data, value); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		add(value)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package marathon
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the writes reaching a store
+type countingStore struct {
+	Store
+	mu      sync.Mutex
+	puts    int
+	deletes int
+}
+
+func (s *countingStore) Put(key string, value []byte) error {
+	s.mu.Lock()
+	s.puts++
+	s.mu.Unlock()
+	return s.Store.Put(key, value)
+}
+
+func (s *countingStore) Delete(key string) error {
+	s.mu.Lock()
+	s.deletes++
+	s.mu.Unlock()
+	return s.Store.Delete(key)
+}
+
+// counts returns the number of puts and deletes so far
+func (s *countingStore) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.puts, s.deletes
+}
+
+// newStoredMarathon creates a Marathon instance writing to store until the
+// test ends
+func newStoredMarathon(t *testing.T, store Store) *Marathon {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	marathon.Store = store
+	t.Cleanup(func() {
+		// Detach the store and wait for a write in progress, so the
+		// background writer leaves the store alone once the test is over
+		marathon.mu.Lock()
+		marathon.Store = nil
+		marathon.mu.Unlock()
+		marathon.flushMu.Lock()
+		marathon.flushMu.Unlock()
+	})
+	return marathon
+}
+
+func TestMarathon_RecoverState(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			before := newStoredMarathon(t, store)
+
+			require.NoError(t, before.CreateApp(&Application{ID: "/web", Instances: 1, CPUs: 1.0}))
+			completeDeployments(t, before)
+			require.NoError(t, before.UpdateApp("/web", &Application{Instances: 1, CPUs: 2.0}))
+			completeDeployments(t, before)
+			before.ResourceOffers([]*Offer{testOffer(1, "r1")})
+
+			// A group deployment is still on its first step when Marathon stops
+			group, err := before.CreateGroup(testGroup(), false)
+			require.NoError(t, err)
+			before.flush()
+
+			after := newStoredMarathon(t, store)
+			require.NoError(t, after.Recover())
+
+			assert.ElementsMatch(t, []string{"/web", "/prod/db"}, appIDs(after))
+			web := after.Applications["/web"]
+			assert.Equal(t, 2.0, web.CPUs)
+			require.Len(t, web.Tasks, 1)
+			assert.Same(t, after.Tasks[web.Tasks[0].ID], web.Tasks[0])
+			assert.Equal(t, 1, web.TasksRunning)
+			assert.Contains(t, after.Agents, "agent-1")
+			assert.Contains(t, after.Groups, "/prod/web")
+
+			versions, err := after.ListAppVersions("/web")
+			require.NoError(t, err)
+			assert.Len(t, versions, 2)
+
+			require.Contains(t, after.Deployments, group.ID)
+			recovered := after.Deployments[group.ID]
+			assert.Equal(t, 0, recovered.CurrentStep)
+			assert.Equal(t, 3, recovered.TotalSteps)
+			assert.Empty(t, web.Deployments)
+			assert.Equal(t, []*Deployment{recovered}, after.Applications["/prod/db"].Deployments)
+
+			// The recovered deployment carries on with the remaining steps
+			completeDeployments(t, after)
+			assert.Contains(t, after.Applications, "/prod/web/api")
+			assert.Contains(t, after.Applications, "/prod/web/frontend")
+			assert.Len(t, after.Applications["/prod/web/frontend"].Tasks, 2)
+		})
+	}
+}
+
+func appIDs(m *Marathon) []string {
+	ids := make([]string, 0, len(m.Applications))
+	for id := range m.Applications {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestMarathon_PersistWritesChangesOnly(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	store := &countingStore{Store: fileStore}
+	marathon := newStoredMarathon(t, store)
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 1}))
+	marathon.flush()
+	puts, _ := store.counts()
+	assert.Positive(t, puts)
+
+	// Nothing changed, so nothing is written
+	marathon.flush()
+	after, _ := store.counts()
+	assert.Equal(t, puts, after)
+
+	require.NoError(t, marathon.DeleteApp("/app"))
+	marathon.flush()
+	_, deletes := store.counts()
+	assert.Positive(t, deletes)
+
+	for _, prefix := range []string{keyApps, keyTasks, keyDeployments, keyAppVersions} {
+		names, err := store.List(prefix)
+		require.NoError(t, err)
+		assert.Empty(t, names, prefix)
+	}
+}
+
+func TestMarathon_RecoverWithoutStore(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	assert.Error(t, marathon.Recover())
+}
+
+// blockingStore holds writes until released
+type blockingStore struct {
+	Store
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(key string, value []byte) error {
+	<-s.release
+	return s.Store.Put(key, value)
+}
+
+func TestMarathon_PersistInBackground(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	store := &blockingStore{Store: fileStore, release: make(chan struct{})}
+	marathon := newStoredMarathon(t, store)
+
+	// A slow store blocks neither the call changing the state nor later ones
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 1}))
+	require.NoError(t, marathon.ScaleApp("/app", 2))
+	names, err := fileStore.List(keyApps)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	// Until the write completes both changes would be lost with the
+	// instance, a flush stores everything acknowledged so far
+	close(store.release)
+	require.Eventually(t, func() bool {
+		names, err := fileStore.List(keyApps)
+		return err == nil && len(names) == 1
+	}, time.Second, time.Millisecond)
+	marathon.flush()
+	recovered := newStoredMarathon(t, fileStore)
+	require.NoError(t, recovered.Recover())
+	assert.Equal(t, 2, recovered.Applications["/app"].Instances)
+}
+
+func TestMarathon_NoWritesAfterLeadershipLoss(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	counting := &countingStore{Store: fileStore}
+	store := &blockingStore{Store: counting, release: make(chan struct{})}
+	marathon := newStoredMarathon(t, store)
+	marathon.Elector = newZKLeaderElector(newFakeZKConn(), "")
+	marathon.elected = true
+
+	// The app is stored under several keys, the first write blocks
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 1}))
+	require.Eventually(t, func() bool {
+		if marathon.flushMu.TryLock() {
+			marathon.flushMu.Unlock()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond)
+
+	// Losing leadership waits for the write in progress and stops the rest
+	lost := make(chan struct{})
+	go func() {
+		marathon.onLeadershipChange(false)
+		close(lost)
+	}()
+	assert.Eventually(t, func() bool { return !marathon.IsLeader() }, time.Second, time.Millisecond)
+	select {
+	case <-lost:
+		t.Fatal("leadership change did not wait for the write in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(store.release)
+	<-lost
+	puts, deletes := counting.counts()
+	assert.Equal(t, 1, puts)
+	assert.Zero(t, deletes)
+
+	// Nothing is written afterwards
+	require.NoError(t, marathon.ScaleApp("/app", 2))
+	marathon.flush()
+	puts, _ = counting.counts()
+	assert.Equal(t, 1, puts)
+}
+
+func TestMarathon_RecoverTaskIndexes(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	before := newStoredMarathon(t, store)
+	require.NoError(t, before.CreateApp(&Application{ID: "/app", Instances: 3, CPUs: 1.0}))
+	completeDeployments(t, before)
+	require.NoError(t, before.ScaleApp("/app", 2))
+	completeDeployments(t, before)
+	require.Len(t, before.Applications["/app"].Tasks, 2)
+	assert.NotContains(t, before.Tasks, "/app.2")
+	before.flush()
+
+	// IDs of killed tasks are not reused after a restart either
+	after := newStoredMarathon(t, store)
+	require.NoError(t, after.Recover())
+	require.NoError(t, after.ScaleApp("/app", 3))
+	completeDeployments(t, after)
+	assert.NotContains(t, after.Tasks, "/app.2")
+	assert.Contains(t, after.Tasks, "/app.3")
+}
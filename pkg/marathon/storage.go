@@ -0,0 +1,272 @@
+package marathon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// DefaultZKRoot is the ZooKeeper node Marathon state is stored under
+const DefaultZKRoot = "/marathon/state"
+
+// ErrKeyNotFound is returned by a Store for keys that hold no value
+var ErrKeyNotFound = errors.New("key not found")
+
+// Store persists Marathon state as values under slash-separated keys such
+// as "apps/<id>". Backends map keys below their own root.
+type Store interface {
+	// Put creates or replaces the value of a key
+	Put(key string, value []byte) error
+	// Get returns the value of a key or ErrKeyNotFound
+	Get(key string) ([]byte, error)
+	// Delete removes a key and everything below it; missing keys are ignored
+	Delete(key string) error
+	// List returns the names of the keys directly below prefix, sorted
+	List(prefix string) ([]string, error)
+	// Close releases the backend's resources
+	Close() error
+}
+
+// FileStore is a Store keeping one file per key below a directory. Values
+// are written to a temporary file and renamed into place, so a crash never
+// leaves a partially written value behind.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a file store rooted at dir, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes a value atomically
+func (s *FileStore) Put(key string, value []byte) error {
+	file := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get reads a value
+func (s *FileStore) Get(key string) ([]byte, error) {
+	value, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Delete removes a value and the keys below it
+func (s *FileStore) Delete(key string) error {
+	if err := os.RemoveAll(s.path(key)); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// List returns the keys below prefix, skipping temporary files
+func (s *FileStore) List(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(s.path(prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".tmp-") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Close is a no-op for file stores
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// zkConn is the subset of *zk.Conn used by ZKStore
+type zkConn interface {
+	Get(path string) ([]byte, *zk.Stat, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Children(path string) ([]string, *zk.Stat, error)
+	Exists(path string) (bool, *zk.Stat, error)
+	Close()
+}
+
+// ZKStore is a Store keeping one znode per key below a root node, following
+// Marathon's /marathon/state layout
+type ZKStore struct {
+	conn zkConn
+	root string
+}
+
+// NewZKStore connects to a ZooKeeper ensemble and stores state below root,
+// or DefaultZKRoot if root is empty
+func NewZKStore(servers []string, root string, sessionTimeout time.Duration) (*ZKStore, error) {
+	conn, _, err := zk.Connect(servers, sessionTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ZooKeeper: %w", err)
+	}
+	return newZKStore(conn, root), nil
+}
+
+func newZKStore(conn zkConn, root string) *ZKStore {
+	if root == "" {
+		root = DefaultZKRoot
+	}
+	return &ZKStore{conn: conn, root: path.Clean("/" + root)}
+}
+
+func (s *ZKStore) path(key string) string {
+	return path.Join(s.root, path.Clean("/"+key))
+}
+
+// Put sets a znode, creating it and its parents as needed
+func (s *ZKStore) Put(key string, value []byte) error {
+	node := s.path(key)
+	if _, err := s.conn.Set(node, value, -1); err == nil {
+		return nil
+	} else if !errors.Is(err, zk.ErrNoNode) {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+
+	if err := ensureZKPath(s.conn, path.Dir(node)); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	if _, err := s.conn.Create(node, value, 0, zk.WorldACL(zk.PermAll)); err != nil {
+		if !errors.Is(err, zk.ErrNodeExists) {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+		// Lost a race with another writer; overwrite its value
+		if _, err := s.conn.Set(node, value, -1); err != nil {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ensureZKPath creates a znode and its ancestors where they are missing
+func ensureZKPath(conn zkConn, node string) error {
+	current := ""
+	for _, part := range strings.Split(strings.TrimPrefix(node, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		current += "/" + part
+		exists, _, err := conn.Exists(current)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := conn.Create(current, nil, 0, zk.WorldACL(zk.PermAll)); err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get reads a znode
+func (s *ZKStore) Get(key string) ([]byte, error) {
+	value, _, err := s.conn.Get(s.path(key))
+	if errors.Is(err, zk.ErrNoNode) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Delete removes a znode and its descendants
+func (s *ZKStore) Delete(key string) error {
+	if err := s.deleteRecursive(s.path(key)); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *ZKStore) deleteRecursive(node string) error {
+	children, _, err := s.conn.Children(node)
+	if errors.Is(err, zk.ErrNoNode) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := s.deleteRecursive(path.Join(node, child)); err != nil {
+			return err
+		}
+	}
+	if err := s.conn.Delete(node, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return err
+	}
+	return nil
+}
+
+// List returns the children of a znode
+func (s *ZKStore) List(prefix string) ([]string, error) {
+	children, _, err := s.conn.Children(s.path(prefix))
+	if errors.Is(err, zk.ErrNoNode) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// Close closes the ZooKeeper connection
+func (s *ZKStore) Close() error {
+	s.conn.Close()
+	return nil
+}
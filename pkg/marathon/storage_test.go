@@ -0,0 +1,205 @@
+package marathon
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeZKConn is an in-memory ZooKeeper that enforces parent nodes and
+// supports sequential nodes and existence watches
+type fakeZKConn struct {
+	mu       sync.Mutex
+	nodes    map[string][]byte
+	sequence int
+	watches  map[string][]chan zk.Event
+	closed   bool
+}
+
+func newFakeZKConn() *fakeZKConn {
+	return &fakeZKConn{nodes: map[string][]byte{"/": nil}, watches: make(map[string][]chan zk.Event)}
+}
+
+// fire notifies and removes the watches on a node
+func (c *fakeZKConn) fire(node string, eventType zk.EventType) {
+	for _, watch := range c.watches[node] {
+		watch <- zk.Event{Type: eventType, Path: node}
+		close(watch)
+	}
+	delete(c.watches, node)
+}
+
+func (c *fakeZKConn) Get(node string) ([]byte, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, exists := c.nodes[node]
+	if !exists {
+		return nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, nil
+}
+
+func (c *fakeZKConn) Set(node string, data []byte, version int32) (*zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.nodes[node]; !exists {
+		return nil, zk.ErrNoNode
+	}
+	c.nodes[node] = data
+	return &zk.Stat{}, nil
+}
+
+func (c *fakeZKConn) Create(node string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if flags&zk.FlagSequence != 0 {
+		c.sequence++
+		node = fmt.Sprintf("%s%010d", node, c.sequence)
+	}
+	if _, exists := c.nodes[node]; exists {
+		return "", zk.ErrNodeExists
+	}
+	if _, exists := c.nodes[path.Dir(node)]; !exists {
+		return "", zk.ErrNoNode
+	}
+	c.nodes[node] = data
+	c.fire(node, zk.EventNodeCreated)
+	return node, nil
+}
+
+func (c *fakeZKConn) Delete(node string, version int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.nodes[node]; !exists {
+		return zk.ErrNoNode
+	}
+	if len(c.children(node)) > 0 {
+		return zk.ErrNotEmpty
+	}
+	delete(c.nodes, node)
+	c.fire(node, zk.EventNodeDeleted)
+	return nil
+}
+
+func (c *fakeZKConn) children(node string) []string {
+	children := make([]string, 0)
+	for other := range c.nodes {
+		if other != node && path.Dir(other) == node {
+			children = append(children, path.Base(other))
+		}
+	}
+	return children
+}
+
+func (c *fakeZKConn) Children(node string) ([]string, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.nodes[node]; !exists {
+		return nil, nil, zk.ErrNoNode
+	}
+	return c.children(node), &zk.Stat{}, nil
+}
+
+func (c *fakeZKConn) Exists(node string) (bool, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.nodes[node]
+	return exists, &zk.Stat{}, nil
+}
+
+func (c *fakeZKConn) ExistsW(node string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.nodes[node]
+	watch := make(chan zk.Event, 1)
+	c.watches[node] = append(c.watches[node], watch)
+	return exists, &zk.Stat{}, watch, nil
+}
+
+func (c *fakeZKConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+// testStores returns a fresh instance of every Store backend
+func testStores(t *testing.T) map[string]Store {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	return map[string]Store{
+		"File":      fileStore,
+		"ZooKeeper": newZKStore(newFakeZKConn(), ""),
+	}
+}
+
+func TestStore_Backends(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Get("apps/missing")
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+
+			names, err := store.List("apps")
+			require.NoError(t, err)
+			assert.Empty(t, names)
+
+			require.NoError(t, store.Put("apps/b", []byte("one")))
+			require.NoError(t, store.Put("apps/a", []byte("two")))
+			require.NoError(t, store.Put("apps/b", []byte("three")))
+			require.NoError(t, store.Put("app-versions/a/v1", []byte("four")))
+
+			value, err := store.Get("apps/b")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("three"), value)
+
+			names, err = store.List("apps")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, names)
+
+			// Deleting removes everything below the key
+			require.NoError(t, store.Delete("app-versions/a"))
+			require.NoError(t, store.Delete("app-versions/a"))
+			names, err = store.List("app-versions/a")
+			require.NoError(t, err)
+			assert.Empty(t, names)
+
+			require.NoError(t, store.Delete("apps/b"))
+			_, err = store.Get("apps/b")
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+
+			assert.NoError(t, store.Close())
+		})
+	}
+}
+
+func TestZKStore_Layout(t *testing.T) {
+	conn := newFakeZKConn()
+	store := newZKStore(conn, "")
+
+	require.NoError(t, store.Put("apps/%2Fprod%2Fapi", []byte("{}")))
+	assert.Contains(t, conn.nodes, "/marathon/state/apps/%2Fprod%2Fapi")
+	assert.Contains(t, conn.nodes, "/marathon/state/apps")
+
+	custom := newZKStore(conn, "marathon-test/state/")
+	require.NoError(t, custom.Put("tasks/t1", []byte("{}")))
+	assert.Contains(t, conn.nodes, "/marathon-test/state/tasks/t1")
+
+	require.NoError(t, store.Close())
+	assert.True(t, conn.closed)
+}
+
+func TestFileStore_KeysStayInsideDirectory(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(path.Join(dir, "state"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("../../escape", []byte("x")))
+	names, err := store.List("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"escape"}, names)
+}
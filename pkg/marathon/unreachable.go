@@ -0,0 +1,155 @@
+package marathon
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Defaults for an unset unreachable strategy, matching Marathon
+const (
+	defaultInactiveAfterSeconds = 300
+	defaultExpungeAfterSeconds  = 600
+)
+
+// UnreachableStrategy decides how long tasks on an unreachable agent are
+// waited for. After InactiveAfterSeconds they are replaced; after
+// ExpungeAfterSeconds they are forgotten.
+type UnreachableStrategy struct {
+	InactiveAfterSeconds int `json:"inactiveAfterSeconds"`
+	ExpungeAfterSeconds  int `json:"expungeAfterSeconds"`
+}
+
+// unreachableTimeouts returns an app's unreachable strategy with defaults
+// applied. Job tasks have no app and use the defaults.
+func unreachableTimeouts(app *Application) (inactive, expunge time.Duration) {
+	if app == nil || app.UnreachableStrategy == nil {
+		return defaultInactiveAfterSeconds * time.Second, defaultExpungeAfterSeconds * time.Second
+	}
+	s := app.UnreachableStrategy
+	return time.Duration(s.InactiveAfterSeconds) * time.Second, time.Duration(s.ExpungeAfterSeconds) * time.Second
+}
+
+// AgentLost marks the staging and running tasks on an agent that stopped
+// responding as TASK_UNREACHABLE. They are replaced once their app's
+// unreachable strategy declares them inactive.
+func (m *Marathon) AgentLost(agentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	return m.agentLost(agentID, time.Now())
+}
+
+// agentLost marks an agent's tasks unreachable. The caller must hold m.mu.
+func (m *Marathon) agentLost(agentID string, now time.Time) error {
+	lost := make([]string, 0)
+	for id, task := range m.Tasks {
+		if task.SlaveID == agentID && (task.State == "TASK_STAGING" || task.State == "TASK_RUNNING") {
+			lost = append(lost, id)
+		}
+	}
+	sort.Strings(lost)
+
+	for _, id := range lost {
+		if err := m.statusUpdate(id, "TASK_UNREACHABLE", fmt.Sprintf("agent %s is unreachable", agentID), now); err != nil {
+			return err
+		}
+	}
+	if len(lost) > 0 {
+		log.Printf("Agent %s is unreachable, %d tasks affected", agentID, len(lost))
+	}
+	return nil
+}
+
+// expireUnreachable applies the unreachable strategies to the tasks waiting
+// for their agent: inactive tasks leave their app and are replaced, expunged
+// tasks are dropped. Job tasks are failed once inactive so their run's
+// restart policy applies. The caller must hold m.mu.
+func (m *Marathon) expireUnreachable(now time.Time) {
+	ids := make([]string, 0)
+	for id, task := range m.Tasks {
+		if task.State == "TASK_UNREACHABLE" && task.UnreachableSince != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		task := m.Tasks[id]
+		app := m.Applications[task.AppID]
+		inactive, expunge := unreachableTimeouts(app)
+		elapsed := now.Sub(*task.UnreachableSince)
+
+		if run := m.jobRunForTask(task); run != nil {
+			if elapsed >= inactive {
+				m.statusUpdate(id, "TASK_LOST", "agent did not return", now)
+			}
+			continue
+		}
+
+		if !task.UnreachableInactive && elapsed >= inactive {
+			task.UnreachableInactive = true
+			if app != nil {
+				m.removeAppTask(app, task)
+				log.Printf("Task %s of %s is inactive after %s unreachable", task.ID, app.ID, elapsed)
+				if task.Version == app.Version && len(app.Tasks) < app.Instances {
+					m.stageTask(app)
+				}
+				m.updateTaskCounts(app)
+			}
+		}
+		if elapsed >= expunge {
+			delete(m.Tasks, id)
+			task.State = "TASK_GONE"
+			m.publishStatusUpdate(task)
+			log.Printf("Expunged unreachable task %s of %s", task.ID, task.AppID)
+		}
+	}
+}
+
+// taskReachable handles a task whose agent came back. A task that was
+// already replaced rejoins its app, and the tasks now exceeding the app's
+// instance count are killed. The caller must hold m.mu.
+func (m *Marathon) taskReachable(app *Application, task *MarathonTask) {
+	replaced := task.UnreachableInactive
+	task.UnreachableSince = nil
+	task.UnreachableInactive = false
+	if !replaced || app == nil {
+		return
+	}
+
+	app.Tasks = append(app.Tasks, task)
+	log.Printf("Inactive task %s of %s is reachable again", task.ID, app.ID)
+	m.killExcessTasks(app, task)
+}
+
+// killExcessTasks kills tasks beyond an app's instance count, newest first.
+// Tasks still waiting for an offer go first, then staging tasks, then the
+// other tasks, and the returned task only when nothing else is left. The
+// caller must hold m.mu.
+func (m *Marathon) killExcessTasks(app *Application, returned *MarathonTask) {
+	for len(app.Tasks) > app.Instances {
+		var victim *MarathonTask
+		for _, pick := range []func(*MarathonTask) bool{
+			waitingForOffer,
+			func(t *MarathonTask) bool { return t.State == "TASK_STAGING" },
+			func(*MarathonTask) bool { return true },
+		} {
+			for i := len(app.Tasks) - 1; i >= 0 && victim == nil; i-- {
+				if t := app.Tasks[i]; t != returned && pick(t) {
+					victim = t
+				}
+			}
+			if victim != nil {
+				break
+			}
+		}
+		if victim == nil {
+			victim = returned
+		}
+		log.Printf("Killing task %s of %s in excess of %d instances", victim.ID, app.ID, app.Instances)
+		m.killAppTask(app, victim)
+	}
+}
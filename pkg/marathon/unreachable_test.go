@@ -0,0 +1,122 @@
+package marathon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableApp creates an app with one running task on each of agent-1
+// and agent-2
+func unreachableApp(t *testing.T, marathon *Marathon, now time.Time) *Application {
+	app := &Application{ID: "/web", Instances: 2, CPUs: 3, UnreachableStrategy: &UnreachableStrategy{InactiveAfterSeconds: 60, ExpungeAfterSeconds: 120}}
+	require.NoError(t, marathon.CreateApp(app))
+	require.Len(t, marathon.matchOffers([]*Offer{testOffer(1, "r1"), testOffer(2, "r1")}, now), 2)
+	for _, task := range app.Tasks {
+		require.NoError(t, marathon.statusUpdate(task.ID, "TASK_RUNNING", "", now))
+	}
+	return app
+}
+
+func TestMarathon_AgentLost(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	now := time.Now()
+	app := unreachableApp(t, marathon, now)
+	lost := app.Tasks[0]
+	require.Equal(t, "agent-1", lost.SlaveID)
+
+	require.NoError(t, marathon.agentLost("agent-1", now))
+	assert.Equal(t, "TASK_UNREACHABLE", lost.State)
+	assert.Equal(t, now, *lost.UnreachableSince)
+	assert.Len(t, app.Tasks, 2)
+	assert.Equal(t, 1, app.TasksRunning)
+
+	// The task is waited for until it becomes inactive
+	marathon.expireUnreachable(now.Add(59 * time.Second))
+	assert.Len(t, app.Tasks, 2)
+	assert.False(t, lost.UnreachableInactive)
+
+	marathon.expireUnreachable(now.Add(60 * time.Second))
+	assert.True(t, lost.UnreachableInactive)
+	require.Len(t, app.Tasks, 2)
+	assert.NotContains(t, app.Tasks, lost)
+	assert.True(t, waitingForOffer(app.Tasks[1]))
+	assert.Contains(t, marathon.Tasks, lost.ID)
+
+	// Expunged tasks are forgotten
+	marathon.expireUnreachable(now.Add(120 * time.Second))
+	assert.NotContains(t, marathon.Tasks, lost.ID)
+	assert.Equal(t, "TASK_GONE", lost.State)
+	assert.ErrorIs(t, marathon.statusUpdate(lost.ID, "TASK_RUNNING", "", now), ErrTaskNotFound)
+}
+
+func TestMarathon_UnreachableTaskReturns(t *testing.T) {
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		placed   bool
+		killed   int
+		tasksLen int
+	}{
+		{"before inactive", 30 * time.Second, false, 0, 2},
+		{"replacement waiting for offer", 90 * time.Second, false, 1, 2},
+		{"replacement running", 90 * time.Second, true, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+			now := time.Now()
+			app := unreachableApp(t, marathon, now)
+			lost := app.Tasks[0]
+			require.NoError(t, marathon.agentLost("agent-1", now))
+			marathon.expireUnreachable(now.Add(tt.elapsed))
+			if tt.placed {
+				require.Len(t, marathon.matchOffers([]*Offer{testOffer(3, "r1")}, now.Add(tt.elapsed)), 1)
+				require.NoError(t, marathon.statusUpdate(app.Tasks[1].ID, "TASK_RUNNING", "", now.Add(tt.elapsed)))
+			}
+			tasks := append([]*MarathonTask(nil), app.Tasks...)
+
+			require.NoError(t, marathon.statusUpdate(lost.ID, "TASK_RUNNING", "", now.Add(tt.elapsed)))
+			assert.Nil(t, lost.UnreachableSince)
+			assert.False(t, lost.UnreachableInactive)
+			assert.Len(t, app.Tasks, tt.tasksLen)
+			assert.Contains(t, app.Tasks, lost)
+			assert.Equal(t, 2, app.TasksRunning)
+
+			killed := 0
+			for _, task := range tasks {
+				if task.State == "TASK_KILLED" {
+					killed++
+					assert.NotContains(t, app.Tasks, task)
+				}
+			}
+			assert.Equal(t, tt.killed, killed)
+		})
+	}
+}
+
+func TestMarathon_UnreachableTaskFailsAfterReplacement(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	now := time.Now()
+	app := unreachableApp(t, marathon, now)
+	lost := app.Tasks[0]
+	require.NoError(t, marathon.agentLost("agent-1", now))
+	marathon.expireUnreachable(now.Add(time.Minute))
+
+	// The replacement already fills the place of the failed task
+	require.NoError(t, marathon.statusUpdate(lost.ID, "TASK_FAILED", "", now.Add(time.Minute)))
+	assert.Len(t, app.Tasks, 2)
+	assert.NotContains(t, marathon.delays, "/web")
+}
+
+func TestMarathon_UnreachableDefaults(t *testing.T) {
+	inactive, expunge := unreachableTimeouts(&Application{})
+	assert.Equal(t, 5*time.Minute, inactive)
+	assert.Equal(t, 10*time.Minute, expunge)
+
+	inactive, expunge = unreachableTimeouts(&Application{UnreachableStrategy: &UnreachableStrategy{}})
+	assert.Zero(t, inactive)
+	assert.Zero(t, expunge)
+}
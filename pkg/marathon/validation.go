@@ -0,0 +1,313 @@
+package marathon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrAppExists is returned when creating an app whose ID is taken
+var ErrAppExists = errors.New("application already exists")
+
+// Default resources of apps that do not request any, as in Marathon
+const (
+	DefaultAppInstances = 1
+	DefaultAppCPUs      = 1.0
+	DefaultAppMemory    = 128.0
+)
+
+// idSegment matches one segment of an app or group ID
+var idSegment = regexp.MustCompile(`^(([a-z0-9]|[a-z0-9][a-z0-9\-]*[a-z0-9])\.)*([a-z0-9]|[a-z0-9][a-z0-9\-]*[a-z0-9])$`)
+
+// Violation lists the errors found at one path of a definition
+type Violation struct {
+	Path   string   `json:"path"`
+	Errors []string `json:"errors"`
+}
+
+// ValidationError reports every violation found in a definition. The HTTP
+// API answers it with 422 Unprocessable Entity and the error as JSON body.
+type ValidationError struct {
+	Message string       `json:"message"`
+	Details []*Violation `json:"details"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Details))
+	for _, v := range e.Details {
+		parts = append(parts, v.Path+": "+strings.Join(v.Errors, ", "))
+	}
+	return e.Message + ": " + strings.Join(parts, "; ")
+}
+
+// validator collects violations in the order they are found
+type validator struct {
+	details []*Violation
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, d := range v.details {
+		if d.Path == path {
+			d.Errors = append(d.Errors, msg)
+			return
+		}
+	}
+	v.details = append(v.details, &Violation{Path: path, Errors: []string{msg}})
+}
+
+// err returns the collected violations as a ValidationError, nil if there
+// are none
+func (v *validator) err() error {
+	if len(v.details) == 0 {
+		return nil
+	}
+	return &ValidationError{Message: "Object is not valid", Details: v.details}
+}
+
+// defaultApp returns an app definition holding Marathon's defaults, to
+// decode request bodies into
+func defaultApp() *Application {
+	return &Application{Instances: DefaultAppInstances, CPUs: DefaultAppCPUs, Memory: DefaultAppMemory}
+}
+
+// ValidateApp checks an app definition and returns a *ValidationError
+// listing every problem found
+func ValidateApp(app *Application) error {
+	var v validator
+	v.app("", app)
+	return v.err()
+}
+
+// ValidateGroup checks a group definition and the apps in it
+func ValidateGroup(group *Group) error {
+	var v validator
+	v.group("", group)
+	return v.err()
+}
+
+func (v *validator) group(path string, group *Group) {
+	v.id(path+"/id", group.ID)
+	for i, dep := range group.Dependencies {
+		v.id(fmt.Sprintf("%s/dependencies(%d)", path, i), dep)
+	}
+	for i, app := range group.Apps {
+		v.app(fmt.Sprintf("%s/apps(%d)", path, i), app)
+	}
+	for i, pod := range group.Pods {
+		v.pod(fmt.Sprintf("%s/pods(%d)", path, i), pod)
+	}
+	for i, child := range group.Groups {
+		v.group(fmt.Sprintf("%s/groups(%d)", path, i), child)
+	}
+}
+
+// pod checks a pod definition nested in a group
+func (v *validator) pod(path string, pod *Pod) {
+	v.id(path+"/id", pod.ID)
+	if strings.Trim(pod.ID, "/") == "" {
+		return
+	}
+	if _, err := podRunSpec(pod); err != nil {
+		v.add(path, "%s", err)
+	}
+}
+
+// id checks an absolute or relative app or group ID
+func (v *validator) id(path, id string) {
+	if strings.Trim(id, "/") == "" {
+		v.add(path, "must not be empty")
+		return
+	}
+	for _, segment := range strings.Split(strings.Trim(id, "/"), "/") {
+		if segment != "." && segment != ".." && !idSegment.MatchString(segment) {
+			v.add(path, "path segment %q must consist of lowercase letters, digits, hyphens and dots", segment)
+			return
+		}
+	}
+}
+
+func (v *validator) app(path string, app *Application) {
+	v.id(path+"/id", app.ID)
+	if app.Instances < 0 {
+		v.add(path+"/instances", "must not be negative")
+	}
+	if app.CPUs <= 0 {
+		v.add(path+"/cpus", "must be greater than 0")
+	}
+	if app.Memory < 0 {
+		v.add(path+"/mem", "must not be negative")
+	}
+	if app.BackoffSeconds < 0 {
+		v.add(path+"/backoffSeconds", "must not be negative")
+	}
+	if app.BackoffFactor != 0 && app.BackoffFactor < 1 {
+		v.add(path+"/backoffFactor", "must be at least 1")
+	}
+	if app.MaxLaunchDelaySeconds < 0 {
+		v.add(path+"/maxLaunchDelaySeconds", "must not be negative")
+	}
+	if s := app.UnreachableStrategy; s != nil {
+		if s.InactiveAfterSeconds < 0 {
+			v.add(path+"/unreachableStrategy/inactiveAfterSeconds", "must not be negative")
+		}
+		if s.ExpungeAfterSeconds < s.InactiveAfterSeconds {
+			v.add(path+"/unreachableStrategy/expungeAfterSeconds", "must not be smaller than inactiveAfterSeconds")
+		}
+	}
+	for i, dep := range app.Dependencies {
+		v.id(fmt.Sprintf("%s/dependencies(%d)", path, i), dep)
+	}
+	for i, raw := range app.Constraints {
+		if _, err := ParseConstraint(raw); err != nil {
+			v.add(fmt.Sprintf("%s/constraints(%d)", path, i), "%s", err.Error())
+		}
+	}
+
+	ports := len(appPorts(app))
+	for i, pd := range app.PortDefinitions {
+		p := fmt.Sprintf("%s/portDefinitions(%d)", path, i)
+		v.port(p+"/port", pd.Port)
+		v.protocol(p+"/protocol", pd.Protocol)
+	}
+	if app.Container != nil {
+		v.container(path+"/container", app.Container)
+		if app.Container.Docker != nil && len(app.Container.Docker.PortMappings) > 0 && len(app.PortDefinitions) > 0 {
+			v.add(path+"/portDefinitions", "must be empty when the container declares port mappings")
+		}
+	}
+	for i, hc := range app.HealthChecks {
+		v.healthCheck(fmt.Sprintf("%s/healthChecks(%d)", path, i), hc, ports)
+	}
+
+	names := make(map[string]bool, len(app.ReadinessChecks))
+	for i, rc := range app.ReadinessChecks {
+		p := fmt.Sprintf("%s/readinessChecks(%d)", path, i)
+		switch rc.Protocol {
+		case "", ProtocolHTTP, ProtocolHTTPS:
+		default:
+			v.add(p+"/protocol", "unsupported protocol %q", rc.Protocol)
+		}
+		if names[rc.name()] {
+			v.add(p+"/name", "duplicate name %q", rc.name())
+		}
+		names[rc.name()] = true
+		if rc.PortIndex < 0 || (ports > 0 && rc.PortIndex >= ports) {
+			v.add(p+"/portIndex", "must address one of the %d ports of the app", ports)
+		}
+		if rc.IntervalSeconds < 0 || rc.TimeoutSeconds < 0 {
+			v.add(p, "intervalSeconds and timeoutSeconds must not be negative")
+		}
+		for _, code := range rc.HTTPStatusCodesForReady {
+			if code < 100 || code > 599 {
+				v.add(p+"/httpStatusCodesForReady", "invalid status code %d", code)
+			}
+		}
+	}
+}
+
+// healthCheck checks a health check of an app declaring the given number
+// of ports
+func (v *validator) healthCheck(path string, hc *HealthCheck, ports int) {
+	switch hc.Protocol {
+	case ProtocolHTTP, ProtocolHTTPS, ProtocolTCP:
+	default:
+		v.add(path+"/protocol", "unsupported protocol %q", hc.Protocol)
+	}
+	if hc.Port != 0 {
+		v.port(path+"/port", hc.Port)
+	} else if hc.PortIndex < 0 || (ports > 0 && hc.PortIndex >= ports) {
+		v.add(path+"/portIndex", "must address one of the %d ports of the app", ports)
+	}
+	if hc.Path != "" && hc.Protocol == ProtocolTCP {
+		v.add(path+"/path", "is only supported by HTTP and HTTPS checks")
+	}
+	if hc.GracePeriodSeconds < 0 || hc.IntervalSeconds < 0 || hc.TimeoutSeconds < 0 || hc.MaxConsecutiveFailures < 0 {
+		v.add(path, "durations and maxConsecutiveFailures must not be negative")
+	}
+	if hc.TimeoutSeconds > 0 && hc.IntervalSeconds > 0 && hc.TimeoutSeconds >= hc.IntervalSeconds {
+		v.add(path+"/timeoutSeconds", "must be smaller than intervalSeconds")
+	}
+}
+
+func (v *validator) container(path string, c *Container) {
+	switch c.Type {
+	case "DOCKER", "MESOS":
+	default:
+		v.add(path+"/type", "must be DOCKER or MESOS")
+	}
+	if c.Type == "DOCKER" && c.Docker == nil {
+		v.add(path+"/docker", "must be set for DOCKER containers")
+	}
+	if c.Docker == nil {
+		return
+	}
+
+	d := c.Docker
+	path += "/docker"
+	if strings.TrimSpace(d.Image) == "" {
+		v.add(path+"/image", "must not be empty")
+	}
+	switch d.Network {
+	case "", "HOST", "BRIDGE", "USER", "NONE":
+	default:
+		v.add(path+"/network", "must be HOST, BRIDGE, USER or NONE")
+	}
+	if len(d.PortMappings) > 0 && d.Network != "BRIDGE" && d.Network != "USER" {
+		v.add(path+"/portMappings", "are only supported with BRIDGE or USER networking")
+	}
+
+	hostPorts := make(map[int]bool)
+	for i, pm := range d.PortMappings {
+		p := fmt.Sprintf("%s/portMappings(%d)", path, i)
+		v.port(p+"/containerPort", pm.ContainerPort)
+		v.port(p+"/hostPort", pm.HostPort)
+		v.port(p+"/servicePort", pm.ServicePort)
+		v.protocol(p+"/protocol", pm.Protocol)
+		if pm.HostPort != 0 {
+			if hostPorts[pm.HostPort] {
+				v.add(p+"/hostPort", "duplicate host port %d", pm.HostPort)
+			}
+			hostPorts[pm.HostPort] = true
+		}
+	}
+	for i, param := range d.Parameters {
+		if strings.TrimSpace(param.Key) == "" {
+			v.add(fmt.Sprintf("%s/parameters(%d)/key", path, i), "must not be empty")
+		}
+	}
+}
+
+// port checks a port number, where 0 requests any port
+func (v *validator) port(path string, port int) {
+	if port < 0 || port > 65535 {
+		v.add(path, "must be between 0 and 65535")
+	}
+}
+
+// protocol checks the protocol of a port
+func (v *validator) protocol(path, protocol string) {
+	for _, part := range strings.Split(protocol, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "", "tcp", "udp":
+		default:
+			v.add(path, "must be tcp, udp or udp,tcp")
+			return
+		}
+	}
+}
+
+// writeError writes an API error, as JSON for validation errors
+func writeError(w http.ResponseWriter, err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(validationErr)
+		return
+	}
+	http.Error(w, err.Error(), errorStatus(err))
+}
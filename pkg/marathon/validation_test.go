@@ -0,0 +1,153 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateApp(t *testing.T) {
+	valid := func() *Application {
+		return &Application{ID: "/prod/web-1", Instances: 2, CPUs: 0.5, Memory: 128}
+	}
+	docker := func(pms ...*PortMapping) *Container {
+		return &Container{Type: "DOCKER", Docker: &DockerSpec{Image: "nginx", Network: "BRIDGE", PortMappings: pms}}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(app *Application)
+		want   map[string][]string
+	}{
+		{"valid", func(app *Application) {}, nil},
+		{"relative id", func(app *Application) { app.ID = "../web" }, nil},
+		{"empty id", func(app *Application) { app.ID = "/" }, map[string][]string{"/id": {"must not be empty"}}},
+		{"invalid id", func(app *Application) { app.ID = "/Prod/web" }, map[string][]string{
+			"/id": {`path segment "Prod" must consist of lowercase letters, digits, hyphens and dots`}}},
+		{"resources", func(app *Application) { app.Instances, app.CPUs, app.Memory = -1, 0, -1 }, map[string][]string{
+			"/instances": {"must not be negative"},
+			"/cpus":      {"must be greater than 0"},
+			"/mem":       {"must not be negative"},
+		}},
+		{"constraint", func(app *Application) { app.Constraints = [][]string{{"rack", "MAX_PER"}} }, map[string][]string{
+			"/constraints(0)": {`MAX_PER requires a positive integer, got ""`}}},
+		{"health check", func(app *Application) {
+			app.PortDefinitions = []*PortDefinition{{}}
+			app.HealthChecks = []*HealthCheck{{Protocol: "COMMAND", PortIndex: 1, IntervalSeconds: 5, TimeoutSeconds: 10}}
+		}, map[string][]string{
+			"/healthChecks(0)/protocol":       {`unsupported protocol "COMMAND"`},
+			"/healthChecks(0)/portIndex":      {"must address one of the 1 ports of the app"},
+			"/healthChecks(0)/timeoutSeconds": {"must be smaller than intervalSeconds"},
+		}},
+		{"port mappings", func(app *Application) {
+			app.Container = docker(&PortMapping{ContainerPort: 70000, HostPort: 31000, Protocol: "sctp"},
+				&PortMapping{ContainerPort: 80, HostPort: 31000})
+		}, map[string][]string{
+			"/container/docker/portMappings(0)/containerPort": {"must be between 0 and 65535"},
+			"/container/docker/portMappings(0)/protocol":      {"must be tcp, udp or udp,tcp"},
+			"/container/docker/portMappings(1)/hostPort":      {"duplicate host port 31000"},
+		}},
+		{"port mappings on host network", func(app *Application) {
+			app.Container = docker(&PortMapping{ContainerPort: 80})
+			app.Container.Docker.Network = "HOST"
+		}, map[string][]string{
+			"/container/docker/portMappings": {"are only supported with BRIDGE or USER networking"}}},
+		{"docker", func(app *Application) {
+			app.Container = docker()
+			app.Container.Docker.Image = ""
+			app.Container.Docker.Network = "OVERLAY"
+			app.Container.Docker.Parameters = []*Parameter{{Key: "label", Value: "a=b"}, {Value: "x"}}
+		}, map[string][]string{
+			"/container/docker/image":             {"must not be empty"},
+			"/container/docker/network":           {"must be HOST, BRIDGE, USER or NONE"},
+			"/container/docker/parameters(1)/key": {"must not be empty"},
+		}},
+		{"unreachable strategy", func(app *Application) {
+			app.UnreachableStrategy = &UnreachableStrategy{InactiveAfterSeconds: 60, ExpungeAfterSeconds: 30}
+		}, map[string][]string{
+			"/unreachableStrategy/expungeAfterSeconds": {"must not be smaller than inactiveAfterSeconds"}}},
+		{"container type", func(app *Application) { app.Container = &Container{Type: "RKT"} }, map[string][]string{
+			"/container/type": {"must be DOCKER or MESOS"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := valid()
+			tt.modify(app)
+			err := ValidateApp(app)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			got := make(map[string][]string)
+			for _, v := range validationErr.Details {
+				got[v.Path] = v.Errors
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, http.StatusUnprocessableEntity, errorStatus(err))
+		})
+	}
+}
+
+func TestValidateGroup(t *testing.T) {
+	assert.NoError(t, ValidateGroup(testGroup()))
+
+	group := testGroup()
+	group.Groups[0].Apps[1].CPUs = 0
+	group.Groups[0].Dependencies = []string{"/Prod/db"}
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, ValidateGroup(group), &validationErr)
+	paths := make([]string, 0)
+	for _, v := range validationErr.Details {
+		paths = append(paths, v.Path)
+	}
+	assert.Equal(t, []string{"/groups(0)/dependencies(0)", "/groups(0)/apps(1)/cpus"}, paths)
+}
+
+func TestMarathon_HandleCreateAppValidation(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	// Omitted resources take Marathon's defaults
+	w := post("/v2/apps", `{"id": "/web"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	app := marathon.Applications["/web"]
+	assert.Equal(t, DefaultAppInstances, app.Instances)
+	assert.Equal(t, DefaultAppCPUs, app.CPUs)
+	assert.Equal(t, DefaultAppMemory, app.Memory)
+
+	assert.Equal(t, http.StatusConflict, post("/v2/apps", `{"id": "/web"}`).Code)
+
+	w = post("/v2/apps", `{"id": "", "cpus": 0, "instances": -2}`)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"message": "Object is not valid", "details": [
+		{"path": "/id", "errors": ["must not be empty"]},
+		{"path": "/instances", "errors": ["must not be negative"]},
+		{"path": "/cpus", "errors": ["must be greater than 0"]}
+	]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/v2/apps/web?force=true", bytes.NewBufferString(`{"mem": -1}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var group bytes.Buffer
+	require.NoError(t, json.NewEncoder(&group).Encode(&Group{ID: "/prod", Apps: []*Application{{ID: "db", Instances: 1}}}))
+	w = post("/v2/groups", group.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "/apps(0)/cpus")
+}
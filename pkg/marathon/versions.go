@@ -0,0 +1,142 @@
+package marathon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// maxAppVersions is the number of definitions kept per app; older ones are
+// dropped first
+const maxAppVersions = 50
+
+// ErrVersionNotFound is returned when an app has no definition with the
+// requested version
+var ErrVersionNotFound = errors.New("app version not found")
+
+// recordVersion stores an app definition under its version. The caller
+// must hold m.mu.
+func (m *Marathon) recordVersion(app *Application) {
+	versions := append(m.versions[app.ID], snapshotApp(app))
+	if len(versions) > maxAppVersions {
+		versions = versions[len(versions)-maxAppVersions:]
+	}
+	m.versions[app.ID] = versions
+}
+
+// ListAppVersions returns the stored versions of an app, newest first
+func (m *Marathon) ListAppVersions(appID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.Applications[appID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+
+	stored := m.versions[appID]
+	versions := make([]string, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		versions = append(versions, stored[i].Version)
+	}
+	return versions, nil
+}
+
+// GetAppVersion returns a copy of the app definition stored under version
+func (m *Marathon) GetAppVersion(appID, version string) (*Application, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, err := m.appVersion(appID, version)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotApp(app), nil
+}
+
+// appVersion looks up a stored app definition. The caller must hold m.mu.
+func (m *Marathon) appVersion(appID, version string) (*Application, error) {
+	if _, exists := m.Applications[appID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	for _, app := range m.versions[appID] {
+		if app.Version == version {
+			return app, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrVersionNotFound, appID, version)
+}
+
+// RollbackApp redeploys a previous definition of an app through a regular
+// deployment plan. The redeployed definition gets a new version.
+func (m *Marathon) RollbackApp(appID, version string) error {
+	_, err := m.rollbackApp(appID, version, true)
+	return err
+}
+
+func (m *Marathon) rollbackApp(appID, version string, force bool) (*Deployment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.persist()
+
+	previous, err := m.appVersion(appID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	target := snapshotApp(previous)
+	deployment, err := m.deploy(map[string]*Application{appID: target}, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	m.publishAPIPost(target)
+	log.Printf("Rolled back application %s to version %s", appID, version)
+	return deployment, nil
+}
+
+func (m *Marathon) handleListAppVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := m.ListAppVersions(m.appIDFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"versions": versions})
+}
+
+func (m *Marathon) handleGetAppVersion(w http.ResponseWriter, r *http.Request) {
+	app, err := m.GetAppVersion(m.appIDFromRequest(r), mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app)
+}
+
+// rollbackVersion returns the version requested by an app update body of
+// the form {"version": "..."}. Full definitions, which carry the version of
+// the app they were read from, are regular updates.
+func rollbackVersion(body []byte) (string, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", false, err
+	}
+	raw, exists := fields["version"]
+	delete(fields, "id")
+	if !exists || len(fields) > 1 {
+		return "", false, nil
+	}
+
+	var version string
+	if err := json.Unmarshal(raw, &version); err != nil || version == "" {
+		return "", false, errors.New("version must be a non-empty string")
+	}
+	return version, true, nil
+}
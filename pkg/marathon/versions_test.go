@@ -0,0 +1,165 @@
+package marathon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarathon_AppVersions(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 1, CPUs: 1.0}))
+	first := marathon.Applications["/app"].Version
+	completeDeployments(t, marathon)
+
+	require.NoError(t, marathon.UpdateApp("/app", &Application{ID: "/app", Instances: 1, CPUs: 2.0}))
+	second := marathon.Applications["/app"].Version
+	completeDeployments(t, marathon)
+
+	// Scaling keeps the current version
+	require.NoError(t, marathon.ScaleApp("/app", 2))
+
+	versions, err := marathon.ListAppVersions("/app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{second, first}, versions)
+
+	app, err := marathon.GetAppVersion("/app", first)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, app.CPUs)
+	assert.Empty(t, app.Tasks)
+
+	_, err = marathon.GetAppVersion("/app", "1970-01-01T00:00:00.000Z")
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+	_, err = marathon.ListAppVersions("/missing")
+	assert.ErrorIs(t, err, ErrAppNotFound)
+
+	// Deleting an app drops its history
+	require.NoError(t, marathon.DeleteApp("/app"))
+	assert.NotContains(t, marathon.versions, "/app")
+}
+
+func TestMarathon_AppVersionsLimit(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 0}))
+	for i := 0; i < maxAppVersions+5; i++ {
+		require.NoError(t, marathon.UpdateApp("/app", &Application{ID: "/app", Instances: 0, Memory: float64(i + 1)}))
+	}
+
+	versions, err := marathon.ListAppVersions("/app")
+	require.NoError(t, err)
+	assert.Len(t, versions, maxAppVersions)
+	assert.Equal(t, marathon.Applications["/app"].Version, versions[0])
+}
+
+func TestMarathon_RollbackApp(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/app", Instances: 2, CPUs: 1.0}))
+	first := marathon.Applications["/app"].Version
+	completeDeployments(t, marathon)
+
+	require.NoError(t, marathon.UpdateApp("/app", &Application{ID: "/app", Instances: 2, CPUs: 2.0}))
+	completeDeployments(t, marathon)
+
+	deployment, err := marathon.rollbackApp("/app", first, false)
+	require.NoError(t, err)
+	require.Len(t, deployment.Steps, 1)
+	assert.Equal(t, ActionRestartApplication, deployment.Steps[0].Action)
+	completeDeployments(t, marathon)
+
+	app := marathon.Applications["/app"]
+	assert.Equal(t, 1.0, app.CPUs)
+	assert.NotEqual(t, first, app.Version, "a rollback is deployed as a new version")
+	assert.Len(t, app.Tasks, 2)
+	for _, task := range app.Tasks {
+		assert.Equal(t, app.Version, task.Version)
+	}
+
+	versions, err := marathon.ListAppVersions("/app")
+	require.NoError(t, err)
+	assert.Len(t, versions, 3)
+
+	assert.ErrorIs(t, marathon.RollbackApp("/app", "unknown"), ErrVersionNotFound)
+}
+
+func TestRollbackVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		version     string
+		rollback    bool
+		expectError bool
+	}{
+		{"Version only", `{"version": "2024-01-01T00:00:00.000Z"}`, "2024-01-01T00:00:00.000Z", true, false},
+		{"Version with id", `{"id": "/app", "version": "v1"}`, "v1", true, false},
+		{"Full definition", `{"id": "/app", "instances": 2, "version": "v1"}`, "", false, false},
+		{"No version", `{"instances": 2}`, "", false, false},
+		{"Empty version", `{"version": ""}`, "", false, true},
+		{"Invalid JSON", `{`, "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, rollback, err := rollbackVersion([]byte(tt.body))
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, version)
+			assert.Equal(t, tt.rollback, rollback)
+		})
+	}
+}
+
+func TestMarathon_AppVersionHTTPHandlers(t *testing.T) {
+	marathon := NewMarathon("test-marathon", "localhost", 8080, "http://localhost:5050")
+	router := marathon.setupRoutes()
+
+	require.NoError(t, marathon.CreateApp(&Application{ID: "/prod/app", Instances: 1, CPUs: 1.0}))
+	first := marathon.Applications["/prod/app"].Version
+	completeDeployments(t, marathon)
+	require.NoError(t, marathon.UpdateApp("/prod/app", &Application{Instances: 1, CPUs: 2.0}))
+	completeDeployments(t, marathon)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/apps/prod/app/versions", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list map[string][]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(t, list["versions"], 2)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/apps/prod/app/versions/"+first, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var app Application
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &app))
+	assert.Equal(t, first, app.Version)
+	assert.Equal(t, 1.0, app.CPUs)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/apps/prod/app/versions/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v2/apps/missing/versions", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	body, _ := json.Marshal(map[string]string{"version": first})
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v2/apps/prod/app", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var result map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Contains(t, marathon.Deployments, result["deploymentId"])
+
+	completeDeployments(t, marathon)
+	assert.Equal(t, 1.0, marathon.Applications["/prod/app"].CPUs)
+}
@@ -1,15 +1,27 @@
 package scheduler
 
 import (
+	"fmt"
 	"math"
 	"sort"
 	"sync"
+	"time"
 )
 
 // DRFScheduler implements Dominant Resource Fairness algorithm
 // Ensures fair resource allocation across multiple tenants in multi-resource environments
 type DRFScheduler struct {
 	tenants      map[string]*Tenant
+	tasks        map[string]*RunningTask
+	runtimes     []taskRuntime
+	pending      []*PendingTask
+	gangs        map[string]*Gang
+	gangHistory  []string // IDs of finished gangs, oldest first
+	nodes        map[string]*Node
+	untracked    []*RunningTask
+	scorer       PlacementScorer
+	classes      map[string]int
+	onScheduled  func(RunningTask)
 	clusterTotal Resources
 	mu           sync.RWMutex
 }
@@ -24,8 +36,11 @@ type Tenant struct {
 	AllocatedGPU     float64
 	DominantShare    float64
 	WeightedShare    float64
-	Quota            Resources
+	Quota            Resources // Limit of the tenant and its children
+	Guaranteed       Resources // Reserved capacity, lent to siblings while idle
+	Parent           string    // Parent tenant in the quota hierarchy
 	Usage            Resources
+	QueueLimit       int // Max pending tasks (default: 100)
 }
 
 // Resources represents multi-dimensional resources
@@ -41,12 +56,27 @@ type TaskRequest struct {
 	TenantID  string
 	TaskID    string
 	Resources Resources
+	Priority  int // Higher priority tasks may preempt lower priority ones
+	// PriorityClass sets Priority to the value of a registered class
+	PriorityClass string
+}
+
+// RunningTask is a scheduled task holding resources until it is released
+type RunningTask struct {
+	TaskRequest
+	StartedAt time.Time
+	NodeID    string // Node the task is placed on, if nodes are registered
 }
 
 // NewDRFScheduler creates a new DRF scheduler
 func NewDRFScheduler(clusterTotal Resources) *DRFScheduler {
 	return &DRFScheduler{
 		tenants:      make(map[string]*Tenant),
+		tasks:        make(map[string]*RunningTask),
+		gangs:        make(map[string]*Gang),
+		nodes:        make(map[string]*Node),
+		scorer:       BestFitScorer{},
+		classes:      defaultPriorityClasses(),
 		clusterTotal: clusterTotal,
 	}
 }
@@ -79,34 +109,83 @@ func (d *DRFScheduler) ScheduleTask(request TaskRequest) (bool, string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	return d.schedule(request)
+}
+
+// schedule allocates the resources of a task if they fit. The caller must
+// hold d.mu.
+func (d *DRFScheduler) schedule(request TaskRequest) (bool, string) {
 	tenant, exists := d.tenants[request.TenantID]
 	if !exists {
 		return false, "tenant not found"
 	}
+	if _, running := d.tasks[request.TaskID]; running && request.TaskID != "" {
+		return false, "task already scheduled"
+	}
+	if !d.resolvePriority(&request) {
+		return false, "unknown priority class"
+	}
+
+	if reason := d.fitReason(tenant, request.Resources); reason != "" {
+		return false, reason
+	}
+	nodeID := d.allocate(tenant, request.Resources)
+
+	// Track the task so it can be released or preempted by ID
+	if request.TaskID != "" {
+		d.tasks[request.TaskID] = &RunningTask{TaskRequest: request, StartedAt: time.Now(), NodeID: nodeID}
+	} else if nodeID != "" {
+		// Remember where tasks without an ID run to free their node
+		d.untracked = append(d.untracked, &RunningTask{TaskRequest: request, StartedAt: time.Now(), NodeID: nodeID})
+	}
+
+	return true, "scheduled"
+}
 
+// fitReason returns why resources do not fit a tenant's quota, the cluster
+// or any single registered node, or an empty string if they fit. The caller
+// must hold d.mu.
+func (d *DRFScheduler) fitReason(tenant *Tenant, resources Resources) string {
 	// Check if tenant has quota available
-	if !d.checkQuota(tenant, request.Resources) {
-		return false, "quota exceeded"
+	if !d.checkQuota(tenant, resources) {
+		return "quota exceeded"
+	}
+	if reason := d.hierarchyReason(tenant, resources); reason != "" {
+		return reason
 	}
 
 	// Check if cluster has resources available
-	if !d.checkClusterCapacity(request.Resources) {
-		return false, "insufficient cluster resources"
+	if !d.checkClusterCapacity(resources) {
+		return "insufficient cluster resources"
+	}
+
+	// Free resources spread over several nodes do not fit a task
+	if len(d.nodes) > 0 && d.bestNode(resources) == nil {
+		return "no single node fits"
 	}
+	return ""
+}
+
+// allocate assigns resources to a tenant and places them on the best node,
+// returning its ID. The caller must hold d.mu.
+func (d *DRFScheduler) allocate(tenant *Tenant, resources Resources) string {
+	d.charge(tenant, resources)
+	return d.place(resources)
+}
 
-	// Allocate resources
-	tenant.AllocatedCPU += request.Resources.CPU
-	tenant.AllocatedMemory += request.Resources.Memory
-	tenant.AllocatedGPU += request.Resources.GPU
-	tenant.Usage.CPU += request.Resources.CPU
-	tenant.Usage.Memory += request.Resources.Memory
-	tenant.Usage.GPU += request.Resources.GPU
-	tenant.Usage.Disk += request.Resources.Disk
+// charge adds resources to a tenant's allocation. The caller must hold
+// d.mu.
+func (d *DRFScheduler) charge(tenant *Tenant, resources Resources) {
+	tenant.AllocatedCPU += resources.CPU
+	tenant.AllocatedMemory += resources.Memory
+	tenant.AllocatedGPU += resources.GPU
+	tenant.Usage.CPU += resources.CPU
+	tenant.Usage.Memory += resources.Memory
+	tenant.Usage.GPU += resources.GPU
+	tenant.Usage.Disk += resources.Disk
 
 	// Update dominant share
 	d.updateDominantShare(tenant)
-
-	return true, "scheduled"
 }
 
 // checkQuota validates tenant quota limits
@@ -188,8 +267,13 @@ func (d *DRFScheduler) GetSchedulingOrder() []*Tenant {
 	return tenantList
 }
 
-// ReleaseResources releases resources when a task completes
+// ReleaseResources releases resources when a task completes. The oldest
+// tracked task of the tenant with the same resources is released like
+// ReleaseTask, so it can be scheduled again and is not preempted. Pending
+// tasks that fit now are scheduled.
 func (d *DRFScheduler) ReleaseResources(tenantID string, resources Resources) error {
+	var scheduled []RunningTask
+	defer func() { d.notifyScheduled(scheduled) }()
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -198,6 +282,82 @@ func (d *DRFScheduler) ReleaseResources(tenantID string, resources Resources) er
 		return nil
 	}
 
+	if task := d.matchingTask(tenantID, resources); task != nil {
+		d.finishTask(task, time.Now())
+	} else {
+		d.release(tenant, resources)
+		d.unplaceUntracked(tenantID, resources)
+	}
+	scheduled = d.scheduleWaiting()
+	return nil
+}
+
+// matchingTask returns the oldest tracked task of a tenant with the given
+// resources, or nil. The caller must hold d.mu.
+func (d *DRFScheduler) matchingTask(tenantID string, resources Resources) *RunningTask {
+	var match *RunningTask
+	for _, task := range d.tasks {
+		if task.TenantID != tenantID || task.Resources != resources {
+			continue
+		}
+		if match == nil || task.StartedAt.Before(match.StartedAt) ||
+			(task.StartedAt.Equal(match.StartedAt) && task.TaskID < match.TaskID) {
+			match = task
+		}
+	}
+	return match
+}
+
+// finishTask stops tracking a completed task, remembers its runtime and
+// releases its resources. The caller must hold d.mu.
+func (d *DRFScheduler) finishTask(task *RunningTask, finishedAt time.Time) {
+	delete(d.tasks, task.TaskID)
+	d.recordRuntime(task, finishedAt)
+	if tenant, exists := d.tenants[task.TenantID]; exists {
+		d.release(tenant, task.Resources)
+	}
+	d.unplace(task.NodeID, task.Resources)
+}
+
+// ReleaseTask releases the resources of a scheduled task when it completes.
+// Its runtime is remembered to estimate wait times, and pending tasks that
+// fit now are scheduled.
+func (d *DRFScheduler) ReleaseTask(taskID string) error {
+	var scheduled []RunningTask
+	defer func() { d.notifyScheduled(scheduled) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	task, exists := d.tasks[taskID]
+	if !exists {
+		return fmt.Errorf("task %s is not running", taskID)
+	}
+
+	d.finishTask(task, time.Now())
+	scheduled = d.scheduleWaiting()
+	return nil
+}
+
+// GetRunningTasks returns the tracked tasks of a tenant, oldest first
+func (d *DRFScheduler) GetRunningTasks(tenantID string) []RunningTask {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	tasks := make([]RunningTask, 0)
+	for _, task := range d.tasks {
+		if task.TenantID == tenantID {
+			tasks = append(tasks, *task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].StartedAt.Before(tasks[j].StartedAt)
+	})
+	return tasks
+}
+
+// release returns resources of a tenant to the cluster. The caller must hold
+// d.mu.
+func (d *DRFScheduler) release(tenant *Tenant, resources Resources) {
 	tenant.AllocatedCPU -= resources.CPU
 	tenant.AllocatedMemory -= resources.Memory
 	tenant.AllocatedGPU -= resources.GPU
@@ -219,8 +379,6 @@ func (d *DRFScheduler) ReleaseResources(tenantID string, resources Resources) er
 
 	// Update dominant share
 	d.updateDominantShare(tenant)
-
-	return nil
 }
 
 // GetTenantStats returns current allocation stats for a tenant
@@ -241,12 +399,10 @@ func (d *DRFScheduler) GetTenantStats(tenantID string) (*TenantStats, error) {
 		CPUUtilization:   tenant.Usage.CPU / tenant.Quota.CPU,
 		MemoryUtilization: tenant.Usage.Memory / tenant.Quota.Memory,
 		GPUUtilization:   tenant.Usage.GPU / tenant.Quota.GPU,
-		QuotaRemaining: Resources{
-			CPU:    tenant.Quota.CPU - tenant.Usage.CPU,
-			Memory: tenant.Quota.Memory - tenant.Usage.Memory,
-			GPU:    tenant.Quota.GPU - tenant.Usage.GPU,
-			Disk:   tenant.Quota.Disk - tenant.Usage.Disk,
-		},
+		QuotaRemaining:   d.headroom(tenant),
+		Guaranteed:       tenant.Guaranteed,
+		Borrowed:         d.borrowed(tenant),
+		Lent:             d.lent(tenant),
 	}, nil
 }
 
@@ -259,7 +415,10 @@ type TenantStats struct {
 	CPUUtilization    float64
 	MemoryUtilization float64
 	GPUUtilization    float64
-	QuotaRemaining    Resources
+	QuotaRemaining    Resources // Including capacity that may be borrowed
+	Guaranteed        Resources
+	Borrowed          Resources // Guaranteed capacity of siblings in use
+	Lent              Resources // Idle guaranteed capacity in use by siblings
 }
 
 // GetClusterUtilization returns overall cluster resource utilization
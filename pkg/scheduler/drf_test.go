@@ -678,3 +678,26 @@ func TestDRFScheduler_EdgeCases(t *testing.T) {
 		assert.Equal(t, "scheduled", reason)
 	})
 }
+
+func TestDRFScheduler_ReleaseTask(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 100, Memory: 1000, GPU: 10, Disk: 5000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 50, Memory: 500, GPU: 5, Disk: 2500}, 1.0)
+
+	request := TaskRequest{TenantID: "tenant-1", TaskID: "task-1", Resources: Resources{CPU: 10, Memory: 100}, Priority: 3}
+	allowed, _ := scheduler.ScheduleTask(request)
+	assert.True(t, allowed)
+
+	allowed, reason := scheduler.ScheduleTask(request)
+	assert.False(t, allowed)
+	assert.Equal(t, "task already scheduled", reason)
+
+	tasks := scheduler.GetRunningTasks("tenant-1")
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, 3, tasks[0].Priority)
+	assert.False(t, tasks[0].StartedAt.IsZero())
+
+	assert.NoError(t, scheduler.ReleaseTask("task-1"))
+	assert.Equal(t, 0.0, scheduler.tenants["tenant-1"].AllocatedCPU)
+	assert.Empty(t, scheduler.GetRunningTasks("tenant-1"))
+	assert.Error(t, scheduler.ReleaseTask("task-1"))
+}
@@ -0,0 +1,361 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultGangTimeout bounds how long a gang holds partial reservations
+	defaultGangTimeout = 5 * time.Minute
+	// maxGangHistory bounds the number of finished gangs remembered
+	maxGangHistory = 100
+)
+
+// GangState is the admission state of a gang
+type GangState string
+
+const (
+	GangWaiting   GangState = "waiting"   // Reserving resources for its tasks
+	GangAdmitted  GangState = "admitted"  // All tasks scheduled together
+	GangTimedOut  GangState = "timed-out" // Reservations released after the timeout
+	GangCancelled GangState = "cancelled" // Reservations released on request
+)
+
+// GangRequest is a group of tasks that only run together, such as the
+// workers of a distributed training job. Either all tasks are scheduled or
+// none are.
+type GangRequest struct {
+	ID      string
+	Tasks   []TaskRequest
+	Timeout time.Duration // How long partial reservations are held (default: 5m)
+}
+
+// Gang tracks the admission of a gang request. Resources are reserved for
+// its tasks as they become available, so a large gang is not starved by
+// smaller requests, and released if not all tasks fit before the timeout,
+// so gangs holding each other's resources do not deadlock.
+type Gang struct {
+	GangRequest
+	State       GangState
+	SubmittedAt time.Time
+	Deadline    time.Time
+	reserved    map[string]bool
+	nodes       map[string]string
+	waiting     map[string]string
+	timer       *time.Timer
+}
+
+// GangStatus explains the admission state of a gang
+type GangStatus struct {
+	ID          string
+	State       GangState
+	SubmittedAt time.Time
+	Deadline    time.Time
+	Reserved    []string          // Tasks holding reserved resources
+	Waiting     map[string]string // Why the other tasks do not fit yet
+	Reason      string
+}
+
+// SubmitGang admits a gang if all its tasks fit, and otherwise reserves
+// resources for the tasks that fit and waits for the rest. Tasks of an
+// admitted gang are running tasks, released one by one with ReleaseTask.
+func (d *DRFScheduler) SubmitGang(request GangRequest) (*GangStatus, error) {
+	var scheduled []RunningTask
+	defer func() { d.notifyScheduled(scheduled) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.validateGang(&request); err != nil {
+		return nil, err
+	}
+	if request.Timeout <= 0 {
+		request.Timeout = defaultGangTimeout
+	}
+
+	now := time.Now()
+	gang := &Gang{
+		GangRequest: request,
+		State:       GangWaiting,
+		SubmittedAt: now,
+		Deadline:    now.Add(request.Timeout),
+		reserved:    make(map[string]bool),
+		nodes:       make(map[string]string),
+		waiting:     make(map[string]string),
+	}
+	d.forgetGang(request.ID)
+	d.gangs[request.ID] = gang
+
+	scheduled = d.reserveGang(gang, now)
+	if gang.State == GangWaiting {
+		gang.timer = time.AfterFunc(request.Timeout, func() { d.expireGang(request.ID) })
+		log.Printf("Gang %s waiting: %s", gang.ID, gangReason(gang))
+	}
+	return gangStatus(gang), nil
+}
+
+// validateGang checks that a gang is well formed and could fit once enough
+// resources are released, resolving the priorities of its tasks. The caller
+// must hold d.mu.
+func (d *DRFScheduler) validateGang(request *GangRequest) error {
+	if request.ID == "" {
+		return fmt.Errorf("gang ID required")
+	}
+	if gang, exists := d.gangs[request.ID]; exists && gang.State == GangWaiting {
+		return fmt.Errorf("gang %s is already waiting", request.ID)
+	}
+	if len(request.Tasks) == 0 {
+		return fmt.Errorf("gang %s has no tasks", request.ID)
+	}
+
+	tasks := make([]TaskRequest, len(request.Tasks))
+	seen := make(map[string]bool)
+	totals := make(map[string]Resources)
+	var total Resources
+	for i, task := range request.Tasks {
+		if _, exists := d.tenants[task.TenantID]; !exists {
+			return fmt.Errorf("gang %s: tenant %s not found", request.ID, task.TenantID)
+		}
+		if task.TaskID == "" {
+			return fmt.Errorf("gang %s: task ID required", request.ID)
+		}
+		if _, running := d.tasks[task.TaskID]; running || seen[task.TaskID] ||
+			d.pendingIndex(task.TaskID) >= 0 || d.waitingGangMember(task.TaskID) {
+			return fmt.Errorf("gang %s: task %s already scheduled", request.ID, task.TaskID)
+		}
+		if !d.resolvePriority(&task) {
+			return fmt.Errorf("gang %s: unknown priority class %s", request.ID, task.PriorityClass)
+		}
+		if !d.fitsEmptyNode(task.Resources) {
+			return fmt.Errorf("gang %s: task %s exceeds every node", request.ID, task.TaskID)
+		}
+		seen[task.TaskID] = true
+		tasks[i] = task
+		totals[task.TenantID] = totals[task.TenantID].add(task.Resources)
+		total = total.add(task.Resources)
+	}
+
+	// Gangs that can never fit would hold reservations for nothing
+	if tenantID := d.limitExceeded(totals); tenantID != "" {
+		return fmt.Errorf("gang %s exceeds the quota of tenant %s", request.ID, tenantID)
+	}
+	if tooLarge := shortage(Resources{}, total, d.clusterTotal); tooLarge.CPU > 0 || tooLarge.Memory > 0 || tooLarge.GPU > 0 {
+		return fmt.Errorf("gang %s exceeds cluster capacity", request.ID)
+	}
+
+	request.Tasks = tasks
+	return nil
+}
+
+// reserveGang reserves resources for the tasks of a waiting gang that fit
+// and admits the gang once all are reserved, returning its tasks. The caller
+// must hold d.mu.
+func (d *DRFScheduler) reserveGang(gang *Gang, now time.Time) []RunningTask {
+	for _, task := range gang.Tasks {
+		if gang.reserved[task.TaskID] {
+			continue
+		}
+		tenant := d.tenants[task.TenantID]
+		if reason := d.fitReason(tenant, task.Resources); reason != "" {
+			gang.waiting[task.TaskID] = reason
+			continue
+		}
+		gang.nodes[task.TaskID] = d.allocate(tenant, task.Resources)
+		gang.reserved[task.TaskID] = true
+		delete(gang.waiting, task.TaskID)
+	}
+	if len(gang.reserved) < len(gang.Tasks) {
+		return nil
+	}
+
+	gang.State = GangAdmitted
+	if gang.timer != nil {
+		gang.timer.Stop()
+	}
+	d.finishGang(gang)
+	admitted := make([]RunningTask, 0, len(gang.Tasks))
+	for _, task := range gang.Tasks {
+		running := &RunningTask{TaskRequest: task, StartedAt: now, NodeID: gang.nodes[task.TaskID]}
+		d.tasks[task.TaskID] = running
+		admitted = append(admitted, *running)
+	}
+	log.Printf("Admitted gang %s with %d tasks after %s", gang.ID, len(gang.Tasks), now.Sub(gang.SubmittedAt).Round(time.Millisecond))
+	return admitted
+}
+
+// releaseGang releases the reservations of a waiting gang. The caller must
+// hold d.mu.
+func (d *DRFScheduler) releaseGang(gang *Gang, state GangState) {
+	for _, task := range gang.Tasks {
+		if gang.reserved[task.TaskID] {
+			d.release(d.tenants[task.TenantID], task.Resources)
+			d.unplace(gang.nodes[task.TaskID], task.Resources)
+		}
+	}
+	gang.reserved = make(map[string]bool)
+	gang.nodes = make(map[string]string)
+	gang.State = state
+	if gang.timer != nil {
+		gang.timer.Stop()
+	}
+	d.finishGang(gang)
+}
+
+// finishGang remembers a gang that is no longer waiting, forgetting the
+// oldest finished gangs beyond maxGangHistory. The caller must hold d.mu.
+func (d *DRFScheduler) finishGang(gang *Gang) {
+	d.gangHistory = append(d.gangHistory, gang.ID)
+	for len(d.gangHistory) > maxGangHistory {
+		delete(d.gangs, d.gangHistory[0])
+		d.gangHistory = d.gangHistory[1:]
+	}
+}
+
+// forgetGang removes a finished gang, such as one resubmitted under the same
+// ID. The caller must hold d.mu.
+func (d *DRFScheduler) forgetGang(gangID string) {
+	if _, exists := d.gangs[gangID]; !exists {
+		return
+	}
+	delete(d.gangs, gangID)
+	for i, id := range d.gangHistory {
+		if id == gangID {
+			d.gangHistory = append(d.gangHistory[:i], d.gangHistory[i+1:]...)
+			break
+		}
+	}
+}
+
+// expireGang releases the reservations of a gang still waiting at its
+// deadline
+func (d *DRFScheduler) expireGang(gangID string) {
+	var scheduled []RunningTask
+	defer func() { d.notifyScheduled(scheduled) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	gang, exists := d.gangs[gangID]
+	if !exists || gang.State != GangWaiting {
+		return
+	}
+	log.Printf("Gang %s timed out after %s: %s", gang.ID, gang.Timeout, gangReason(gang))
+	d.releaseGang(gang, GangTimedOut)
+	scheduled = d.scheduleWaiting()
+}
+
+// CancelGang releases the reservations of a waiting gang
+func (d *DRFScheduler) CancelGang(gangID string) error {
+	var scheduled []RunningTask
+	defer func() { d.notifyScheduled(scheduled) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	gang, exists := d.gangs[gangID]
+	if !exists || gang.State != GangWaiting {
+		return fmt.Errorf("gang %s is not waiting", gangID)
+	}
+	d.releaseGang(gang, GangCancelled)
+	scheduled = d.scheduleWaiting()
+	return nil
+}
+
+// GetGangStatus returns the admission state of a gang. Only the most recent
+// finished gangs are remembered.
+func (d *DRFScheduler) GetGangStatus(gangID string) (*GangStatus, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	gang, exists := d.gangs[gangID]
+	if !exists {
+		return nil, fmt.Errorf("gang %s not found", gangID)
+	}
+	return gangStatus(gang), nil
+}
+
+// scheduleWaiting hands released resources to waiting gangs, oldest first,
+// and then to pending tasks. The caller must hold d.mu.
+func (d *DRFScheduler) scheduleWaiting() []RunningTask {
+	waiting := make([]*Gang, 0)
+	for _, gang := range d.gangs {
+		if gang.State == GangWaiting {
+			waiting = append(waiting, gang)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].SubmittedAt.Before(waiting[j].SubmittedAt)
+	})
+
+	now := time.Now()
+	scheduled := make([]RunningTask, 0)
+	for _, gang := range waiting {
+		scheduled = append(scheduled, d.reserveGang(gang, now)...)
+	}
+	return append(scheduled, d.schedulePending()...)
+}
+
+// waitingGangMember reports whether a task belongs to a waiting gang. The
+// caller must hold d.mu.
+func (d *DRFScheduler) waitingGangMember(taskID string) bool {
+	for _, gang := range d.gangs {
+		if gang.State != GangWaiting {
+			continue
+		}
+		for _, task := range gang.Tasks {
+			if task.TaskID == taskID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gangStatus returns a copy of the state of a gang
+func gangStatus(gang *Gang) *GangStatus {
+	status := &GangStatus{
+		ID:          gang.ID,
+		State:       gang.State,
+		SubmittedAt: gang.SubmittedAt,
+		Deadline:    gang.Deadline,
+		Reserved:    make([]string, 0, len(gang.reserved)),
+		Waiting:     make(map[string]string),
+		Reason:      gangReason(gang),
+	}
+	for _, task := range gang.Tasks {
+		if gang.reserved[task.TaskID] {
+			status.Reserved = append(status.Reserved, task.TaskID)
+		} else if reason, waiting := gang.waiting[task.TaskID]; waiting && gang.State == GangWaiting {
+			status.Waiting[task.TaskID] = reason
+		}
+	}
+	return status
+}
+
+// gangReason summarizes why a gang is in its state
+func gangReason(gang *Gang) string {
+	switch gang.State {
+	case GangAdmitted:
+		return fmt.Sprintf("all %d tasks scheduled", len(gang.Tasks))
+	case GangCancelled:
+		return "cancelled, reservations released"
+	}
+
+	waiting := make([]string, 0, len(gang.waiting))
+	for _, task := range gang.Tasks {
+		if reason, ok := gang.waiting[task.TaskID]; ok && !gang.reserved[task.TaskID] {
+			waiting = append(waiting, fmt.Sprintf("%s: %s", task.TaskID, reason))
+		}
+	}
+	if gang.State == GangTimedOut {
+		return fmt.Sprintf("timed out waiting for %s", strings.Join(waiting, ", "))
+	}
+	return fmt.Sprintf("%d of %d tasks reserved, waiting for %s",
+		len(gang.reserved), len(gang.Tasks), strings.Join(waiting, ", "))
+}
+
+// add returns the sum of two resource amounts
+func (r Resources) add(o Resources) Resources {
+	return Resources{CPU: r.CPU + o.CPU, Memory: r.Memory + o.Memory, GPU: r.GPU + o.GPU, Disk: r.Disk + o.Disk}
+}
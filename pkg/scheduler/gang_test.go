@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gangOf creates a gang request of workers with 10 CPUs each
+func gangOf(id, tenantID string, workers int, timeout time.Duration) GangRequest {
+	gang := GangRequest{ID: id, Timeout: timeout}
+	for i := 0; i < workers; i++ {
+		gang.Tasks = append(gang.Tasks, TaskRequest{TenantID: tenantID, TaskID: fmt.Sprintf("%s-worker-%d", id, i), Resources: Resources{CPU: 10}})
+	}
+	return gang
+}
+
+func TestDRFScheduler_SubmitGang(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 40, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 40, Memory: 1000}, 1.0)
+
+	scheduled := make([]string, 0)
+	scheduler.SetScheduledHandler(func(task RunningTask) { scheduled = append(scheduled, task.TaskID) })
+
+	// A gang that fits is admitted right away
+	status, err := scheduler.SubmitGang(gangOf("small", "tenant-1", 2, 0))
+	require.NoError(t, err)
+	assert.Equal(t, GangAdmitted, status.State)
+	assert.Equal(t, []string{"small-worker-0", "small-worker-1"}, scheduled)
+	assert.Equal(t, defaultGangTimeout, status.Deadline.Sub(status.SubmittedAt))
+
+	// A larger gang reserves what is left and waits for the rest
+	status, err = scheduler.SubmitGang(gangOf("large", "tenant-1", 3, time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, GangWaiting, status.State)
+	assert.Equal(t, []string{"large-worker-0", "large-worker-1"}, status.Reserved)
+	assert.Equal(t, map[string]string{"large-worker-2": "quota exceeded"}, status.Waiting)
+	assert.Equal(t, "2 of 3 tasks reserved, waiting for large-worker-2: quota exceeded", status.Reason)
+	assert.Len(t, scheduled, 2)
+
+	// Reserved resources are not available to other tasks
+	ok, _ := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "other", Resources: Resources{CPU: 10}})
+	assert.False(t, ok)
+
+	// The gang is admitted as a whole once enough is released
+	require.NoError(t, scheduler.ReleaseTask("small-worker-0"))
+	status, err = scheduler.GetGangStatus("large")
+	require.NoError(t, err)
+	assert.Equal(t, GangAdmitted, status.State)
+	assert.Empty(t, status.Waiting)
+	assert.Len(t, scheduled, 5)
+	assert.Len(t, scheduler.GetRunningTasks("tenant-1"), 4)
+
+	// Tasks of an admitted gang are released one by one
+	require.NoError(t, scheduler.ReleaseTask("large-worker-2"))
+	assert.Equal(t, 30.0, scheduler.tenants["tenant-1"].Usage.CPU)
+}
+
+func TestDRFScheduler_GangTimeout(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 40, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 40, Memory: 1000}, 1.0)
+	scheduler.RegisterTenant("tenant-2", "Tenant Two", Resources{CPU: 40, Memory: 1000}, 1.0)
+
+	ok, _ := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-2", TaskID: "blocker", Resources: Resources{CPU: 20}})
+	require.True(t, ok)
+
+	// Two gangs each hold half of what is left and would wait on each other
+	first, err := scheduler.SubmitGang(gangOf("first", "tenant-1", 2, 20*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, GangAdmitted, first.State)
+	require.NoError(t, scheduler.ReleaseTask("blocker"))
+
+	second, err := scheduler.SubmitGang(gangOf("second", "tenant-2", 3, 20*time.Millisecond))
+	require.NoError(t, err)
+	assert.Len(t, second.Reserved, 2)
+
+	// The partial reservation is released at the deadline
+	assert.Eventually(t, func() bool {
+		status, err := scheduler.GetGangStatus("second")
+		return err == nil && status.State == GangTimedOut
+	}, time.Second, time.Millisecond)
+	status, _ := scheduler.GetGangStatus("second")
+	assert.Empty(t, status.Reserved)
+	assert.Equal(t, "timed out waiting for second-worker-2: insufficient cluster resources", status.Reason)
+	assert.Equal(t, 0.0, scheduler.tenants["tenant-2"].Usage.CPU)
+
+	// Released reservations go to pending tasks
+	ok, _ = scheduler.SubmitTask(TaskRequest{TenantID: "tenant-2", TaskID: "queued", Resources: Resources{CPU: 20}})
+	assert.True(t, ok)
+}
+
+func TestDRFScheduler_CancelGang(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 30, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 30, Memory: 1000}, 1.0)
+
+	ok, _ := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "long", Resources: Resources{CPU: 20}})
+	require.True(t, ok)
+	ok, _ = scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "running", Resources: Resources{CPU: 10}})
+	require.True(t, ok)
+	ok, _ = scheduler.SubmitTask(TaskRequest{TenantID: "tenant-1", TaskID: "queued", Resources: Resources{CPU: 10}})
+	require.False(t, ok)
+
+	status, err := scheduler.SubmitGang(gangOf("gang", "tenant-1", 2, time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, GangWaiting, status.State)
+	assert.Empty(t, status.Reserved)
+
+	// Waiting gangs get released resources before pending tasks
+	require.NoError(t, scheduler.ReleaseTask("running"))
+	status, _ = scheduler.GetGangStatus("gang")
+	assert.Equal(t, []string{"gang-worker-0"}, status.Reserved)
+	assert.Len(t, scheduler.GetPendingTasks(""), 1)
+
+	require.NoError(t, scheduler.CancelGang("gang"))
+	status, _ = scheduler.GetGangStatus("gang")
+	assert.Equal(t, GangCancelled, status.State)
+	assert.Empty(t, scheduler.GetPendingTasks(""))
+	assert.Len(t, scheduler.GetRunningTasks("tenant-1"), 2)
+	assert.Error(t, scheduler.CancelGang("gang"))
+	_, err = scheduler.GetGangStatus("missing")
+	assert.Error(t, err)
+}
+
+func TestDRFScheduler_SubmitGangValidation(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 20, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 20, Memory: 1000}, 1.0)
+	ok, _ := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "running"})
+	require.True(t, ok)
+
+	tests := []struct {
+		name  string
+		gang  GangRequest
+		error string
+	}{
+		{"Missing ID", GangRequest{Tasks: []TaskRequest{{TenantID: "tenant-1", TaskID: "a"}}}, "gang ID required"},
+		{"No tasks", GangRequest{ID: "gang"}, "has no tasks"},
+		{"Unknown tenant", GangRequest{ID: "gang", Tasks: []TaskRequest{{TenantID: "missing", TaskID: "a"}}}, "tenant missing not found"},
+		{"Duplicate task", GangRequest{ID: "gang", Tasks: []TaskRequest{{TenantID: "tenant-1", TaskID: "a"}, {TenantID: "tenant-1", TaskID: "a"}}}, "task a already scheduled"},
+		{"Running task", GangRequest{ID: "gang", Tasks: []TaskRequest{{TenantID: "tenant-1", TaskID: "running"}}}, "task running already scheduled"},
+		{"Unknown class", GangRequest{ID: "gang", Tasks: []TaskRequest{{TenantID: "tenant-1", TaskID: "a", PriorityClass: "urgent"}}}, "unknown priority class urgent"},
+		{"Larger than quota", gangOf("gang", "tenant-1", 3, 0), "exceeds the quota of tenant tenant-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := scheduler.SubmitGang(tt.gang)
+			assert.ErrorContains(t, err, tt.error)
+		})
+	}
+}
+
+func TestDRFScheduler_SubmitGangHierarchy(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+
+	// Each team is within its own limit, but together they exceed the org's
+	gang := gangOf("gang", "team-a", 6, 0)
+	gang.Tasks = append(gang.Tasks, gangOf("gang-b", "team-b", 5, 0).Tasks...)
+	_, err := scheduler.SubmitGang(gang)
+	assert.ErrorContains(t, err, "exceeds the quota of tenant org")
+
+	gang.Tasks = gang.Tasks[:10]
+	status, err := scheduler.SubmitGang(gang)
+	require.NoError(t, err)
+	assert.Equal(t, GangAdmitted, status.State)
+}
+
+func TestDRFScheduler_GangHistory(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 20, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 20, Memory: 1000}, 1.0)
+
+	for i := 0; i <= maxGangHistory; i++ {
+		id := fmt.Sprintf("gang-%d", i)
+		status, err := scheduler.SubmitGang(gangOf(id, "tenant-1", 1, 0))
+		require.NoError(t, err)
+		require.Equal(t, GangAdmitted, status.State)
+		require.NoError(t, scheduler.ReleaseTask(id+"-worker-0"))
+	}
+
+	// Only the most recent finished gangs are remembered
+	_, err := scheduler.GetGangStatus("gang-0")
+	assert.Error(t, err)
+	status, err := scheduler.GetGangStatus(fmt.Sprintf("gang-%d", maxGangHistory))
+	require.NoError(t, err)
+	assert.Equal(t, GangAdmitted, status.State)
+	assert.Len(t, scheduler.gangs, maxGangHistory)
+
+	// A resubmitted gang replaces the finished one
+	_, err = scheduler.SubmitGang(gangOf("gang-1", "tenant-1", 1, 0))
+	require.NoError(t, err)
+	assert.Len(t, scheduler.gangs, maxGangHistory)
+	assert.Len(t, scheduler.gangHistory, maxGangHistory)
+	_, err = scheduler.GetGangStatus("gang-2")
+	assert.NoError(t, err)
+}
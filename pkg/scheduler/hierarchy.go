@@ -0,0 +1,378 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// TenantSpec describes a tenant of a quota hierarchy, such as an org, a team
+// of the org or a project of the team
+type TenantSpec struct {
+	ID       string
+	Name     string
+	ParentID string // Empty for a root tenant
+	Weight   float64
+	// Guaranteed is reserved for the tenant and its children. While idle it
+	// is lent to siblings, and reclaimed by preempting them when needed.
+	Guaranteed Resources
+	// Limit caps the usage of the tenant and its children, including
+	// borrowed capacity
+	Limit Resources
+}
+
+// reclaim is guaranteed capacity of a tenant lent to its siblings that a
+// request needs back
+type reclaim struct {
+	parentID string
+	shortage Resources            // How much must be reclaimed
+	borrowed map[string]Resources // How much each borrowing sibling borrows
+}
+
+// RegisterHierarchicalTenant registers a tenant of a quota hierarchy. The
+// guaranteed quotas of the children of a tenant must sum within its own, and
+// the limit of a child within the limit of its parent. Children of tenants
+// without a guaranteed quota are only capped by their limits.
+func (d *DRFScheduler) RegisterHierarchicalTenant(spec TenantSpec) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if spec.ID == "" {
+		return fmt.Errorf("tenant ID required")
+	}
+	if _, exists := d.tenants[spec.ID]; exists {
+		return fmt.Errorf("tenant %s already registered", spec.ID)
+	}
+	if !shortage(Resources{}, spec.Guaranteed, spec.Limit).isZero() {
+		return fmt.Errorf("tenant %s: guaranteed quota exceeds its limit", spec.ID)
+	}
+
+	if spec.ParentID != "" {
+		parent, exists := d.tenants[spec.ParentID]
+		if !exists {
+			return fmt.Errorf("tenant %s: parent tenant %s not found", spec.ID, spec.ParentID)
+		}
+		if !shortage(Resources{}, spec.Limit, parent.Quota).isZero() {
+			return fmt.Errorf("tenant %s: limit exceeds the limit of parent %s", spec.ID, parent.ID)
+		}
+		guaranteed := spec.Guaranteed
+		for _, child := range d.children(parent.ID) {
+			guaranteed = guaranteed.add(child.Guaranteed)
+		}
+		if !shortage(Resources{}, guaranteed, parent.Guaranteed).isZero() {
+			return fmt.Errorf("tenant %s: guaranteed quotas of the children of %s exceed its guaranteed quota", spec.ID, parent.ID)
+		}
+	}
+
+	if spec.Weight <= 0 {
+		spec.Weight = 1.0
+	}
+	d.tenants[spec.ID] = &Tenant{
+		ID:         spec.ID,
+		Name:       spec.Name,
+		Weight:     spec.Weight,
+		Quota:      spec.Limit,
+		Guaranteed: spec.Guaranteed,
+		Parent:     spec.ParentID,
+	}
+	return nil
+}
+
+// hierarchyReason returns why resources do not fit the quotas of a tenant's
+// ancestors or the capacity it may borrow, or an empty string if they fit.
+// The caller must hold d.mu.
+func (d *DRFScheduler) hierarchyReason(tenant *Tenant, resources Resources) string {
+	hard, reclaims := d.quotaShortage(tenant, resources)
+	if !hard.isZero() {
+		return "quota exceeded"
+	}
+	if len(reclaims) > 0 {
+		return "guaranteed quota lent to other tenants"
+	}
+	return ""
+}
+
+// quotaShortage returns by how much a request exceeds the limits of a tenant
+// and its ancestors or the capacity it may borrow, and the guaranteed
+// capacity the tenant lent to others that it needs back. The caller must
+// hold d.mu.
+func (d *DRFScheduler) quotaShortage(tenant *Tenant, requested Resources) (Resources, []reclaim) {
+	// Pools nest, a pool short of its guarantee borrows from the pool above
+	// it, up to the capacity of the top pool
+	var missing Resources
+	levels := d.poolLevels(tenant)
+	if len(levels) > 0 {
+		top := d.tenants[levels[len(levels)-1].Parent]
+		missing = shortage(d.subtreeUsage(top), requested, d.poolCapacity(top))
+	}
+
+	// What is missing within the idle guarantee of the tenant or one of its
+	// ancestors is lent to siblings and reclaimed, nearest siblings first
+	reclaims := make([]reclaim, 0)
+	for _, node := range levels {
+		if missing.isZero() {
+			break
+		}
+		parent := d.tenants[node.Parent]
+		borrowed := d.borrowers(parent, node.ID)
+		var lent Resources
+		for _, b := range borrowed {
+			lent = lent.add(b)
+		}
+		idle := shortage(node.Guaranteed, Resources{}, d.subtreeUsage(node))
+		amount := missing.intersection(idle).intersection(lent)
+		if amount.isZero() {
+			continue
+		}
+		reclaims = append(reclaims, reclaim{parentID: parent.ID, shortage: amount, borrowed: borrowed})
+		missing = missing.reduce(amount)
+	}
+
+	// Reclaimed capacity also counts towards the limits of the tenants whose
+	// children it is reclaimed from and their ancestors. What is still
+	// missing beyond the limits is left to the cluster capacity check.
+	var hard, freed Resources
+	for node := tenant; node != nil; node = d.tenants[node.Parent] {
+		for _, r := range reclaims {
+			if r.parentID == node.ID {
+				freed = freed.add(r.shortage)
+			}
+		}
+		hard = hard.union(shortage(d.subtreeUsage(node), requested, node.Quota).reduce(freed))
+	}
+	return hard, reclaims
+}
+
+// headroom returns how much more a tenant may use within the limits of its
+// hierarchy and the capacity it may borrow, not counting lent capacity it
+// could reclaim. The caller must hold d.mu.
+func (d *DRFScheduler) headroom(tenant *Tenant) Resources {
+	remaining := [4]float64{math.Inf(1), math.Inf(1), math.Inf(1), math.Inf(1)}
+	for node := tenant; node != nil; node = d.tenants[node.Parent] {
+		u, limit := d.subtreeUsage(node).vector(), node.Quota.vector()
+		for i := range remaining {
+			remaining[i] = math.Min(remaining[i], limit[i]-u[i])
+		}
+	}
+
+	if levels := d.poolLevels(tenant); len(levels) > 0 {
+		top := d.tenants[levels[len(levels)-1].Parent]
+		total, pool := d.subtreeUsage(top).vector(), d.poolCapacity(top).vector()
+		for i := range remaining {
+			remaining[i] = math.Min(remaining[i], pool[i]-total[i])
+		}
+	}
+	return resourcesOf(remaining)
+}
+
+// limitExceeded returns the tenant whose limit the requested resources of
+// its subtree exceed even while all of it is idle, nearest to the requesting
+// tenants first, or an empty string if they could fit. Requested resources
+// are keyed by tenant ID. The caller must hold d.mu.
+func (d *DRFScheduler) limitExceeded(requested map[string]Resources) string {
+	tenantIDs := make([]string, 0, len(requested))
+	for tenantID := range requested {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	// Ancestors limit the requests of all their descendants together
+	order := make([]string, 0)
+	subtree := make(map[string]Resources)
+	for _, tenantID := range tenantIDs {
+		for node := d.tenants[tenantID]; node != nil; node = d.tenants[node.Parent] {
+			if _, seen := subtree[node.ID]; !seen {
+				order = append(order, node.ID)
+			}
+			subtree[node.ID] = subtree[node.ID].add(requested[tenantID])
+		}
+	}
+	for _, tenantID := range order {
+		if !shortage(Resources{}, subtree[tenantID], d.tenants[tenantID].Quota).isZero() {
+			return tenantID
+		}
+	}
+	return ""
+}
+
+// poolLevels returns the tenant and its ancestors whose parent has a
+// guaranteed quota shared by its children, nearest first. The caller must
+// hold d.mu.
+func (d *DRFScheduler) poolLevels(tenant *Tenant) []*Tenant {
+	levels := make([]*Tenant, 0)
+	for node := tenant; node != nil; node = d.tenants[node.Parent] {
+		if parent := d.tenants[node.Parent]; parent != nil && !parent.Guaranteed.isZero() {
+			levels = append(levels, node)
+		}
+	}
+	return levels
+}
+
+// poolCapacity returns how much the top pool of a hierarchy may use: its
+// guaranteed quota, or more up to its limit while the cluster has free
+// capacity. The caller must hold d.mu.
+func (d *DRFScheduler) poolCapacity(top *Tenant) Resources {
+	free := shortage(Resources{}, d.clusterTotal, d.allocated())
+	burst := d.subtreeUsage(top).add(free).intersection(top.Quota)
+	return top.Guaranteed.union(burst)
+}
+
+// borrowed returns how much a tenant uses beyond its guaranteed quota. The
+// caller must hold d.mu.
+func (d *DRFScheduler) borrowed(tenant *Tenant) Resources {
+	if parent := d.tenants[tenant.Parent]; parent == nil || parent.Guaranteed.isZero() {
+		return Resources{}
+	}
+	return shortage(d.subtreeUsage(tenant), Resources{}, tenant.Guaranteed)
+}
+
+// lent returns how much of a tenant's idle guaranteed capacity its siblings
+// use, including the parent's own tasks, which have no guarantee of their
+// own. Borrowers use guaranteed capacity of the parent not given to any
+// child first, then the idle capacity of all lenders alike, and then borrow
+// from the parent's siblings. The caller must hold d.mu.
+func (d *DRFScheduler) lent(tenant *Tenant) Resources {
+	parent := d.tenants[tenant.Parent]
+	if parent == nil || parent.Guaranteed.isZero() {
+		return Resources{}
+	}
+
+	var guaranteed, idle [4]float64
+	borrowed := parent.Usage.vector()
+	for _, child := range d.children(parent.ID) {
+		u, g := d.subtreeUsage(child).vector(), child.Guaranteed.vector()
+		for i := range u {
+			borrowed[i] += excess(u[i] - g[i])
+			guaranteed[i] += g[i]
+			idle[i] += excess(g[i] - u[i])
+		}
+	}
+
+	u, g, pool := d.subtreeUsage(tenant).vector(), tenant.Guaranteed.vector(), parent.Guaranteed.vector()
+	var lent [4]float64
+	for i := range lent {
+		fromLenders := math.Min(idle[i], excess(borrowed[i]-excess(pool[i]-guaranteed[i])))
+		if own := excess(g[i] - u[i]); idle[i] > 0 {
+			lent[i] = fromLenders * own / idle[i]
+		}
+	}
+	return resourcesOf(lent)
+}
+
+// borrowers returns how much each child of parent other than except borrows
+// beyond its guaranteed quota. The parent's own tasks borrow all they use
+// and are listed under its ID. The caller must hold d.mu.
+func (d *DRFScheduler) borrowers(parent *Tenant, except string) map[string]Resources {
+	borrowed := make(map[string]Resources)
+	if !parent.Usage.isZero() {
+		borrowed[parent.ID] = parent.Usage
+	}
+	for _, child := range d.children(parent.ID) {
+		if child.ID == except {
+			continue
+		}
+		if b := shortage(d.subtreeUsage(child), Resources{}, child.Guaranteed); !b.isZero() {
+			borrowed[child.ID] = b
+		}
+	}
+	return borrowed
+}
+
+// reclaimedBy returns the indexes of the reclaims releasing a task helps.
+// The caller must hold d.mu.
+func (d *DRFScheduler) reclaimedBy(task *RunningTask, reclaims []reclaim) []int {
+	indexes := make([]int, 0)
+	for i, r := range reclaims {
+		borrowed, exists := r.borrowed[d.branchOf(r.parentID, task.TenantID)]
+		if exists && task.Resources.overlaps(r.shortage.intersection(borrowed)) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// reclaimed reports whether no lent guaranteed capacity is still needed back
+func reclaimed(reclaims []reclaim) bool {
+	for _, r := range reclaims {
+		if !r.shortage.isZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// branchOf returns the child of an ancestor a tenant belongs to, the
+// ancestor itself for its own tasks, or an empty string if the tenant is not
+// in its subtree. The caller must hold d.mu.
+func (d *DRFScheduler) branchOf(ancestorID, tenantID string) string {
+	if tenantID == ancestorID {
+		return ancestorID
+	}
+	for node := d.tenants[tenantID]; node != nil; node = d.tenants[node.Parent] {
+		if node.Parent == ancestorID {
+			return node.ID
+		}
+	}
+	return ""
+}
+
+// children returns the children of a tenant sorted by ID. The caller must
+// hold d.mu.
+func (d *DRFScheduler) children(tenantID string) []*Tenant {
+	children := make([]*Tenant, 0)
+	for _, tenant := range d.tenants {
+		if tenant.Parent == tenantID && tenantID != "" {
+			children = append(children, tenant)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].ID < children[j].ID })
+	return children
+}
+
+// subtreeUsage returns the usage of a tenant and its descendants. The caller
+// must hold d.mu.
+func (d *DRFScheduler) subtreeUsage(tenant *Tenant) Resources {
+	usage := tenant.Usage
+	for _, child := range d.children(tenant.ID) {
+		usage = usage.add(d.subtreeUsage(child))
+	}
+	return usage
+}
+
+// excess returns x if it is positive beyond floating point error, else 0
+func excess(x float64) float64 {
+	if x > resourceEpsilon {
+		return x
+	}
+	return 0
+}
+
+// union returns the larger of r and o in each dimension
+func (r Resources) union(o Resources) Resources {
+	return Resources{
+		CPU:    math.Max(r.CPU, o.CPU),
+		Memory: math.Max(r.Memory, o.Memory),
+		GPU:    math.Max(r.GPU, o.GPU),
+		Disk:   math.Max(r.Disk, o.Disk),
+	}
+}
+
+// intersection returns the smaller of r and o in each dimension
+func (r Resources) intersection(o Resources) Resources {
+	return Resources{
+		CPU:    math.Min(r.CPU, o.CPU),
+		Memory: math.Min(r.Memory, o.Memory),
+		GPU:    math.Min(r.GPU, o.GPU),
+		Disk:   math.Min(r.Disk, o.Disk),
+	}
+}
+
+// vector returns the dimensions of r in a fixed order
+func (r Resources) vector() [4]float64 {
+	return [4]float64{r.CPU, r.Memory, r.GPU, r.Disk}
+}
+
+// resourcesOf is the inverse of Resources.vector
+func resourcesOf(v [4]float64) Resources {
+	return Resources{CPU: v[0], Memory: v[1], GPU: v[2], Disk: v[3]}
+}
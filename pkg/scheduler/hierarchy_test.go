@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOrgScheduler creates an org guaranteed 100 CPUs with team-a guaranteed
+// 60 of them and team-b guaranteed 40
+func newOrgScheduler(t *testing.T) *DRFScheduler {
+	scheduler := NewDRFScheduler(Resources{CPU: 200, Memory: 1000})
+	for _, spec := range []TenantSpec{
+		{ID: "org", Name: "Org", Guaranteed: Resources{CPU: 100}, Limit: Resources{CPU: 100, Memory: 1000}},
+		{ID: "team-a", Name: "Team A", ParentID: "org", Guaranteed: Resources{CPU: 60}, Limit: Resources{CPU: 100, Memory: 1000}},
+		{ID: "team-b", Name: "Team B", ParentID: "org", Guaranteed: Resources{CPU: 40}, Limit: Resources{CPU: 80, Memory: 1000}},
+	} {
+		require.NoError(t, scheduler.RegisterHierarchicalTenant(spec))
+	}
+	return scheduler
+}
+
+func TestDRFScheduler_RegisterHierarchicalTenant(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+	scheduler.RegisterTenant("flat", "Flat", Resources{CPU: 50}, 1.0)
+
+	tests := []struct {
+		name    string
+		spec    TenantSpec
+		wantErr string
+	}{
+		{
+			name:    "ID required",
+			spec:    TenantSpec{Limit: Resources{CPU: 10}},
+			wantErr: "tenant ID required",
+		},
+		{
+			name:    "Already registered",
+			spec:    TenantSpec{ID: "team-a", ParentID: "org", Limit: Resources{CPU: 10}},
+			wantErr: "tenant team-a already registered",
+		},
+		{
+			name:    "Guarantee above limit",
+			spec:    TenantSpec{ID: "team-c", ParentID: "org", Guaranteed: Resources{CPU: 20}, Limit: Resources{CPU: 10}},
+			wantErr: "tenant team-c: guaranteed quota exceeds its limit",
+		},
+		{
+			name:    "Unknown parent",
+			spec:    TenantSpec{ID: "team-c", ParentID: "other-org", Limit: Resources{CPU: 10}},
+			wantErr: "tenant team-c: parent tenant other-org not found",
+		},
+		{
+			name:    "Limit above the parent's",
+			spec:    TenantSpec{ID: "team-c", ParentID: "org", Limit: Resources{CPU: 120}},
+			wantErr: "tenant team-c: limit exceeds the limit of parent org",
+		},
+		{
+			name:    "Guarantees of children above the parent's",
+			spec:    TenantSpec{ID: "team-c", ParentID: "org", Guaranteed: Resources{CPU: 10}, Limit: Resources{CPU: 10}},
+			wantErr: "tenant team-c: guaranteed quotas of the children of org exceed its guaranteed quota",
+		},
+		{
+			name:    "Guarantee under a tenant without one",
+			spec:    TenantSpec{ID: "flat-child", ParentID: "flat", Guaranteed: Resources{CPU: 10}, Limit: Resources{CPU: 10}},
+			wantErr: "tenant flat-child: guaranteed quotas of the children of flat exceed its guaranteed quota",
+		},
+		{
+			name: "Borrowing only project",
+			spec: TenantSpec{ID: "project", ParentID: "team-b", Limit: Resources{CPU: 80}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := scheduler.RegisterHierarchicalTenant(tt.spec)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			stats, err := scheduler.GetTenantStats(tt.spec.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.spec.Guaranteed, stats.Guaranteed)
+		})
+	}
+}
+
+func TestDRFScheduler_QuotaBorrowing(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+
+	// team-a borrows 30 CPUs team-b does not use
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "team-a", TaskID: "a-1", Resources: Resources{CPU: 90}})
+	require.True(t, ok, reason)
+
+	stats, err := scheduler.GetTenantStats("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, Resources{CPU: 60}, stats.Guaranteed)
+	assert.Equal(t, Resources{CPU: 30}, stats.Borrowed)
+	assert.Equal(t, Resources{}, stats.Lent)
+	assert.Equal(t, 10.0, stats.QuotaRemaining.CPU)
+
+	stats, err = scheduler.GetTenantStats("team-b")
+	require.NoError(t, err)
+	assert.Equal(t, Resources{}, stats.Borrowed)
+	assert.Equal(t, Resources{CPU: 30}, stats.Lent)
+	assert.Equal(t, 10.0, stats.QuotaRemaining.CPU)
+
+	stats, err = scheduler.GetTenantStats("org")
+	require.NoError(t, err)
+	assert.Equal(t, Resources{}, stats.Borrowed)
+	assert.Equal(t, 10.0, stats.QuotaRemaining.CPU)
+
+	// team-b needs back what it lent, which takes preemption
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "team-b", TaskID: "b-1", Resources: Resources{CPU: 20}})
+	assert.False(t, ok)
+	assert.Equal(t, "guaranteed quota lent to other tenants", reason)
+
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "team-b", TaskID: "b-1", Resources: Resources{CPU: 10}})
+	assert.True(t, ok, reason)
+
+	// Nothing is left to borrow
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "team-a", TaskID: "a-2", Resources: Resources{CPU: 1}})
+	assert.False(t, ok)
+	assert.Equal(t, "quota exceeded", reason)
+}
+
+func TestQuotaEnforcer_ReclaimLentQuota(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+	enforcer := NewQuotaEnforcer(scheduler, HardEnforcement, PreemptLowPriority)
+
+	// Borrowed capacity is reclaimed whatever the priority of the borrower
+	for _, task := range []TaskRequest{
+		{TenantID: "team-a", TaskID: "a-1", Resources: Resources{CPU: 60}, Priority: 100},
+		{TenantID: "team-a", TaskID: "a-2", Resources: Resources{CPU: 30}, Priority: 100},
+	} {
+		ok, reason := scheduler.ScheduleTask(task)
+		require.True(t, ok, reason)
+	}
+
+	result := enforcer.EnforceQuota(context.Background(), TaskRequest{TenantID: "team-b", TaskID: "b-1", Resources: Resources{CPU: 20}})
+	assert.True(t, result.Allowed)
+	assert.Equal(t, []string{"a-2"}, result.PreemptedTasks)
+
+	assert.True(t, result.Scheduled)
+	assert.Equal(t, "scheduled after preemption", result.Reason)
+	assert.Len(t, scheduler.GetRunningTasks("team-b"), 1)
+	stats, err := scheduler.GetTenantStats("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, Resources{}, stats.Borrowed)
+
+	// Tasks within their guarantee are not preempted to lend capacity
+	result = enforcer.EnforceQuota(context.Background(), TaskRequest{TenantID: "team-b", TaskID: "b-2", Resources: Resources{CPU: 50}})
+	assert.False(t, result.Allowed)
+	assert.Empty(t, result.PreemptedTasks)
+}
+
+func TestDRFScheduler_NestedQuotaPools(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+	require.NoError(t, scheduler.RegisterHierarchicalTenant(TenantSpec{ID: "project-1", ParentID: "team-a", Guaranteed: Resources{CPU: 40}, Limit: Resources{CPU: 60}}))
+	require.NoError(t, scheduler.RegisterHierarchicalTenant(TenantSpec{ID: "project-2", ParentID: "team-a", Guaranteed: Resources{CPU: 20}, Limit: Resources{CPU: 60}}))
+
+	// project-1 borrows from project-2 within team-a
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "project-1", TaskID: "p1-1", Resources: Resources{CPU: 60}})
+	require.True(t, ok, reason)
+
+	borrowedAndLent := func(tenantID string) (Resources, Resources) {
+		stats, err := scheduler.GetTenantStats(tenantID)
+		require.NoError(t, err)
+		return stats.Borrowed, stats.Lent
+	}
+	borrowed, _ := borrowedAndLent("project-1")
+	assert.Equal(t, Resources{CPU: 20}, borrowed)
+	_, lent := borrowedAndLent("project-2")
+	assert.Equal(t, Resources{CPU: 20}, lent)
+	borrowed, _ = borrowedAndLent("team-a")
+	assert.Equal(t, Resources{}, borrowed)
+
+	// team-a borrows from team-b once its own guarantee is used up
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "project-2", TaskID: "p2-1", Resources: Resources{CPU: 30}})
+	require.True(t, ok, reason)
+	borrowed, _ = borrowedAndLent("team-a")
+	assert.Equal(t, Resources{CPU: 30}, borrowed)
+	_, lent = borrowedAndLent("team-b")
+	assert.Equal(t, Resources{CPU: 30}, lent)
+	borrowed, lent = borrowedAndLent("project-2")
+	assert.Equal(t, Resources{CPU: 10}, borrowed)
+	assert.Equal(t, Resources{}, lent)
+
+	// team-b reclaims from the projects of team-a
+	request := TaskRequest{TenantID: "team-b", TaskID: "b-1", Resources: Resources{CPU: 20}}
+	ok, reason = scheduler.ScheduleTask(request)
+	assert.False(t, ok)
+	assert.Equal(t, "guaranteed quota lent to other tenants", reason)
+
+	assert.Equal(t, []string{"p2-1"}, scheduler.preempt(request, PreemptLowPriority, false))
+	ok, reason = scheduler.ScheduleTask(request)
+	assert.True(t, ok, reason)
+}
+
+func TestDRFScheduler_TopPoolBursts(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 30, Memory: 1000})
+	for _, spec := range []TenantSpec{
+		{ID: "org", Guaranteed: Resources{CPU: 10}, Limit: Resources{CPU: 20}},
+		{ID: "team-x", ParentID: "org", Guaranteed: Resources{CPU: 5}, Limit: Resources{CPU: 20}},
+		{ID: "team-y", ParentID: "org", Guaranteed: Resources{CPU: 5}, Limit: Resources{CPU: 20}},
+	} {
+		require.NoError(t, scheduler.RegisterHierarchicalTenant(spec))
+	}
+	scheduler.RegisterTenant("other", "Other", Resources{CPU: 30}, 1.0)
+
+	// The org bursts beyond its guarantee up to its limit
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "team-x", TaskID: "x-1", Resources: Resources{CPU: 12}})
+	require.True(t, ok, reason)
+	stats, err := scheduler.GetTenantStats("team-x")
+	require.NoError(t, err)
+	assert.Equal(t, Resources{CPU: 7}, stats.Borrowed)
+	assert.Equal(t, 8.0, stats.QuotaRemaining.CPU)
+
+	// Bursting is bounded by free cluster capacity
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "other", TaskID: "o-1", Resources: Resources{CPU: 15}})
+	require.True(t, ok, reason)
+	stats, err = scheduler.GetTenantStats("team-x")
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, stats.QuotaRemaining.CPU)
+
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "team-x", TaskID: "x-2", Resources: Resources{CPU: 4}})
+	assert.False(t, ok)
+	assert.Equal(t, "insufficient cluster resources", reason)
+
+	// team-y's guarantee is still its own
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "team-y", TaskID: "y-1", Resources: Resources{CPU: 4}})
+	assert.False(t, ok)
+	assert.Equal(t, "guaranteed quota lent to other tenants", reason)
+}
+
+func TestDRFScheduler_ParentUsageCountsInPool(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+
+	// The org's own tasks have no guarantee and borrow from its teams
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "org", TaskID: "org-1", Resources: Resources{CPU: 50}})
+	require.True(t, ok, reason)
+
+	stats, err := scheduler.GetTenantStats("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, Resources{CPU: 30}, stats.Lent)
+	assert.Equal(t, 50.0, stats.QuotaRemaining.CPU)
+
+	// team-a reclaims its guarantee from the org's own tasks
+	request := TaskRequest{TenantID: "team-a", TaskID: "a-1", Resources: Resources{CPU: 60}}
+	ok, reason = scheduler.ScheduleTask(request)
+	assert.False(t, ok)
+	assert.Equal(t, "guaranteed quota lent to other tenants", reason)
+
+	assert.Equal(t, []string{"org-1"}, scheduler.preempt(request, PreemptLowPriority, false))
+	ok, reason = scheduler.ScheduleTask(request)
+	assert.True(t, ok, reason)
+}
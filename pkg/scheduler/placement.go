@@ -0,0 +1,307 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Node is a machine of the cluster tasks are placed on
+type Node struct {
+	ID        string
+	Capacity  Resources
+	Allocated Resources
+}
+
+// PlacementScorer ranks the nodes a task fits on. Higher scores are better.
+type PlacementScorer interface {
+	Name() string
+	Score(node Node, request Resources) float64
+}
+
+// Placement is the node chosen for a task
+type Placement struct {
+	NodeID string
+	Score  float64
+}
+
+// NodeScore explains how well a task fits a node
+type NodeScore struct {
+	NodeID string
+	Fits   bool
+	Score  float64
+	Reason string // Why the task does not fit
+}
+
+// BestFitScorer packs tasks onto the fullest nodes, keeping other nodes
+// free for large tasks
+type BestFitScorer struct{}
+
+// Name returns the name of the strategy
+func (BestFitScorer) Name() string { return "best-fit" }
+
+// Score is the average fraction of the node's resources in use after
+// placing the task
+func (BestFitScorer) Score(node Node, request Resources) float64 {
+	free := freeFractions(node, request)
+	return 1 - mean(free)
+}
+
+// LeastAllocatedScorer spreads tasks onto the emptiest nodes, limiting how
+// many tasks a node failure takes down
+type LeastAllocatedScorer struct{}
+
+// Name returns the name of the strategy
+func (LeastAllocatedScorer) Name() string { return "least-allocated" }
+
+// Score is the average fraction of the node's resources left free after
+// placing the task
+func (LeastAllocatedScorer) Score(node Node, request Resources) float64 {
+	return mean(freeFractions(node, request))
+}
+
+// FragmentationScorer packs tasks like BestFitScorer but avoids leaving
+// resources stranded, such as free GPUs on a node without free CPUs, or
+// plenty of memory but no CPU
+type FragmentationScorer struct{}
+
+// Name returns the name of the strategy
+func (FragmentationScorer) Name() string { return "fragmentation-aware" }
+
+// Score is the best-fit score less the spread between the most and least
+// free resource of the node after placing the task
+func (FragmentationScorer) Score(node Node, request Resources) float64 {
+	free := freeFractions(node, request)
+	if len(free) == 0 {
+		return 0
+	}
+	lowest, highest := free[0], free[0]
+	for _, f := range free[1:] {
+		lowest, highest = math.Min(lowest, f), math.Max(highest, f)
+	}
+	return 1 - mean(free) - (highest - lowest)
+}
+
+// RegisterNode adds a node to the inventory or changes its capacity. Once
+// nodes are registered every task must fit on a single node.
+func (d *DRFScheduler) RegisterNode(id string, capacity Resources) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if node, exists := d.nodes[id]; exists {
+		node.Capacity = capacity
+		return
+	}
+	d.nodes[id] = &Node{ID: id, Capacity: capacity}
+}
+
+// RemoveNode removes a node without tasks from the inventory
+func (d *DRFScheduler) RemoveNode(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	node, exists := d.nodes[id]
+	if !exists {
+		return fmt.Errorf("node %s not found", id)
+	}
+	if !node.Allocated.isZero() {
+		return fmt.Errorf("node %s has tasks placed on it", id)
+	}
+	delete(d.nodes, id)
+	return nil
+}
+
+// GetNodes returns the node inventory sorted by ID
+func (d *DRFScheduler) GetNodes() []Node {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	nodes := make([]Node, 0, len(d.nodes))
+	for _, node := range d.nodes {
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// SetPlacementScorer changes the strategy choosing among the nodes a task
+// fits on
+func (d *DRFScheduler) SetPlacementScorer(scorer PlacementScorer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.scorer = scorer
+}
+
+// PlaceTask schedules a task like ScheduleTask and returns the node it was
+// placed on, which is empty without a node inventory
+func (d *DRFScheduler) PlaceTask(request TaskRequest) (*Placement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if request.TaskID == "" {
+		return nil, fmt.Errorf("task ID required")
+	}
+	if ok, reason := d.schedule(request); !ok {
+		return nil, fmt.Errorf("task %s not scheduled: %s", request.TaskID, reason)
+	}
+
+	task := d.tasks[request.TaskID]
+	placement := &Placement{NodeID: task.NodeID}
+	if node, exists := d.nodes[task.NodeID]; exists {
+		// Score the placement as it was before the task was added
+		before := *node
+		before.Allocated = before.Allocated.reduce(task.Resources)
+		placement.Score = d.scorer.Score(before, task.Resources)
+	}
+	return placement, nil
+}
+
+// ScorePlacement scores every node for a task without placing it, best
+// nodes first
+func (d *DRFScheduler) ScorePlacement(request Resources) []NodeScore {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.scoreNodes(request)
+}
+
+// scoreNodes scores every node for a task, nodes the task fits on first and
+// best first. The caller must hold d.mu.
+func (d *DRFScheduler) scoreNodes(request Resources) []NodeScore {
+	scores := make([]NodeScore, 0, len(d.nodes))
+	for _, node := range d.nodes {
+		score := NodeScore{NodeID: node.ID}
+		if over := shortage(node.Allocated, request, node.Capacity); !over.isZero() {
+			score.Reason = "insufficient " + over.dimensions()
+		} else {
+			score.Fits = true
+			score.Score = d.scorer.Score(*node, request)
+		}
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Fits != scores[j].Fits {
+			return scores[i].Fits
+		}
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].NodeID < scores[j].NodeID
+	})
+	return scores
+}
+
+// bestNode returns the node a task is placed on, or nil if it fits on none.
+// The caller must hold d.mu.
+func (d *DRFScheduler) bestNode(request Resources) *Node {
+	scores := d.scoreNodes(request)
+	if len(scores) == 0 || !scores[0].Fits {
+		return nil
+	}
+	return d.nodes[scores[0].NodeID]
+}
+
+// fitsEmptyNode reports whether resources fit some node once it is empty,
+// which they always do without a node inventory. The caller must hold d.mu.
+func (d *DRFScheduler) fitsEmptyNode(resources Resources) bool {
+	if len(d.nodes) == 0 {
+		return true
+	}
+	for _, node := range d.nodes {
+		if shortage(Resources{}, resources, node.Capacity).isZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// place assigns resources to the best node, returning its ID, or an empty
+// string without a node inventory. The caller must hold d.mu and have
+// checked the resources fit.
+func (d *DRFScheduler) place(resources Resources) string {
+	node := d.bestNode(resources)
+	if node == nil {
+		return ""
+	}
+	node.Allocated = node.Allocated.add(resources)
+	return node.ID
+}
+
+// unplace returns resources to a node. The caller must hold d.mu.
+func (d *DRFScheduler) unplace(nodeID string, resources Resources) {
+	if node, exists := d.nodes[nodeID]; exists {
+		node.Allocated = node.Allocated.reduce(resources)
+	}
+}
+
+// unplaceUntracked frees the node of the oldest task without an ID of a
+// tenant with the given resources. The caller must hold d.mu.
+func (d *DRFScheduler) unplaceUntracked(tenantID string, resources Resources) {
+	for i, task := range d.untracked {
+		if task.TenantID == tenantID && task.Resources == resources {
+			d.unplace(task.NodeID, task.Resources)
+			d.untracked = append(d.untracked[:i], d.untracked[i+1:]...)
+			return
+		}
+	}
+}
+
+// freeFractions returns the fraction of each resource of a node left free
+// after placing a task, skipping resources the node does not have
+func freeFractions(node Node, request Resources) []float64 {
+	capacity := []float64{node.Capacity.CPU, node.Capacity.Memory, node.Capacity.GPU, node.Capacity.Disk}
+	used := []float64{
+		node.Allocated.CPU + request.CPU,
+		node.Allocated.Memory + request.Memory,
+		node.Allocated.GPU + request.GPU,
+		node.Allocated.Disk + request.Disk,
+	}
+
+	free := make([]float64, 0, len(capacity))
+	for i := range capacity {
+		if capacity[i] > 0 {
+			free = append(free, math.Max(0, capacity[i]-used[i])/capacity[i])
+		}
+	}
+	return free
+}
+
+// mean returns the average of values, or 0 if there are none
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// dimensions lists the positive dimensions of r
+func (r Resources) dimensions() string {
+	names := make([]string, 0, 4)
+	for _, dim := range []struct {
+		name  string
+		value float64
+	}{{"CPU", r.CPU}, {"memory", r.Memory}, {"GPU", r.GPU}, {"disk", r.Disk}} {
+		if dim.value > resourceEpsilon {
+			names = append(names, dim.name)
+		}
+	}
+	return joinNames(names)
+}
+
+// joinNames joins names as a readable list
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	}
+	list := names[0]
+	for _, name := range names[1 : len(names)-1] {
+		list += ", " + name
+	}
+	return list + " and " + names[len(names)-1]
+}
@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDRFScheduler_NodeFragmentation(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 32, Memory: 128})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 32, Memory: 128}, 1.0)
+	scheduler.RegisterNode("node-1", Resources{CPU: 16, Memory: 64})
+	scheduler.RegisterNode("node-2", Resources{CPU: 16, Memory: 64})
+
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-1", Resources: Resources{CPU: 10, Memory: 10}})
+	require.True(t, ok, reason)
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-2", Resources: Resources{CPU: 10, Memory: 10}})
+	require.True(t, ok, reason)
+
+	tasks := scheduler.GetRunningTasks("tenant-1")
+	require.Len(t, tasks, 2)
+	assert.ElementsMatch(t, []string{"node-1", "node-2"}, []string{tasks[0].NodeID, tasks[1].NodeID})
+
+	// 12 CPUs are free in total, but only 6 on each node
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-3", Resources: Resources{CPU: 10, Memory: 10}})
+	assert.False(t, ok)
+	assert.Equal(t, "no single node fits", reason)
+
+	// Releasing a task frees its node
+	require.NoError(t, scheduler.ReleaseTask("task-1"))
+	ok, reason = scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-3", Resources: Resources{CPU: 10, Memory: 10}})
+	assert.True(t, ok, reason)
+	assert.Equal(t, tasks[0].NodeID, scheduler.GetRunningTasks("tenant-1")[1].NodeID)
+}
+
+func TestDRFScheduler_PlacementScorers(t *testing.T) {
+	tests := []struct {
+		name     string
+		scorer   PlacementScorer
+		expected string
+	}{
+		// node-1 has 4 CPUs and 64GB free, node-2 is empty
+		{"Best fit packs the busy node", BestFitScorer{}, "node-1"},
+		{"Least allocated spreads to the empty node", LeastAllocatedScorer{}, "node-2"},
+		{"Fragmentation aware keeps memory usable", FragmentationScorer{}, "node-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := NewDRFScheduler(Resources{CPU: 32, Memory: 128})
+			scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 32, Memory: 128}, 1.0)
+			scheduler.RegisterNode("node-1", Resources{CPU: 16, Memory: 64})
+			ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "cpu-heavy", Resources: Resources{CPU: 12}})
+			require.True(t, ok, reason)
+			scheduler.RegisterNode("node-2", Resources{CPU: 16, Memory: 64})
+			scheduler.SetPlacementScorer(tt.scorer)
+
+			placement, err := scheduler.PlaceTask(TaskRequest{TenantID: "tenant-1", TaskID: "task", Resources: Resources{CPU: 2, Memory: 8}})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, placement.NodeID)
+			assert.Equal(t, tt.expected, scheduler.ScorePlacement(Resources{CPU: 2, Memory: 8})[0].NodeID)
+		})
+	}
+}
+
+func TestDRFScheduler_ScorePlacement(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 48, Memory: 192, GPU: 4})
+	scheduler.RegisterNode("cpu-node", Resources{CPU: 16, Memory: 64})
+	scheduler.RegisterNode("gpu-node", Resources{CPU: 16, Memory: 64, GPU: 4})
+	scheduler.RegisterNode("small-node", Resources{CPU: 4, Memory: 16})
+
+	scores := scheduler.ScorePlacement(Resources{CPU: 8, Memory: 32, GPU: 2})
+	require.Len(t, scores, 3)
+	assert.Equal(t, NodeScore{NodeID: "gpu-node", Fits: true, Score: 0.5}, scores[0])
+	assert.Equal(t, NodeScore{NodeID: "cpu-node", Reason: "insufficient GPU"}, scores[1])
+	assert.Equal(t, NodeScore{NodeID: "small-node", Reason: "insufficient CPU, memory and GPU"}, scores[2])
+
+	// Scoring does not place anything
+	for _, node := range scheduler.GetNodes() {
+		assert.True(t, node.Allocated.isZero())
+	}
+}
+
+func TestDRFScheduler_PlaceTask(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 32, Memory: 128})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 32, Memory: 128}, 1.0)
+
+	// Without a node inventory tasks are only checked against the cluster
+	placement, err := scheduler.PlaceTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-1", Resources: Resources{CPU: 20}})
+	require.NoError(t, err)
+	assert.Equal(t, "", placement.NodeID)
+	require.NoError(t, scheduler.ReleaseTask("task-1"))
+
+	scheduler.RegisterNode("node-1", Resources{CPU: 16, Memory: 64})
+	scheduler.RegisterNode("node-2", Resources{CPU: 16, Memory: 64})
+
+	placement, err = scheduler.PlaceTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-2", Resources: Resources{CPU: 8, Memory: 32}})
+	require.NoError(t, err)
+	assert.Equal(t, &Placement{NodeID: "node-1", Score: 0.5}, placement)
+
+	_, err = scheduler.PlaceTask(TaskRequest{TenantID: "tenant-1", Resources: Resources{CPU: 1}})
+	assert.EqualError(t, err, "task ID required")
+	_, err = scheduler.PlaceTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-3", Resources: Resources{CPU: 20}})
+	assert.EqualError(t, err, "task task-3 not scheduled: no single node fits")
+
+	// Tasks larger than every node are never queued
+	ok, reason := scheduler.SubmitTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-4", Resources: Resources{CPU: 20}})
+	assert.False(t, ok)
+	assert.Equal(t, "request exceeds every node", reason)
+}
+
+func TestDRFScheduler_RemoveNode(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 32, Memory: 128})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 32, Memory: 128}, 1.0)
+	scheduler.RegisterNode("node-1", Resources{CPU: 16, Memory: 64})
+
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-1", Resources: Resources{CPU: 4}})
+	require.True(t, ok, reason)
+	assert.EqualError(t, scheduler.RemoveNode("node-1"), "node node-1 has tasks placed on it")
+	assert.EqualError(t, scheduler.RemoveNode("node-2"), "node node-2 not found")
+
+	require.NoError(t, scheduler.ReleaseTask("task-1"))
+	require.NoError(t, scheduler.RemoveNode("node-1"))
+	assert.Empty(t, scheduler.GetNodes())
+}
+
+func TestDRFScheduler_PreemptionFreesNode(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 16, Memory: 64})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 16, Memory: 64}, 1.0)
+	scheduler.RegisterNode("node-1", Resources{CPU: 16, Memory: 64})
+
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "low", Resources: Resources{CPU: 12}})
+	require.True(t, ok, reason)
+
+	request := TaskRequest{TenantID: "tenant-1", TaskID: "high", Resources: Resources{CPU: 12}, Priority: 10}
+	assert.Equal(t, []string{"low"}, scheduler.preempt(request, PreemptLowPriority, false))
+	assert.True(t, scheduler.GetNodes()[0].Allocated.isZero())
+
+	placement, err := scheduler.PlaceTask(request)
+	require.NoError(t, err)
+	assert.Equal(t, "node-1", placement.NodeID)
+}
+
+func TestDRFScheduler_GangPlacement(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 40, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 40, Memory: 1000}, 1.0)
+	scheduler.RegisterNode("node-1", Resources{CPU: 20, Memory: 500})
+	scheduler.RegisterNode("node-2", Resources{CPU: 15, Memory: 500})
+
+	// Only three workers fit on the nodes, though four fit the cluster
+	status, err := scheduler.SubmitGang(gangOf("gang", "tenant-1", 4, 0))
+	require.NoError(t, err)
+	assert.Equal(t, GangWaiting, status.State)
+	assert.Equal(t, map[string]string{"gang-worker-3": "no single node fits"}, status.Waiting)
+
+	require.NoError(t, scheduler.CancelGang("gang"))
+	for _, node := range scheduler.GetNodes() {
+		assert.True(t, node.Allocated.isZero(), node.ID)
+	}
+
+	status, err = scheduler.SubmitGang(gangOf("small", "tenant-1", 3, 0))
+	require.NoError(t, err)
+	assert.Equal(t, GangAdmitted, status.State)
+	nodes := make(map[string]int)
+	for _, task := range scheduler.GetRunningTasks("tenant-1") {
+		nodes[task.NodeID]++
+	}
+	assert.Equal(t, map[string]int{"node-1": 2, "node-2": 1}, nodes)
+
+	_, err = scheduler.SubmitGang(GangRequest{ID: "huge", Tasks: []TaskRequest{{TenantID: "tenant-1", TaskID: "huge-0", Resources: Resources{CPU: 25}}}})
+	assert.EqualError(t, err, "gang huge: task huge-0 exceeds every node")
+}
+
+func TestDRFScheduler_ReleaseResourcesFreesNode(t *testing.T) {
+	tests := []struct {
+		name   string
+		taskID string
+	}{
+		{"Tracked task", "task-1"},
+		{"Task without an ID", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := NewDRFScheduler(Resources{CPU: 4, Memory: 16})
+			scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 4, Memory: 16}, 1.0)
+			scheduler.RegisterNode("node-1", Resources{CPU: 4, Memory: 16})
+
+			ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: tt.taskID, Resources: Resources{CPU: 4}})
+			require.True(t, ok, reason)
+			require.NoError(t, scheduler.ReleaseResources("tenant-1", Resources{CPU: 4}))
+			assert.True(t, scheduler.GetNodes()[0].Allocated.isZero())
+
+			placement, err := scheduler.PlaceTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-2", Resources: Resources{CPU: 4}})
+			require.NoError(t, err)
+			assert.Equal(t, "node-1", placement.NodeID)
+		})
+	}
+}
+
+func TestQuotaEnforcer_PreemptionKeepsVictimsWithoutFit(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 16, Memory: 64})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 16, Memory: 64}, 1.0)
+	scheduler.RegisterNode("node-1", Resources{CPU: 8, Memory: 32})
+	scheduler.RegisterNode("node-2", Resources{CPU: 8, Memory: 32})
+	enforcer := NewQuotaEnforcer(scheduler, HardEnforcement, PreemptLowPriority)
+
+	for _, taskID := range []string{"low-1", "low-2"} {
+		ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: taskID, Resources: Resources{CPU: 6}})
+		require.True(t, ok, reason)
+	}
+
+	// Preempting both tasks frees 12 CPUs, but on two nodes
+	result := enforcer.EnforceQuota(context.Background(), TaskRequest{TenantID: "tenant-1", TaskID: "high", Resources: Resources{CPU: 12}, Priority: 10})
+	assert.False(t, result.Allowed)
+	assert.Empty(t, result.PreemptedTasks)
+	assert.Len(t, scheduler.GetRunningTasks("tenant-1"), 2)
+	for _, node := range scheduler.GetNodes() {
+		assert.Equal(t, 6.0, node.Allocated.CPU, node.ID)
+	}
+	stats, err := scheduler.GetTenantStats("tenant-1")
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, stats.QuotaRemaining.CPU)
+}
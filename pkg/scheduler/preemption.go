@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"log"
+	"math"
+	"sort"
+)
+
+// resourceEpsilon absorbs floating point error when comparing resources
+const resourceEpsilon = 1e-9
+
+// preempt selects running tasks of lower priority than request whose
+// release lets it fit both its tenant's quota and the cluster, ordered by
+// policy. Guaranteed capacity the tenant lent is reclaimed from borrowing
+// tasks of any priority. Unless dryRun is set the victims' resources are
+// released. Nothing is selected when preemption cannot make enough room.
+func (d *DRFScheduler) preempt(request TaskRequest, policy PreemptionPolicy, dryRun bool) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	victims, ok := d.preemptionVictims(request, policy)
+	if !ok {
+		return nil
+	}
+	if !dryRun {
+		d.evict(victims, request)
+	}
+	return taskIDs(victims)
+}
+
+// preemptAndSchedule preempts tasks like preempt and schedules the request
+// in their place without releasing d.mu in between, so no other request
+// takes the freed resources. Nothing is preempted unless the request is
+// scheduled, and nothing is scheduled unless some task is preempted.
+func (d *DRFScheduler) preemptAndSchedule(request TaskRequest, policy PreemptionPolicy) ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	victims, ok := d.preemptionVictims(request, policy)
+	if !ok || len(victims) == 0 {
+		return nil, false
+	}
+	d.evict(victims, request)
+	if ok, reason := d.schedule(request); !ok {
+		// The freed resources may still not fit a single node
+		log.Printf("Task %s of tenant %s not scheduled after preemption: %s", request.TaskID, request.TenantID, reason)
+		for _, task := range victims {
+			d.restore(task)
+		}
+		return nil, false
+	}
+	return taskIDs(victims), true
+}
+
+// preemptionVictims selects the tasks preempt releases for a request. It
+// returns false when preemption cannot make enough room. The caller must
+// hold d.mu.
+func (d *DRFScheduler) preemptionVictims(request TaskRequest, policy PreemptionPolicy) ([]*RunningTask, bool) {
+	tenant, exists := d.tenants[request.TenantID]
+	if !exists || policy == PreemptNever || !d.resolvePriority(&request) {
+		return nil, false
+	}
+
+	// Only the tenant's own tasks free its quota, any task frees the cluster
+	// and borrowing tasks free lent guaranteed capacity
+	quotaShortage, reclaims := d.quotaShortage(tenant, request.Resources)
+	clusterShortage := shortage(d.allocated(), request.Resources, d.clusterTotal)
+	clusterShortage.Disk = 0
+
+	victims := make([]*RunningTask, 0)
+	for _, task := range d.preemptionCandidates(request, policy, reclaims) {
+		if quotaShortage.isZero() && clusterShortage.isZero() && reclaimed(reclaims) {
+			break
+		}
+
+		ownTask := task.TenantID == request.TenantID
+		lower := task.Priority < request.Priority
+		reclaiming := d.reclaimedBy(task, reclaims)
+		if len(reclaiming) == 0 && !(lower && ((ownTask && task.Resources.overlaps(quotaShortage)) ||
+			task.Resources.overlaps(clusterShortage))) {
+			continue
+		}
+		victims = append(victims, task)
+		if ownTask {
+			quotaShortage = quotaShortage.reduce(task.Resources)
+		}
+		clusterShortage = clusterShortage.reduce(task.Resources)
+		for _, i := range reclaiming {
+			branch := d.branchOf(reclaims[i].parentID, task.TenantID)
+			returned := task.Resources.intersection(reclaims[i].borrowed[branch])
+			reclaims[i].shortage = reclaims[i].shortage.reduce(returned)
+			reclaims[i].borrowed[branch] = reclaims[i].borrowed[branch].reduce(returned)
+		}
+	}
+	if !quotaShortage.isZero() || !clusterShortage.isZero() || !reclaimed(reclaims) {
+		return nil, false
+	}
+	return victims, true
+}
+
+// evict releases the resources of preempted tasks. The caller must hold
+// d.mu.
+func (d *DRFScheduler) evict(victims []*RunningTask, request TaskRequest) {
+	for _, task := range victims {
+		delete(d.tasks, task.TaskID)
+		if owner, exists := d.tenants[task.TenantID]; exists {
+			d.release(owner, task.Resources)
+		}
+		d.unplace(task.NodeID, task.Resources)
+		log.Printf("Preempted task %s of tenant %s for task %s of tenant %s",
+			task.TaskID, task.TenantID, request.TaskID, request.TenantID)
+	}
+}
+
+// restore gives an evicted task its resources and node back. The caller
+// must hold d.mu.
+func (d *DRFScheduler) restore(task *RunningTask) {
+	d.tasks[task.TaskID] = task
+	if owner, exists := d.tenants[task.TenantID]; exists {
+		d.charge(owner, task.Resources)
+	}
+	if node, exists := d.nodes[task.NodeID]; exists {
+		node.Allocated = node.Allocated.add(task.Resources)
+	}
+}
+
+// taskIDs returns the IDs of tasks
+func taskIDs(tasks []*RunningTask) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.TaskID
+	}
+	return ids
+}
+
+// preemptionCandidates returns the running tasks a request may preempt in
+// the order the policy preempts them. Only tasks of strictly lower priority
+// and tasks using guaranteed capacity the request needs back are
+// candidates. The caller must hold d.mu.
+func (d *DRFScheduler) preemptionCandidates(request TaskRequest, policy PreemptionPolicy, reclaims []reclaim) []*RunningTask {
+	candidates := make([]*RunningTask, 0)
+	for _, task := range d.tasks {
+		if task.Priority < request.Priority || len(d.reclaimedBy(task, reclaims)) > 0 {
+			candidates = append(candidates, task)
+		}
+	}
+
+	// Lowest priority first, newest first among equal priorities, so the
+	// least work is lost
+	lowPriority := func(a, b *RunningTask) bool {
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.After(b.StartedAt)
+		}
+		return a.TaskID < b.TaskID
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch policy {
+		case PreemptOldest:
+			if !a.StartedAt.Equal(b.StartedAt) {
+				return a.StartedAt.Before(b.StartedAt)
+			}
+		case PreemptOverFairShare:
+			// Tenants furthest over their fair share give up tasks first
+			shareA, shareB := d.tenantShare(a.TenantID), d.tenantShare(b.TenantID)
+			if shareA != shareB {
+				return shareA > shareB
+			}
+		}
+		return lowPriority(a, b)
+	})
+	return candidates
+}
+
+// tenantShare returns a tenant's weighted dominant share. The caller must
+// hold d.mu.
+func (d *DRFScheduler) tenantShare(tenantID string) float64 {
+	if tenant, exists := d.tenants[tenantID]; exists {
+		return tenant.WeightedShare
+	}
+	return 0
+}
+
+// allocated returns the resources allocated across all tenants. The caller
+// must hold d.mu.
+func (d *DRFScheduler) allocated() Resources {
+	var total Resources
+	for _, tenant := range d.tenants {
+		total.CPU += tenant.AllocatedCPU
+		total.Memory += tenant.AllocatedMemory
+		total.GPU += tenant.AllocatedGPU
+		total.Disk += tenant.Usage.Disk
+	}
+	return total
+}
+
+// hasCapacity reports whether the cluster can fit resources right now
+func (d *DRFScheduler) hasCapacity(resources Resources) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.checkClusterCapacity(resources)
+}
+
+// shortage returns by how much used plus requested exceeds limit in each
+// dimension
+func shortage(used, requested, limit Resources) Resources {
+	over := func(used, requested, limit float64) float64 {
+		if excess := used + requested - limit; excess > resourceEpsilon {
+			return excess
+		}
+		return 0
+	}
+	return Resources{
+		CPU:    over(used.CPU, requested.CPU, limit.CPU),
+		Memory: over(used.Memory, requested.Memory, limit.Memory),
+		GPU:    over(used.GPU, requested.GPU, limit.GPU),
+		Disk:   over(used.Disk, requested.Disk, limit.Disk),
+	}
+}
+
+// isZero reports whether no dimension is positive
+func (r Resources) isZero() bool {
+	return r.CPU <= resourceEpsilon && r.Memory <= resourceEpsilon &&
+		r.GPU <= resourceEpsilon && r.Disk <= resourceEpsilon
+}
+
+// overlaps reports whether r and o are both positive in some dimension
+func (r Resources) overlaps(o Resources) bool {
+	return (r.CPU > 0 && o.CPU > resourceEpsilon) || (r.Memory > 0 && o.Memory > resourceEpsilon) ||
+		(r.GPU > 0 && o.GPU > resourceEpsilon) || (r.Disk > 0 && o.Disk > resourceEpsilon)
+}
+
+// reduce subtracts o from r, stopping at zero in each dimension
+func (r Resources) reduce(o Resources) Resources {
+	return Resources{
+		CPU:    math.Max(0, r.CPU-o.CPU),
+		Memory: math.Max(0, r.Memory-o.Memory),
+		GPU:    math.Max(0, r.GPU-o.GPU),
+		Disk:   math.Max(0, r.Disk-o.Disk),
+	}
+}
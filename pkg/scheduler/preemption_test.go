@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPreemptionScheduler creates a scheduler running tasks with the given
+// priorities and start times, each using 10 CPUs and 100GB of memory
+func newPreemptionScheduler(t *testing.T, tasks ...RunningTask) *DRFScheduler {
+	scheduler := NewDRFScheduler(Resources{CPU: 40, Memory: 1000})
+	scheduler.RegisterTenant("tenant-a", "Tenant A", Resources{CPU: 40, Memory: 1000}, 1.0)
+	scheduler.RegisterTenant("tenant-b", "Tenant B", Resources{CPU: 40, Memory: 1000}, 1.0)
+
+	for _, task := range tasks {
+		task.Resources = Resources{CPU: 10, Memory: 100}
+		allowed, reason := scheduler.ScheduleTask(task.TaskRequest)
+		require.True(t, allowed, reason)
+		scheduler.tasks[task.TaskID].StartedAt = task.StartedAt
+	}
+	return scheduler
+}
+
+func runningTask(tenantID, taskID string, priority int, startedAt time.Time) RunningTask {
+	return RunningTask{TaskRequest: TaskRequest{TenantID: tenantID, TaskID: taskID, Priority: priority}, StartedAt: startedAt}
+}
+
+func TestDRFScheduler_preempt(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	tasks := []RunningTask{
+		runningTask("tenant-a", "a-old", 1, start),
+		runningTask("tenant-a", "a-new", 1, start.Add(20*time.Minute)),
+		runningTask("tenant-a", "a-low", 0, start.Add(10*time.Minute)),
+		runningTask("tenant-b", "b-low", 0, start.Add(30*time.Minute)),
+	}
+
+	tests := []struct {
+		name     string
+		policy   PreemptionPolicy
+		request  TaskRequest
+		expected []string
+	}{
+		{
+			name:     "Lowest priority and newest first",
+			policy:   PreemptLowPriority,
+			request:  TaskRequest{TenantID: "tenant-b", TaskID: "new", Priority: 5, Resources: Resources{CPU: 20}},
+			expected: []string{"b-low", "a-low"},
+		},
+		{
+			name:     "Oldest first",
+			policy:   PreemptOldest,
+			request:  TaskRequest{TenantID: "tenant-b", TaskID: "new", Priority: 5, Resources: Resources{CPU: 20}},
+			expected: []string{"a-old", "a-low"},
+		},
+		{
+			name:     "Tenants over fair share first",
+			policy:   PreemptOverFairShare,
+			request:  TaskRequest{TenantID: "tenant-b", TaskID: "new", Priority: 5, Resources: Resources{CPU: 10}},
+			expected: []string{"a-low"},
+		},
+		{
+			name:     "Only lower priorities",
+			policy:   PreemptLowPriority,
+			request:  TaskRequest{TenantID: "tenant-b", TaskID: "new", Priority: 1, Resources: Resources{CPU: 30}},
+			expected: nil,
+		},
+		{
+			name:     "Never",
+			policy:   PreemptNever,
+			request:  TaskRequest{TenantID: "tenant-b", TaskID: "new", Priority: 5, Resources: Resources{CPU: 10}},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := newPreemptionScheduler(t, tasks...)
+
+			// Dry runs select the same tasks without releasing them
+			assert.Equal(t, tt.expected, scheduler.preempt(tt.request, tt.policy, true))
+			assert.Len(t, scheduler.tasks, len(tasks))
+
+			assert.Equal(t, tt.expected, scheduler.preempt(tt.request, tt.policy, false))
+			assert.Len(t, scheduler.tasks, len(tasks)-len(tt.expected))
+			if tt.expected != nil {
+				allowed, reason := scheduler.ScheduleTask(tt.request)
+				assert.True(t, allowed, reason)
+			}
+		})
+	}
+}
+
+func TestDRFScheduler_preemptQuota(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	scheduler := newPreemptionScheduler(t,
+		runningTask("tenant-a", "a-1", 0, start),
+		runningTask("tenant-b", "b-1", 0, start.Add(time.Minute)),
+	)
+	scheduler.tenants["tenant-a"].Quota = Resources{CPU: 10, Memory: 1000}
+
+	// The cluster has room, but only the tenant's own tasks free its quota
+	request := TaskRequest{TenantID: "tenant-a", TaskID: "a-2", Priority: 1, Resources: Resources{CPU: 5}}
+	assert.Equal(t, []string{"a-1"}, scheduler.preempt(request, PreemptLowPriority, false))
+	assert.Equal(t, 0.0, scheduler.tenants["tenant-a"].Usage.CPU)
+	assert.Equal(t, 10.0, scheduler.tenants["tenant-b"].Usage.CPU)
+
+	// Nothing is preempted when preemption cannot make enough room
+	request = TaskRequest{TenantID: "tenant-a", TaskID: "a-3", Priority: 1, Resources: Resources{CPU: 15}}
+	assert.Nil(t, scheduler.preempt(request, PreemptLowPriority, false))
+	assert.Len(t, scheduler.tasks, 1)
+}
+
+func TestDRFScheduler_preemptAfterReleaseResources(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	scheduler := newPreemptionScheduler(t,
+		runningTask("tenant-a", "a-1", 0, start),
+		runningTask("tenant-a", "a-2", 0, start.Add(time.Minute)),
+		runningTask("tenant-b", "b-1", 0, start.Add(2*time.Minute)),
+		runningTask("tenant-b", "b-2", 0, start.Add(3*time.Minute)),
+	)
+
+	// Releasing resources by amount releases the oldest matching task
+	require.NoError(t, scheduler.ReleaseResources("tenant-a", Resources{CPU: 10, Memory: 100}))
+	assert.NotContains(t, scheduler.tasks, "a-1")
+	assert.Equal(t, 10.0, scheduler.tenants["tenant-a"].Usage.CPU)
+
+	// The released task is no preemption candidate
+	request := TaskRequest{TenantID: "tenant-b", TaskID: "b-3", Priority: 1, Resources: Resources{CPU: 20}}
+	assert.Equal(t, []string{"a-2"}, scheduler.preempt(request, PreemptOldest, true))
+
+	// and can be scheduled again
+	allowed, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-a", TaskID: "a-1", Resources: Resources{CPU: 10, Memory: 100}})
+	assert.True(t, allowed, reason)
+}
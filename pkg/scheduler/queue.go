@@ -0,0 +1,265 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Built-in priority classes, from most to least important
+const (
+	PriorityClassSystem = "system"
+	PriorityClassHigh   = "high"
+	PriorityClassNormal = "normal"
+	PriorityClassBatch  = "batch"
+)
+
+// defaultQueueLimit bounds the pending tasks of tenants without a QueueLimit
+const defaultQueueLimit = 100
+
+// PendingTask is a task request waiting for resources
+type PendingTask struct {
+	TaskRequest
+	EnqueuedAt time.Time
+	Position   int    // Position in the queue, starting at 0
+	Reason     string // Why the task could not be scheduled yet
+}
+
+// defaultPriorityClasses returns the values of the built-in priority classes
+func defaultPriorityClasses() map[string]int {
+	return map[string]int{
+		PriorityClassSystem: 1000,
+		PriorityClassHigh:   100,
+		PriorityClassNormal: 0,
+		PriorityClassBatch:  -100,
+	}
+}
+
+// RegisterPriorityClass adds a priority class or changes its value. Running
+// tasks keep the priority they were scheduled with.
+func (d *DRFScheduler) RegisterPriorityClass(name string, value int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.classes[name] = value
+}
+
+// resolvePriority sets the priority of a request from its priority class,
+// reporting false for unknown classes. The caller must hold d.mu.
+func (d *DRFScheduler) resolvePriority(request *TaskRequest) bool {
+	if request.PriorityClass == "" {
+		return true
+	}
+	value, exists := d.classes[request.PriorityClass]
+	if !exists {
+		return false
+	}
+	request.Priority = value
+	return true
+}
+
+// SetQueueLimit limits how many tasks of a tenant may be pending
+func (d *DRFScheduler) SetQueueLimit(tenantID string, limit int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tenant, exists := d.tenants[tenantID]
+	if !exists {
+		return fmt.Errorf("tenant %s not found", tenantID)
+	}
+	tenant.QueueLimit = limit
+	return nil
+}
+
+// SetScheduledHandler registers a function called with each pending task
+// once it is scheduled, outside of the scheduler's lock
+func (d *DRFScheduler) SetScheduledHandler(handler func(RunningTask)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onScheduled = handler
+}
+
+// SubmitTask schedules a task like ScheduleTask, but queues it if it does
+// not fit yet. Queued tasks are scheduled as resources are released.
+func (d *DRFScheduler) SubmitTask(request TaskRequest) (bool, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tenant, exists := d.tenants[request.TenantID]
+	if !exists {
+		return false, "tenant not found"
+	}
+	if request.TaskID == "" {
+		return false, "task ID required"
+	}
+	if d.pendingIndex(request.TaskID) >= 0 || d.waitingGangMember(request.TaskID) {
+		return false, "task already pending"
+	}
+	if !d.resolvePriority(&request) {
+		return false, "unknown priority class"
+	}
+	// Requests that can never fit are not queued
+	if exceeded := d.limitExceeded(map[string]Resources{tenant.ID: request.Resources}); exceeded == tenant.ID {
+		return false, "request exceeds tenant quota"
+	} else if exceeded != "" {
+		return false, fmt.Sprintf("request exceeds the quota of tenant %s", exceeded)
+	}
+	if tooLarge := shortage(Resources{}, request.Resources, d.clusterTotal); tooLarge.CPU > 0 || tooLarge.Memory > 0 || tooLarge.GPU > 0 {
+		return false, "request exceeds cluster capacity"
+	}
+	if !d.fitsEmptyNode(request.Resources) {
+		return false, "request exceeds every node"
+	}
+
+	// Tasks that fit right away are not queued, which lets them backfill
+	// room that queued tasks are too large for
+	ok, reason := d.schedule(request)
+	if ok || reason == "task already scheduled" {
+		return ok, reason
+	}
+	if limit := queueLimit(tenant); d.pendingCount(tenant.ID) >= limit {
+		return false, fmt.Sprintf("%s, pending queue limit of %d reached", reason, limit)
+	}
+
+	d.pending = append(d.pending, &PendingTask{TaskRequest: request, EnqueuedAt: time.Now(), Reason: reason})
+	return false, "queued: " + reason
+}
+
+// CancelPendingTask removes a task from the pending queue
+func (d *DRFScheduler) CancelPendingTask(taskID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.pendingIndex(taskID)
+	if i < 0 {
+		return fmt.Errorf("task %s is not pending", taskID)
+	}
+	d.pending = append(d.pending[:i], d.pending[i+1:]...)
+	return nil
+}
+
+// GetPendingTasks returns the pending tasks of a tenant in queue order, or
+// all pending tasks if tenantID is empty
+func (d *DRFScheduler) GetPendingTasks(tenantID string) []PendingTask {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sortPending()
+	tasks := make([]PendingTask, 0)
+	for i, task := range d.pending {
+		if tenantID == "" || task.TenantID == tenantID {
+			pending := *task
+			pending.Position = i
+			tasks = append(tasks, pending)
+		}
+	}
+	return tasks
+}
+
+// GetPendingTask returns a pending task and its position in the queue
+func (d *DRFScheduler) GetPendingTask(taskID string) (*PendingTask, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sortPending()
+	i := d.pendingIndex(taskID)
+	if i < 0 {
+		return nil, fmt.Errorf("task %s is not pending", taskID)
+	}
+	pending := *d.pending[i]
+	pending.Position = i
+	return &pending, nil
+}
+
+// schedulePending schedules pending tasks that fit, in queue order, until no
+// more do. A task that does not fit does not hold back smaller tasks queued
+// behind it. The caller must hold d.mu.
+func (d *DRFScheduler) schedulePending() []RunningTask {
+	scheduled := make([]RunningTask, 0)
+	for {
+		// Shares change with every scheduled task, so the order does too
+		d.sortPending()
+		progress := false
+		for i, task := range d.pending {
+			ok, reason := d.schedule(task.TaskRequest)
+			if !ok {
+				task.Reason = reason
+				continue
+			}
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			scheduled = append(scheduled, *d.tasks[task.TaskID])
+			log.Printf("Scheduled pending task %s of tenant %s after %s",
+				task.TaskID, task.TenantID, time.Since(task.EnqueuedAt).Round(time.Millisecond))
+			progress = true
+			break
+		}
+		if !progress {
+			return scheduled
+		}
+	}
+}
+
+// sortPending orders the queue by priority, then by the weighted dominant
+// share of the tenant like GetSchedulingOrder, then by arrival. The caller
+// must hold d.mu.
+func (d *DRFScheduler) sortPending() {
+	sort.SliceStable(d.pending, func(i, j int) bool {
+		a, b := d.pending[i], d.pending[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if shareA, shareB := d.tenantShare(a.TenantID), d.tenantShare(b.TenantID); shareA != shareB {
+			return shareA < shareB
+		}
+		return a.EnqueuedAt.Before(b.EnqueuedAt)
+	})
+}
+
+// pendingIndex returns the queue index of a task, or -1. The caller must
+// hold d.mu.
+func (d *DRFScheduler) pendingIndex(taskID string) int {
+	for i, task := range d.pending {
+		if task.TaskID == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+// pendingCount returns the number of pending tasks of a tenant. The caller
+// must hold d.mu.
+func (d *DRFScheduler) pendingCount(tenantID string) int {
+	count := 0
+	for _, task := range d.pending {
+		if task.TenantID == tenantID {
+			count++
+		}
+	}
+	return count
+}
+
+// queueLimit returns how many tasks of a tenant may be pending
+func queueLimit(tenant *Tenant) int {
+	if tenant.QueueLimit > 0 {
+		return tenant.QueueLimit
+	}
+	return defaultQueueLimit
+}
+
+// notifyScheduled calls the scheduled handler for pending tasks that were
+// scheduled. The caller must not hold d.mu.
+func (d *DRFScheduler) notifyScheduled(tasks []RunningTask) {
+	if len(tasks) == 0 {
+		return
+	}
+	d.mu.RLock()
+	handler := d.onScheduled
+	d.mu.RUnlock()
+
+	if handler == nil {
+		return
+	}
+	for _, task := range tasks {
+		handler(task)
+	}
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDRFScheduler_SubmitTask(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 20, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 20, Memory: 1000}, 1.0)
+	scheduler.RegisterTenant("tenant-2", "Tenant Two", Resources{CPU: 20, Memory: 1000}, 1.0)
+
+	var mu sync.Mutex
+	scheduled := make([]string, 0)
+	scheduler.SetScheduledHandler(func(task RunningTask) {
+		mu.Lock()
+		defer mu.Unlock()
+		scheduled = append(scheduled, task.TaskID)
+	})
+
+	submit := func(tenantID, taskID string, cpu float64, class string) (bool, string) {
+		return scheduler.SubmitTask(TaskRequest{TenantID: tenantID, TaskID: taskID, Resources: Resources{CPU: cpu}, PriorityClass: class})
+	}
+
+	ok, reason := submit("tenant-1", "running", 20, PriorityClassNormal)
+	require.True(t, ok, reason)
+
+	ok, reason = submit("tenant-1", "batch", 10, PriorityClassBatch)
+	assert.False(t, ok)
+	assert.Equal(t, "queued: quota exceeded", reason)
+	ok, _ = submit("tenant-2", "normal", 10, PriorityClassNormal)
+	assert.False(t, ok)
+	ok, _ = submit("tenant-1", "high", 20, PriorityClassHigh)
+	assert.False(t, ok)
+
+	// Higher priority classes go first
+	pending := scheduler.GetPendingTasks("")
+	require.Len(t, pending, 3)
+	assert.Equal(t, "high", pending[0].TaskID)
+	assert.Equal(t, 100, pending[0].Priority)
+	assert.Equal(t, "normal", pending[1].TaskID)
+	assert.Equal(t, "batch", pending[2].TaskID)
+
+	task, err := scheduler.GetPendingTask("batch")
+	require.NoError(t, err)
+	assert.Equal(t, 2, task.Position)
+	assert.Equal(t, "quota exceeded", task.Reason)
+
+	// The high priority task takes the released capacity, the others keep
+	// waiting
+	require.NoError(t, scheduler.ReleaseTask("running"))
+	assert.Equal(t, []string{"high"}, scheduled)
+	assert.Len(t, scheduler.GetPendingTasks(""), 2)
+
+	// Released capacity goes to the remaining tasks by priority
+	require.NoError(t, scheduler.ReleaseTask("high"))
+	assert.Equal(t, []string{"high", "normal", "batch"}, scheduled)
+	assert.Empty(t, scheduler.GetPendingTasks(""))
+}
+
+func TestDRFScheduler_SubmitTaskHierarchy(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+
+	ok, reason := scheduler.SubmitTask(TaskRequest{TenantID: "team-b", TaskID: "b-1", Resources: Resources{CPU: 60}})
+	require.True(t, ok, reason)
+	ok, reason = scheduler.SubmitTask(TaskRequest{TenantID: "team-a", TaskID: "a-1", Resources: Resources{CPU: 40}})
+	require.True(t, ok, reason)
+
+	// Team A is within its own limit but the org is at its limit, so the
+	// task waits for capacity of the org
+	ok, reason = scheduler.SubmitTask(TaskRequest{TenantID: "team-a", TaskID: "a-2", Resources: Resources{CPU: 30}})
+	assert.False(t, ok)
+	assert.Equal(t, "queued: quota exceeded", reason)
+
+	// Requests beyond a limit in the hierarchy are never queued
+	ok, reason = scheduler.SubmitTask(TaskRequest{TenantID: "team-b", TaskID: "b-2", Resources: Resources{CPU: 90}})
+	assert.False(t, ok)
+	assert.Equal(t, "request exceeds tenant quota", reason)
+
+	require.NoError(t, scheduler.ReleaseTask("b-1"))
+	assert.Empty(t, scheduler.GetPendingTasks(""))
+	assert.Len(t, scheduler.GetRunningTasks("team-a"), 2)
+}
+
+func TestDRFScheduler_SubmitTaskFairShare(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 40, Memory: 1000})
+	scheduler.RegisterTenant("heavy", "Heavy", Resources{CPU: 40, Memory: 1000}, 1.0)
+	scheduler.RegisterTenant("light", "Light", Resources{CPU: 40, Memory: 1000}, 1.0)
+
+	ok, _ := scheduler.SubmitTask(TaskRequest{TenantID: "heavy", TaskID: "heavy-1", Resources: Resources{CPU: 30}})
+	require.True(t, ok)
+	ok, _ = scheduler.SubmitTask(TaskRequest{TenantID: "light", TaskID: "light-1", Resources: Resources{CPU: 10}})
+	require.True(t, ok)
+
+	// Within a priority the tenant with the lower share goes first
+	scheduler.SubmitTask(TaskRequest{TenantID: "heavy", TaskID: "heavy-2", Resources: Resources{CPU: 10}})
+	scheduler.SubmitTask(TaskRequest{TenantID: "light", TaskID: "light-2", Resources: Resources{CPU: 10}})
+	pending := scheduler.GetPendingTasks("")
+	require.Len(t, pending, 2)
+	assert.Equal(t, "light-2", pending[0].TaskID)
+
+	require.NoError(t, scheduler.ReleaseResources("heavy", Resources{CPU: 10}))
+	assert.Len(t, scheduler.GetRunningTasks("light"), 2)
+	assert.Equal(t, "heavy-2", scheduler.GetPendingTasks("heavy")[0].TaskID)
+}
+
+func TestDRFScheduler_SubmitTaskRejections(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 10, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 10, Memory: 1000}, 1.0)
+	require.NoError(t, scheduler.SetQueueLimit("tenant-1", 1))
+	assert.Error(t, scheduler.SetQueueLimit("missing", 1))
+
+	ok, _ := scheduler.SubmitTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-1", Resources: Resources{CPU: 10}})
+	require.True(t, ok)
+	ok, _ = scheduler.SubmitTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-2", Resources: Resources{CPU: 5}})
+	require.False(t, ok)
+
+	tests := []struct {
+		name    string
+		request TaskRequest
+		reason  string
+	}{
+		{"Unknown tenant", TaskRequest{TenantID: "missing", TaskID: "task-3"}, "tenant not found"},
+		{"Missing task ID", TaskRequest{TenantID: "tenant-1"}, "task ID required"},
+		{"Running task", TaskRequest{TenantID: "tenant-1", TaskID: "task-1"}, "task already scheduled"},
+		{"Pending task", TaskRequest{TenantID: "tenant-1", TaskID: "task-2"}, "task already pending"},
+		{"Unknown class", TaskRequest{TenantID: "tenant-1", TaskID: "task-3", PriorityClass: "urgent"}, "unknown priority class"},
+		{"Larger than quota", TaskRequest{TenantID: "tenant-1", TaskID: "task-3", Resources: Resources{CPU: 11}}, "request exceeds tenant quota"},
+		{"Queue full", TaskRequest{TenantID: "tenant-1", TaskID: "task-3", Resources: Resources{CPU: 5}}, "quota exceeded, pending queue limit of 1 reached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, reason := scheduler.SubmitTask(tt.request)
+			assert.False(t, ok)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+
+	// Custom classes are usable once registered
+	scheduler.RegisterPriorityClass("urgent", 500)
+	ok, reason := scheduler.ScheduleTask(TaskRequest{TenantID: "tenant-1", TaskID: "task-4", PriorityClass: "urgent"})
+	require.True(t, ok, reason)
+	assert.Equal(t, 500, scheduler.tasks["task-4"].Priority)
+
+	require.NoError(t, scheduler.CancelPendingTask("task-2"))
+	assert.Error(t, scheduler.CancelPendingTask("task-2"))
+	_, err := scheduler.GetPendingTask("task-2")
+	assert.Error(t, err)
+}
@@ -13,9 +13,12 @@ type QuotaEnforcer struct {
 	scheduler        *DRFScheduler
 	quotaViolations  map[string]int
 	violationsMux    sync.RWMutex
+	settingsMux      sync.RWMutex // guards enforcementMode, dryRun and waitPercentile
 	enforcementMode  EnforcementMode
 	gracePeriod      time.Duration
 	preemptionPolicy PreemptionPolicy
+	dryRun           bool
+	waitPercentile   float64
 }
 
 // EnforcementMode defines how strictly quotas are enforced
@@ -30,18 +33,24 @@ const (
 // PreemptionPolicy defines task preemption behavior
 type PreemptionPolicy string
 
+// Only tasks of lower priority than the request are ever preempted, the
+// policy decides which of them go first
 const (
-	PreemptNever       PreemptionPolicy = "never"
-	PreemptLowPriority PreemptionPolicy = "low-priority"
-	PreemptOldest      PreemptionPolicy = "oldest"
+	PreemptNever         PreemptionPolicy = "never"
+	PreemptLowPriority   PreemptionPolicy = "low-priority"    // Lowest priority, newest first
+	PreemptOldest        PreemptionPolicy = "oldest"          // Longest running first
+	PreemptOverFairShare PreemptionPolicy = "over-fair-share" // Tenants furthest over fair share first
 )
 
 // QuotaEnforcementResult represents enforcement decision
 type QuotaEnforcementResult struct {
 	Allowed        bool
+	Scheduled      bool // The request was scheduled and must not be scheduled again
 	Reason         string
 	SuggestedWait  time.Duration
 	PreemptedTasks []string
+	DryRun         bool // PreemptedTasks would have been preempted but still run
+	WaitEstimate   *WaitEstimate
 }
 
 // NewQuotaEnforcer creates a new quota enforcer
@@ -52,11 +61,18 @@ func NewQuotaEnforcer(scheduler *DRFScheduler, mode EnforcementMode, policy Pree
 		enforcementMode:  mode,
 		gracePeriod:      5 * time.Minute,
 		preemptionPolicy: policy,
+		waitPercentile:   90,
 	}
 }
 
-// EnforceQuota checks if a task can be scheduled within quota limits
+// EnforceQuota checks if a task can be scheduled within quota limits. A task
+// that only fits by preempting others is scheduled right away and reported
+// Scheduled, any other allowed task is left to the caller to schedule.
 func (qe *QuotaEnforcer) EnforceQuota(ctx context.Context, request TaskRequest) QuotaEnforcementResult {
+	qe.settingsMux.RLock()
+	mode, dryRun, percentile := qe.enforcementMode, qe.dryRun, qe.waitPercentile
+	qe.settingsMux.RUnlock()
+
 	// Check tenant quota
 	stats, err := qe.scheduler.GetTenantStats(request.TenantID)
 	if err != nil {
@@ -93,15 +109,47 @@ func (qe *QuotaEnforcer) EnforceQuota(ctx context.Context, request TaskRequest)
 			stats.QuotaRemaining.GPU, request.Resources.GPU)
 	}
 
-	// Apply enforcement policy
-	switch qe.enforcementMode {
+	// Make room by preempting lower priority tasks. The request is
+	// scheduled in their place right away, so the caller must not schedule
+	// it again but must kill the preempted tasks, whose resources are
+	// already released.
+	var dryRunVictims []string
+	if (wouldExceedQuota || !qe.scheduler.hasCapacity(request.Resources)) && qe.preemptionPolicy != PreemptNever {
+		if !dryRun {
+			if preemptedTasks, scheduled := qe.scheduler.preemptAndSchedule(request, qe.preemptionPolicy); scheduled {
+				return QuotaEnforcementResult{
+					Allowed:        true,
+					Scheduled:      true,
+					Reason:         "scheduled after preemption",
+					PreemptedTasks: preemptedTasks,
+				}
+			}
+		} else if preemptedTasks := qe.scheduler.preempt(request, qe.preemptionPolicy, true); len(preemptedTasks) > 0 {
+			log.Printf("Dry run: task %s of tenant %s would preempt %v", request.TaskID, request.TenantID, preemptedTasks)
+			dryRunVictims = preemptedTasks
+		}
+	}
+
+	result := qe.applyEnforcementMode(request, mode, percentile, wouldExceedQuota, exceedReason)
+	if dryRunVictims != nil {
+		result.PreemptedTasks = dryRunVictims
+		result.DryRun = true
+	}
+	return result
+}
+
+// applyEnforcementMode decides on a request without preemption
+func (qe *QuotaEnforcer) applyEnforcementMode(request TaskRequest, mode EnforcementMode, percentile float64, wouldExceedQuota bool, exceedReason string) QuotaEnforcementResult {
+	switch mode {
 	case HardEnforcement:
 		if wouldExceedQuota {
 			qe.recordViolation(request.TenantID)
+			wait := qe.scheduler.EstimateWait(request, percentile)
 			return QuotaEnforcementResult{
 				Allowed:       false,
 				Reason:        exceedReason,
-				SuggestedWait: qe.estimateWaitTime(request),
+				SuggestedWait: wait.Wait,
+				WaitEstimate:  &wait,
 			}
 		}
 
@@ -119,27 +167,17 @@ func (qe *QuotaEnforcer) EnforceQuota(ctx context.Context, request TaskRequest)
 			if clusterUtil.CPUUtilization < 0.7 && clusterUtil.MemoryUtilization < 0.7 {
 				log.Printf("Allowing oversubscription for tenant %s due to low cluster utilization", request.TenantID)
 			} else {
+				wait := qe.scheduler.EstimateWait(request, percentile)
 				return QuotaEnforcementResult{
 					Allowed:       false,
 					Reason:        exceedReason + " (adaptive mode, cluster at high utilization)",
-					SuggestedWait: qe.estimateWaitTime(request),
+					SuggestedWait: wait.Wait,
+					WaitEstimate:  &wait,
 				}
 			}
 		}
 	}
 
-	// Check if preemption is needed
-	if wouldExceedQuota && qe.preemptionPolicy != PreemptNever {
-		preemptedTasks := qe.attemptPreemption(request)
-		if len(preemptedTasks) > 0 {
-			return QuotaEnforcementResult{
-				Allowed:        true,
-				Reason:         "scheduled after preemption",
-				PreemptedTasks: preemptedTasks,
-			}
-		}
-	}
-
 	return QuotaEnforcementResult{
 		Allowed: true,
 		Reason:  "within quota limits",
@@ -160,22 +198,34 @@ func (qe *QuotaEnforcer) GetViolationCount(tenantID string) int {
 	return qe.quotaViolations[tenantID]
 }
 
-// estimateWaitTime estimates how long until resources become available
-func (qe *QuotaEnforcer) estimateWaitTime(request TaskRequest) time.Duration {
-	// Simple estimation: assume average task duration is 10 minutes
-	// In production, this should use historical task duration data
-	return 10 * time.Minute
+// estimateWaitTime estimates how long until resources become available from
+// the runtimes of finished tasks, falling back to 10 minutes without history
+func (qe *QuotaEnforcer) estimateWaitTime(request TaskRequest) WaitEstimate {
+	qe.settingsMux.RLock()
+	percentile := qe.waitPercentile
+	qe.settingsMux.RUnlock()
+	return qe.scheduler.EstimateWait(request, percentile)
 }
 
-// attemptPreemption tries to preempt lower-priority tasks to make room
+// SetWaitPercentile sets the percentile of remaining runtimes wait estimates
+// expect running tasks to finish within
+func (qe *QuotaEnforcer) SetWaitPercentile(percentile float64) {
+	if percentile <= 0 || percentile > 100 {
+		return
+	}
+	qe.settingsMux.Lock()
+	defer qe.settingsMux.Unlock()
+	qe.waitPercentile = percentile
+}
+
+// attemptPreemption tries to preempt lower-priority tasks to make room and
+// returns the IDs of the tasks to kill. In dry-run mode the tasks keep their
+// resources.
 func (qe *QuotaEnforcer) attemptPreemption(request TaskRequest) []string {
-	// TODO: Implement actual preemption logic
-	// This would involve:
-	// 1. Finding running tasks from the same tenant
-	// 2. Selecting tasks based on preemption policy
-	// 3. Gracefully terminating those tasks
-	// 4. Returning list of preempted task IDs
-	return []string{}
+	qe.settingsMux.RLock()
+	dryRun := qe.dryRun
+	qe.settingsMux.RUnlock()
+	return qe.scheduler.preempt(request, qe.preemptionPolicy, dryRun)
 }
 
 // MonitorQuotas monitors and logs quota usage periodically
@@ -224,10 +274,21 @@ func (qe *QuotaEnforcer) logQuotaStatus() {
 
 // SetEnforcementMode changes the enforcement mode dynamically
 func (qe *QuotaEnforcer) SetEnforcementMode(mode EnforcementMode) {
+	qe.settingsMux.Lock()
 	qe.enforcementMode = mode
+	qe.settingsMux.Unlock()
 	log.Printf("Quota enforcement mode changed to: %s", mode)
 }
 
+// SetDryRun toggles dry-run mode, in which preemption only reports the tasks
+// it would preempt
+func (qe *QuotaEnforcer) SetDryRun(dryRun bool) {
+	qe.settingsMux.Lock()
+	qe.dryRun = dryRun
+	qe.settingsMux.Unlock()
+	log.Printf("Quota enforcement preemption dry run: %t", dryRun)
+}
+
 // ResetViolations clears violation history for a tenant
 func (qe *QuotaEnforcer) ResetViolations(tenantID string) {
 	qe.violationsMux.Lock()
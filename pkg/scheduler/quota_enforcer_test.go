@@ -280,8 +280,10 @@ func TestQuotaEnforcer_estimateWaitTime(t *testing.T) {
 		Resources: Resources{CPU: 10, Memory: 100, GPU: 1, Disk: 500},
 	}
 
-	waitTime := enforcer.estimateWaitTime(request)
-	assert.Equal(t, 10*time.Minute, waitTime)
+	// Without history the default is suggested
+	estimate := enforcer.estimateWaitTime(request)
+	assert.Equal(t, 10*time.Minute, estimate.Wait)
+	assert.False(t, estimate.Historical)
 }
 
 func TestQuotaEnforcer_attemptPreemption(t *testing.T) {
@@ -295,7 +297,53 @@ func TestQuotaEnforcer_attemptPreemption(t *testing.T) {
 	}
 
 	preemptedTasks := enforcer.attemptPreemption(request)
-	assert.Empty(t, preemptedTasks) // TODO implementation returns empty slice
+	assert.Empty(t, preemptedTasks) // No running tasks to preempt
+}
+
+func TestQuotaEnforcer_EnforceQuota_Preemption(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 100, Memory: 1000, GPU: 10, Disk: 5000})
+	enforcer := NewQuotaEnforcer(scheduler, HardEnforcement, PreemptLowPriority)
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 20, Memory: 200, GPU: 2, Disk: 1000}, 1.0)
+
+	for i, priority := range []int{0, 5} {
+		allowed, reason := scheduler.ScheduleTask(TaskRequest{
+			TenantID:  "tenant-1",
+			TaskID:    fmt.Sprintf("batch-%d", i),
+			Resources: Resources{CPU: 10, Memory: 100},
+			Priority:  priority,
+		})
+		assert.True(t, allowed, reason)
+	}
+
+	// Requests of equal priority never preempt
+	request := TaskRequest{TenantID: "tenant-1", TaskID: "web", Resources: Resources{CPU: 10, Memory: 50}}
+	result := enforcer.EnforceQuota(context.Background(), request)
+	assert.False(t, result.Allowed)
+	assert.Empty(t, result.PreemptedTasks)
+
+	// Dry runs report the victim without releasing it
+	request.Priority = 10
+	enforcer.SetDryRun(true)
+	result = enforcer.EnforceQuota(context.Background(), request)
+	assert.False(t, result.Allowed)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []string{"batch-0"}, result.PreemptedTasks)
+	assert.Len(t, scheduler.GetRunningTasks("tenant-1"), 2)
+
+	enforcer.SetDryRun(false)
+	result = enforcer.EnforceQuota(context.Background(), request)
+	assert.True(t, result.Allowed)
+	assert.False(t, result.DryRun)
+	assert.True(t, result.Scheduled)
+	assert.Equal(t, "scheduled after preemption", result.Reason)
+	assert.Equal(t, []string{"batch-0"}, result.PreemptedTasks)
+
+	// The request already took the freed resources
+	allowed, reason := scheduler.ScheduleTask(request)
+	assert.False(t, allowed)
+	assert.Equal(t, "task already scheduled", reason)
+	stats, _ := scheduler.GetTenantStats("tenant-1")
+	assert.Equal(t, 0.0, stats.QuotaRemaining.CPU)
 }
 
 func TestQuotaEnforcer_MonitorQuotas(t *testing.T) {
@@ -391,6 +439,11 @@ func TestQuotaEnforcer_ConcurrentAccess(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func(tenantID string) {
 			defer func() { done <- true }()
+
+			// Settings change while requests are enforced
+			enforcer.SetDryRun(false)
+			enforcer.SetWaitPercentile(50)
+			enforcer.SetEnforcementMode(HardEnforcement)
 			
 			request := TaskRequest{
 				TenantID: tenantID,
@@ -401,6 +454,8 @@ func TestQuotaEnforcer_ConcurrentAccess(t *testing.T) {
 			ctx := context.Background()
 			result := enforcer.EnforceQuota(ctx, request)
 			assert.True(t, result.Allowed, "Quota enforcement should allow task for %s: %s", tenantID, result.Reason)
+			// Tasks within quota are left to the caller to schedule
+			assert.False(t, result.Scheduled)
 		}(fmt.Sprintf("tenant-%d", i))
 	}
 
@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// maxRuntimeHistory bounds the number of finished tasks remembered
+	maxRuntimeHistory = 1000
+	// defaultWaitEstimate is suggested when there is no history to go by
+	defaultWaitEstimate = 10 * time.Minute
+)
+
+// taskRuntime records how long a finished task ran
+type taskRuntime struct {
+	TenantID string
+	Shape    string
+	Runtime  time.Duration
+}
+
+// WaitEstimate explains a suggested wait until a request fits
+type WaitEstimate struct {
+	Wait       time.Duration
+	Percentile float64
+	// Historical is false when the default estimate was used because
+	// running tasks could not be matched with finished ones
+	Historical bool
+	// Releasing are the running tasks expected to free enough resources,
+	// in the order they are expected to finish
+	Releasing []string
+	Reason    string
+}
+
+// resourceShape identifies tasks requesting the same resources
+func resourceShape(r Resources) string {
+	return fmt.Sprintf("cpu=%g,mem=%g,gpu=%g,disk=%g", r.CPU, r.Memory, r.GPU, r.Disk)
+}
+
+// recordRuntime remembers how long a finished task ran. The caller must hold
+// d.mu.
+func (d *DRFScheduler) recordRuntime(task *RunningTask, finishedAt time.Time) {
+	d.runtimes = append(d.runtimes, taskRuntime{
+		TenantID: task.TenantID,
+		Shape:    resourceShape(task.Resources),
+		Runtime:  finishedAt.Sub(task.StartedAt),
+	})
+	if len(d.runtimes) > maxRuntimeHistory {
+		d.runtimes = d.runtimes[len(d.runtimes)-maxRuntimeHistory:]
+	}
+}
+
+// runtimeSamples returns the runtimes of finished tasks most like a running
+// task: of the same tenant and shape, else of the same shape, else of the
+// same tenant. The caller must hold d.mu.
+func (d *DRFScheduler) runtimeSamples(task *RunningTask) []time.Duration {
+	shape := resourceShape(task.Resources)
+	matchers := []func(taskRuntime) bool{
+		func(r taskRuntime) bool { return r.TenantID == task.TenantID && r.Shape == shape },
+		func(r taskRuntime) bool { return r.Shape == shape },
+		func(r taskRuntime) bool { return r.TenantID == task.TenantID },
+	}
+	for _, matches := range matchers {
+		samples := make([]time.Duration, 0)
+		for _, r := range d.runtimes {
+			if matches(r) {
+				samples = append(samples, r.Runtime)
+			}
+		}
+		if len(samples) > 0 {
+			return samples
+		}
+	}
+	return nil
+}
+
+// remainingRuntime estimates how much longer a running task runs as the
+// given percentile of the remaining runtime of similar finished tasks that
+// ran longer than it has so far. The caller must hold d.mu.
+func (d *DRFScheduler) remainingRuntime(task *RunningTask, percentile float64, now time.Time) (time.Duration, bool) {
+	elapsed := now.Sub(task.StartedAt)
+	remaining := make([]time.Duration, 0)
+	for _, runtime := range d.runtimeSamples(task) {
+		if runtime > elapsed {
+			remaining = append(remaining, runtime-elapsed)
+		}
+	}
+	if len(remaining) == 0 {
+		return 0, false
+	}
+
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i] < remaining[j] })
+	rank := int(math.Ceil(percentile/100*float64(len(remaining)))) - 1
+	return remaining[min(max(rank, 0), len(remaining)-1)], true
+}
+
+// EstimateWait estimates how long a request waits until running tasks free
+// enough quota and cluster capacity for it, from the runtimes of finished
+// tasks. Quota is freed by tasks within the limits of the tenant and its
+// ancestors the request exceeds, and by tasks borrowing guaranteed capacity
+// the tenant lent. Running tasks are expected to finish at the given
+// percentile of their remaining runtime.
+func (d *DRFScheduler) EstimateWait(request TaskRequest, percentile float64) WaitEstimate {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	estimate := WaitEstimate{Wait: defaultWaitEstimate, Percentile: percentile}
+	tenant, exists := d.tenants[request.TenantID]
+	if !exists {
+		estimate.Reason = "tenant not found"
+		return estimate
+	}
+
+	// Shortages against the limits of the tenant and its ancestors, by
+	// tenant ID
+	limits := make(map[string]Resources)
+	for node := tenant; node != nil; node = d.tenants[node.Parent] {
+		if s := shortage(d.subtreeUsage(node), request.Resources, node.Quota); !s.isZero() {
+			limits[node.ID] = s
+		}
+	}
+	_, reclaims := d.quotaShortage(tenant, request.Resources)
+	clusterShortage := shortage(d.allocated(), request.Resources, d.clusterTotal)
+	clusterShortage.Disk = 0
+	fits := func() bool {
+		for _, s := range limits {
+			if !s.isZero() {
+				return false
+			}
+		}
+		return reclaimed(reclaims) && clusterShortage.isZero()
+	}
+	if fits() {
+		return WaitEstimate{Percentile: percentile, Reason: "resources available now"}
+	}
+
+	// Running tasks whose release helps the request, soonest to finish first
+	type release struct {
+		task      *RunningTask
+		remaining time.Duration
+	}
+	now := time.Now()
+	releases := make([]release, 0)
+	for _, task := range d.tasks {
+		helps := task.Resources.overlaps(clusterShortage) || len(d.reclaimedBy(task, reclaims)) > 0
+		for tenantID, s := range limits {
+			helps = helps || (d.branchOf(tenantID, task.TenantID) != "" && task.Resources.overlaps(s))
+		}
+		if !helps {
+			continue
+		}
+		if remaining, ok := d.remainingRuntime(task, percentile, now); ok {
+			releases = append(releases, release{task: task, remaining: remaining})
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].remaining != releases[j].remaining {
+			return releases[i].remaining < releases[j].remaining
+		}
+		return releases[i].task.TaskID < releases[j].task.TaskID
+	})
+
+	for _, r := range releases {
+		for tenantID, s := range limits {
+			if d.branchOf(tenantID, r.task.TenantID) != "" {
+				limits[tenantID] = s.reduce(r.task.Resources)
+			}
+		}
+		for _, i := range d.reclaimedBy(r.task, reclaims) {
+			reclaims[i].shortage = reclaims[i].shortage.reduce(r.task.Resources)
+		}
+		clusterShortage = clusterShortage.reduce(r.task.Resources)
+		estimate.Releasing = append(estimate.Releasing, r.task.TaskID)
+
+		if fits() {
+			estimate.Wait = r.remaining
+			estimate.Historical = true
+			estimate.Reason = fmt.Sprintf("%d running tasks expected to finish within %s (p%g)",
+				len(estimate.Releasing), r.remaining.Round(time.Second), percentile)
+			return estimate
+		}
+	}
+
+	estimate.Releasing = nil
+	estimate.Reason = "not enough history of tasks like the running ones"
+	return estimate
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runTask schedules a task of 10 CPUs that started age ago
+func runTask(t *testing.T, scheduler *DRFScheduler, tenantID, taskID string, age time.Duration) {
+	allowed, reason := scheduler.ScheduleTask(TaskRequest{TenantID: tenantID, TaskID: taskID, Resources: Resources{CPU: 10}})
+	require.True(t, allowed, reason)
+	scheduler.tasks[taskID].StartedAt = time.Now().Add(-age)
+}
+
+// finishTasks records finished tasks of 10 CPUs with the given runtimes
+func finishTasks(t *testing.T, scheduler *DRFScheduler, tenantID string, runtimes ...time.Duration) {
+	for i, runtime := range runtimes {
+		taskID := fmt.Sprintf("%s-finished-%d", tenantID, i)
+		runTask(t, scheduler, tenantID, taskID, runtime)
+		require.NoError(t, scheduler.ReleaseTask(taskID))
+	}
+}
+
+func TestDRFScheduler_EstimateWait(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 100, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 30, Memory: 1000}, 1.0)
+	scheduler.RegisterTenant("tenant-2", "Tenant Two", Resources{CPU: 20, Memory: 1000}, 1.0)
+	request := TaskRequest{TenantID: "tenant-1", TaskID: "new", Resources: Resources{CPU: 20}}
+
+	estimate := scheduler.EstimateWait(request, 50)
+	assert.Zero(t, estimate.Wait)
+	assert.Equal(t, "resources available now", estimate.Reason)
+
+	// Two running tasks leave too little of the tenant's quota
+	runTask(t, scheduler, "tenant-1", "old", 5*time.Minute)
+	runTask(t, scheduler, "tenant-1", "young", time.Minute)
+
+	estimate = scheduler.EstimateWait(request, 50)
+	assert.Equal(t, defaultWaitEstimate, estimate.Wait)
+	assert.False(t, estimate.Historical)
+	assert.Empty(t, estimate.Releasing)
+
+	// Tasks of the same shape elsewhere are the best history there is
+	finishTasks(t, scheduler, "tenant-2", 2*time.Minute)
+	estimate = scheduler.EstimateWait(request, 50)
+	assert.True(t, estimate.Historical)
+	assert.Equal(t, []string{"young"}, estimate.Releasing)
+	assert.InDelta(t, time.Minute, estimate.Wait, float64(time.Second))
+
+	// The tenant's own tasks take precedence. The old task has 5, 15 or 25
+	// minutes left, the young one 9, 19 or 29.
+	finishTasks(t, scheduler, "tenant-1", 10*time.Minute, 20*time.Minute, 30*time.Minute)
+	estimate = scheduler.EstimateWait(request, 50)
+	assert.True(t, estimate.Historical)
+	assert.Equal(t, []string{"old"}, estimate.Releasing)
+	assert.InDelta(t, 15*time.Minute, estimate.Wait, float64(time.Second))
+	assert.Contains(t, estimate.Reason, "p50")
+
+	estimate = scheduler.EstimateWait(request, 90)
+	assert.InDelta(t, 25*time.Minute, estimate.Wait, float64(time.Second))
+
+	// Both tasks need to finish for a larger request
+	request.Resources.CPU = 30
+	estimate = scheduler.EstimateWait(request, 50)
+	assert.Equal(t, []string{"old", "young"}, estimate.Releasing)
+	assert.InDelta(t, 19*time.Minute, estimate.Wait, float64(time.Second))
+}
+
+func TestDRFScheduler_EstimateWaitHierarchy(t *testing.T) {
+	scheduler := newOrgScheduler(t)
+	finishTasks(t, scheduler, "team-b", 10*time.Minute)
+	for i := 0; i < 6; i++ {
+		runTask(t, scheduler, "team-a", fmt.Sprintf("a-%d", i), time.Minute)
+	}
+	for i, age := range []time.Duration{8 * time.Minute, 7 * time.Minute, time.Minute, time.Minute} {
+		runTask(t, scheduler, "team-b", fmt.Sprintf("b-%d", i), age)
+	}
+
+	// Team A is within its own limit, but the org is at its limit and
+	// waits for the tasks of team B finishing first
+	estimate := scheduler.EstimateWait(TaskRequest{TenantID: "team-a", TaskID: "new", Resources: Resources{CPU: 20}}, 50)
+	assert.True(t, estimate.Historical)
+	assert.Equal(t, []string{"b-0", "b-1"}, estimate.Releasing)
+	assert.InDelta(t, 3*time.Minute, estimate.Wait, float64(time.Second))
+}
+
+func TestQuotaEnforcer_EnforceQuota_WaitEstimate(t *testing.T) {
+	scheduler := NewDRFScheduler(Resources{CPU: 100, Memory: 1000})
+	scheduler.RegisterTenant("tenant-1", "Tenant One", Resources{CPU: 10, Memory: 1000}, 1.0)
+	enforcer := NewQuotaEnforcer(scheduler, HardEnforcement, PreemptNever)
+
+	finishTasks(t, scheduler, "tenant-1", 10*time.Minute)
+	runTask(t, scheduler, "tenant-1", "running", 6*time.Minute)
+
+	result := enforcer.EnforceQuota(context.Background(), TaskRequest{TenantID: "tenant-1", TaskID: "new", Resources: Resources{CPU: 5}})
+	assert.False(t, result.Allowed)
+	require.NotNil(t, result.WaitEstimate)
+	assert.Equal(t, []string{"running"}, result.WaitEstimate.Releasing)
+	assert.InDelta(t, 4*time.Minute, result.SuggestedWait, float64(time.Second))
+
+	// Invalid percentiles are ignored
+	enforcer.SetWaitPercentile(0)
+	assert.Equal(t, 90.0, enforcer.waitPercentile)
+	enforcer.SetWaitPercentile(50)
+	assert.Equal(t, 50.0, enforcer.waitPercentile)
+}